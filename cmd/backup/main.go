@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/backup"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/database"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+)
+
+// Exit codes, suitable for cron jobs and CI pipelines
+const (
+	exitOK                = 0
+	exitFailed            = 1
+	exitUsage             = 2
+	exitDependencyFailure = 3
+)
+
+const usage = "usage: backup run | verify [--id N] | list [--limit N]"
+
+func main() {
+	// Logs go to stderr so stdout carries only the result
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(run(os.Args[1], os.Args[2:]))
+}
+
+func run(command string, args []string) int {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	id := fs.Int64("id", 0, "backup to verify (default: latest unverified)")
+	limit := fs.Int("limit", 20, "number of backups to list")
+	timeout := fs.Duration("timeout", time.Hour, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("failed to load config", slog.String("error", err.Error()))
+		return exitUsage
+	}
+
+	db, err := database.NewPostgres(cfg.Database)
+	if err != nil {
+		slog.Error("failed to connect to database", slog.String("error", err.Error()))
+		return exitDependencyFailure
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	repo := repository.NewBackupRepository(db)
+
+	if command == "list" {
+		backups, err := repo.List(ctx, *limit)
+		if err != nil {
+			slog.Error("failed to list backups", slog.String("error", err.Error()))
+			return exitDependencyFailure
+		}
+		return writeResult(backups)
+	}
+
+	if cfg.Backup.StoreURL == "" {
+		slog.Error("BACKUP_STORE_URL is not set")
+		return exitUsage
+	}
+	store, err := storage.Open(cfg.Backup.StoreURL, storage.Options{
+		Token:   cfg.Backup.StoreToken,
+		Timeout: cfg.Backup.StoreTimeout,
+		S3: storage.S3Credentials{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			SessionToken:    cfg.S3.SessionToken,
+		},
+	})
+	if err != nil {
+		slog.Error("failed to configure backup store", slog.String("error", err.Error()))
+		return exitUsage
+	}
+	manager := backup.NewManager(db, repo, store, cfg.Backup.Tables)
+
+	switch command {
+	case "run":
+		b, err := manager.Backup(ctx)
+		if err != nil {
+			slog.Error("backup failed", slog.String("error", err.Error()))
+			return exitFailed
+		}
+		return writeResult(b)
+	case "verify":
+		var b *model.Backup
+		if *id > 0 {
+			b, err = repo.GetByID(ctx, *id)
+		} else {
+			b, err = repo.LatestUnverified(ctx)
+		}
+		if err != nil {
+			slog.Error("failed to find backup", slog.String("error", err.Error()))
+			return exitFailed
+		}
+		if err := manager.Verify(ctx, b); err != nil {
+			slog.Error("verification failed", slog.String("error", err.Error()))
+			return exitFailed
+		}
+		if b, err = repo.GetByID(ctx, b.ID); err != nil {
+			slog.Error("failed to reload backup", slog.String("error", err.Error()))
+			return exitDependencyFailure
+		}
+		return writeResult(b)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return exitUsage
+	}
+}
+
+func writeResult(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("failed to write result", slog.String("error", err.Error()))
+		return exitFailed
+	}
+	return exitOK
+}
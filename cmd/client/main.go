@@ -6,9 +6,9 @@ import (
 	"os"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/client"
 	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
 )
 
@@ -17,27 +17,29 @@ func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
+	// Client-side metrics, exposed by the default Prometheus registry
+	metrics := client.NewMetrics("example-client")
+	prometheus.MustRegister(metrics)
+
 	// Connect to gRPC server
-	conn, err := grpc.Dial("localhost:50051",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-		grpc.WithTimeout(5*time.Second),
+	userClient, err := client.New("localhost:50051",
+		client.WithMetrics(metrics),
+		client.WithPreResolve(time.Second),
+		client.WithPreDial(5*time.Second),
 	)
 	if err != nil {
 		slog.Error("failed to connect", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
-	defer conn.Close()
+	defer userClient.Close()
 
 	slog.Info("connected to gRPC server", slog.String("address", "localhost:50051"))
 
-	client := pb.NewUserServiceClient(conn)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Create a user
-	createResp, err := client.CreateUser(ctx, &pb.CreateUserRequest{
+	createResp, err := userClient.CreateUser(ctx, &pb.CreateUserRequest{
 		Email: "user@example.com",
 		Name:  "John Doe",
 	})
@@ -52,7 +54,7 @@ func main() {
 		slog.String("name", createResp.User.Name))
 
 	// Get the user
-	getResp, err := client.GetUser(ctx, &pb.GetUserRequest{
+	getResp, err := userClient.GetUser(ctx, &pb.GetUserRequest{
 		Id: createResp.User.Id,
 	})
 	if err != nil {
@@ -65,7 +67,7 @@ func main() {
 		slog.String("email", getResp.User.Email))
 
 	// List users
-	listResp, err := client.ListUsers(ctx, &pb.ListUsersRequest{
+	listResp, err := userClient.ListUsers(ctx, &pb.ListUsersRequest{
 		Page:     1,
 		PageSize: 10,
 	})
@@ -83,7 +85,7 @@ func main() {
 	}
 
 	// Update user
-	updateResp, err := client.UpdateUser(ctx, &pb.UpdateUserRequest{
+	updateResp, err := userClient.UpdateUser(ctx, &pb.UpdateUserRequest{
 		Id:    createResp.User.Id,
 		Email: "updated@example.com",
 		Name:  "Jane Doe",
@@ -99,7 +101,7 @@ func main() {
 		slog.String("name", updateResp.User.Name))
 
 	// Delete user
-	_, err = client.DeleteUser(ctx, &pb.DeleteUserRequest{
+	_, err = userClient.DeleteUser(ctx, &pb.DeleteUserRequest{
 		Id: createResp.User.Id,
 	})
 	if err != nil {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthprobe performs a single grpc.health.v1 check and exits 0 when the
+// service reports SERVING, 1 otherwise. It is meant to be used as an exec
+// probe in images that do not ship grpc_health_probe.
+func main() {
+	addr := flag.String("addr", defaultAddress(), "gRPC server address")
+	service := flag.String("service", "", "service name to check (empty checks the server as a whole)")
+	timeout := flag.Duration("timeout", time.Second, "timeout for connecting and checking")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, *addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %s: %v\n", *addr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{
+		Service: *service,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		fmt.Fprintf(os.Stderr, "service unhealthy: %s\n", resp.Status)
+		os.Exit(1)
+	}
+}
+
+// defaultAddress derives the probe target from GRPC_ADDRESS so the probe
+// follows the server's listen address without extra configuration
+func defaultAddress() string {
+	addr := os.Getenv("GRPC_ADDRESS")
+	if addr == "" {
+		return "localhost:50051"
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/schema"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/database"
+)
+
+// Exit codes, suitable for failing CI pipelines
+const (
+	exitOK                = 0
+	exitDrift             = 1
+	exitUsage             = 2
+	exitDependencyFailure = 3
+)
+
+// statusReport is the structured output of the status command
+type statusReport struct {
+	Migrations []string       `json:"migrations"`
+	Tables     int            `json:"expected_tables"`
+	Indexes    int            `json:"expected_indexes"`
+	Verified   bool           `json:"verified"`
+	Drift      []schema.Drift `json:"drift"`
+	OK         bool           `json:"ok"`
+}
+
+func main() {
+	// Logs go to stderr so stdout carries only the report
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+
+	if len(os.Args) < 2 || os.Args[1] != "status" {
+		fmt.Fprintln(os.Stderr, "usage: migrate status [--verify] [--dir migrations] [--format json|text]")
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(status(os.Args[2:]))
+}
+
+func status(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	verify := fs.Bool("verify", false, "compare the live schema against the migration files")
+	dir := fs.String("dir", "migrations", "directory containing migration files")
+	format := fs.String("format", "json", "output format: json or text")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	files, err := schema.MigrationFiles(*dir)
+	if err != nil {
+		slog.Error("failed to list migrations", slog.String("error", err.Error()))
+		return exitUsage
+	}
+
+	expected, err := schema.ParseMigrations(*dir)
+	if err != nil {
+		slog.Error("failed to parse migrations", slog.String("error", err.Error()))
+		return exitUsage
+	}
+
+	report := &statusReport{
+		Migrations: files,
+		Tables:     len(expected.Tables),
+		Indexes:    len(expected.Indexes),
+		Drift:      []schema.Drift{},
+		OK:         true,
+	}
+
+	if *verify {
+		cfg, err := config.Load()
+		if err != nil {
+			slog.Error("failed to load config", slog.String("error", err.Error()))
+			return exitUsage
+		}
+
+		db, err := database.NewPostgres(cfg.Database)
+		if err != nil {
+			slog.Error("failed to connect to database", slog.String("error", err.Error()))
+			return exitDependencyFailure
+		}
+		defer db.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		live, err := schema.Inspect(ctx, db)
+		if err != nil {
+			slog.Error("failed to inspect schema", slog.String("error", err.Error()))
+			return exitDependencyFailure
+		}
+
+		report.Verified = true
+		report.Drift = append(report.Drift, schema.Diff(expected, live)...)
+		report.OK = len(report.Drift) == 0
+	}
+
+	if err := writeReport(os.Stdout, report, *format); err != nil {
+		slog.Error("failed to write report", slog.String("error", err.Error()))
+		return exitUsage
+	}
+
+	if !report.OK {
+		return exitDrift
+	}
+	return exitOK
+}
+
+func writeReport(w io.Writer, report *statusReport, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "text":
+		fmt.Fprintf(w, "migrations: %d files, %d tables, %d indexes\n", len(report.Migrations), report.Tables, report.Indexes)
+		if !report.Verified {
+			fmt.Fprintln(w, "live schema not verified (use --verify)")
+			return nil
+		}
+		for _, d := range report.Drift {
+			fmt.Fprintf(w, "drift: %-14s table=%s name=%s\n", d.Kind, d.Table, d.Name)
+		}
+		if report.OK {
+			fmt.Fprintln(w, "schema matches migrations")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
@@ -10,23 +12,48 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
-	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/jobs"
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/server"
-	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
-	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
-	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/database"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/certs"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
 	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/logger"
-	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/sdnotify"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/tracing"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/userservice"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:]))
+	}
+
+	// Under the Windows service control manager, stop requests arrive
+	// through it instead of as signals
+	if exitCode, ok := runService(); ok {
+		os.Exit(exitCode)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	os.Exit(run(quit, func() {}))
+}
+
+// run serves until a signal is received on quit, calling ready once the
+// server accepts connections, and returns the exit code
+func run(quit <-chan os.Signal, ready func()) int {
+	startedAt := time.Now()
+
 	// Initialize logger
 	log := logger.New()
 	slog.SetDefault(log)
@@ -37,98 +64,222 @@ func main() {
 
 	// Load configuration
 	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
 	if err != nil {
 		slog.Error("failed to load config", slog.String("error", err.Error()))
-		os.Exit(1)
+		return exitConfigFailure
 	}
 
-	// Initialize database
-	db, err := database.NewPostgres(cfg.Database)
-	if err != nil {
-		slog.Error("failed to connect to database", slog.String("error", err.Error()))
-		os.Exit(1)
+	// Resources are released in reverse order on every exit path
+	var closers components
+	tracker := server.NewRequestTracker()
+	report := &shutdownReport{startedAt: startedAt}
+	finish := func(reason string, exitCode int) int {
+		report.reason = reason
+		report.exitCode = exitCode
+		report.served = tracker.Served()
+		report.closeErrors = closers.closeAll()
+		report.log()
+		return exitCode
 	}
-	defer db.Close()
 
-	// Initialize cache
-	redisClient, err := cache.NewRedis(cfg.Redis)
+	// Install the tracer provider before anything creates spans
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		slog.Error("failed to connect to redis", slog.String("error", err.Error()))
-		os.Exit(1)
+		slog.Error("failed to set up tracing", slog.String("error", err.Error()))
+		return finish("config_failure", exitConfigFailure)
 	}
-	defer redisClient.Close()
+	closers.add("tracing", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return shutdownTracing(ctx)
+	})
 
-	// Initialize repository
-	userRepo := repository.NewUserRepository(db)
+	// Metrics are served from a dedicated registry, so that only the
+	// service's own collectors and the runtime's are exposed
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
-	// Initialize service
-	userService := service.NewUserService(userRepo, redisClient)
+	// Assemble the user service; the watchdog exits without releasing
+	// resources, as closing a wedged pool would block
+	svc, err := userservice.New(context.Background(), userservice.Options{
+		Config:     cfg,
+		Registerer: registry,
+		OnWatchdog: func(reason string) {
+			report.reason = "watchdog"
+			report.exitCode = exitWatchdog
+			report.served = tracker.Served()
+			report.log()
+			os.Exit(exitWatchdog)
+		},
+	})
+	switch {
+	case errors.Is(err, userservice.ErrConfig):
+		slog.Error("failed to configure user service", slog.String("error", err.Error()))
+		return finish("config_failure", exitConfigFailure)
+	case err != nil:
+		slog.Error("failed to start user service", slog.String("error", err.Error()))
+		return finish("dependency_failure", exitDependencyFailure)
+	}
+	closers.add("userservice", svc.Close)
 
 	// Create gRPC server
-	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			server.LoggingInterceptor,
-			server.MetricsInterceptor,
-			server.RecoveryInterceptor,
-		),
-	)
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{tracker.UnaryInterceptor}, svc.UnaryInterceptors()...)...),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{tracker.StreamInterceptor}, svc.StreamInterceptors()...)...),
+		grpc.MaxRecvMsgSize(cfg.Messages.MaxRecvSize),
+		grpc.MaxSendMsgSize(cfg.Messages.MaxSendSize),
+	}
+
+	// Serve TLS, verifying client certificates when a client CA is set.
+	// Rotated certificates are picked up without a restart.
+	if cfg.TLS.CertFile != "" {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			slog.Error("failed to load TLS certificates", slog.String("error", err.Error()))
+			return finish("config_failure", exitConfigFailure)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+
+		tlsJobs := jobs.NewScheduler(clock.Real{})
+		tlsJobs.Add(jobs.Job{
+			Name:     "tls-reload",
+			Interval: cfg.TLS.ReloadInterval,
+			Run:      reloader.Run,
+		})
+		tlsJobs.Start(context.Background())
+		closers.add("tls_reload", func() error {
+			tlsJobs.Stop()
+			return nil
+		})
+		slog.Info("TLS enabled", slog.Bool("client_auth", cfg.TLS.ClientCAFile != ""))
+	}
+
+	grpcServer := grpc.NewServer(serverOpts...)
 
 	// Register services
-	userServer := server.NewUserServer(userService)
-	pb.RegisterUserServiceServer(grpcServer, userServer)
+	svc.RegisterWith(grpcServer)
 
 	// Register health check
 	healthServer := health.NewServer()
 	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
-	healthServer.SetServingStatus("user-service", grpc_health_v1.HealthCheckResponse_SERVING)
+	svc.ReportHealth(healthServer)
 
 	// Enable reflection for development
 	reflection.Register(grpcServer)
 
+	// Refuse exemptions from authentication that match no registered method
+	if err := svc.CheckExemptions(grpcServer); err != nil {
+		slog.Error("invalid auth exemptions", slog.String("error", err.Error()))
+		return finish("config_failure", exitConfigFailure)
+	}
+
+	// Run background jobs until shutdown
+	runCtx, stopRun := context.WithCancel(context.Background())
+	runDone := make(chan struct{})
+	go func() {
+		svc.Run(runCtx)
+		close(runDone)
+	}()
+	closers.add("jobs", func() error {
+		stopRun()
+		<-runDone
+		return nil
+	})
+
 	// Start metrics server
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.Handle("/readyz", svc.ReadinessHandler())
+	metricsServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.MetricsPort),
+		Handler: mux,
+	}
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("OK"))
-		})
 		slog.Info("metrics server starting", slog.Int("port", cfg.MetricsPort))
-		if err := http.ListenAndServe(":9090", nil); err != nil {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("metrics server failed", slog.String("error", err.Error()))
 		}
 	}()
+	closers.add("metrics_server", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return metricsServer.Shutdown(ctx)
+	})
 
 	// Start gRPC server
 	lis, err := net.Listen("tcp", cfg.GRPCAddress)
 	if err != nil {
 		slog.Error("failed to listen", slog.String("error", err.Error()))
-		os.Exit(1)
+		return finish("listen_failure", exitServeFailure)
 	}
 
+	serveErr := make(chan error, 1)
 	go func() {
 		slog.Info("gRPC server listening", slog.String("address", cfg.GRPCAddress))
-		if err := grpcServer.Serve(lis); err != nil {
-			slog.Error("failed to serve", slog.String("error", err.Error()))
-			os.Exit(1)
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	// Tell the process manager the server is up, then keep its watchdog
+	// fed until exit
+	if _, err := sdnotify.Notify(sdnotify.Ready); err != nil {
+		slog.Warn("failed to notify systemd", slog.String("error", err.Error()))
+	}
+	ready()
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	go func() {
+		if err := sdnotify.RunWatchdog(watchdogCtx); err != nil {
+			slog.Warn("systemd watchdog stopped", slog.String("error", err.Error()))
 		}
 	}()
+	closers.add("sd_watchdog", func() error {
+		stopWatchdog()
+		return nil
+	})
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Wait for a shutdown signal or a serve failure
+	select {
+	case sig := <-quit:
+		report.signal = sig
+	case err := <-serveErr:
+		slog.Error("failed to serve", slog.String("error", err.Error()))
+		return finish("serve_failure", exitServeFailure)
+	}
 
-	slog.Info("shutting down server...")
+	slog.Info("shutting down server...", slog.String("signal", report.signal.String()))
+	sdnotify.Notify(sdnotify.Stopping)
+	healthServer.Shutdown()
 
-	// Create shutdown context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Watch streams never finish on their own; stopping the service ends
+	// them, letting clients reconnect to another instance instead of
+	// holding up the drain
+	stopRun()
+	<-runDone
 
-	// Gracefully stop gRPC server
-	grpcServer.GracefulStop()
+	// Drain in-flight requests, aborting whatever remains after the timeout
+	report.inFlight = tracker.InFlight()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
 
-	// Close database connection
-	db.Close()
+	select {
+	case <-stopped:
+	case <-time.After(cfg.ShutdownTimeout):
+		report.aborted = tracker.InFlight()
+		slog.Warn("shutdown timeout exceeded, aborting in-flight requests",
+			slog.Int64("in_flight", report.aborted))
+		grpcServer.Stop()
+		<-stopped
+	}
 
-	slog.Info("server stopped", slog.String("context", ctx.Err().Error()))
+	return finish("signal", signalExitCode(report.signal))
 }
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// runService reports that the process is not run as a Windows service
+func runService() (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,75 @@
+//go:build windows
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the name the service is installed under
+const serviceName = "user-service"
+
+// runService runs the server under the Windows service control manager when
+// it started the process. It reports whether it did, and the exit code.
+func runService() (int, bool) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return 0, false
+	}
+
+	handler := &windowsService{}
+	if err := svc.Run(serviceName, handler); err != nil {
+		slog.Error("failed to run windows service", slog.String("error", err.Error()))
+		return exitServeFailure, true
+	}
+	return handler.exitCode, true
+}
+
+// windowsService translates service control requests to the shutdown
+// signals run expects
+type windowsService struct {
+	exitCode int
+}
+
+// Execute implements svc.Handler
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	changes <- svc.Status{State: svc.StartPending}
+
+	quit := make(chan os.Signal, 1)
+	done := make(chan int, 1)
+	go func() {
+		done <- run(quit, func() {
+			changes <- svc.Status{State: svc.Running, Accepts: accepted}
+		})
+	}()
+
+	stopping := false
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				if !stopping {
+					stopping = true
+					changes <- svc.Status{State: svc.StopPending}
+					quit <- syscall.SIGTERM
+				}
+			}
+		case exitCode := <-done:
+			// A requested stop is a clean exit for the control manager
+			if stopping {
+				exitCode = exitOK
+			}
+			s.exitCode = exitCode
+			return false, uint32(exitCode)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Exit codes reported to the process supervisor
+const (
+	exitOK                = 0
+	exitServeFailure      = 1
+	exitConfigFailure     = 2
+	exitDependencyFailure = 3
+	exitWatchdog          = 4
+	// exitSignalBase follows the shell convention of 128 + signal number
+	exitSignalBase = 128
+)
+
+// signalExitCode returns the exit code for a shutdown triggered by sig
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return exitSignalBase + int(s)
+	}
+	return exitSignalBase
+}
+
+// component is a resource that must be released on shutdown
+type component struct {
+	name  string
+	close func() error
+}
+
+// components releases resources in reverse order of registration
+type components []component
+
+func (c *components) add(name string, close func() error) {
+	*c = append(*c, component{name: name, close: close})
+}
+
+func (c *components) closeAll() map[string]error {
+	errs := make(map[string]error)
+	for i := len(*c) - 1; i >= 0; i-- {
+		comp := (*c)[i]
+		if err := comp.close(); err != nil {
+			errs[comp.name] = err
+		}
+	}
+	*c = nil
+	return errs
+}
+
+// shutdownReport summarizes the lifetime of the process in a single log line
+type shutdownReport struct {
+	startedAt   time.Time
+	reason      string
+	signal      os.Signal
+	served      int64
+	inFlight    int64
+	aborted     int64
+	closeErrors map[string]error
+	exitCode    int
+}
+
+func (r *shutdownReport) log() {
+	closeErrors := make([]any, 0, len(r.closeErrors))
+	for name, err := range r.closeErrors {
+		closeErrors = append(closeErrors, slog.String(name, err.Error()))
+	}
+
+	attrs := []any{
+		slog.String("reason", r.reason),
+		slog.Duration("uptime", time.Since(r.startedAt)),
+		slog.Int64("requests_served", r.served),
+		slog.Int64("in_flight_at_shutdown", r.inFlight),
+		slog.Int64("drained", r.inFlight-r.aborted),
+		slog.Int64("aborted", r.aborted),
+		slog.Group("close_errors", closeErrors...),
+		slog.Int("exit_code", r.exitCode),
+	}
+	if r.signal != nil {
+		attrs = append(attrs, slog.String("signal", r.signal.String()))
+	}
+
+	if r.exitCode == exitOK || r.signal != nil && len(r.closeErrors) == 0 {
+		slog.Info("shutdown report", attrs...)
+	} else {
+		slog.Error("shutdown report", attrs...)
+	}
+}
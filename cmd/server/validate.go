@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/policy"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/schema"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/migrations"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/certs"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/database"
+)
+
+// validation collects the outcome of the checks of the validate command
+type validation struct {
+	out          io.Writer
+	configFailed bool
+	depsFailed   bool
+}
+
+// config records the outcome of a check of the configuration
+func (v *validation) config(name string, err error) {
+	v.configFailed = v.report(name, err) || v.configFailed
+}
+
+// dependency records the outcome of a check of a dependency
+func (v *validation) dependency(name string, err error) {
+	v.depsFailed = v.report(name, err) || v.depsFailed
+}
+
+// report prints the outcome of a check and reports whether it failed
+func (v *validation) report(name string, err error) bool {
+	if err != nil {
+		fmt.Fprintf(v.out, "FAIL  %s: %v\n", name, err)
+		return true
+	}
+	fmt.Fprintf(v.out, "ok    %s\n", name)
+	return false
+}
+
+// exitCode is the exit code of the command: configuration failures take
+// precedence as they usually cause the dependency failures
+func (v *validation) exitCode() int {
+	switch {
+	case v.configFailed:
+		return exitConfigFailure
+	case v.depsFailed:
+		return exitDependencyFailure
+	}
+	return exitOK
+}
+
+// validate checks the configuration and the dependencies the server needs
+// without serving, so that an init container can fail a rollout early.
+// Migrations are applied in a transaction that is rolled back.
+func validate(args []string) int {
+	// Logs go to stderr so stdout carries only the report
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for all dependency checks")
+	lockTimeout := fs.Duration("lock-timeout", 5*time.Second, "how long the migration dry run waits for table locks")
+	if err := fs.Parse(args); err != nil {
+		return exitConfigFailure
+	}
+
+	v := &validation{out: os.Stdout}
+
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	v.config("config", err)
+	if err != nil {
+		return v.exitCode()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if cfg.TLS.CertFile != "" {
+		_, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		v.config("tls", err)
+	}
+	if cfg.Policy.Path != "" {
+		_, err := policy.NewOPA(ctx, cfg.Policy.Path, cfg.Policy.Query)
+		v.config("policy", err)
+	}
+	if cfg.RBAC.PolicyPath != "" {
+		_, err := authz.Load(cfg.RBAC.PolicyPath)
+		v.config("rbac_policy", err)
+	}
+
+	db, err := database.NewPostgres(cfg.Database)
+	v.dependency("postgres", err)
+	if err == nil {
+		defer db.Close()
+		v.dependency("migrations", schema.DryRun(ctx, db, migrations.FS, *lockTimeout))
+	}
+
+	redisClient, err := cache.NewRedis(cfg.Redis)
+	if err == nil {
+		defer redisClient.Close()
+		err = redisClient.Ping(ctx)
+	}
+	v.dependency("redis", err)
+
+	return v.exitCode()
+}
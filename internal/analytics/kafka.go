@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// KafkaRESTSink produces summaries as JSON records to a Kafka topic through
+// a Kafka REST Proxy, keyed by caller so that each caller's requests stay
+// ordered within a partition
+type KafkaRESTSink struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewKafkaRESTSink creates a new KafkaRESTSink instance
+func NewKafkaRESTSink(baseURL, topic, username, password string, timeout time.Duration) *KafkaRESTSink {
+	return &KafkaRESTSink{
+		endpoint: baseURL + "/topics/" + url.PathEscape(topic),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value Summary `json:"value"`
+}
+
+// Send implements Sink
+func (s *KafkaRESTSink) Send(ctx context.Context, summaries []Summary) error {
+	records := make([]kafkaRecord, len(summaries))
+	for i, summary := range summaries {
+		records[i] = kafkaRecord{Key: summary.Caller, Value: summary}
+	}
+
+	payload, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy returned %s", resp.Status)
+	}
+
+	return nil
+}
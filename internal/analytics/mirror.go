@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Summary is the compact record mirrored for every request. Unlike logs,
+// summaries are never sampled, so product analytics can count on them.
+type Summary struct {
+	Method    string `json:"method"`
+	Caller    string `json:"caller"`
+	LatencyMs int64  `json:"latency_ms"`
+	Code      string `json:"code"`
+	// EntityID is the user or organization the request was about, zero when
+	// the request does not target a single entity
+	EntityID int64     `json:"entity_id,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Sink delivers batches of summaries to an analytics pipeline
+type Sink interface {
+	Send(ctx context.Context, summaries []Summary) error
+}
+
+// Mirror queues summaries in memory and sends them to a Sink in batches on
+// Flush, so that the pipeline's latency and outages never reach requests.
+// Summaries are dropped once maxPending are queued.
+type Mirror struct {
+	sink       Sink
+	batchSize  int
+	maxPending int
+
+	mu      sync.Mutex
+	pending []Summary
+	dropped atomic.Int64
+}
+
+// NewMirror creates a new Mirror instance
+func NewMirror(sink Sink, batchSize, maxPending int) *Mirror {
+	return &Mirror{
+		sink:       sink,
+		batchSize:  max(batchSize, 1),
+		maxPending: max(maxPending, 1),
+	}
+}
+
+// Record queues a summary without blocking
+func (m *Mirror) Record(summary Summary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.pending) >= m.maxPending {
+		m.dropped.Add(1)
+		return
+	}
+	m.pending = append(m.pending, summary)
+}
+
+// Dropped returns the number of summaries dropped because the queue was full
+func (m *Mirror) Dropped() int64 {
+	return m.dropped.Load()
+}
+
+// Flush sends queued summaries in batches. Batches that fail are put back
+// and retried on the next flush, as long as the queue has room for them.
+func (m *Mirror) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	for start := 0; start < len(pending); start += m.batchSize {
+		batch := pending[start:min(start+m.batchSize, len(pending))]
+		if err := m.sink.Send(ctx, batch); err != nil {
+			m.requeue(pending[start:])
+			return fmt.Errorf("failed to send request summaries: %w", err)
+		}
+	}
+
+	if dropped := m.dropped.Swap(0); dropped > 0 {
+		slog.Warn("request summaries dropped, analytics queue full", slog.Int64("dropped", dropped))
+	}
+
+	return nil
+}
+
+func (m *Mirror) requeue(summaries []Summary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room := max(m.maxPending-len(m.pending), 0)
+	if len(summaries) > room {
+		m.dropped.Add(int64(len(summaries) - room))
+		summaries = summaries[:room]
+	}
+	m.pending = append(summaries[:len(summaries):len(summaries)], m.pending...)
+}
@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeSink struct {
+	batches [][]Summary
+	fail    bool
+}
+
+func (s *fakeSink) Send(_ context.Context, summaries []Summary) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, append([]Summary(nil), summaries...))
+	return nil
+}
+
+func TestMirror(t *testing.T) {
+	t.Run("sends in batches", func(t *testing.T) {
+		sink := &fakeSink{}
+		m := NewMirror(sink, 2, 10)
+		for i := int64(1); i <= 5; i++ {
+			m.Record(Summary{EntityID: i})
+		}
+
+		if err := m.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(sink.batches) != 3 || len(sink.batches[2]) != 1 || sink.batches[2][0].EntityID != 5 {
+			t.Errorf("unexpected batches: %+v", sink.batches)
+		}
+	})
+
+	t.Run("drops when full and requeues failed batches", func(t *testing.T) {
+		sink := &fakeSink{fail: true}
+		m := NewMirror(sink, 10, 2)
+		for i := int64(1); i <= 3; i++ {
+			m.Record(Summary{EntityID: i})
+		}
+		if m.Dropped() != 1 {
+			t.Errorf("expected 1 dropped, got %d", m.Dropped())
+		}
+
+		if err := m.Flush(context.Background()); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		sink.fail = false
+		if err := m.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(sink.batches) != 1 || len(sink.batches[0]) != 2 {
+			t.Errorf("expected the failed batch to be retried, got %+v", sink.batches)
+		}
+	})
+}
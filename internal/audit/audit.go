@@ -0,0 +1,130 @@
+// Package audit records who called which mutating RPC, on which user, and
+// what the call changed
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+// ErrInvalidPageToken is returned by List for tokens it did not issue
+var ErrInvalidPageToken = pagination.ErrInvalidToken
+
+// writeTimeout bounds storing an event once the call it records returned
+const writeTimeout = 5 * time.Second
+
+// Store persists audit events
+type Store interface {
+	Insert(ctx context.Context, event *model.AuditEvent) error
+	List(ctx context.Context, filter model.AuditFilter, after pagination.Cursor, limit int) ([]*model.AuditEvent, error)
+}
+
+// UserLoader loads the current state of a user, failing for unknown and
+// deleted users
+type UserLoader func(ctx context.Context, id int64) (*model.User, error)
+
+// Recorder captures and stores audit events
+type Recorder struct {
+	store Store
+	users UserLoader
+	clock clock.Clock
+}
+
+// NewRecorder creates a Recorder loading users for diffs with users
+func NewRecorder(store Store, users UserLoader, clk clock.Clock) *Recorder {
+	return &Recorder{store: store, users: users, clock: clk}
+}
+
+// Snapshot returns the stored fields of a user, or nil when it does not
+// exist or cannot be loaded
+func (r *Recorder) Snapshot(ctx context.Context, userID int64) map[string]interface{} {
+	user, err := r.users(ctx, userID)
+	if err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// Record stores an event, stamping it with the current time and the
+// impersonator of the caller, if any. The call it records already
+// happened, so failures are logged rather than returned, and a cancelled
+// call still gets recorded.
+func (r *Recorder) Record(ctx context.Context, event *model.AuditEvent) {
+	event.CreatedAt = r.clock.Now()
+	event.Impersonator = auth.Impersonator(ctx)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+
+	if err := r.store.Insert(ctx, event); err != nil {
+		slog.Error("failed to record audit event",
+			slog.String("method", event.Method),
+			slog.String("actor", event.Actor),
+			slog.String("error", err.Error()))
+	}
+}
+
+// List returns the page of events matching filter after pageToken, most
+// recent first, and the token of the next page
+func (r *Recorder) List(ctx context.Context, filter model.AuditFilter, pageToken string, pageSize int) ([]*model.AuditEvent, string, error) {
+	after := pagination.Cursor{CreatedAt: time.Unix(0, math.MaxInt64), ID: math.MaxInt64}
+	if pageToken != "" {
+		var err error
+		if after, err = pagination.Decode(pageToken); err != nil {
+			return nil, "", err
+		}
+	}
+	if filter.To.IsZero() {
+		filter.To = r.clock.Now().Add(time.Second)
+	}
+
+	events, err := r.store.List(ctx, filter, after, pageSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	next := pagination.Next(events, pageSize, func(e *model.AuditEvent) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+	return events, next, nil
+}
+
+// Diff returns the fields whose values differ between two snapshots. A nil
+// snapshot stands for a user that did not exist.
+func Diff(before, after map[string]interface{}) map[string]model.AuditChange {
+	if before == nil && after == nil {
+		return nil
+	}
+
+	diff := make(map[string]model.AuditChange)
+	for field, b := range before {
+		if a, ok := after[field]; !ok || !reflect.DeepEqual(a, b) {
+			diff[field] = model.AuditChange{Before: b, After: a}
+		}
+	}
+	for field, a := range after {
+		if _, ok := before[field]; !ok {
+			diff[field] = model.AuditChange{After: a}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+type memoryStore struct {
+	events []*model.AuditEvent
+	err    error
+}
+
+func (s *memoryStore) Insert(_ context.Context, event *model.AuditEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memoryStore) List(context.Context, model.AuditFilter, pagination.Cursor, int) ([]*model.AuditEvent, error) {
+	return s.events, nil
+}
+
+func TestDiff(t *testing.T) {
+	before := map[string]interface{}{"id": 1.0, "name": "Jane", "email": "jane@example.com"}
+	after := map[string]interface{}{"id": 1.0, "name": "Jane Doe", "email": "jane@example.com", "avatar_url": "a.png"}
+
+	t.Run("changed and added fields", func(t *testing.T) {
+		diff := Diff(before, after)
+		if len(diff) != 2 || diff["name"].Before != "Jane" || diff["name"].After != "Jane Doe" || diff["avatar_url"].After != "a.png" {
+			t.Errorf("unexpected diff %v", diff)
+		}
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		diff := Diff(before, nil)
+		if len(diff) != 3 || diff["email"].After != nil {
+			t.Errorf("unexpected diff %v", diff)
+		}
+	})
+
+	t.Run("no snapshots", func(t *testing.T) {
+		if diff := Diff(nil, nil); diff != nil {
+			t.Errorf("expected no diff, got %v", diff)
+		}
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	users := func(_ context.Context, id int64) (*model.User, error) {
+		if id != 1 {
+			return nil, errors.New("user not found")
+		}
+		return &model.User{ID: 1, Name: "Jane"}, nil
+	}
+
+	t.Run("snapshots users", func(t *testing.T) {
+		r := NewRecorder(&memoryStore{}, users, clock.NewFake(now))
+		if snap := r.Snapshot(context.Background(), 1); snap["name"] != "Jane" {
+			t.Errorf("unexpected snapshot %v", snap)
+		}
+		if snap := r.Snapshot(context.Background(), 2); snap != nil {
+			t.Errorf("expected no snapshot of a missing user, got %v", snap)
+		}
+	})
+
+	t.Run("records cancelled calls", func(t *testing.T) {
+		store := &memoryStore{}
+		r := NewRecorder(store, users, clock.NewFake(now))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r.Record(ctx, &model.AuditEvent{Method: "/user.UserService/DeleteUser", Actor: "admin", Code: "OK"})
+
+		if len(store.events) != 1 || !store.events[0].CreatedAt.Equal(now) {
+			t.Fatalf("unexpected events %v", store.events)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		store := &memoryStore{}
+		r := NewRecorder(store, users, clock.NewFake(now))
+		r.Record(context.Background(), &model.AuditEvent{Method: "m", Actor: "a", Code: "OK"})
+
+		if _, next, err := r.List(context.Background(), model.AuditFilter{}, "", 1); err != nil || next == "" {
+			t.Errorf("expected a next page token, got %q, %v", next, err)
+		}
+		if _, _, err := r.List(context.Background(), model.AuditFilter{}, "bogus", 1); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("expected ErrInvalidPageToken, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/grpcmeta"
+)
+
+// APIKeyHeader carries the API key of a service-to-service caller
+const APIKeyHeader = grpcmeta.APIKeyKey
+
+// APIKeyVerifier resolves an API key to the principal it was issued for
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyAuthenticator identifies callers by the static API key they send in
+// the x-api-key header, for batch jobs and other callers that cannot obtain
+// tokens
+type APIKeyAuthenticator struct {
+	Keys APIKeyVerifier
+}
+
+// Authenticate implements Authenticator
+func (a APIKeyAuthenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	key := grpcmeta.Get(ctx, APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	return a.Keys.VerifyAPIKey(ctx, key)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it understands, letting the next authenticator try
+var ErrNoCredentials = errors.New("no credentials")
+
+// Anonymous is the subject assigned to callers without credentials
+const Anonymous = "anonymous"
+
+// AdminRole is the role required by RPCs that would hand over other users'
+// accounts or data, whatever the policy engine allows
+const AdminRole = "admin"
+
+// Principal identifies the caller of a request
+type Principal struct {
+	Subject string
+	// Method records how the caller was identified, e.g. "header"
+	Method string
+	// Roles are the roles granted to the caller by its credentials
+	Roles []string
+	// KeyID is the ID of the API key the caller used, or 0
+	KeyID int64
+	// RateLimit is the requests per minute allowed to the caller's
+	// credential; 0 applies the default limit
+	RateLimit int
+	// Impersonator is the subject of the support engineer acting as
+	// Subject with an impersonation token; empty otherwise
+	Impersonator string
+}
+
+// Authenticator identifies the caller of an incoming request
+type Authenticator interface {
+	Authenticate(ctx context.Context) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// NewContext returns a context carrying the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Impersonator returns the subject impersonating the principal in ctx, or
+// an empty string
+func Impersonator(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok {
+		return p.Impersonator
+	}
+	return ""
+}
+
+// HasRole reports whether the principal in ctx holds role. Principals
+// acting through an impersonation token hold none, and callers without a
+// principal hold none either, so checks fail closed.
+func HasRole(ctx context.Context, role string) bool {
+	p, ok := FromContext(ctx)
+	if !ok || p.Impersonator != "" {
+		return false
+	}
+	return slices.Contains(p.Roles, role)
+}
+
+// Subject returns the subject of the principal in ctx, or Anonymous
+func Subject(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok && p.Subject != "" {
+		return p.Subject
+	}
+	return Anonymous
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"google.golang.org/grpc/peer"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/grpcmeta"
+)
+
+// CallerIDHeader carries the caller identity asserted by a trusted proxy
+const CallerIDHeader = grpcmeta.CallerIDKey
+
+// CallerRolesHeader carries the comma-separated roles of the caller
+const CallerRolesHeader = grpcmeta.CallerRolesKey
+
+// HeaderAuthenticator trusts the caller identity set by the service mesh or
+// gateway in front of the service, and optionally the roles it takes from
+// the claims of the token it verified. The headers are only believed on
+// calls whose peer address is in Proxies; other callers are left to the
+// next authenticator, as if they sent no header.
+type HeaderAuthenticator struct {
+	// Proxies are the ranges of the mesh or gateway setting the headers
+	Proxies []netip.Prefix
+	// TrustRoles takes the caller's roles from x-caller-roles; otherwise
+	// header callers hold no role
+	TrustRoles bool
+}
+
+// NewHeaderAuthenticator creates a HeaderAuthenticator believing the headers
+// of peers in proxies, CIDR ranges or single addresses. At least one is
+// required, so that clients cannot assert their own identity.
+func NewHeaderAuthenticator(proxies []string, trustRoles bool) (*HeaderAuthenticator, error) {
+	if len(proxies) == 0 {
+		return nil, errors.New("trusting the caller header requires the addresses of the proxies setting it")
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, v := range proxies {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an address nor a CIDR range", v)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return &HeaderAuthenticator{Proxies: prefixes, TrustRoles: trustRoles}, nil
+}
+
+// Authenticate implements Authenticator
+func (a HeaderAuthenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	if !a.fromProxy(ctx) {
+		return nil, ErrNoCredentials
+	}
+
+	subject, err := grpcmeta.CallerID(ctx)
+	if err != nil {
+		return nil, ErrNoCredentials
+	}
+
+	p := &Principal{Subject: subject, Method: "header"}
+	if a.TrustRoles {
+		p.Roles = grpcmeta.CallerRoles(ctx)
+	}
+	return p, nil
+}
+
+// fromProxy reports whether the peer of the call is one of the proxies
+func (a HeaderAuthenticator) fromProxy(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range a.Proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/grpcmeta"
+)
+
+// AccessTokenVerifier resolves an access token to the principal it was
+// issued for
+type AccessTokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// BearerAuthenticator identifies users by the access token they send as a
+// bearer token in the authorization header
+type BearerAuthenticator struct {
+	Tokens AccessTokenVerifier
+}
+
+// Authenticate implements Authenticator. Other authorization schemes are
+// left to the next authenticator.
+func (a BearerAuthenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	token, err := grpcmeta.BearerToken(ctx)
+	if err != nil {
+		return nil, ErrNoCredentials
+	}
+
+	return a.Tokens.VerifyAccessToken(ctx, token)
+}
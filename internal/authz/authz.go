@@ -0,0 +1,119 @@
+// Package authz grants callers access to gRPC methods by role
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidPolicy is returned for policies with malformed method patterns
+var ErrInvalidPolicy = errors.New("invalid authorization policy")
+
+// Policy declares the methods each role may call. Methods are full gRPC
+// method names such as "/user.UserService/DeleteUser"; "/user.UserService/*"
+// matches every method of a service and "*" matches every method. Methods
+// granted to no role of the caller and not public are denied.
+type Policy struct {
+	// Roles maps a role to the methods it may call
+	Roles map[string][]string `json:"roles"`
+	// Public lists the methods every caller may call, including anonymous ones
+	Public []string `json:"public"`
+}
+
+// Authorizer decides whether callers may invoke methods under a Policy
+type Authorizer struct {
+	roles  map[string][]string
+	public []string
+}
+
+// New creates an Authorizer enforcing p
+func New(p Policy) (*Authorizer, error) {
+	for role, patterns := range p.Roles {
+		if role == "" {
+			return nil, fmt.Errorf("%w: empty role name", ErrInvalidPolicy)
+		}
+		if err := CheckPatterns(patterns); err != nil {
+			return nil, fmt.Errorf("%w: role %s: %v", ErrInvalidPolicy, role, err)
+		}
+	}
+	if err := CheckPatterns(p.Public); err != nil {
+		return nil, fmt.Errorf("%w: public: %v", ErrInvalidPolicy, err)
+	}
+
+	return &Authorizer{roles: p.Roles, public: p.Public}, nil
+}
+
+// Load creates an Authorizer enforcing the JSON policy in the file at path
+func Load(path string) (*Authorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+
+	return New(p)
+}
+
+// Allowed reports whether a caller holding roles may invoke method
+func (a *Authorizer) Allowed(method string, roles []string) bool {
+	if MatchAny(a.public, method) {
+		return true
+	}
+	for _, role := range roles {
+		if MatchAny(a.roles[role], method) {
+			return true
+		}
+	}
+	return false
+}
+
+// RolesFor returns the sorted roles that may invoke method
+func (a *Authorizer) RolesFor(method string) []string {
+	var roles []string
+	for role, patterns := range a.roles {
+		if MatchAny(patterns, method) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// CheckPatterns returns an error for the first pattern that is neither a
+// full method name, a service wildcard such as "/user.UserService/*", nor "*"
+func CheckPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			continue
+		}
+		service, method, ok := strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+		if !strings.HasPrefix(pattern, "/") || !ok || service == "" || method == "" || strings.Contains(method, "/") {
+			return fmt.Errorf("pattern %q is not a full method name", pattern)
+		}
+		if strings.Contains(method, "*") && method != "*" {
+			return fmt.Errorf("pattern %q may only use * for a whole method name", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchAny reports whether method matches one of patterns
+func MatchAny(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == method {
+			return true
+		}
+		if service, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(method, service+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package authz
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAuthorizer(t *testing.T) {
+	a, err := New(Policy{
+		Public: []string{"/grpc.health.v1.Health/*"},
+		Roles: map[string][]string{
+			"admin":   {"*"},
+			"support": {"/user.UserService/GetUser", "/user.UserService/DeleteUser"},
+			"user":    {"/user.UserService/GetUser"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("public methods need no role", func(t *testing.T) {
+		if !a.Allowed("/grpc.health.v1.Health/Check", nil) {
+			t.Error("expected health checks to be public")
+		}
+	})
+
+	t.Run("roles grant their methods only", func(t *testing.T) {
+		if !a.Allowed("/user.UserService/GetUser", []string{"user"}) {
+			t.Error("expected user to get users")
+		}
+		if a.Allowed("/user.UserService/DeleteUser", []string{"user"}) {
+			t.Error("expected user not to delete users")
+		}
+		if !a.Allowed("/user.UserService/DeleteUser", []string{"user", "support"}) {
+			t.Error("expected any granting role to allow the call")
+		}
+		if a.Allowed("/user.UserService/GetUser", nil) {
+			t.Error("expected callers without roles to be denied")
+		}
+	})
+
+	t.Run("reports the roles allowed to call a method", func(t *testing.T) {
+		if got := a.RolesFor("/user.UserService/DeleteUser"); !slices.Equal(got, []string{"admin", "support"}) {
+			t.Errorf("got %v", got)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "roles.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("loads a policy", func(t *testing.T) {
+		a, err := Load(write(t, `{"roles": {"admin": ["/user.UserService/*"]}}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !a.Allowed("/user.UserService/PurgeUser", []string{"admin"}) {
+			t.Error("expected the service wildcard to match")
+		}
+	})
+
+	t.Run("rejects malformed patterns", func(t *testing.T) {
+		for _, pattern := range []string{"DeleteUser", "/user.UserService", "/user.UserService/Delete*"} {
+			_, err := Load(write(t, `{"roles": {"admin": ["`+pattern+`"]}}`))
+			if !errors.Is(err, ErrInvalidPolicy) {
+				t.Errorf("%s: expected ErrInvalidPolicy, got %v", pattern, err)
+			}
+		}
+	})
+}
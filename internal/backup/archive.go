@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// manifestName is the archive entry describing the dump. It is written last
+// because row counts are only known once every table has been copied.
+const manifestName = "manifest.json"
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	CreatedAt time.Time        `json:"created_at"`
+	Tables    []string         `json:"tables"`
+	RowCounts map[string]int64 `json:"row_counts"`
+}
+
+// Dump writes a gzipped tar archive holding one CSV file per table followed
+// by a manifest to w. All tables are read through tx, which should be a
+// repeatable read transaction so the dump is a consistent snapshot.
+func Dump(ctx context.Context, tx pgx.Tx, tables []string, w io.Writer) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest := &Manifest{
+		CreatedAt: time.Now().UTC(),
+		Tables:    tables,
+		RowCounts: make(map[string]int64, len(tables)),
+	}
+
+	for _, table := range tables {
+		rows, err := dumpTable(ctx, tx, tw, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump table %s: %w", table, err)
+		}
+		manifest.RowCounts[table] = rows
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, data); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// dumpTable copies a table to a temporary file first since tar headers need
+// the entry size up front
+func dumpTable(ctx context.Context, tx pgx.Tx, tw *tar.Writer, table string) (int64, error) {
+	tmp, err := os.CreateTemp("", "backup-*.csv")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// COPY of a query rather than the table also works for partitioned tables
+	sql := fmt.Sprintf("COPY (SELECT * FROM %s) TO STDOUT WITH (FORMAT csv, HEADER)", pgx.Identifier{table}.Sanitize())
+	tag, err := tx.Conn().PgConn().CopyTo(ctx, tmp, sql)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	header := &tar.Header{
+		Name:    table + ".csv",
+		Mode:    0o640,
+		Size:    info.Size(),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o640,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Verify loads an archive produced by Dump into the scratch schema within
+// tx, row-counts every table and compares the counts with the manifest.
+// Scratch tables are created LIKE the live tables, so the archive must match
+// the current schema. The caller is expected to roll tx back afterwards.
+func Verify(ctx context.Context, tx pgx.Tx, scratch string, r io.Reader) (*Manifest, map[string]int64, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer gz.Close()
+
+	schema := pgx.Identifier{scratch}.Sanitize()
+	if _, err := tx.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		return nil, nil, fmt.Errorf("failed to create scratch schema: %w", err)
+	}
+
+	var manifest *Manifest
+	loaded := make(map[string]int64)
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if header.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+			}
+			continue
+		}
+
+		table, ok := strings.CutSuffix(header.Name, ".csv")
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected archive entry %q", header.Name)
+		}
+
+		count, err := loadTable(ctx, tx, scratch, table, tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load table %s: %w", table, err)
+		}
+		loaded[table] = count
+	}
+
+	if manifest == nil {
+		return nil, nil, errors.New("archive has no manifest")
+	}
+
+	for _, table := range manifest.Tables {
+		if loaded[table] != manifest.RowCounts[table] {
+			return manifest, loaded, fmt.Errorf("table %s: restored %d rows, manifest has %d",
+				table, loaded[table], manifest.RowCounts[table])
+		}
+	}
+
+	return manifest, loaded, nil
+}
+
+func loadTable(ctx context.Context, tx pgx.Tx, scratch, table string, r io.Reader) (int64, error) {
+	target := pgx.Identifier{scratch, table}.Sanitize()
+	source := pgx.Identifier{table}.Sanitize()
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", target, source)); err != nil {
+		return 0, err
+	}
+
+	sql := fmt.Sprintf("COPY %s FROM STDIN WITH (FORMAT csv, HEADER)", target)
+	if _, err := tx.Conn().PgConn().CopyFrom(ctx, r, sql); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM "+target).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
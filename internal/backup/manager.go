@@ -0,0 +1,214 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+)
+
+// Advisory lock keys ensuring only one replica backs up or verifies at a time
+const (
+	backupLockKey = 0x62_61_63_6b // "back"
+	verifyLockKey = 0x76_65_72_69 // "veri"
+)
+
+// errLocked is returned internally when another process holds the job lock
+var errLocked = errors.New("backup job locked by another process")
+
+// Manager takes logical backups of the service tables and verifies them
+type Manager struct {
+	db     *pgxpool.Pool
+	repo   *repository.BackupRepository
+	store  storage.Store
+	tables []string
+}
+
+// NewManager creates a new Manager instance
+func NewManager(db *pgxpool.Pool, repo *repository.BackupRepository, store storage.Store, tables []string) *Manager {
+	return &Manager{
+		db:     db,
+		repo:   repo,
+		store:  store,
+		tables: tables,
+	}
+}
+
+// Run takes a backup unless another replica is already doing so
+func (m *Manager) Run(ctx context.Context) error {
+	_, err := m.Backup(ctx)
+	if errors.Is(err, errLocked) {
+		slog.Info("backup skipped, already running elsewhere")
+		return nil
+	}
+	return err
+}
+
+// Backup dumps the configured tables from a consistent snapshot, uploads the
+// archive and records its metadata
+func (m *Manager) Backup(ctx context.Context) (*model.Backup, error) {
+	var backup *model.Backup
+	opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+
+	err := pgx.BeginTxFunc(ctx, m.db, opts, func(tx pgx.Tx) error {
+		if err := tryLock(ctx, tx, backupLockKey); err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("users/%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+		started, err := m.repo.Start(ctx, key)
+		if err != nil {
+			return err
+		}
+		backup = started
+
+		if err := m.dump(ctx, tx, backup); err != nil {
+			if ferr := m.repo.Fail(ctx, backup.ID, err.Error()); ferr != nil {
+				slog.Error("failed to record backup failure", slog.String("error", ferr.Error()))
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("backup completed",
+		slog.Int64("backup_id", backup.ID),
+		slog.String("object_key", backup.ObjectKey),
+		slog.Int64("size_bytes", backup.SizeBytes))
+
+	return backup, nil
+}
+
+func (m *Manager) dump(ctx context.Context, tx pgx.Tx, backup *model.Backup) error {
+	tmp, err := os.CreateTemp("", "backup-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create backup archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	manifest, err := Dump(ctx, tx, m.tables, tmp)
+	if err != nil {
+		return fmt.Errorf("failed to dump tables: %w", err)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := m.store.Put(ctx, backup.ObjectKey, tmp); err != nil {
+		return err
+	}
+
+	if err := m.repo.Complete(ctx, backup.ID, manifest.RowCounts, size); err != nil {
+		return err
+	}
+
+	backup.Status = model.BackupStatusCompleted
+	backup.RowCounts = manifest.RowCounts
+	backup.SizeBytes = size
+	return nil
+}
+
+// RunVerify verifies the latest unverified backup, if any
+func (m *Manager) RunVerify(ctx context.Context) error {
+	backup, err := m.repo.LatestUnverified(ctx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = m.Verify(ctx, backup)
+	if errors.Is(err, errLocked) {
+		slog.Info("backup verification skipped, already running elsewhere")
+		return nil
+	}
+	return err
+}
+
+// Verify restores a backup into a scratch schema, row-counts it against both
+// the archive manifest and the recorded metadata, and stores the outcome.
+// The scratch schema is rolled back and never left behind.
+func (m *Manager) Verify(ctx context.Context, backup *model.Backup) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin verification: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tryLock(ctx, tx, verifyLockKey); err != nil {
+		return err
+	}
+
+	verr := m.restore(ctx, tx, backup)
+
+	status, reason := model.VerifyStatusPassed, ""
+	if verr != nil {
+		status, reason = model.VerifyStatusFailed, verr.Error()
+	}
+	if err := m.repo.RecordVerification(ctx, backup.ID, status, reason); err != nil {
+		return err
+	}
+
+	if verr != nil {
+		slog.Error("backup verification failed",
+			slog.Int64("backup_id", backup.ID),
+			slog.String("error", reason))
+		return fmt.Errorf("backup %d failed verification: %w", backup.ID, verr)
+	}
+
+	slog.Info("backup verified", slog.Int64("backup_id", backup.ID))
+	return nil
+}
+
+func (m *Manager) restore(ctx context.Context, tx pgx.Tx, backup *model.Backup) error {
+	r, err := m.store.Get(ctx, backup.ObjectKey)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scratch := fmt.Sprintf("backup_verify_%d", backup.ID)
+	_, loaded, err := Verify(ctx, tx, scratch, r)
+	if err != nil {
+		return err
+	}
+
+	for table, expected := range backup.RowCounts {
+		if loaded[table] != expected {
+			return fmt.Errorf("table %s: restored %d rows, metadata has %d", table, loaded[table], expected)
+		}
+	}
+
+	return nil
+}
+
+func tryLock(ctx context.Context, tx pgx.Tx, key int64) error {
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", key).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to acquire backup lock: %w", err)
+	}
+	if !locked {
+		return errLocked
+	}
+	return nil
+}
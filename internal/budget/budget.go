@@ -0,0 +1,60 @@
+// Package budget declares how large a method's requests may be and how long
+// its handler may take, and counts the calls exceeding them
+package budget
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of violations
+const (
+	Size    = "size"
+	Latency = "latency"
+)
+
+// Budget bounds a method's requests. Zero fields are not enforced.
+type Budget struct {
+	MaxRequestBytes int
+	MaxLatency      time.Duration
+}
+
+// Budgets holds the budgets of every method that has one. It implements
+// prometheus.Collector.
+type Budgets struct {
+	budgets    map[string]Budget
+	violations *prometheus.CounterVec
+}
+
+// New creates Budgets keyed by full method name
+func New(budgets map[string]Budget) *Budgets {
+	return &Budgets{
+		budgets: budgets,
+		violations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_budget_violations_total",
+			Help: "Number of calls exceeding the size or latency budget of their method",
+		}, []string{"method", "kind"}),
+	}
+}
+
+// For returns the budget of a method
+func (b *Budgets) For(method string) (Budget, bool) {
+	budget, ok := b.budgets[method]
+	return budget, ok
+}
+
+// Violated counts a call of method exceeding the given kind of budget
+func (b *Budgets) Violated(method, kind string) {
+	b.violations.WithLabelValues(method, kind).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (b *Budgets) Describe(ch chan<- *prometheus.Desc) {
+	b.violations.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (b *Budgets) Collect(ch chan<- prometheus.Metric) {
+	b.violations.Collect(ch)
+}
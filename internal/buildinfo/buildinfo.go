@@ -0,0 +1,92 @@
+// Package buildinfo describes the running binary: its toolchain, the
+// versions of its main dependencies and what its configuration enables
+package buildinfo
+
+import (
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// Dependencies are the modules whose versions are reported, by short name
+var Dependencies = map[string]string{
+	"grpc":  "google.golang.org/grpc",
+	"pgx":   "github.com/jackc/pgx/v5",
+	"redis": "github.com/redis/go-redis/v9",
+}
+
+// unknown stands for versions the binary does not record, e.g. in tests
+const unknown = "unknown"
+
+// Info describes the running binary
+type Info struct {
+	GoVersion string
+	// Revision is the VCS commit the binary was built from
+	Revision string
+	// Modules maps the short names of Dependencies to their versions
+	Modules map[string]string
+	// SchemaVersion identifies the database schema the binary expects
+	SchemaVersion string
+	// Features are the optional features enabled by the configuration
+	Features  []string
+	StartedAt time.Time
+}
+
+// Read describes the running binary from the build information embedded
+// by the Go toolchain
+func Read(schemaVersion string, features []string, startedAt time.Time) Info {
+	info := Info{
+		GoVersion:     runtime.Version(),
+		Revision:      unknown,
+		Modules:       make(map[string]string, len(Dependencies)),
+		SchemaVersion: schemaVersion,
+		Features:      features,
+		StartedAt:     startedAt,
+	}
+	for name := range Dependencies {
+		info.Modules[name] = unknown
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range bi.Settings {
+		if setting.Key == "vcs.revision" {
+			info.Revision = setting.Value
+		}
+	}
+	for _, dep := range bi.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		for name, path := range Dependencies {
+			if dep.Path == path {
+				info.Modules[name] = dep.Version
+			}
+		}
+	}
+	return info
+}
+
+// Log writes info as a single structured record, so incidents can start
+// from what was actually deployed
+func (i Info) Log() {
+	names := make([]string, 0, len(i.Modules))
+	for name := range i.Modules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	modules := make([]any, len(names))
+	for j, name := range names {
+		modules[j] = slog.String(name, i.Modules[name])
+	}
+	slog.Info("user service started",
+		slog.String("go_version", i.GoVersion),
+		slog.String("revision", i.Revision),
+		slog.Group("modules", modules...),
+		slog.String("schema_version", i.SchemaVersion),
+		slog.Any("features", i.Features))
+}
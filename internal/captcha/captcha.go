@@ -0,0 +1,90 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrVerificationFailed is returned when a token does not prove a human caller
+var ErrVerificationFailed = errors.New("human verification failed")
+
+// Verifier validates human-verification tokens issued to clients
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// Disabled accepts every token, for local development
+type Disabled struct{}
+
+// Verify implements Verifier
+func (Disabled) Verify(context.Context, string, string) error {
+	return nil
+}
+
+// SiteVerifier checks tokens against a siteverify endpoint as exposed by
+// Cloudflare Turnstile, hCaptcha and reCAPTCHA
+type SiteVerifier struct {
+	verifyURL string
+	secret    string
+	client    *http.Client
+}
+
+// NewSiteVerifier creates a new SiteVerifier instance
+func NewSiteVerifier(verifyURL, secret string, timeout time.Duration) *SiteVerifier {
+	return &SiteVerifier{
+		verifyURL: verifyURL,
+		secret:    secret,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Verify implements Verifier
+func (v *SiteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrVerificationFailed
+	}
+
+	form := url.Values{
+		"secret":   {v.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to verify captcha: siteverify returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrVerificationFailed, strings.Join(result.ErrorCodes, ","))
+	}
+
+	return nil
+}
@@ -1,71 +1,974 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the service
 type Config struct {
-	GRPCAddress string
-	MetricsPort int
-	Database    DatabaseConfig
-	Redis       RedisConfig
-	Tracing     TracingConfig
+	GRPCAddress     string
+	MetricsPort     int
+	ShutdownTimeout time.Duration
+	// StreamChunkSize is the default number of users per StreamUsers message
+	StreamChunkSize int
+	Database        DatabaseConfig
+	Redis           RedisConfig
+	Region          RegionConfig
+	Tracing         TracingConfig
+	History         HistoryConfig
+	Partitions      PartitionsConfig
+	Events          EventsConfig
+	RetryHints      RetryHintsConfig
+	Usage           UsageConfig
+	Analytics       AnalyticsConfig
+	Auth            AuthConfig
+	Policy          PolicyConfig
+	PII             PIIConfig
+	Diagnostics     DiagnosticsConfig
+	Backup          BackupConfig
+	Registration    RegistrationConfig
+	Captcha         CaptchaConfig
+	Mail            MailConfig
+	Invitations     InvitationsConfig
+	SchemaRegistry  SchemaRegistryConfig
+	Readiness       ReadinessConfig
+	Heartbeat       HeartbeatConfig
+	CacheWarm       CacheWarmConfig
+	BatchGet        BatchGetConfig
+	S3              S3Config
+	Avatars         AvatarsConfig
+	RBAC            RBACConfig
+	APIKeys         APIKeysConfig
+	AdaptiveLimit   AdaptiveLimitConfig
+	TLS             TLSConfig
+	Passwords       PasswordsConfig
+	Sessions        SessionsConfig
+	Log             LogConfig
+	Deadlines       DeadlinesConfig
+	Messages        MessagesConfig
+	IPFilter        IPFilterConfig
+	Secrets         SecretsConfig
+	CallerLimits    CallerLimitsConfig
+	Lockout         LockoutConfig
+	Erasure         ErasureConfig
+	RequestSigning  RequestSigningConfig
+	TrafficDump     TrafficDumpConfig
+	Encryption      EncryptionConfig
+	Watch           WatchConfig
+	Reports         ReportsConfig
+	DataQuality     DataQualityConfig
+	Guests          GuestsConfig
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
+	// URL is a full connection string, either a postgres:// URL or
+	// keyword/value pairs, replacing the discrete settings below
+	URL string
+	// Host is a host name or the directory of a unix socket
 	Host     string
 	Port     int
 	User     string
-	Password string
+	Password Secret
 	DBName   string
-	SSLMode  string
+	// SSLMode is disable, allow, prefer, require, verify-ca or verify-full;
+	// managed databases usually need verify-full with their CA bundle
+	SSLMode string
+	// SSLRootCert is a PEM bundle verifying the server in the verify modes
+	// instead of ~/.postgresql/root.crt
+	SSLRootCert string
+	// SSLCert and SSLKey are a client certificate presented to the server
+	SSLCert  string
+	SSLKey   string
 	MaxConns int
+	// PgBouncer adapts the client to pgbouncer in transaction pooling mode
+	PgBouncer bool
+	// Auth selects how to authenticate: password, rds-iam, cloudsql-iam,
+	// command or file
+	Auth string
+	// AuthTokenCommand prints a token on stdout for the command method
+	AuthTokenCommand string
+	// AuthTokenFile holds the token for the file method
+	AuthTokenFile string
+	// AuthTokenTTL is how long a generated token is reused
+	AuthTokenTTL time.Duration
+}
+
+// RegionConfig holds multi-region failover configuration. Whether the
+// region is primary is detected from the database's recovery state.
+type RegionConfig struct {
+	Name          string
+	CheckInterval time.Duration
+	// MaxReplicationLag above which a secondary region reports unhealthy
+	MaxReplicationLag time.Duration
 }
 
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
-	Host     string
-	Port     int
-	Password string
+	Host string
+	Port int
+	// Username selects the ACL user; empty authenticates as the default user
+	Username string
+	Password Secret
 	DB       int
+	// TLS enables encryption, as required by most managed Redis offerings
+	TLS bool
+	// TLSCAFile is a PEM bundle verifying the server instead of the system roots
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are a client certificate presented to
+	// servers requiring mutual TLS
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSServerName overrides the host name verified against the certificate
+	TLSServerName string
+	// TLSSkipVerify disables certificate verification, for local testing only
+	TLSSkipVerify bool
+	DialTimeout   time.Duration
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	// PoolSize caps the connections per instance; 0 keeps the client
+	// default of 10 per CPU
+	PoolSize     int
+	MinIdleConns int
+	// TTLJitter spreads cache expirations by up to this fraction of the TTL
+	// either way, so keys written together do not expire together
+	TTLJitter float64
 }
 
 // TracingConfig holds OpenTelemetry tracing configuration
 type TracingConfig struct {
-	Enabled     bool
-	JaegerURL   string
-	ServiceName string
+	Enabled bool
+	// Exporter is otlp (gRPC), otlp-http or jaeger
+	Exporter string
+	// OTLPEndpoint is the host:port of the OTLP collector, which Jaeger
+	// also accepts on ports 4317 and 4318
+	OTLPEndpoint string
+	OTLPInsecure bool
+	JaegerURL    string
+	ServiceName  string
+	// SampleRatio is the share of new traces recorded; traces started by
+	// a caller follow the caller's decision
+	SampleRatio float64
+}
+
+// HistoryConfig holds user history retention configuration
+type HistoryConfig struct {
+	RetentionDays int
+	PruneInterval time.Duration
+}
+
+// PartitionsConfig holds partition maintenance configuration for the
+// partitioned users_history table
+type PartitionsConfig struct {
+	Interval time.Duration
+	// MonthsAhead is how many monthly partitions are kept ready beyond the current month
+	MonthsAhead int
+}
+
+// EventsConfig holds domain event publishing configuration
+type EventsConfig struct {
+	BufferSize int
+}
+
+// RetryHintsConfig holds the retry delays advertised to clients on
+// Unavailable and ResourceExhausted errors
+type RetryHintsConfig struct {
+	UnavailableDelay       time.Duration
+	ResourceExhaustedDelay time.Duration
+}
+
+// UsageConfig holds per-caller cost accounting configuration
+type UsageConfig struct {
+	Enabled       bool
+	FlushInterval time.Duration
+}
+
+// AnalyticsConfig holds request mirroring configuration
+type AnalyticsConfig struct {
+	// KafkaRESTURL is the Kafka REST Proxy summaries are produced through;
+	// empty disables mirroring
+	KafkaRESTURL  string
+	Topic         string
+	Username      string
+	Password      string
+	Timeout       time.Duration
+	FlushInterval time.Duration
+	BatchSize     int
+	// MaxPending bounds the summaries queued between flushes; further
+	// summaries are dropped
+	MaxPending int
+}
+
+// AuthConfig holds caller identification configuration
+type AuthConfig struct {
+	// TrustCallerHeader accepts the x-caller-id header set by the mesh or
+	// gateway on calls from CallerHeaderProxies
+	TrustCallerHeader bool
+	// CallerHeaderProxies are the addresses and CIDR ranges of the mesh or
+	// gateway; required with TrustCallerHeader
+	CallerHeaderProxies []string
+	// TrustCallerRoles also takes the caller's roles from the x-caller-roles
+	// header of trusted calls
+	TrustCallerRoles bool
+	// ExemptMethods skip authentication, authorization and the per-caller
+	// rate limits. Each must match a registered method, or startup fails.
+	ExemptMethods []string
+}
+
+// PolicyConfig holds authorization policy configuration
+type PolicyConfig struct {
+	// Path to a Rego file, directory or bundle archive; empty allows all requests
+	Path        string
+	Query       string
+	CacheTTL    time.Duration
+	DecisionLog bool
+}
+
+// PIIConfig holds PII tokenization configuration
+type PIIConfig struct {
+	// TokenizerURL of the external tokenization service; empty stores raw values
+	TokenizerURL       string
+	TokenizerAPIKey    string
+	TokenizerTimeout   time.Duration
+	PrivilegedSubjects []string
+}
+
+// DiagnosticsConfig holds index advisor configuration
+type DiagnosticsConfig struct {
+	// Interval between samples; zero disables the index advisor
+	Interval               time.Duration
+	Tables                 []string
+	SeqScanMinRows         int
+	SlowStatementThreshold time.Duration
+}
+
+// BackupConfig holds logical backup configuration
+type BackupConfig struct {
+	// StoreURL is file:///path, http(s)://host/prefix or s3://bucket/prefix;
+	// empty disables backups
+	StoreURL       string
+	StoreToken     string
+	StoreTimeout   time.Duration
+	Tables         []string
+	Interval       time.Duration
+	VerifyInterval time.Duration
+}
+
+// RegistrationConfig holds public self-registration configuration
+type RegistrationConfig struct {
+	TokenTTL  time.Duration
+	VerifyURL string
+	// Per client address limits applied to RegisterUser and VerifyEmail
+	RateLimitPerMinute float64
+	RateLimitBurst     int
+	CleanupInterval    time.Duration
+}
+
+// CaptchaConfig holds human-verification configuration
+type CaptchaConfig struct {
+	// Secret for the siteverify endpoint; empty disables verification
+	Secret    string
+	VerifyURL string
+	Timeout   time.Duration
+}
+
+// MailConfig holds outgoing mail configuration
+type MailConfig struct {
+	// SMTPAddress of the relay; empty logs messages instead of sending them
+	SMTPAddress  string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
+// InvitationsConfig holds invitation workflow configuration
+type InvitationsConfig struct {
+	// SigningKey signs invite tokens; when empty a random key is generated
+	// at startup and outstanding invite links break on restart. It is read
+	// once at startup.
+	SigningKey Secret
+	TTL        time.Duration
+	AcceptURL  string
+}
+
+// SchemaRegistryConfig holds event schema registry configuration
+type SchemaRegistryConfig struct {
+	// URL of the registry; empty disables schema registration
+	URL      string
+	Username string
+	Password string
+	Timeout  time.Duration
+	// Subject the user event schema is registered under
+	Subject string
+	// AutoRegister registers the schema as a new subject version at startup;
+	// when false the schema must already be registered
+	AutoRegister bool
+}
+
+// ReadinessConfig holds /readyz configuration
+type ReadinessConfig struct {
+	// Timeout bounds each dependency check
+	Timeout time.Duration
+	// SchemaInterval is how long a passing schema check is reused, as
+	// inspecting the live schema is too expensive for every probe
+	SchemaInterval time.Duration
+}
+
+// HeartbeatConfig holds dependency heartbeat and watchdog configuration
+type HeartbeatConfig struct {
+	Interval time.Duration
+	// Timeout bounds each roundtrip
+	Timeout time.Duration
+	// WatchdogThreshold exits the process once the heartbeat or the database
+	// has been stalled for this long; zero disables the watchdog
+	WatchdogThreshold time.Duration
+}
+
+// CacheWarmConfig holds how the cache is filled besides reads
+type CacheWarmConfig struct {
+	// OnChange refills the entries of a user right after it changes
+	// instead of leaving them to the next read
+	OnChange bool
+}
+
+// BatchGetConfig holds the worker pool running the lookups of BatchGetUsers
+type BatchGetConfig struct {
+	Workers int
+	// QueueSize bounds the lookups waiting for a worker; further lookups
+	// run on the goroutine of the request
+	QueueSize int
+}
+
+// S3Config holds the credentials of s3:// object stores
+type S3Config struct {
+	// Endpoint of an S3-compatible service; defaults to AWS
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AvatarsConfig holds user avatar storage configuration
+type AvatarsConfig struct {
+	// StoreURL is file:///path, http(s)://host/prefix or s3://bucket/prefix;
+	// empty disables avatar uploads
+	StoreURL     string
+	StoreToken   string
+	StoreTimeout time.Duration
+	// MaxSize bounds uploads in bytes
+	MaxSize int
+	// PublicURL is the base URL avatars are served from, e.g. a CDN in
+	// front of the store; when empty avatar URLs are relative object keys
+	PublicURL string
+}
+
+// RBACConfig holds role-based method authorization configuration
+type RBACConfig struct {
+	// PolicyPath is a JSON file mapping roles to the methods they may call;
+	// empty disables role checks
+	PolicyPath string
+}
+
+// APIKeysConfig holds API key authentication configuration
+type APIKeysConfig struct {
+	// Enabled accepts the x-api-key header
+	Enabled bool
+	// CacheTTL bounds how long a revoked key may still be accepted by
+	// instances other than the one that revoked it
+	CacheTTL time.Duration
+	// RotationGrace is how long a rotated key keeps working by default
+	RotationGrace time.Duration
+	// RateLimitPerMinute applies to keys without their own limit
+	RateLimitPerMinute float64
+	RateLimitBurst     int
+}
+
+// AdaptiveLimitConfig holds the server-wide adaptive rate limit
+// configuration. Limits are in requests per second.
+type AdaptiveLimitConfig struct {
+	Enabled bool
+	// Interval is how often the limit is adjusted
+	Interval time.Duration
+	Initial  float64
+	Min      float64
+	Max      float64
+	// Increase is added to the limit after a healthy interval
+	Increase float64
+	// Decrease multiplies the limit after an unhealthy interval
+	Decrease float64
+	// MaxErrorRate and MaxDBLatency mark an interval unhealthy when exceeded
+	MaxErrorRate float64
+	MaxDBLatency time.Duration
+	MinRequests  int
+}
+
+// TLSConfig holds the TLS settings of the gRPC listener
+type TLSConfig struct {
+	// CertFile and KeyFile hold the PEM server certificate and key; TLS is
+	// disabled when CertFile is empty
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle verifying client certificates; when set,
+	// clients must present a certificate it signed
+	ClientCAFile string
+	// ReloadInterval is how often the files are checked for changes, so
+	// rotated certificates are picked up without a restart
+	ReloadInterval time.Duration
+}
+
+// PasswordsConfig holds password hashing configuration. Raising the
+// argon2id costs rehashes passwords as users authenticate.
+type PasswordsConfig struct {
+	MinLength int
+	// Memory is in KiB
+	Memory      int
+	Iterations  int
+	Parallelism int
+}
+
+// SessionsConfig holds login session configuration
+type SessionsConfig struct {
+	// SigningKey signs access tokens and must be shared by all instances;
+	// when empty a random key is generated. It is read once at startup.
+	SigningKey Secret
+	AccessTTL  time.Duration
+	// RefreshTTL is how long a session lasts after login
+	RefreshTTL      time.Duration
+	CleanupInterval time.Duration
+	// RateLimitPerMinute and RateLimitBurst limit logins and refreshes per
+	// client address
+	RateLimitPerMinute float64
+	RateLimitBurst     int
+	// ImpersonationTTL is how long impersonation tokens last; they cannot
+	// be refreshed
+	ImpersonationTTL time.Duration
+}
+
+// LogConfig holds log redaction settings. The logger itself reads the same
+// variables, as it is created before the configuration is loaded.
+type LogConfig struct {
+	RedactFields []string
+	// RedactMode is "mask" or "hash"
+	RedactMode string
+	// RequestPayloads logs every request message, redacted, at debug level
+	RequestPayloads bool
+}
+
+// DeadlinesConfig holds dependency deadline budget configuration
+type DeadlinesConfig struct {
+	// Reserve is the fraction of a request's remaining deadline kept from
+	// each database or cache call; zero disables the budgets
+	Reserve float64
+}
+
+// MessagesConfig holds gRPC message size limits
+type MessagesConfig struct {
+	MaxRecvSize int
+	MaxSendSize int
+	// MaxStringBytes caps every string field of a request; zero disables
+	// the check
+	MaxStringBytes int
+}
+
+// IPFilterConfig holds the client address rules. Ranges are CIDR prefixes
+// or single addresses.
+type IPFilterConfig struct {
+	// Deny lists the ranges rejected on every method
+	Deny []string
+	// Allow lists the only ranges admitted to AllowMethods; empty admits all
+	Allow []string
+	// AllowMethods are the method patterns restricted to Allow
+	AllowMethods []string
+	// TrustedProxies are the ranges of proxies whose x-forwarded-for header
+	// is believed
+	TrustedProxies []string
+}
+
+// CallerLimitsConfig holds the per-caller rate limits shared by all
+// instances through Redis. Callers are told apart by API key, then by
+// subject, then by client address.
+type CallerLimitsConfig struct {
+	// PerMinute is the default rate of each caller; zero disables the limits
+	PerMinute float64
+	Burst     int
+	// Methods override the default for matching methods, written as
+	// "<method pattern>=<per minute>:<burst>"; the first match applies
+	Methods []string
+}
+
+// LockoutConfig holds the throttling of failed authentications per user
+type LockoutConfig struct {
+	// MaxFailures locks an account once that many attempts failed within
+	// Window; zero disables locking
+	MaxFailures int
+	Window      time.Duration
+	// Duration is how long an account stays locked
+	Duration time.Duration
+	// BaseDelay is the wait imposed after a failed attempt, doubled with
+	// each further failure up to MaxDelay; zero disables the backoff
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// ErasureConfig holds the job carrying out queued erasures of users'
+// personal data
+type ErasureConfig struct {
+	Interval time.Duration
+	// RetryDelay is how long a failed or interrupted erasure waits before
+	// it is attempted again
+	RetryDelay time.Duration
+}
+
+// RequestSigningConfig holds the HMAC signatures required on calls of
+// sensitive methods, which protect them against forgery and replays
+type RequestSigningConfig struct {
+	// Key verifies signatures; unset disables signature checks
+	Key Secret
+	// PreviousKey is also accepted while clients roll over to a new key
+	PreviousKey Secret
+	// Methods are the patterns of the methods requiring a signature
+	Methods []string
+	// MaxSkew bounds how far from now a signature's timestamp may be
+	MaxSkew time.Duration
+}
+
+// TrafficDumpConfig holds the in-memory summaries of recent calls kept for
+// debugging
+type TrafficDumpConfig struct {
+	// Size is the number of calls kept; zero disables the dump
+	Size int
+	// Methods are the patterns of the methods recorded
+	Methods []string
+}
+
+// EncryptionConfig holds the keys sensitive columns are encrypted with at
+// rest
+type EncryptionConfig struct {
+	// Keys are the key-encryption keys as comma-separated id:base64 pairs;
+	// unset disables encryption
+	Keys Secret
+	// KeyID selects the key new values are encrypted with; values
+	// encrypted with the other keys stay readable
+	KeyID string
+	// MetadataKeys are the user metadata keys whose values are encrypted,
+	// * for all
+	MetadataKeys []string
+}
+
+// WatchConfig bounds the WatchUsers streams of an instance, each holding
+// an event buffer of EVENTS_BUFFER_SIZE
+type WatchConfig struct {
+	// MaxStreams and MaxStreamsPerClient cap the open streams; zero
+	// disables a cap
+	MaxStreams          int
+	MaxStreamsPerClient int
+	// IdleTimeout ends streams that delivered no change for that long;
+	// zero keeps them open
+	IdleTimeout time.Duration
+}
+
+// ReportsConfig holds the generation of user reports for support staff
+type ReportsConfig struct {
+	// StoreURL is file:///path, http(s)://host/prefix or s3://bucket/prefix;
+	// empty disables reports. Only s3 stores hand out download URLs.
+	StoreURL     string
+	StoreToken   string
+	StoreTimeout time.Duration
+	Interval     time.Duration
+	// RetryDelay is how long a failed report waits before it is attempted
+	// again, up to MaxAttempts runs
+	RetryDelay  time.Duration
+	MaxAttempts int
+	// URLTTL is how long download URLs stay valid, at most 7 days
+	URLTTL time.Duration
+}
+
+// DataQualityConfig holds the scan for anomalies in user data
+type DataQualityConfig struct {
+	// Interval between scans; zero disables the checker
+	Interval time.Duration
+	// Repair lists the kinds of issues repaired when found:
+	// null_timestamp and orphaned_membership
+	Repair []string
+	// Samples is the number of issues of each kind ListDataIssues returns
+	Samples int
+}
+
+// GuestsConfig holds the guest users who try the product before signing up
+type GuestsConfig struct {
+	// Enabled serves CreateGuestUser and UpgradeGuest
+	Enabled bool
+}
+
+// SecretsConfig holds where credentials may come from. Each secret KEY is
+// given inline as KEY, in a file named by KEY_FILE, or in Vault as
+// KEY_VAULT=<api path>#<field>.
+type SecretsConfig struct {
+	// AllowEnv admits secrets given inline in the environment
+	AllowEnv bool
+	Vault    VaultConfig
+}
+
+// VaultConfig holds the Vault server secrets are read from, logging in with
+// AppRole
+type VaultConfig struct {
+	// Addr is the URL of the server; empty disables KEY_VAULT references
+	Addr string
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace string
+	// AuthMount is the path the AppRole auth method is mounted at
+	AuthMount string
+	RoleID    string
+	SecretID  Secret
+	Timeout   time.Duration
+	// RefreshInterval is how long secrets are cached, unless their lease
+	// is shorter
+	RefreshInterval time.Duration
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
-	return &Config{
-		GRPCAddress: getEnv("GRPC_ADDRESS", ":50051"),
-		MetricsPort: getEnvAsInt("METRICS_PORT", 9090),
+	var errs []error
+	secret := func(key, defaultValue string, vault *vaultClient) Secret {
+		s, err := getEnvAsSecret(key, defaultValue, vault)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return s
+	}
+
+	vault := VaultConfig{
+		Addr:            getEnv("VAULT_ADDR", ""),
+		Namespace:       getEnv("VAULT_NAMESPACE", ""),
+		AuthMount:       getEnv("VAULT_AUTH_MOUNT", "approle"),
+		RoleID:          getEnv("VAULT_ROLE_ID", ""),
+		SecretID:        secret("VAULT_SECRET_ID", "", nil),
+		Timeout:         getEnvAsDuration("VAULT_TIMEOUT", 5*time.Second),
+		RefreshInterval: getEnvAsDuration("VAULT_REFRESH_INTERVAL", 5*time.Minute),
+	}
+	vaultClient := newVaultClient(vault)
+
+	cfg := &Config{
+		GRPCAddress:     getEnv("GRPC_ADDRESS", ":50051"),
+		MetricsPort:     getEnvAsInt("METRICS_PORT", 9090),
+		ShutdownTimeout: getEnvAsDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		StreamChunkSize: getEnvAsInt("STREAM_CHUNK_SIZE", 500),
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnvAsInt("DB_PORT", 5432),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "postgres"),
-			DBName:   getEnv("DB_NAME", "users"),
-			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
-			MaxConns: getEnvAsInt("DB_MAX_CONNS", 10),
+			URL:              getEnv("DATABASE_URL", ""),
+			Host:             getEnv("DB_HOST", "localhost"),
+			Port:             getEnvAsInt("DB_PORT", 5432),
+			User:             getEnv("DB_USER", "postgres"),
+			Password:         secret("DB_PASSWORD", "postgres", vaultClient),
+			DBName:           getEnv("DB_NAME", "users"),
+			SSLMode:          getEnv("DB_SSL_MODE", "disable"),
+			SSLRootCert:      getEnv("DB_SSL_ROOT_CERT", ""),
+			SSLCert:          getEnv("DB_SSL_CERT", ""),
+			SSLKey:           getEnv("DB_SSL_KEY", ""),
+			MaxConns:         getEnvAsInt("DB_MAX_CONNS", 10),
+			PgBouncer:        getEnvAsBool("DB_PGBOUNCER", false),
+			Auth:             getEnv("DB_AUTH", "password"),
+			AuthTokenCommand: getEnv("DB_AUTH_TOKEN_COMMAND", ""),
+			AuthTokenFile:    getEnv("DB_AUTH_TOKEN_FILE", ""),
+			AuthTokenTTL:     getEnvAsDuration("DB_AUTH_TOKEN_TTL", 10*time.Minute),
 		},
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "localhost"),
-			Port:     getEnvAsInt("REDIS_PORT", 6379),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       getEnvAsInt("REDIS_DB", 0),
+			Host:          getEnv("REDIS_HOST", "localhost"),
+			Port:          getEnvAsInt("REDIS_PORT", 6379),
+			Username:      getEnv("REDIS_USERNAME", ""),
+			Password:      secret("REDIS_PASSWORD", "", vaultClient),
+			DB:            getEnvAsInt("REDIS_DB", 0),
+			TLS:           getEnvAsBool("REDIS_TLS", false),
+			TLSCAFile:     getEnv("REDIS_TLS_CA_FILE", ""),
+			TLSCertFile:   getEnv("REDIS_TLS_CERT_FILE", ""),
+			TLSKeyFile:    getEnv("REDIS_TLS_KEY_FILE", ""),
+			TLSServerName: getEnv("REDIS_TLS_SERVER_NAME", ""),
+			TLSSkipVerify: getEnvAsBool("REDIS_TLS_SKIP_VERIFY", false),
+			DialTimeout:   getEnvAsDuration("REDIS_DIAL_TIMEOUT", 5*time.Second),
+			ReadTimeout:   getEnvAsDuration("REDIS_READ_TIMEOUT", 3*time.Second),
+			WriteTimeout:  getEnvAsDuration("REDIS_WRITE_TIMEOUT", 3*time.Second),
+			PoolSize:      getEnvAsInt("REDIS_POOL_SIZE", 0),
+			MinIdleConns:  getEnvAsInt("REDIS_MIN_IDLE_CONNS", 0),
+			TTLJitter:     getEnvAsFloat("REDIS_TTL_JITTER", 0.1),
+		},
+		Region: RegionConfig{
+			Name:              getEnv("REGION_NAME", "default"),
+			CheckInterval:     getEnvAsDuration("REGION_CHECK_INTERVAL", 10*time.Second),
+			MaxReplicationLag: getEnvAsDuration("REGION_MAX_REPLICATION_LAG", 30*time.Second),
 		},
 		Tracing: TracingConfig{
-			Enabled:     getEnvAsBool("TRACING_ENABLED", true),
-			JaegerURL:   getEnv("JAEGER_URL", "http://localhost:14268/api/traces"),
-			ServiceName: getEnv("SERVICE_NAME", "user-service"),
+			Enabled:      getEnvAsBool("TRACING_ENABLED", false),
+			Exporter:     getEnv("TRACING_EXPORTER", "otlp"),
+			OTLPEndpoint: getEnv("TRACING_OTLP_ENDPOINT", "localhost:4317"),
+			OTLPInsecure: getEnvAsBool("TRACING_OTLP_INSECURE", false),
+			JaegerURL:    getEnv("JAEGER_URL", "http://localhost:14268/api/traces"),
+			ServiceName:  getEnv("SERVICE_NAME", "user-service"),
+			SampleRatio:  getEnvAsFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		History: HistoryConfig{
+			RetentionDays: getEnvAsInt("HISTORY_RETENTION_DAYS", 365),
+			PruneInterval: getEnvAsDuration("HISTORY_PRUNE_INTERVAL", time.Hour),
+		},
+		Partitions: PartitionsConfig{
+			Interval:    getEnvAsDuration("PARTITION_MAINTENANCE_INTERVAL", 24*time.Hour),
+			MonthsAhead: getEnvAsInt("PARTITION_MONTHS_AHEAD", 3),
+		},
+		Events: EventsConfig{
+			BufferSize: getEnvAsInt("EVENTS_BUFFER_SIZE", 256),
+		},
+		RetryHints: RetryHintsConfig{
+			UnavailableDelay:       getEnvAsDuration("RETRY_HINT_UNAVAILABLE", time.Second),
+			ResourceExhaustedDelay: getEnvAsDuration("RETRY_HINT_RESOURCE_EXHAUSTED", 5*time.Second),
+		},
+		Usage: UsageConfig{
+			Enabled:       getEnvAsBool("USAGE_ENABLED", true),
+			FlushInterval: getEnvAsDuration("USAGE_FLUSH_INTERVAL", time.Minute),
+		},
+		Analytics: AnalyticsConfig{
+			KafkaRESTURL:  getEnv("ANALYTICS_KAFKA_REST_URL", ""),
+			Topic:         getEnv("ANALYTICS_TOPIC", "user-service-requests"),
+			Username:      getEnv("ANALYTICS_USERNAME", ""),
+			Password:      getEnv("ANALYTICS_PASSWORD", ""),
+			Timeout:       getEnvAsDuration("ANALYTICS_TIMEOUT", 5*time.Second),
+			FlushInterval: getEnvAsDuration("ANALYTICS_FLUSH_INTERVAL", 5*time.Second),
+			BatchSize:     getEnvAsInt("ANALYTICS_BATCH_SIZE", 500),
+			MaxPending:    getEnvAsInt("ANALYTICS_MAX_PENDING", 50000),
+		},
+		Auth: AuthConfig{
+			TrustCallerHeader:   getEnvAsBool("AUTH_TRUST_CALLER_HEADER", false),
+			CallerHeaderProxies: getEnvAsSlice("AUTH_CALLER_HEADER_PROXIES", nil),
+			TrustCallerRoles:    getEnvAsBool("AUTH_TRUST_CALLER_ROLES", false),
+			ExemptMethods: getEnvAsSlice("AUTH_EXEMPT_METHODS", []string{
+				"/grpc.health.v1.Health/*",
+				"/grpc.reflection.v1.ServerReflection/*",
+				"/grpc.reflection.v1alpha.ServerReflection/*",
+				"/user.UserService/Login",
+			}),
+		},
+		Policy: PolicyConfig{
+			Path:        getEnv("POLICY_PATH", ""),
+			Query:       getEnv("POLICY_QUERY", "data.userservice.authz.allow"),
+			CacheTTL:    getEnvAsDuration("POLICY_CACHE_TTL", 30*time.Second),
+			DecisionLog: getEnvAsBool("POLICY_DECISION_LOG", true),
+		},
+		PII: PIIConfig{
+			TokenizerURL:       getEnv("PII_TOKENIZER_URL", ""),
+			TokenizerAPIKey:    getEnv("PII_TOKENIZER_API_KEY", ""),
+			TokenizerTimeout:   getEnvAsDuration("PII_TOKENIZER_TIMEOUT", 2*time.Second),
+			PrivilegedSubjects: getEnvAsSlice("PII_PRIVILEGED_SUBJECTS", nil),
+		},
+		Diagnostics: DiagnosticsConfig{
+			Interval:               getEnvAsDuration("DIAGNOSTICS_INTERVAL", 15*time.Minute),
+			Tables:                 getEnvAsSlice("DIAGNOSTICS_TABLES", []string{"users", "users_history"}),
+			SeqScanMinRows:         getEnvAsInt("DIAGNOSTICS_SEQ_SCAN_MIN_ROWS", 10000),
+			SlowStatementThreshold: getEnvAsDuration("DIAGNOSTICS_SLOW_STATEMENT_THRESHOLD", 100*time.Millisecond),
+		},
+		Backup: BackupConfig{
+			StoreURL:       getEnv("BACKUP_STORE_URL", ""),
+			StoreToken:     getEnv("BACKUP_STORE_TOKEN", ""),
+			StoreTimeout:   getEnvAsDuration("BACKUP_STORE_TIMEOUT", 10*time.Minute),
+			Tables:         getEnvAsSlice("BACKUP_TABLES", []string{"users", "users_history", "usage_hourly"}),
+			Interval:       getEnvAsDuration("BACKUP_INTERVAL", 24*time.Hour),
+			VerifyInterval: getEnvAsDuration("BACKUP_VERIFY_INTERVAL", 24*time.Hour),
+		},
+		Registration: RegistrationConfig{
+			TokenTTL:           getEnvAsDuration("REGISTRATION_TOKEN_TTL", 24*time.Hour),
+			VerifyURL:          getEnv("REGISTRATION_VERIFY_URL", "http://localhost:3000/verify-email"),
+			RateLimitPerMinute: getEnvAsFloat("REGISTRATION_RATE_LIMIT_PER_MINUTE", 5),
+			RateLimitBurst:     getEnvAsInt("REGISTRATION_RATE_LIMIT_BURST", 3),
+			CleanupInterval:    getEnvAsDuration("REGISTRATION_CLEANUP_INTERVAL", time.Hour),
+		},
+		Captcha: CaptchaConfig{
+			Secret:    getEnv("CAPTCHA_SECRET", ""),
+			VerifyURL: getEnv("CAPTCHA_VERIFY_URL", "https://challenges.cloudflare.com/turnstile/v0/siteverify"),
+			Timeout:   getEnvAsDuration("CAPTCHA_TIMEOUT", 5*time.Second),
+		},
+		Mail: MailConfig{
+			SMTPAddress:  getEnv("MAIL_SMTP_ADDRESS", ""),
+			SMTPUsername: getEnv("MAIL_SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("MAIL_SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", "no-reply@example.com"),
+		},
+		Invitations: InvitationsConfig{
+			SigningKey: secret("INVITE_SIGNING_KEY", "", vaultClient),
+			TTL:        getEnvAsDuration("INVITE_TTL", 7*24*time.Hour),
+			AcceptURL:  getEnv("INVITE_ACCEPT_URL", "http://localhost:3000/accept-invite"),
+		},
+		SchemaRegistry: SchemaRegistryConfig{
+			URL:          getEnv("SCHEMA_REGISTRY_URL", ""),
+			Username:     getEnv("SCHEMA_REGISTRY_USERNAME", ""),
+			Password:     getEnv("SCHEMA_REGISTRY_PASSWORD", ""),
+			Timeout:      getEnvAsDuration("SCHEMA_REGISTRY_TIMEOUT", 10*time.Second),
+			Subject:      getEnv("SCHEMA_REGISTRY_SUBJECT", "user-events-value"),
+			AutoRegister: getEnvAsBool("SCHEMA_REGISTRY_AUTO_REGISTER", true),
+		},
+		Readiness: ReadinessConfig{
+			Timeout:        getEnvAsDuration("READINESS_TIMEOUT", 2*time.Second),
+			SchemaInterval: getEnvAsDuration("READINESS_SCHEMA_INTERVAL", 5*time.Minute),
+		},
+		Heartbeat: HeartbeatConfig{
+			Interval:          getEnvAsDuration("HEARTBEAT_INTERVAL", 10*time.Second),
+			Timeout:           getEnvAsDuration("HEARTBEAT_TIMEOUT", 2*time.Second),
+			WatchdogThreshold: getEnvAsDuration("WATCHDOG_THRESHOLD", 0),
+		},
+		CacheWarm: CacheWarmConfig{
+			OnChange: getEnvAsBool("CACHE_WARM_ON_CHANGE", false),
+		},
+		BatchGet: BatchGetConfig{
+			Workers:   getEnvAsInt("BATCH_GET_WORKERS", 16),
+			QueueSize: getEnvAsInt("BATCH_GET_QUEUE_SIZE", 1000),
+		},
+		S3: S3Config{
+			Endpoint:        getEnv("S3_ENDPOINT", ""),
+			Region:          getEnv("S3_REGION", "us-east-1"),
+			AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+			SessionToken:    getEnv("S3_SESSION_TOKEN", ""),
+		},
+		Avatars: AvatarsConfig{
+			StoreURL:     getEnv("AVATAR_STORE_URL", ""),
+			StoreToken:   getEnv("AVATAR_STORE_TOKEN", ""),
+			StoreTimeout: getEnvAsDuration("AVATAR_STORE_TIMEOUT", 30*time.Second),
+			MaxSize:      getEnvAsInt("AVATAR_MAX_SIZE", 2<<20),
+			PublicURL:    getEnv("AVATAR_PUBLIC_URL", ""),
+		},
+		RBAC: RBACConfig{
+			PolicyPath: getEnv("RBAC_POLICY_PATH", ""),
+		},
+		APIKeys: APIKeysConfig{
+			Enabled:            getEnvAsBool("API_KEYS_ENABLED", true),
+			CacheTTL:           getEnvAsDuration("API_KEY_CACHE_TTL", time.Minute),
+			RotationGrace:      getEnvAsDuration("API_KEY_ROTATION_GRACE", 24*time.Hour),
+			RateLimitPerMinute: getEnvAsFloat("API_KEY_RATE_LIMIT", 600),
+			RateLimitBurst:     getEnvAsInt("API_KEY_RATE_BURST", 100),
+		},
+		AdaptiveLimit: AdaptiveLimitConfig{
+			Enabled:      getEnvAsBool("ADAPTIVE_LIMIT_ENABLED", false),
+			Interval:     getEnvAsDuration("ADAPTIVE_LIMIT_INTERVAL", 5*time.Second),
+			Initial:      getEnvAsFloat("ADAPTIVE_LIMIT_INITIAL", 1000),
+			Min:          getEnvAsFloat("ADAPTIVE_LIMIT_MIN", 50),
+			Max:          getEnvAsFloat("ADAPTIVE_LIMIT_MAX", 5000),
+			Increase:     getEnvAsFloat("ADAPTIVE_LIMIT_INCREASE", 50),
+			Decrease:     getEnvAsFloat("ADAPTIVE_LIMIT_DECREASE", 0.5),
+			MaxErrorRate: getEnvAsFloat("ADAPTIVE_LIMIT_MAX_ERROR_RATE", 0.05),
+			MaxDBLatency: getEnvAsDuration("ADAPTIVE_LIMIT_MAX_DB_LATENCY", 200*time.Millisecond),
+			MinRequests:  getEnvAsInt("ADAPTIVE_LIMIT_MIN_REQUESTS", 20),
+		},
+		TLS: TLSConfig{
+			CertFile:       getEnv("GRPC_TLS_CERT_FILE", ""),
+			KeyFile:        getEnv("GRPC_TLS_KEY_FILE", ""),
+			ClientCAFile:   getEnv("GRPC_TLS_CLIENT_CA_FILE", ""),
+			ReloadInterval: getEnvAsDuration("GRPC_TLS_RELOAD_INTERVAL", time.Minute),
 		},
-	}, nil
+		Passwords: PasswordsConfig{
+			MinLength:   getEnvAsInt("PASSWORD_MIN_LENGTH", 12),
+			Memory:      getEnvAsInt("PASSWORD_ARGON2_MEMORY_KIB", 64*1024),
+			Iterations:  getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 3),
+			Parallelism: getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 2),
+		},
+		Sessions: SessionsConfig{
+			SigningKey:         secret("SESSION_SIGNING_KEY", "", vaultClient),
+			AccessTTL:          getEnvAsDuration("SESSION_ACCESS_TTL", 15*time.Minute),
+			RefreshTTL:         getEnvAsDuration("SESSION_REFRESH_TTL", 30*24*time.Hour),
+			CleanupInterval:    getEnvAsDuration("SESSION_CLEANUP_INTERVAL", time.Hour),
+			RateLimitPerMinute: getEnvAsFloat("LOGIN_RATE_LIMIT", 20),
+			RateLimitBurst:     getEnvAsInt("LOGIN_RATE_BURST", 10),
+			ImpersonationTTL:   getEnvAsDuration("SESSION_IMPERSONATION_TTL", 15*time.Minute),
+		},
+		Log: LogConfig{
+			RedactFields:    getEnvAsSlice("LOG_REDACT_FIELDS", []string{"email", "name"}),
+			RedactMode:      getEnv("LOG_REDACT_MODE", "mask"),
+			RequestPayloads: getEnvAsBool("LOG_REQUEST_PAYLOADS", false),
+		},
+		Deadlines: DeadlinesConfig{
+			Reserve: getEnvAsFloat("DEADLINE_RESERVE", 0.2),
+		},
+		Messages: MessagesConfig{
+			MaxRecvSize:    getEnvAsInt("GRPC_MAX_RECV_MSG_SIZE", 4<<20),
+			MaxSendSize:    getEnvAsInt("GRPC_MAX_SEND_MSG_SIZE", 16<<20),
+			MaxStringBytes: getEnvAsInt("GRPC_MAX_STRING_FIELD_BYTES", 64<<10),
+		},
+		IPFilter: IPFilterConfig{
+			Deny:           getEnvAsSlice("IP_DENY", nil),
+			Allow:          getEnvAsSlice("IP_ALLOW", nil),
+			AllowMethods:   getEnvAsSlice("IP_ALLOW_METHODS", []string{"*"}),
+			TrustedProxies: getEnvAsSlice("IP_TRUSTED_PROXIES", nil),
+		},
+		Secrets: SecretsConfig{
+			AllowEnv: getEnvAsBool("SECRETS_ALLOW_ENV", true),
+			Vault:    vault,
+		},
+		Lockout: LockoutConfig{
+			MaxFailures: getEnvAsInt("LOCKOUT_MAX_FAILURES", 10),
+			Window:      getEnvAsDuration("LOCKOUT_WINDOW", 15*time.Minute),
+			Duration:    getEnvAsDuration("LOCKOUT_DURATION", 30*time.Minute),
+			BaseDelay:   getEnvAsDuration("LOCKOUT_BASE_DELAY", time.Second),
+			MaxDelay:    getEnvAsDuration("LOCKOUT_MAX_DELAY", time.Minute),
+		},
+		CallerLimits: CallerLimitsConfig{
+			PerMinute: getEnvAsFloat("CALLER_RATE_LIMIT_PER_MINUTE", 0),
+			Burst:     getEnvAsInt("CALLER_RATE_LIMIT_BURST", 100),
+			Methods:   getEnvAsSlice("CALLER_RATE_LIMIT_METHODS", nil),
+		},
+		RequestSigning: RequestSigningConfig{
+			Key:         secret("REQUEST_SIGNING_KEY", "", vaultClient),
+			PreviousKey: secret("REQUEST_SIGNING_PREVIOUS_KEY", "", vaultClient),
+			Methods: getEnvAsSlice("REQUEST_SIGNING_METHODS", []string{
+				"/user.UserService/PurgeUser",
+				"/user.UserService/BulkDeleteUsers",
+				"/user.UserService/EraseUser",
+				"/user.UserService/FlushCache",
+				"/user.UserService/ReplayEvents",
+				"/user.UserService/CreateAPIKey",
+				"/user.UserService/RotateAPIKey",
+				"/user.UserService/RevokeAPIKey",
+				"/user.UserService/RevokeAllSessions",
+				"/user.UserService/UnlockUser",
+			}),
+			MaxSkew: getEnvAsDuration("REQUEST_SIGNING_MAX_SKEW", 5*time.Minute),
+		},
+		Erasure: ErasureConfig{
+			Interval:   getEnvAsDuration("ERASURE_INTERVAL", time.Minute),
+			RetryDelay: getEnvAsDuration("ERASURE_RETRY_DELAY", 10*time.Minute),
+		},
+		TrafficDump: TrafficDumpConfig{
+			Size:    getEnvAsInt("TRAFFIC_DUMP_SIZE", 0),
+			Methods: getEnvAsSlice("TRAFFIC_DUMP_METHODS", []string{"*"}),
+		},
+		Encryption: EncryptionConfig{
+			Keys:         secret("ENCRYPTION_KEYS", "", vaultClient),
+			KeyID:        getEnv("ENCRYPTION_KEY_ID", ""),
+			MetadataKeys: getEnvAsSlice("ENCRYPTION_METADATA_KEYS", []string{"*"}),
+		},
+		Watch: WatchConfig{
+			MaxStreams:          getEnvAsInt("WATCH_MAX_STREAMS", 1000),
+			MaxStreamsPerClient: getEnvAsInt("WATCH_MAX_STREAMS_PER_CLIENT", 10),
+			IdleTimeout:         getEnvAsDuration("WATCH_IDLE_TIMEOUT", 30*time.Minute),
+		},
+		Reports: ReportsConfig{
+			StoreURL:     getEnv("REPORT_STORE_URL", ""),
+			StoreToken:   getEnv("REPORT_STORE_TOKEN", ""),
+			StoreTimeout: getEnvAsDuration("REPORT_STORE_TIMEOUT", 5*time.Minute),
+			Interval:     getEnvAsDuration("REPORT_INTERVAL", 30*time.Second),
+			RetryDelay:   getEnvAsDuration("REPORT_RETRY_DELAY", 5*time.Minute),
+			MaxAttempts:  getEnvAsInt("REPORT_MAX_ATTEMPTS", 3),
+			URLTTL:       getEnvAsDuration("REPORT_URL_TTL", 15*time.Minute),
+		},
+		DataQuality: DataQualityConfig{
+			Interval: getEnvAsDuration("DATA_QUALITY_INTERVAL", 6*time.Hour),
+			Repair:   getEnvAsSlice("DATA_QUALITY_REPAIR", nil),
+			Samples:  getEnvAsInt("DATA_QUALITY_SAMPLES", 100),
+		},
+		Guests: GuestsConfig{
+			Enabled: getEnvAsBool("GUESTS_ENABLED", false),
+		},
+	}
+	return cfg, errors.Join(errs...)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -92,3 +995,62 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if durationVal, err := time.ParseDuration(value); err == nil {
+			return durationVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	return defaultValue
+}
+
+// getEnvAsSecret reads the secret key from exactly one of key, key_FILE and
+// key_VAULT. Vault references are rejected when vault is nil.
+func getEnvAsSecret(key, defaultValue string, vault *vaultClient) (Secret, error) {
+	value, inline := os.LookupEnv(key)
+	file, fromFile := os.LookupEnv(key + "_FILE")
+	ref, fromVault := os.LookupEnv(key + "_VAULT")
+
+	switch {
+	case inline && fromFile || inline && fromVault || fromFile && fromVault:
+		return Secret{}, fmt.Errorf("only one of %s, %s_FILE and %s_VAULT may be set", key, key, key)
+	case fromFile:
+		return FileSecret(file), nil
+	case fromVault:
+		if vault == nil {
+			return Secret{}, fmt.Errorf("%s_VAULT is not supported", key)
+		}
+		path, field, ok := strings.Cut(ref, "#")
+		if !ok || path == "" || field == "" {
+			return Secret{}, fmt.Errorf("%s_VAULT must be <path>#<field>, got %q", key, ref)
+		}
+		return Secret{src: &vaultSecret{client: vault, path: path, field: field}}, nil
+	case inline:
+		return InlineSecret(value), nil
+	default:
+		return InlineSecret(defaultValue), nil
+	}
+}
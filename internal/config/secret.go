@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sources of a Secret
+const (
+	SecretUnset = ""
+	// SecretEnv is a value given inline in the environment
+	SecretEnv = "env"
+	// SecretFile is read from a file named by the KEY_FILE variable, such as
+	// a mounted Kubernetes Secret
+	SecretFile = "file"
+	// SecretVault is read from Vault at the path named by the KEY_VAULT
+	// variable
+	SecretVault = "vault"
+)
+
+// Secret is a credential given inline, in a mounted file or in Vault. Files
+// are read again when they change and Vault secrets once their refresh
+// interval passes, so rotated credentials are picked up without a restart.
+// A failed refresh keeps the last value. The zero value is an unset secret.
+type Secret struct {
+	src secretSource
+}
+
+type secretSource interface {
+	value(ctx context.Context) (string, error)
+	source() string
+}
+
+// InlineSecret returns a secret with the fixed value v, unset when v is
+// empty
+func InlineSecret(v string) Secret {
+	if v == "" {
+		return Secret{}
+	}
+	return Secret{src: inlineSecret(v)}
+}
+
+// FileSecret returns a secret read from path
+func FileSecret(path string) Secret {
+	return Secret{src: &fileSecret{path: path}}
+}
+
+// Value returns the current value of the secret, or "" when it is unset
+func (s Secret) Value(ctx context.Context) (string, error) {
+	if s.src == nil {
+		return "", nil
+	}
+	return s.src.value(ctx)
+}
+
+// Source returns where the secret comes from, one of the Secret constants
+func (s Secret) Source() string {
+	if s.src == nil {
+		return SecretUnset
+	}
+	return s.src.source()
+}
+
+// IsSet reports whether the secret has a source
+func (s Secret) IsSet() bool {
+	return s.src != nil
+}
+
+// Static reports whether the value never changes, i.e. the secret is unset
+// or inline
+func (s Secret) Static() bool {
+	src := s.Source()
+	return src == SecretUnset || src == SecretEnv
+}
+
+// String names the source without revealing the value
+func (s Secret) String() string {
+	if s.src == nil {
+		return ""
+	}
+	return "[redacted " + s.src.source() + " secret]"
+}
+
+// LogValue implements slog.LogValuer
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// Inline returns the value of an inline secret, reporting whether the
+// secret is one
+func (s Secret) Inline() (string, bool) {
+	v, ok := s.src.(inlineSecret)
+	return string(v), ok
+}
+
+type inlineSecret string
+
+func (s inlineSecret) value(context.Context) (string, error) { return string(s), nil }
+func (s inlineSecret) source() string                        { return SecretEnv }
+
+// fileSecret caches the content of a file until its modification time or
+// size changes
+type fileSecret struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	data    string
+}
+
+func (f *fileSecret) source() string { return SecretFile }
+
+func (f *fileSecret) value(context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.stale(fmt.Errorf("failed to stat secret file: %w", err))
+	}
+	if f.data != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.data, nil
+	}
+
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return f.stale(fmt.Errorf("failed to read secret file: %w", err))
+	}
+	data := strings.TrimSpace(string(raw))
+	if data == "" {
+		return f.stale(fmt.Errorf("secret file %s is empty", f.path))
+	}
+
+	if f.data != "" && data != f.data {
+		slog.Info("secret file changed", slog.String("path", f.path))
+	}
+	f.data, f.modTime, f.size = data, info.ModTime(), info.Size()
+	return data, nil
+}
+
+// stale returns the last value in place of err, which happens while a
+// mounted secret is being swapped
+func (f *fileSecret) stale(err error) (string, error) {
+	if f.data == "" {
+		return "", err
+	}
+	slog.Warn("keeping previous secret", slog.String("path", f.path), slog.String("error", err.Error()))
+	return f.data, nil
+}
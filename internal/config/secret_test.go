@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecret(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("file is read again when it changes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "password")
+		if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		s := FileSecret(path)
+		if v, err := s.Value(ctx); err != nil || v != "first" {
+			t.Fatalf("Value() = %q, %v, want first", v, err)
+		}
+
+		if err := os.WriteFile(path, []byte("second\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Value(ctx); err != nil || v != "second" {
+			t.Errorf("Value() = %q, %v, want second", v, err)
+		}
+
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Value(ctx); err != nil || v != "second" {
+			t.Errorf("Value() after removal = %q, %v, want the previous value", v, err)
+		}
+	})
+
+	t.Run("vault logs in with approle and reads kv v2", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/auth/approle/login":
+				var body map[string]string
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				if body["role_id"] != "role" || body["secret_id"] != "id" {
+					http.Error(w, "bad credentials", http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(`{"auth":{"client_token":"tok","lease_duration":3600}}`))
+			case "/v1/secret/data/users":
+				if r.Header.Get("X-Vault-Token") != "tok" {
+					http.Error(w, "permission denied", http.StatusForbidden)
+					return
+				}
+				_, _ = w.Write([]byte(`{"data":{"data":{"db_password":"s3cret"}}}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		t.Setenv("DB_PASSWORD_VAULT", "secret/data/users#db_password")
+		vault := newVaultClient(VaultConfig{
+			Addr:            srv.URL,
+			AuthMount:       "approle",
+			RoleID:          "role",
+			SecretID:        InlineSecret("id"),
+			Timeout:         time.Second,
+			RefreshInterval: time.Minute,
+		})
+		s, err := getEnvAsSecret("DB_PASSWORD", "", vault)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Value(ctx); err != nil || v != "s3cret" {
+			t.Errorf("Value() = %q, %v, want s3cret", v, err)
+		}
+	})
+
+	t.Run("rejects more than one source", func(t *testing.T) {
+		t.Setenv("REDIS_PASSWORD", "inline")
+		t.Setenv("REDIS_PASSWORD_FILE", "/run/secrets/redis")
+		if _, err := getEnvAsSecret("REDIS_PASSWORD", "", nil); err == nil {
+			t.Error("getEnvAsSecret() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sslModes are the values of DB_SSL_MODE understood by libpq and pgx
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// dataQualityRepairs are the kinds of issues DATA_QUALITY_REPAIR may name
+var dataQualityRepairs = []string{"null_timestamp", "orphaned_membership"}
+
+// tracingExporters are the values of TRACING_EXPORTER
+var tracingExporters = []string{"otlp", "otlp-http", "jaeger"}
+
+// Validate reports settings that cannot work, such as out of range values
+// and incomplete groups, naming the environment variables to fix
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.GRPCAddress != "", "GRPC_ADDRESS must not be empty")
+	check(c.MetricsPort > 0 && c.MetricsPort <= 65535, "METRICS_PORT must be a port number, got %d", c.MetricsPort)
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(c.StreamChunkSize > 0, "STREAM_CHUNK_SIZE must be positive")
+
+	check(c.Database.URL != "" || c.Database.Host != "", "DATABASE_URL or DB_HOST must be set")
+	check(c.Database.MaxConns > 0, "DB_MAX_CONNS must be positive")
+	if c.Database.URL == "" {
+		check(slices.Contains(sslModes, c.Database.SSLMode), "DB_SSL_MODE must be one of %s, got %q", strings.Join(sslModes, ", "), c.Database.SSLMode)
+	}
+	check((c.Database.SSLCert == "") == (c.Database.SSLKey == ""), "DB_SSL_CERT and DB_SSL_KEY must be set together")
+	check((c.Redis.TLSCertFile == "") == (c.Redis.TLSKeyFile == ""), "REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	check(c.Redis.TLS || (c.Redis.TLSCAFile == "" && c.Redis.TLSCertFile == ""), "REDIS_TLS_CA_FILE and REDIS_TLS_CERT_FILE require REDIS_TLS")
+	check(c.Redis.TTLJitter >= 0 && c.Redis.TTLJitter < 1, "REDIS_TTL_JITTER must be at least 0 and below 1")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE must be set together")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "", "GRPC_TLS_CLIENT_CA_FILE requires GRPC_TLS_CERT_FILE")
+
+	check(c.Passwords.MinLength > 0, "PASSWORD_MIN_LENGTH must be positive")
+	check(c.Passwords.Iterations > 0, "PASSWORD_ARGON2_ITERATIONS must be positive")
+	check(c.Passwords.Parallelism > 0 && c.Passwords.Parallelism <= 255, "PASSWORD_ARGON2_PARALLELISM must be between 1 and 255")
+	check(c.Passwords.Memory >= 8*c.Passwords.Parallelism, "PASSWORD_ARGON2_MEMORY_KIB must be at least 8 times PASSWORD_ARGON2_PARALLELISM")
+
+	check(c.Sessions.AccessTTL > 0 && c.Sessions.AccessTTL < c.Sessions.RefreshTTL, "SESSION_ACCESS_TTL must be positive and shorter than SESSION_REFRESH_TTL")
+	check(c.Sessions.ImpersonationTTL > 0 && c.Sessions.ImpersonationTTL <= time.Hour, "SESSION_IMPERSONATION_TTL must be positive and at most 1h")
+	if key, ok := c.Sessions.SigningKey.Inline(); ok {
+		check(len(key) >= 32, "SESSION_SIGNING_KEY must be at least 32 bytes")
+	}
+
+	if c.Tracing.Enabled {
+		check(slices.Contains(tracingExporters, c.Tracing.Exporter), "TRACING_EXPORTER must be one of %s, got %q", strings.Join(tracingExporters, ", "), c.Tracing.Exporter)
+		check(c.Tracing.Exporter == "jaeger" || c.Tracing.OTLPEndpoint != "", "TRACING_OTLP_ENDPOINT must not be empty")
+		check(c.Tracing.Exporter != "jaeger" || c.Tracing.JaegerURL != "", "JAEGER_URL must not be empty")
+		check(c.Tracing.ServiceName != "", "SERVICE_NAME must not be empty")
+		check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+
+	check(c.Log.RedactMode == "mask" || c.Log.RedactMode == "hash", "LOG_REDACT_MODE must be mask or hash, got %q", c.Log.RedactMode)
+
+	check(c.Messages.MaxRecvSize > 0, "GRPC_MAX_RECV_MSG_SIZE must be positive")
+	check(c.Messages.MaxSendSize > 0, "GRPC_MAX_SEND_MSG_SIZE must be positive")
+	check(c.Messages.MaxStringBytes >= 0, "GRPC_MAX_STRING_FIELD_BYTES must not be negative")
+	check(c.Deadlines.Reserve >= 0 && c.Deadlines.Reserve < 1, "DEADLINE_RESERVE must be at least 0 and below 1")
+
+	check(c.CallerLimits.PerMinute >= 0, "CALLER_RATE_LIMIT_PER_MINUTE must not be negative")
+	check(c.CallerLimits.PerMinute == 0 || c.CallerLimits.Burst > 0, "CALLER_RATE_LIMIT_BURST must be positive")
+
+	check(c.Lockout.MaxFailures >= 0, "LOCKOUT_MAX_FAILURES must not be negative")
+	if c.Lockout.MaxFailures > 0 || c.Lockout.BaseDelay > 0 {
+		check(c.Lockout.Window > 0, "LOCKOUT_WINDOW must be positive")
+	}
+	check(c.Lockout.MaxFailures == 0 || c.Lockout.Duration > 0, "LOCKOUT_DURATION must be positive")
+	check(c.Lockout.BaseDelay <= 0 || c.Lockout.MaxDelay >= c.Lockout.BaseDelay, "LOCKOUT_MAX_DELAY must be at least LOCKOUT_BASE_DELAY")
+	check(c.Erasure.RetryDelay > 0, "ERASURE_RETRY_DELAY must be positive")
+	if c.RequestSigning.Key.IsSet() {
+		check(c.RequestSigning.MaxSkew > 0, "REQUEST_SIGNING_MAX_SKEW must be positive")
+	}
+	check(!c.RequestSigning.PreviousKey.IsSet() || c.RequestSigning.Key.IsSet(), "REQUEST_SIGNING_PREVIOUS_KEY requires REQUEST_SIGNING_KEY")
+	check(c.TrafficDump.Size >= 0, "TRAFFIC_DUMP_SIZE must not be negative")
+	check(!c.Encryption.Keys.IsSet() || c.Encryption.KeyID != "", "ENCRYPTION_KEY_ID is required with ENCRYPTION_KEYS")
+	check(c.Watch.MaxStreams >= 0, "WATCH_MAX_STREAMS must not be negative")
+	check(c.Watch.MaxStreamsPerClient >= 0, "WATCH_MAX_STREAMS_PER_CLIENT must not be negative")
+	check(c.Watch.IdleTimeout >= 0, "WATCH_IDLE_TIMEOUT must not be negative")
+	if c.Reports.StoreURL != "" {
+		check(c.Reports.Interval > 0, "REPORT_INTERVAL must be positive")
+		check(c.Reports.RetryDelay > 0, "REPORT_RETRY_DELAY must be positive")
+		check(c.Reports.MaxAttempts > 0, "REPORT_MAX_ATTEMPTS must be positive")
+		check(c.Reports.URLTTL >= time.Second && c.Reports.URLTTL <= 7*24*time.Hour, "REPORT_URL_TTL must be between 1s and 168h")
+	}
+	check(c.DataQuality.Interval >= 0, "DATA_QUALITY_INTERVAL must not be negative")
+	if c.DataQuality.Interval > 0 {
+		check(c.DataQuality.Samples > 0, "DATA_QUALITY_SAMPLES must be positive")
+		for _, kind := range c.DataQuality.Repair {
+			check(slices.Contains(dataQualityRepairs, kind), "DATA_QUALITY_REPAIR must only name %s, got %q", strings.Join(dataQualityRepairs, ", "), kind)
+		}
+	}
+
+	if c.AdaptiveLimit.Enabled {
+		check(c.AdaptiveLimit.Min > 0 && c.AdaptiveLimit.Min <= c.AdaptiveLimit.Max, "ADAPTIVE_LIMIT_MIN must be positive and at most ADAPTIVE_LIMIT_MAX")
+		check(c.AdaptiveLimit.Decrease > 0 && c.AdaptiveLimit.Decrease < 1, "ADAPTIVE_LIMIT_DECREASE must be between 0 and 1")
+	}
+
+	type namedSecret struct {
+		name   string
+		secret Secret
+	}
+	secrets := []namedSecret{
+		{"REDIS_PASSWORD", c.Redis.Password},
+		{"INVITE_SIGNING_KEY", c.Invitations.SigningKey},
+		{"SESSION_SIGNING_KEY", c.Sessions.SigningKey},
+		{"REQUEST_SIGNING_KEY", c.RequestSigning.Key},
+		{"REQUEST_SIGNING_PREVIOUS_KEY", c.RequestSigning.PreviousKey},
+		{"ENCRYPTION_KEYS", c.Encryption.Keys},
+	}
+	// Other database auth methods ignore the password
+	if c.Database.Auth == "" || c.Database.Auth == "password" {
+		secrets = append(secrets, namedSecret{"DB_PASSWORD", c.Database.Password})
+	}
+	for _, s := range secrets {
+		check(c.Secrets.AllowEnv || s.secret.Source() != SecretEnv, "%s must be set with %s_FILE or %s_VAULT, SECRETS_ALLOW_ENV is false", s.name, s.name, s.name)
+		check(c.Secrets.Vault.Addr != "" || s.secret.Source() != SecretVault, "%s_VAULT requires VAULT_ADDR", s.name)
+	}
+	if c.Secrets.Vault.Addr != "" {
+		check(c.Secrets.Vault.RoleID != "", "VAULT_ROLE_ID must be set with VAULT_ADDR")
+		check(c.Secrets.Vault.SecretID.IsSet(), "VAULT_SECRET_ID or VAULT_SECRET_ID_FILE must be set with VAULT_ADDR")
+		check(c.Secrets.Vault.Timeout > 0, "VAULT_TIMEOUT must be positive")
+		check(c.Secrets.Vault.RefreshInterval > 0, "VAULT_REFRESH_INTERVAL must be positive")
+	}
+
+	return errors.Join(errs...)
+}
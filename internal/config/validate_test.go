@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run("accepts the defaults", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate() error = %v", err)
+		}
+	})
+
+	t.Run("names every invalid setting", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.MetricsPort = 0
+		cfg.TLS.KeyFile = "/etc/tls/tls.key"
+		cfg.AdaptiveLimit.Enabled = true
+		cfg.AdaptiveLimit.Decrease = 2
+		cfg.DataQuality.Repair = []string{"duplicate_email"}
+
+		err = cfg.Validate()
+		if err == nil {
+			t.Fatal("Validate() error = nil, want error")
+		}
+		for _, name := range []string{"METRICS_PORT", "GRPC_TLS_KEY_FILE", "ADAPTIVE_LIMIT_DECREASE", "DATA_QUALITY_REPAIR"} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("Validate() error = %q, want it to name %s", err, name)
+			}
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultRetryInterval is how long a cached secret is served after a failed
+// refresh before Vault is asked again
+const vaultRetryInterval = 30 * time.Second
+
+// vaultClient reads secrets over the Vault HTTP API, logging in with
+// AppRole and reusing the client token until most of its lease has passed
+type vaultClient struct {
+	cfg  VaultConfig
+	http *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newVaultClient(cfg VaultConfig) *vaultClient {
+	return &vaultClient{cfg: cfg, http: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// login returns a client token, logging in when there is none or it is
+// about to expire
+func (c *vaultClient) login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	secretID, err := c.cfg.SecretID.Value(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get vault secret id: %w", err)
+	}
+	body, err := json.Marshal(map[string]string{"role_id": c.cfg.RoleID, "secret_id": secretID})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode vault login: %w", err)
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "auth/"+c.cfg.AuthMount+"/login", "", body, &resp); err != nil {
+		return "", fmt.Errorf("failed to log in to vault: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", errors.New("failed to log in to vault: no client token returned")
+	}
+
+	lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+	if lease <= 0 {
+		lease = 24 * time.Hour
+	}
+	c.token = resp.Auth.ClientToken
+	c.expires = time.Now().Add(lease * 3 / 4)
+	return c.token, nil
+}
+
+// forget drops token after Vault rejected it, e.g. because it was revoked
+func (c *vaultClient) forget(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// read returns field of the secret at path, which may be a KV version 1 or 2
+// API path such as "secret/data/user-service", and how long to cache it
+func (c *vaultClient) read(ctx context.Context, path, field string) (string, time.Duration, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.login(ctx)
+		if err != nil {
+			return "", 0, err
+		}
+
+		var resp struct {
+			LeaseDuration int            `json:"lease_duration"`
+			Data          map[string]any `json:"data"`
+		}
+		err = c.do(ctx, http.MethodGet, path, token, nil, &resp)
+		var statusErr *vaultStatusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusForbidden && attempt == 0 {
+			c.forget(token)
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read vault secret %s: %w", path, err)
+		}
+
+		data := resp.Data
+		if nested, ok := data["data"].(map[string]any); ok {
+			data = nested
+		}
+		value, _ := data[field].(string)
+		if value == "" {
+			return "", 0, fmt.Errorf("vault secret %s has no field %q", path, field)
+		}
+
+		ttl := c.cfg.RefreshInterval
+		if lease := time.Duration(resp.LeaseDuration) * time.Second; lease > 0 && lease < ttl {
+			ttl = lease
+		}
+		return value, ttl, nil
+	}
+}
+
+// vaultStatusError is a response other than 200 OK
+type vaultStatusError struct {
+	code int
+	body string
+}
+
+func (e *vaultStatusError) Error() string {
+	return fmt.Sprintf("vault returned %d: %s", e.code, e.body)
+}
+
+func (c *vaultClient) do(ctx context.Context, method, path, token string, body []byte, out any) error {
+	url := strings.TrimRight(c.cfg.Addr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &vaultStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// vaultSecret caches a field of a Vault secret until its refresh interval
+// passes
+type vaultSecret struct {
+	client *vaultClient
+	path   string
+	field  string
+
+	mu      sync.Mutex
+	data    string
+	expires time.Time
+}
+
+func (v *vaultSecret) source() string { return SecretVault }
+
+func (v *vaultSecret) value(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.data != "" && time.Now().Before(v.expires) {
+		return v.data, nil
+	}
+
+	data, ttl, err := v.client.read(ctx, v.path, v.field)
+	if err != nil {
+		if v.data == "" {
+			return "", err
+		}
+		// Keep serving the last value while Vault is unreachable, without
+		// stalling every caller on it
+		v.expires = time.Now().Add(vaultRetryInterval)
+		slog.Warn("keeping previous secret", slog.String("vault_path", v.path), slog.String("error", err.Error()))
+		return v.data, nil
+	}
+
+	v.data = data
+	v.expires = time.Now().Add(ttl)
+	return data, nil
+}
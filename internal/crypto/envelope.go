@@ -0,0 +1,227 @@
+// Package crypto encrypts sensitive column values at rest with envelope
+// encryption: values are sealed with AES-256-GCM under a data key, and the
+// data key is wrapped by a key-encryption key held by a KMS. Sealed values
+// carry the ID of the key-encryption key and the wrapped data key, so keys
+// can be rotated while values sealed under older keys stay readable.
+package crypto
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Prefix marks sealed values. Values without it were stored before
+// encryption was enabled and are read as they are.
+const Prefix = "enc:v1:"
+
+const (
+	// maxKeyIDLength bounds key IDs, which are stored in every value
+	maxKeyIDLength = 64
+	// maxDataKeyUses is how many values one data key seals before a new one
+	// is made, well below the limit of random GCM nonces
+	maxDataKeyUses = 1 << 24
+	// maxOpenedKeys bounds the unwrapped data keys kept in memory
+	maxOpenedKeys = 1024
+)
+
+var (
+	// ErrUnknownKey is returned for values sealed under a key the KMS
+	// does not hold
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrMalformed is returned for sealed values that cannot be decoded
+	ErrMalformed = errors.New("malformed encrypted value")
+	// ErrDecrypt is returned for sealed values that fail authentication,
+	// because they were altered or moved to another field
+	ErrDecrypt = errors.New("failed to decrypt value")
+)
+
+// Cipher seals and opens string values. The associated data binds a value
+// to where it is stored, so it cannot be opened elsewhere.
+type Cipher interface {
+	Seal(ctx context.Context, plaintext, associated string) (string, error)
+	Open(ctx context.Context, sealed, associated string) (string, error)
+}
+
+// Noop stores values as they are, for deployments without encryption
+type Noop struct{}
+
+// Seal implements Cipher
+func (Noop) Seal(_ context.Context, plaintext, _ string) (string, error) {
+	return plaintext, nil
+}
+
+// Open implements Cipher
+func (Noop) Open(_ context.Context, sealed, _ string) (string, error) {
+	return sealed, nil
+}
+
+// Envelope seals values under data keys wrapped by a KMS. It makes a data
+// key once and reuses it for many values, and keeps unwrapped data keys in
+// memory, so the KMS is only called when a key is first seen.
+type Envelope struct {
+	kms   KMS
+	keyID string
+
+	mu      sync.Mutex
+	current *dataKey
+	opened  map[string]cipher.AEAD
+}
+
+// dataKey is the data key values are sealed with
+type dataKey struct {
+	aead    cipher.AEAD
+	wrapped []byte
+	uses    int
+}
+
+// NewEnvelope creates an Envelope sealing values under the key-encryption
+// key keyID of kms. Values sealed under any other key of kms can be opened.
+func NewEnvelope(kms KMS, keyID string) *Envelope {
+	return &Envelope{kms: kms, keyID: keyID, opened: make(map[string]cipher.AEAD)}
+}
+
+// Seal implements Cipher
+func (e *Envelope) Seal(ctx context.Context, plaintext, associated string) (string, error) {
+	key, err := e.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// keyID length | keyID | wrapped length | wrapped | nonce | ciphertext
+	out := make([]byte, 0, 3+len(e.keyID)+len(key.wrapped)+len(nonce)+len(plaintext)+key.aead.Overhead())
+	out = append(out, byte(len(e.keyID)))
+	out = append(out, e.keyID...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(key.wrapped)))
+	out = append(out, key.wrapped...)
+	out = append(out, nonce...)
+	out = key.aead.Seal(out, nonce, []byte(plaintext), []byte(associated))
+
+	return Prefix + base64.RawStdEncoding.EncodeToString(out), nil
+}
+
+// Open implements Cipher. Values without Prefix are returned as they are.
+func (e *Envelope) Open(ctx context.Context, sealed, associated string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, Prefix)
+	if !ok {
+		return sealed, nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	keyID, wrapped, rest, err := split(data)
+	if err != nil {
+		return "", err
+	}
+	aead, err := e.open(ctx, keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(associated))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// KeyID returns the ID of the key-encryption key a value is sealed under,
+// or "" for values stored in plain
+func KeyID(sealed string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, Prefix)
+	if !ok {
+		return "", nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	keyID, _, _, err := split(data)
+	return keyID, err
+}
+
+// dataKey returns the data key to seal with, making a new one when there
+// is none yet or the current one was used too often
+func (e *Envelope) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil || e.current.uses >= maxDataKeyUses {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate data key: %w", err)
+		}
+		wrapped, err := e.kms.Wrap(ctx, e.keyID, raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, err
+		}
+		e.current = &dataKey{aead: aead, wrapped: wrapped}
+	}
+
+	e.current.uses++
+	return e.current, nil
+}
+
+// open returns the cipher of a wrapped data key, unwrapping it with the
+// KMS when it is not in memory
+func (e *Envelope) open(ctx context.Context, keyID string, wrapped []byte) (cipher.AEAD, error) {
+	cacheKey := keyID + "\x00" + string(wrapped)
+
+	e.mu.Lock()
+	aead, ok := e.opened[cacheKey]
+	e.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	raw, err := e.kms.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	if aead, err = newAEAD(raw); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	if len(e.opened) >= maxOpenedKeys {
+		clear(e.opened)
+	}
+	e.opened[cacheKey] = aead
+	e.mu.Unlock()
+
+	return aead, nil
+}
+
+// split decodes the key ID and wrapped data key heading a sealed value
+func split(data []byte) (keyID string, wrapped, rest []byte, err error) {
+	if len(data) < 1 || len(data) < 1+int(data[0])+2 {
+		return "", nil, nil, ErrMalformed
+	}
+	keyID, data = string(data[1:1+int(data[0])]), data[1+int(data[0]):]
+
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", nil, nil, ErrMalformed
+	}
+	return keyID, data[2 : 2+n], data[2+n:], nil
+}
@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	ctx := context.Background()
+	old := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", 32)))
+	current := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("c", 32)))
+	kms, err := ParseStaticKMS("2023:" + old + ", 2024:" + current)
+	if err != nil {
+		t.Fatalf("failed to parse keys: %v", err)
+	}
+
+	t.Run("opens what it sealed", func(t *testing.T) {
+		env := NewEnvelope(kms, "2024")
+		sealed, err := env.Seal(ctx, "4111 1111", "users.metadata.card")
+		if err != nil {
+			t.Fatalf("failed to seal: %v", err)
+		}
+		if !strings.HasPrefix(sealed, Prefix) || strings.Contains(sealed, "4111") {
+			t.Errorf("expected a sealed value, got %q", sealed)
+		}
+		if plaintext, err := env.Open(ctx, sealed, "users.metadata.card"); err != nil || plaintext != "4111 1111" {
+			t.Errorf("expected the plaintext back, got %q, %v", plaintext, err)
+		}
+		if _, err := env.Open(ctx, sealed, "users.metadata.plan"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("expected a value moved to another field to fail, got %v", err)
+		}
+	})
+
+	t.Run("opens values sealed under a rotated key", func(t *testing.T) {
+		sealed, err := NewEnvelope(kms, "2023").Seal(ctx, "pro", "users.metadata.plan")
+		if err != nil {
+			t.Fatalf("failed to seal: %v", err)
+		}
+		if keyID, _ := KeyID(sealed); keyID != "2023" {
+			t.Errorf("expected key 2023, got %q", keyID)
+		}
+		if plaintext, err := NewEnvelope(kms, "2024").Open(ctx, sealed, "users.metadata.plan"); err != nil || plaintext != "pro" {
+			t.Errorf("expected the plaintext back, got %q, %v", plaintext, err)
+		}
+	})
+
+	t.Run("reads plain values as they are", func(t *testing.T) {
+		if plaintext, err := NewEnvelope(kms, "2024").Open(ctx, "pro", "users.metadata.plan"); err != nil || plaintext != "pro" {
+			t.Errorf("expected the plain value, got %q, %v", plaintext, err)
+		}
+	})
+}
@@ -0,0 +1,327 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IssueKind is a class of data anomaly
+type IssueKind string
+
+const (
+	// IssueDuplicateEmail is a group of active users whose emails differ
+	// only in case, which the case-sensitive unique index lets through
+	IssueDuplicateEmail IssueKind = "duplicate_email"
+	// IssueNullTimestamp is a user without created_at or updated_at, e.g.
+	// written by a manual insert
+	IssueNullTimestamp IssueKind = "null_timestamp"
+	// IssueOrphanedMembership is an organization membership whose user or
+	// organization no longer exists, e.g. after a partial restore
+	IssueOrphanedMembership IssueKind = "orphaned_membership"
+)
+
+// IssueKinds are the kinds of issues checked, in order
+var IssueKinds = []IssueKind{IssueDuplicateEmail, IssueNullTimestamp, IssueOrphanedMembership}
+
+// DataIssue is one anomaly found by a scan
+type DataIssue struct {
+	Kind  IssueKind
+	Table string
+	// IDs locate the rows: user IDs, or the organization and user IDs of a
+	// membership
+	IDs    []int64
+	Detail string
+	// Repaired is set when the scan that found the issue repaired it
+	Repaired bool
+}
+
+// DataQualityReport is the outcome of a scan
+type DataQualityReport struct {
+	// Issues holds up to the configured number of samples per kind
+	Issues []DataIssue
+	// Counts are the numbers of issues found per kind
+	Counts    map[IssueKind]int64
+	ScannedAt time.Time
+}
+
+// DataQualityConfig tunes what the checker reports and repairs
+type DataQualityConfig struct {
+	// Repair are the kinds repaired when found. Duplicate emails are never
+	// repaired, as only a person can tell which user to keep.
+	Repair []IssueKind
+	// Samples is the number of issues kept per kind
+	Samples int
+	// SkipEmails skips the duplicate email check, for tokenized emails
+	// whose case means nothing
+	SkipEmails bool
+}
+
+// dataCheck finds, and for some kinds repairs, one kind of issue
+type dataCheck struct {
+	kind IssueKind
+	// scan returns up to limit issues and the number found
+	scan func(ctx context.Context, limit int) ([]DataIssue, int64, error)
+	// repair fixes every issue of the kind, returning how many; nil for
+	// kinds that are only reported
+	repair func(ctx context.Context) (int64, error)
+}
+
+// DataQualityChecker scans the user tables for anomalies the schema does
+// not prevent, exporting their numbers as gauges and keeping the latest
+// report for the ListDataIssues RPC. It is a prometheus.Collector and is
+// meant to run as a periodic job.
+type DataQualityChecker struct {
+	db  *pgxpool.Pool
+	cfg DataQualityConfig
+
+	mu   sync.Mutex
+	last *DataQualityReport
+
+	issues   *prometheus.GaugeVec
+	repaired *prometheus.CounterVec
+}
+
+// NewDataQualityChecker creates a new DataQualityChecker instance
+func NewDataQualityChecker(db *pgxpool.Pool, cfg DataQualityConfig) *DataQualityChecker {
+	return &DataQualityChecker{
+		db:  db,
+		cfg: cfg,
+		issues: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "data_quality_issues",
+			Help: "Anomalies found by the latest data quality scan and not repaired, by kind.",
+		}, []string{"kind"}),
+		repaired: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "data_quality_repaired_total",
+			Help: "Anomalies repaired by data quality scans, by kind.",
+		}, []string{"kind"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *DataQualityChecker) Describe(ch chan<- *prometheus.Desc) {
+	c.issues.Describe(ch)
+	c.repaired.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *DataQualityChecker) Collect(ch chan<- prometheus.Metric) {
+	c.issues.Collect(ch)
+	c.repaired.Collect(ch)
+}
+
+// Run scans for every kind of issue, repairing the kinds configured to be.
+// A failing check does not stop the others.
+func (c *DataQualityChecker) Run(ctx context.Context) error {
+	report := &DataQualityReport{Counts: make(map[IssueKind]int64), ScannedAt: time.Now()}
+
+	var errs []error
+	for _, check := range c.checks() {
+		if check.kind == IssueDuplicateEmail && c.cfg.SkipEmails {
+			continue
+		}
+
+		issues, found, err := check.scan(ctx, c.cfg.Samples)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to check %s: %w", check.kind, err))
+			continue
+		}
+
+		remaining := found
+		if found > 0 && check.repair != nil && slices.Contains(c.cfg.Repair, check.kind) {
+			repaired, err := check.repair(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to repair %s: %w", check.kind, err))
+			} else {
+				for i := range issues {
+					issues[i].Repaired = true
+				}
+				remaining = max(found-repaired, 0)
+				c.repaired.WithLabelValues(string(check.kind)).Add(float64(repaired))
+				slog.Info("data quality: repaired issues",
+					slog.String("kind", string(check.kind)),
+					slog.Int64("repaired", repaired))
+			}
+		}
+		if remaining > 0 {
+			slog.Warn("data quality: issues found",
+				slog.String("kind", string(check.kind)),
+				slog.Int64("count", remaining))
+		}
+
+		c.issues.WithLabelValues(string(check.kind)).Set(float64(remaining))
+		report.Counts[check.kind] = found
+		report.Issues = append(report.Issues, issues...)
+	}
+
+	c.mu.Lock()
+	c.last = report
+	c.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// Report returns the latest scan, keeping only the issues of kind unless
+// it is empty. It returns nil before the first scan.
+func (c *DataQualityChecker) Report(kind IssueKind) *DataQualityReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last == nil {
+		return nil
+	}
+	report := *c.last
+	if kind != "" {
+		report.Issues = slices.DeleteFunc(slices.Clone(report.Issues), func(issue DataIssue) bool {
+			return issue.Kind != kind
+		})
+	}
+	return &report
+}
+
+func (c *DataQualityChecker) checks() []dataCheck {
+	return []dataCheck{
+		{kind: IssueDuplicateEmail, scan: c.scanDuplicateEmails},
+		{kind: IssueNullTimestamp, scan: c.scanNullTimestamps, repair: c.repairNullTimestamps},
+		{kind: IssueOrphanedMembership, scan: c.scanOrphanedMemberships, repair: c.repairOrphanedMemberships},
+	}
+}
+
+// scanDuplicateEmails reports the groups of active users sharing an email
+// up to case. The email itself is not reported.
+func (c *DataQualityChecker) scanDuplicateEmails(ctx context.Context, limit int) ([]DataIssue, int64, error) {
+	query := `
+		SELECT array_agg(id ORDER BY id), COUNT(*) OVER ()
+		FROM users
+		WHERE deleted_at IS NULL
+		GROUP BY lower(email)
+		HAVING COUNT(*) > 1
+		ORDER BY min(id)
+		LIMIT $1
+	`
+
+	var found int64
+	issues, err := c.collect(ctx, query, limit, func(row pgx.CollectableRow) (DataIssue, error) {
+		var ids []int64
+		if err := row.Scan(&ids, &found); err != nil {
+			return DataIssue{}, err
+		}
+		return DataIssue{
+			Kind:   IssueDuplicateEmail,
+			Table:  "users",
+			IDs:    ids,
+			Detail: fmt.Sprintf("%d active users have emails differing only in case", len(ids)),
+		}, nil
+	})
+	return issues, found, err
+}
+
+func (c *DataQualityChecker) scanNullTimestamps(ctx context.Context, limit int) ([]DataIssue, int64, error) {
+	query := `
+		SELECT id, created_at IS NULL, updated_at IS NULL, COUNT(*) OVER ()
+		FROM users
+		WHERE created_at IS NULL OR updated_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`
+
+	var found int64
+	issues, err := c.collect(ctx, query, limit, func(row pgx.CollectableRow) (DataIssue, error) {
+		var (
+			id                   int64
+			noCreated, noUpdated bool
+		)
+		if err := row.Scan(&id, &noCreated, &noUpdated, &found); err != nil {
+			return DataIssue{}, err
+		}
+		detail := "created_at and updated_at are null"
+		if !noCreated {
+			detail = "updated_at is null"
+		} else if !noUpdated {
+			detail = "created_at is null"
+		}
+		return DataIssue{Kind: IssueNullTimestamp, Table: "users", IDs: []int64{id}, Detail: detail}, nil
+	})
+	return issues, found, err
+}
+
+// repairNullTimestamps fills a missing timestamp with the other one, or
+// the current time when both are missing
+func (c *DataQualityChecker) repairNullTimestamps(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE users
+		SET created_at = COALESCE(created_at, updated_at, NOW()),
+			updated_at = COALESCE(updated_at, created_at, NOW())
+		WHERE created_at IS NULL OR updated_at IS NULL
+	`
+
+	tag, err := c.db.Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (c *DataQualityChecker) scanOrphanedMemberships(ctx context.Context, limit int) ([]DataIssue, int64, error) {
+	query := `
+		SELECT m.organization_id, m.user_id, u.id IS NULL, o.id IS NULL, COUNT(*) OVER ()
+		FROM organization_members m
+		LEFT JOIN users u ON u.id = m.user_id
+		LEFT JOIN organizations o ON o.id = m.organization_id
+		WHERE u.id IS NULL OR o.id IS NULL
+		ORDER BY m.organization_id, m.user_id
+		LIMIT $1
+	`
+
+	var found int64
+	issues, err := c.collect(ctx, query, limit, func(row pgx.CollectableRow) (DataIssue, error) {
+		var (
+			orgID, userID int64
+			noUser, noOrg bool
+		)
+		if err := row.Scan(&orgID, &userID, &noUser, &noOrg, &found); err != nil {
+			return DataIssue{}, err
+		}
+		detail := "user and organization do not exist"
+		if !noUser {
+			detail = "organization does not exist"
+		} else if !noOrg {
+			detail = "user does not exist"
+		}
+		return DataIssue{Kind: IssueOrphanedMembership, Table: "organization_members", IDs: []int64{orgID, userID}, Detail: detail}, nil
+	})
+	return issues, found, err
+}
+
+// repairOrphanedMemberships deletes the memberships of missing users or
+// organizations
+func (c *DataQualityChecker) repairOrphanedMemberships(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM organization_members m
+		WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = m.user_id)
+			OR NOT EXISTS (SELECT 1 FROM organizations o WHERE o.id = m.organization_id)
+	`
+
+	tag, err := c.db.Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// collect runs a scan query taking the sample limit and collects its rows
+func (c *DataQualityChecker) collect(ctx context.Context, query string, limit int, scan pgx.RowToFunc[DataIssue]) ([]DataIssue, error) {
+	rows, err := c.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scan)
+}
@@ -0,0 +1,39 @@
+package diagnostics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDataQualityReport(t *testing.T) {
+	t.Run("nil before the first scan", func(t *testing.T) {
+		c := NewDataQualityChecker(nil, DataQualityConfig{Samples: 10})
+		if report := c.Report(""); report != nil {
+			t.Errorf("expected no report, got %+v", report)
+		}
+	})
+
+	t.Run("filters issues by kind", func(t *testing.T) {
+		c := NewDataQualityChecker(nil, DataQualityConfig{Samples: 10})
+		c.last = &DataQualityReport{
+			Issues: []DataIssue{
+				{Kind: IssueDuplicateEmail, Table: "users", IDs: []int64{1, 2}},
+				{Kind: IssueNullTimestamp, Table: "users", IDs: []int64{3}},
+				{Kind: IssueNullTimestamp, Table: "users", IDs: []int64{4}},
+			},
+			Counts:    map[IssueKind]int64{IssueDuplicateEmail: 1, IssueNullTimestamp: 2},
+			ScannedAt: time.Now(),
+		}
+
+		report := c.Report(IssueNullTimestamp)
+		if len(report.Issues) != 2 || report.Issues[0].IDs[0] != 3 || report.Issues[1].IDs[0] != 4 {
+			t.Errorf("expected the null timestamp issues, got %+v", report.Issues)
+		}
+		if report.Counts[IssueDuplicateEmail] != 1 {
+			t.Errorf("expected every count, got %v", report.Counts)
+		}
+		if all := c.Report(""); len(all.Issues) != 3 {
+			t.Errorf("expected filtering to leave the report intact, got %+v", all.Issues)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Postgres error codes returned when pg_stat_statements is not installed,
+// not loaded through shared_preload_libraries or not readable by our role
+const (
+	undefinedTable        = "42P01"
+	notInPrerequisite     = "55000"
+	insufficientPrivilege = "42501"
+)
+
+// IndexAdvisorConfig tunes when the advisor flags a table or statement
+type IndexAdvisorConfig struct {
+	Tables                 []string
+	SeqScanMinRows         int64
+	SlowStatementThreshold time.Duration
+}
+
+type tableStats struct {
+	seqScans   int64
+	seqTupRead int64
+	idxScans   int64
+	liveTuples int64
+}
+
+// IndexAdvisor samples Postgres statistics for sequential scans and slow
+// statements on the configured tables, logging advice and exporting gauges.
+// It is a prometheus.Collector and is meant to run as a periodic job.
+type IndexAdvisor struct {
+	db  *pgxpool.Pool
+	cfg IndexAdvisorConfig
+
+	mu   sync.Mutex
+	last map[string]tableStats
+
+	// unavailable reports a missing pg_stat_statements once
+	unavailable sync.Once
+
+	seqScans       *prometheus.GaugeVec
+	seqTuplesRead  *prometheus.GaugeVec
+	idxScans       *prometheus.GaugeVec
+	slowStatements *prometheus.GaugeVec
+}
+
+// NewIndexAdvisor creates a new IndexAdvisor instance
+func NewIndexAdvisor(db *pgxpool.Pool, cfg IndexAdvisorConfig) *IndexAdvisor {
+	return &IndexAdvisor{
+		db:   db,
+		cfg:  cfg,
+		last: make(map[string]tableStats),
+		seqScans: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "db_table_seq_scans",
+			Help: "Sequential scans started on the table (pg_stat_user_tables.seq_scan).",
+		}, []string{"table"}),
+		seqTuplesRead: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "db_table_seq_tuples_read",
+			Help: "Live rows fetched by sequential scans (pg_stat_user_tables.seq_tup_read).",
+		}, []string{"table"}),
+		idxScans: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "db_table_idx_scans",
+			Help: "Index scans started on the table (pg_stat_user_tables.idx_scan).",
+		}, []string{"table"}),
+		slowStatements: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "db_table_slow_statements",
+			Help: "Statements referencing the table with a mean execution time above the threshold.",
+		}, []string{"table"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (a *IndexAdvisor) Describe(ch chan<- *prometheus.Desc) {
+	a.seqScans.Describe(ch)
+	a.seqTuplesRead.Describe(ch)
+	a.idxScans.Describe(ch)
+	a.slowStatements.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (a *IndexAdvisor) Collect(ch chan<- prometheus.Metric) {
+	a.seqScans.Collect(ch)
+	a.seqTuplesRead.Collect(ch)
+	a.idxScans.Collect(ch)
+	a.slowStatements.Collect(ch)
+}
+
+// Run takes one sample of table and statement statistics
+func (a *IndexAdvisor) Run(ctx context.Context) error {
+	if err := a.sampleTables(ctx); err != nil {
+		return err
+	}
+	return a.sampleStatements(ctx)
+}
+
+func (a *IndexAdvisor) sampleTables(ctx context.Context) error {
+	query := `
+		SELECT relname, seq_scan, seq_tup_read, COALESCE(idx_scan, 0), n_live_tup
+		FROM pg_stat_user_tables
+		WHERE relname = ANY($1)
+	`
+
+	rows, err := a.db.Query(ctx, query, a.cfg.Tables)
+	if err != nil {
+		return fmt.Errorf("failed to sample table statistics: %w", err)
+	}
+	defer rows.Close()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for rows.Next() {
+		var (
+			table string
+			stats tableStats
+		)
+		if err := rows.Scan(&table, &stats.seqScans, &stats.seqTupRead, &stats.idxScans, &stats.liveTuples); err != nil {
+			return fmt.Errorf("failed to scan table statistics: %w", err)
+		}
+
+		a.seqScans.WithLabelValues(table).Set(float64(stats.seqScans))
+		a.seqTuplesRead.WithLabelValues(table).Set(float64(stats.seqTupRead))
+		a.idxScans.WithLabelValues(table).Set(float64(stats.idxScans))
+
+		if prev, ok := a.last[table]; ok {
+			newSeqScans := stats.seqScans - prev.seqScans
+			if newSeqScans > 0 && stats.liveTuples >= a.cfg.SeqScanMinRows {
+				slog.Warn("index advisor: sequential scans on large table",
+					slog.String("table", table),
+					slog.Int64("new_seq_scans", newSeqScans),
+					slog.Int64("new_seq_tuples_read", stats.seqTupRead-prev.seqTupRead),
+					slog.Int64("new_idx_scans", stats.idxScans-prev.idxScans),
+					slog.Int64("live_rows", stats.liveTuples))
+			}
+		}
+		a.last[table] = stats
+	}
+
+	return rows.Err()
+}
+
+func (a *IndexAdvisor) sampleStatements(ctx context.Context) error {
+	query := `
+		SELECT query, calls, mean_exec_time, rows
+		FROM pg_stat_statements
+		WHERE query ILIKE '%' || $1 || '%' AND mean_exec_time > $2
+		ORDER BY mean_exec_time DESC
+		LIMIT 10
+	`
+
+	thresholdMs := float64(a.cfg.SlowStatementThreshold) / float64(time.Millisecond)
+
+	for _, table := range a.cfg.Tables {
+		rows, err := a.db.Query(ctx, query, table, thresholdMs)
+		if err != nil {
+			if statementsUnavailable(err) {
+				a.skipStatements(err)
+				return nil
+			}
+			return fmt.Errorf("failed to sample statement statistics: %w", err)
+		}
+
+		var slow int
+		for rows.Next() {
+			var (
+				statement string
+				calls     int64
+				meanMs    float64
+				rowCount  int64
+			)
+			if err := rows.Scan(&statement, &calls, &meanMs, &rowCount); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan statement statistics: %w", err)
+			}
+			slow++
+			slog.Warn("index advisor: slow statement",
+				slog.String("table", table),
+				slog.String("statement", statement),
+				slog.Int64("calls", calls),
+				slog.Float64("mean_ms", meanMs),
+				slog.Int64("rows", rowCount))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			if statementsUnavailable(err) {
+				a.skipStatements(err)
+				return nil
+			}
+			return fmt.Errorf("failed to sample statement statistics: %w", err)
+		}
+
+		a.slowStatements.WithLabelValues(table).Set(float64(slow))
+	}
+
+	return nil
+}
+
+// skipStatements notes that pg_stat_statements cannot be read. The extension
+// is optional, so the advisor carries on with table statistics alone and
+// says so on the first run only.
+func (a *IndexAdvisor) skipStatements(err error) {
+	a.unavailable.Do(func() {
+		slog.Info("index advisor: pg_stat_statements unavailable, sampling table statistics only",
+			slog.String("error", err.Error()))
+	})
+}
+
+func statementsUnavailable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == undefinedTable || pgErr.Code == notInPrerequisite || pgErr.Code == insufficientPrivilege)
+}
@@ -0,0 +1,28 @@
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestStatementsUnavailable(t *testing.T) {
+	t.Run("missing, unloaded or unreadable extension", func(t *testing.T) {
+		for _, code := range []string{undefinedTable, notInPrerequisite, insufficientPrivilege} {
+			err := fmt.Errorf("failed to sample: %w", &pgconn.PgError{Code: code})
+			if !statementsUnavailable(err) {
+				t.Errorf("expected code %s to be treated as unavailable", code)
+			}
+		}
+	})
+
+	t.Run("other failures", func(t *testing.T) {
+		for _, err := range []error{errors.New("connection reset"), &pgconn.PgError{Code: "57014"}} {
+			if statementsUnavailable(err) {
+				t.Errorf("expected %v to be reported", err)
+			}
+		}
+	})
+}
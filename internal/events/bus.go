@@ -0,0 +1,148 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrBusClosed is returned when publishing to a closed bus
+var ErrBusClosed = errors.New("event bus closed")
+
+// Bus is an in-process Publisher that fans events out to subscribers over
+// channels. It needs no broker, which makes it suitable for single-node
+// deployments and tests.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	buffer int
+	closed bool
+}
+
+// Subscription receives events published on a Bus
+type Subscription struct {
+	bus     *Bus
+	ch      chan Event
+	types   []Type
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// NewBus creates a new Bus whose subscriptions buffer up to buffer events
+func NewBus(buffer int) *Bus {
+	return &Bus{
+		subs:   make(map[*Subscription]struct{}),
+		buffer: max(buffer, 0),
+	}
+}
+
+// Publish delivers the event to every matching subscriber. Delivery never
+// blocks: events are dropped for subscribers whose buffer is full.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+
+	for sub := range b.subs {
+		if !sub.matches(event.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			slog.Warn("event dropped for slow subscriber",
+				slog.String("type", string(event.Type)),
+				slog.Int64("user_id", event.UserID))
+		}
+	}
+
+	return nil
+}
+
+// Subscribe registers a subscriber for the given event types, or for all
+// events when no types are given
+func (b *Bus) Subscribe(types ...Type) *Subscription {
+	sub := &Subscription{
+		bus:   b,
+		ch:    make(chan Event, b.buffer),
+		types: types,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		sub.once.Do(func() { close(sub.ch) })
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Err returns ErrBusClosed once the bus is closed, nil before
+func (b *Bus) Err() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+	return nil
+}
+
+// Close unsubscribes every subscriber and rejects further publishes
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		sub.once.Do(func() { close(sub.ch) })
+	}
+
+	return nil
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription or the bus is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes from the bus
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	delete(s.bus.subs, s)
+	s.once.Do(func() { close(s.ch) })
+}
+
+func (s *Subscription) matches(t Type) bool {
+	return len(s.types) == 0 || slices.Contains(s.types, t)
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should deliver events to matching subscribers", func(t *testing.T) {
+		bus := NewBus(4)
+		all := bus.Subscribe()
+		deletes := bus.Subscribe(UserDeleted)
+
+		bus.Publish(ctx, Event{Type: UserCreated, UserID: 1})
+		bus.Publish(ctx, Event{Type: UserDeleted, UserID: 1})
+
+		if got := len(all.Events()); got != 2 {
+			t.Errorf("expected 2 events, got %d", got)
+		}
+		if got := len(deletes.Events()); got != 1 {
+			t.Errorf("expected 1 event, got %d", got)
+		}
+		if event := <-deletes.Events(); event.Type != UserDeleted {
+			t.Errorf("expected %s, got %s", UserDeleted, event.Type)
+		}
+	})
+
+	t.Run("should drop events when the buffer is full", func(t *testing.T) {
+		bus := NewBus(1)
+		sub := bus.Subscribe()
+
+		bus.Publish(ctx, Event{Type: UserCreated, UserID: 1})
+		bus.Publish(ctx, Event{Type: UserCreated, UserID: 2})
+
+		if sub.Dropped() != 1 {
+			t.Errorf("expected 1 dropped event, got %d", sub.Dropped())
+		}
+	})
+
+	t.Run("should close subscriptions when closed", func(t *testing.T) {
+		bus := NewBus(1)
+		sub := bus.Subscribe()
+		bus.Close()
+
+		if _, ok := <-sub.Events(); ok {
+			t.Error("expected subscription channel to be closed")
+		}
+		if err := bus.Publish(ctx, Event{Type: UserCreated}); !errors.Is(err, ErrBusClosed) {
+			t.Errorf("expected ErrBusClosed, got %v", err)
+		}
+		sub.Close()
+	})
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// Type identifies the kind of domain event
+type Type string
+
+const (
+	UserCreated  Type = "user.created"
+	UserUpdated  Type = "user.updated"
+	UserDeleted  Type = "user.deleted"
+	UserRestored Type = "user.restored"
+	// UserMerged is raised for the source of MergeUsers, which was deleted
+	// after being folded into the user MergedInto
+	UserMerged Type = "user.merged"
+)
+
+// Event describes a change to a user. User is nil for deletions and merges.
+type Event struct {
+	Type       Type        `json:"type"`
+	UserID     int64       `json:"user_id"`
+	User       *model.User `json:"user,omitempty"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	// Replay marks events re-emitted from the user history rather than
+	// produced by a live change
+	Replay bool `json:"replay,omitempty"`
+	// MergedInto is the user a merged user was folded into
+	MergedInto int64 `json:"merged_into,omitempty"`
+}
+
+// Publisher delivers domain events to interested consumers
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Subscriber hands out subscriptions to published events
+type Subscriber interface {
+	Subscribe(types ...Type) *Subscription
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/schemaregistry"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// UserEventSchema is the registered schema of serialized events. It must be
+// kept identical to api/proto/events.proto.
+const UserEventSchema = `syntax = "proto3";
+
+package user;
+
+option go_package = "github.com/davidbadelllab/go-microservice-grpc-2023/proto";
+
+// UserEvent is the payload of user domain events published to Kafka. The
+// file is self-contained so that it registers with the schema registry as a
+// single subject without references; UserEvent must stay the first message.
+message UserEvent {
+  // user.created, user.updated, user.deleted, user.restored or user.merged
+  string type = 1;
+  int64 user_id = 2;
+  // Unix timestamp in milliseconds
+  int64 occurred_at = 3;
+  // Unset for deletions and merges
+  UserSnapshot user = 4;
+  // Set for events re-emitted from the user history
+  bool replay = 5;
+  // For user.merged, the user the merged user was folded into
+  int64 merged_into = 6;
+}
+
+message UserSnapshot {
+  int64 id = 1;
+  string email = 2;
+  string name = 3;
+  int64 created_at = 4;
+  int64 updated_at = 5;
+  string uuid = 6;
+  // Set for guests, whose email is a placeholder
+  bool guest = 7;
+}
+`
+
+// ErrIncompatibleSchema is returned when the event schema would break
+// consumers of the subject's latest registered version
+var ErrIncompatibleSchema = errors.New("event schema is incompatible with the registered subject")
+
+// userEventIndex is the message index path of UserEvent in UserEventSchema
+var userEventIndex = []int{0}
+
+// Serializer encodes events as protobuf in the Confluent wire format so
+// schema-registry-aware consumers such as Kafka Connect and ksqlDB can decode
+// them
+type Serializer struct {
+	schemaID int
+}
+
+// NewSerializer checks UserEventSchema against the latest version of subject
+// and resolves its schema ID. With autoRegister the schema is registered as a
+// new version when missing; otherwise it must already be registered.
+func NewSerializer(ctx context.Context, registry *schemaregistry.Client, subject string, autoRegister bool) (*Serializer, error) {
+	compatible, err := registry.Compatible(ctx, subject, UserEventSchema)
+	if err != nil {
+		return nil, err
+	}
+	if !compatible {
+		return nil, fmt.Errorf("%w: %s", ErrIncompatibleSchema, subject)
+	}
+
+	var id int
+	if autoRegister {
+		id, err = registry.Register(ctx, subject, UserEventSchema)
+	} else {
+		id, err = registry.Lookup(ctx, subject, UserEventSchema)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Serializer{schemaID: id}, nil
+}
+
+// SchemaID returns the registry ID prefixed to every payload
+func (s *Serializer) SchemaID() int {
+	return s.schemaID
+}
+
+// Serialize encodes the event as a schema-ID-prefixed UserEvent
+func (s *Serializer) Serialize(event Event) ([]byte, error) {
+	payload, err := proto.Marshal(toProtoEvent(event))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	return schemaregistry.FrameProtobuf(s.schemaID, userEventIndex, payload), nil
+}
+
+func toProtoEvent(event Event) *pb.UserEvent {
+	msg := &pb.UserEvent{
+		Type:       string(event.Type),
+		UserId:     event.UserID,
+		OccurredAt: event.OccurredAt.UnixMilli(),
+		Replay:     event.Replay,
+		MergedInto: event.MergedInto,
+	}
+	if event.User != nil {
+		msg.User = &pb.UserSnapshot{
+			Id:        event.User.ID,
+			Uuid:      event.User.UUID,
+			Email:     event.User.Email,
+			Name:      event.User.Name,
+			CreatedAt: event.User.CreatedAt.Unix(),
+			UpdatedAt: event.User.UpdatedAt.Unix(),
+			Guest:     event.User.Guest,
+		}
+	}
+	return msg
+}
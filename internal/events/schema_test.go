@@ -0,0 +1,56 @@
+package events
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/schemaregistry"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+func TestUserEventSchema(t *testing.T) {
+	t.Run("matches the proto definition", func(t *testing.T) {
+		data, err := os.ReadFile("../../api/proto/events.proto")
+		if err != nil {
+			t.Fatalf("failed to read events.proto: %v", err)
+		}
+		if string(data) != UserEventSchema {
+			t.Error("UserEventSchema is out of sync with api/proto/events.proto")
+		}
+	})
+
+	t.Run("serialize round trip", func(t *testing.T) {
+		s := &Serializer{schemaID: 12}
+		event := Event{
+			Type:       UserUpdated,
+			UserID:     5,
+			User:       &model.User{ID: 5, Email: "a@example.com", Name: "A"},
+			OccurredAt: time.UnixMilli(1700000000123),
+		}
+
+		data, err := s.Serialize(event)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		id, _, payload, err := schemaregistry.UnframeProtobuf(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id != 12 {
+			t.Errorf("expected schema id 12, got %d", id)
+		}
+
+		var msg pb.UserEvent
+		if err := proto.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if msg.Type != "user.updated" || msg.OccurredAt != 1700000000123 || msg.User.GetEmail() != "a@example.com" {
+			t.Errorf("unexpected message: %v", &msg)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+// Package heartbeat records when the server last completed a roundtrip to
+// each of its dependencies, and can restart the process when it stops doing
+// so
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// Check performs one roundtrip to a dependency
+type Check func(ctx context.Context) error
+
+type target struct {
+	name  string
+	check Check
+}
+
+// Heartbeat probes its targets on every run and exports the time of the last
+// run and of the last successful roundtrip to each target. It is a
+// prometheus.Collector and is meant to run as a periodic job.
+type Heartbeat struct {
+	clock     clock.Clock
+	timeout   time.Duration
+	startedAt time.Time
+	targets   []target
+
+	mu          sync.RWMutex
+	lastBeat    time.Time
+	lastSuccess map[string]time.Time
+
+	beat        prometheus.Gauge
+	success     *prometheus.GaugeVec
+	uptime      prometheus.GaugeFunc
+	probeErrors *prometheus.CounterVec
+}
+
+// New creates a Heartbeat giving each roundtrip up to timeout
+func New(timeout time.Duration, clk clock.Clock) *Heartbeat {
+	h := &Heartbeat{
+		clock:       clk,
+		timeout:     timeout,
+		startedAt:   clk.Now(),
+		lastSuccess: make(map[string]time.Time),
+		beat: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "heartbeat_last_beat_timestamp_seconds",
+			Help: "Unix time of the last heartbeat",
+		}),
+		success: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "heartbeat_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful roundtrip to each dependency",
+		}, []string{"target"}),
+		probeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "heartbeat_errors_total",
+			Help: "Number of failed roundtrips to each dependency",
+		}, []string{"target"}),
+	}
+	h.lastBeat = h.startedAt
+	h.uptime = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "heartbeat_uptime_seconds",
+		Help: "Seconds since the server started",
+	}, func() float64 {
+		return h.clock.Now().Sub(h.startedAt).Seconds()
+	})
+	return h
+}
+
+// Add registers a target. Until its first successful roundtrip, a target is
+// considered to have succeeded at startup. Targets must all be added before
+// the heartbeat runs.
+func (h *Heartbeat) Add(name string, check Check) {
+	h.targets = append(h.targets, target{name: name, check: check})
+	h.lastSuccess[name] = h.startedAt
+}
+
+// Run performs one heartbeat, probing every target in turn
+func (h *Heartbeat) Run(ctx context.Context) error {
+	now := h.clock.Now()
+	h.mu.Lock()
+	h.lastBeat = now
+	h.mu.Unlock()
+	h.beat.Set(float64(now.Unix()))
+
+	var errs []error
+	for _, t := range h.targets {
+		if err := h.probe(ctx, t); err != nil {
+			h.probeErrors.WithLabelValues(t.name).Inc()
+			errs = append(errs, fmt.Errorf("heartbeat to %s failed: %w", t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *Heartbeat) probe(ctx context.Context, t target) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	if err := t.check(ctx); err != nil {
+		return err
+	}
+
+	now := h.clock.Now()
+	h.mu.Lock()
+	h.lastSuccess[t.name] = now
+	h.mu.Unlock()
+	h.success.WithLabelValues(t.name).Set(float64(now.Unix()))
+	return nil
+}
+
+// LastBeat returns the time of the last heartbeat, or the start time before
+// the first one
+func (h *Heartbeat) LastBeat() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lastBeat
+}
+
+// LastSuccess returns the time of the last successful roundtrip to the named
+// target
+func (h *Heartbeat) LastSuccess(name string) (time.Time, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	at, ok := h.lastSuccess[name]
+	return at, ok
+}
+
+// Describe implements prometheus.Collector
+func (h *Heartbeat) Describe(ch chan<- *prometheus.Desc) {
+	h.beat.Describe(ch)
+	h.success.Describe(ch)
+	h.uptime.Describe(ch)
+	h.probeErrors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (h *Heartbeat) Collect(ch chan<- prometheus.Metric) {
+	h.beat.Collect(ch)
+	h.success.Collect(ch)
+	h.uptime.Collect(ch)
+	h.probeErrors.Collect(ch)
+}
@@ -0,0 +1,62 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+func TestWatchdog(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var dbErr error
+
+	hb := New(time.Second, clk)
+	hb.Add("db", func(context.Context) error { return dbErr })
+	hb.Add("cache", func(context.Context) error { return errors.New("down") })
+
+	var reason string
+	w := NewWatchdog(hb, time.Minute, clk, func(r string) { reason = r }, "db")
+
+	t.Run("healthy heartbeat does not exit", func(t *testing.T) {
+		clk.Advance(30 * time.Second)
+		hb.Run(context.Background())
+		clk.Advance(50 * time.Second)
+		w.Run(context.Background())
+		if reason != "" {
+			t.Errorf("expected no exit, got %q", reason)
+		}
+	})
+
+	t.Run("unwatched failing target does not exit", func(t *testing.T) {
+		if last, _ := hb.LastSuccess("cache"); !last.Equal(hb.startedAt) {
+			t.Errorf("expected cache to keep its start time, got %v", last)
+		}
+		if reason != "" {
+			t.Errorf("expected no exit, got %q", reason)
+		}
+	})
+
+	t.Run("failing watched target exits", func(t *testing.T) {
+		dbErr = errors.New("pool exhausted")
+		hb.Run(context.Background())
+		clk.Advance(time.Minute)
+		w.Run(context.Background())
+		if reason != "no successful db roundtrip for 1m50s" {
+			t.Errorf("unexpected reason %q", reason)
+		}
+	})
+
+	t.Run("stalled heartbeat exits", func(t *testing.T) {
+		reason = ""
+		dbErr = nil
+		hb.Run(context.Background())
+		clk.Advance(2 * time.Minute)
+		w.Run(context.Background())
+		if reason != "no heartbeat for 2m0s" {
+			t.Errorf("unexpected reason %q", reason)
+		}
+	})
+}
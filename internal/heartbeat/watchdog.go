@@ -0,0 +1,63 @@
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// Watchdog exits the process when the heartbeat stops beating or a watched
+// target has not answered for longer than the threshold, on the assumption
+// that a restart recovers faster than waiting. It must run on a goroutine of
+// its own rather than after the heartbeat, or a wedged heartbeat would also
+// stop the watchdog.
+type Watchdog struct {
+	heartbeat *Heartbeat
+	threshold time.Duration
+	targets   []string
+	clock     clock.Clock
+	exit      func(reason string)
+}
+
+// NewWatchdog creates a Watchdog over the named targets of heartbeat. exit is
+// called once a stall is detected and is expected not to return.
+func NewWatchdog(heartbeat *Heartbeat, threshold time.Duration, clk clock.Clock, exit func(reason string), targets ...string) *Watchdog {
+	return &Watchdog{
+		heartbeat: heartbeat,
+		threshold: threshold,
+		targets:   targets,
+		clock:     clk,
+		exit:      exit,
+	}
+}
+
+// Run checks the heartbeat once, exiting when it is stalled
+func (w *Watchdog) Run(ctx context.Context) error {
+	if reason := w.stall(); reason != "" {
+		slog.Error("watchdog detected a stall, exiting", slog.String("reason", reason))
+		w.exit(reason)
+	}
+	return nil
+}
+
+// stall describes why the process is considered wedged, or is empty
+func (w *Watchdog) stall() string {
+	now := w.clock.Now()
+
+	if since := now.Sub(w.heartbeat.LastBeat()); since > w.threshold {
+		return fmt.Sprintf("no heartbeat for %s", since.Round(time.Second))
+	}
+	for _, name := range w.targets {
+		last, ok := w.heartbeat.LastSuccess(name)
+		if !ok {
+			continue
+		}
+		if since := now.Sub(last); since > w.threshold {
+			return fmt.Sprintf("no successful %s roundtrip for %s", name, since.Round(time.Second))
+		}
+	}
+	return ""
+}
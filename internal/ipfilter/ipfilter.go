@@ -0,0 +1,156 @@
+// Package ipfilter admits or rejects calls by the address of the client
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+)
+
+// ErrInvalidRules is returned for malformed addresses, ranges or method
+// patterns
+var ErrInvalidRules = errors.New("invalid ip filter rules")
+
+// Reasons for rejecting a call
+const (
+	Denied     = "denied"
+	NotAllowed = "not_allowed"
+)
+
+// Rules declare which client addresses may call which methods. Ranges are
+// CIDR prefixes such as "10.8.0.0/16" or single addresses.
+type Rules struct {
+	// Deny lists the ranges rejected on every method
+	Deny []string
+	// Allow lists the only ranges admitted to Methods; empty admits all
+	Allow []string
+	// Methods are the method patterns, in the syntax of authz policies,
+	// restricted to Allow
+	Methods []string
+	// TrustedProxies are the ranges of proxies whose x-forwarded-for header
+	// is believed
+	TrustedProxies []string
+}
+
+// Filter enforces Rules. It implements prometheus.Collector.
+type Filter struct {
+	deny           []netip.Prefix
+	allow          []netip.Prefix
+	methods        []string
+	trustedProxies []netip.Prefix
+	rejected       *prometheus.CounterVec
+}
+
+// New creates a Filter enforcing r
+func New(r Rules) (*Filter, error) {
+	deny, err := parsePrefixes(r.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("%w: deny: %v", ErrInvalidRules, err)
+	}
+	allow, err := parsePrefixes(r.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("%w: allow: %v", ErrInvalidRules, err)
+	}
+	trustedProxies, err := parsePrefixes(r.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("%w: trusted proxies: %v", ErrInvalidRules, err)
+	}
+	if err := authz.CheckPatterns(r.Methods); err != nil {
+		return nil, fmt.Errorf("%w: methods: %v", ErrInvalidRules, err)
+	}
+
+	return &Filter{
+		deny:           deny,
+		allow:          allow,
+		methods:        r.Methods,
+		trustedProxies: trustedProxies,
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ip_filter_rejected_total",
+			Help: "Number of calls rejected for the address of the client",
+		}, []string{"method", "reason"}),
+	}, nil
+}
+
+// ClientAddr returns the address of the client behind peer. The
+// x-forwarded-for values are walked from the right only while the hop that
+// appended them is a trusted proxy, so clients cannot spoof their address.
+func (f *Filter) ClientAddr(peer netip.Addr, forwardedFor []string) netip.Addr {
+	var hops []string
+	for _, v := range forwardedFor {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	addr := peer
+	for i := len(hops) - 1; i >= 0 && contains(f.trustedProxies, addr); i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr
+}
+
+// Check reports whether a client at addr may call method, and otherwise
+// counts the rejection and returns its reason. Invalid addresses, e.g. of
+// calls not made over the network, are only rejected by allowlists.
+func (f *Filter) Check(method string, addr netip.Addr) (bool, string) {
+	addr = addr.Unmap()
+	reason := ""
+	switch {
+	case contains(f.deny, addr):
+		reason = Denied
+	case len(f.allow) > 0 && authz.MatchAny(f.methods, method) && !contains(f.allow, addr):
+		reason = NotAllowed
+	default:
+		return true, ""
+	}
+
+	f.rejected.WithLabelValues(method, reason).Inc()
+	return false, reason
+}
+
+// Describe implements prometheus.Collector
+func (f *Filter) Describe(ch chan<- *prometheus.Desc) {
+	f.rejected.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (f *Filter) Collect(ch chan<- prometheus.Metric) {
+	f.rejected.Collect(ch)
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an address nor a CIDR range", v)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
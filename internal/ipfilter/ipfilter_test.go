@@ -0,0 +1,55 @@
+package ipfilter
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := New(Rules{
+		Deny:           []string{"203.0.113.7"},
+		Allow:          []string{"10.8.0.0/16"},
+		Methods:        []string{"/user.UserService/PurgeUser"},
+		TrustedProxies: []string{"192.168.1.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vpn := netip.MustParseAddr("10.8.3.4")
+	office := netip.MustParseAddr("198.51.100.1")
+
+	t.Run("allowlist restricts its methods only", func(t *testing.T) {
+		if ok, _ := f.Check("/user.UserService/PurgeUser", vpn); !ok {
+			t.Error("expected the VPN to purge users")
+		}
+		if ok, reason := f.Check("/user.UserService/PurgeUser", office); ok || reason != NotAllowed {
+			t.Errorf("expected %s, got %v %q", NotAllowed, ok, reason)
+		}
+		if ok, _ := f.Check("/user.UserService/GetUser", office); !ok {
+			t.Error("expected other methods to stay open")
+		}
+	})
+
+	t.Run("denylist applies everywhere", func(t *testing.T) {
+		if ok, reason := f.Check("/user.UserService/GetUser", netip.MustParseAddr("203.0.113.7")); ok || reason != Denied {
+			t.Errorf("expected %s, got %v %q", Denied, ok, reason)
+		}
+	})
+
+	t.Run("forwarded addresses need a trusted proxy", func(t *testing.T) {
+		proxy := netip.MustParseAddr("192.168.1.10")
+		if got := f.ClientAddr(proxy, []string{"1.2.3.4, 10.8.3.4"}); got != vpn {
+			t.Errorf("expected %s, got %s", vpn, got)
+		}
+		if got := f.ClientAddr(office, []string{"10.8.3.4"}); got != office {
+			t.Errorf("expected the header of untrusted peers to be ignored, got %s", got)
+		}
+	})
+
+	t.Run("rejects malformed ranges", func(t *testing.T) {
+		if _, err := New(Rules{Allow: []string{"10.8.0.0/33"}}); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("expected ErrInvalidRules, got %v", err)
+		}
+	})
+}
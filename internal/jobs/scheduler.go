@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// Job is a unit of background work executed on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered jobs periodically until stopped
+type Scheduler struct {
+	clock  clock.Clock
+	jobs   []Job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a new Scheduler instance
+func NewScheduler(clk clock.Clock) *Scheduler {
+	return &Scheduler{clock: clk}
+}
+
+// Add registers a job; jobs with a non-positive interval are ignored
+func (s *Scheduler) Add(job Job) {
+	if job.Interval <= 0 {
+		slog.Info("job disabled", slog.String("job", job.Name))
+		return
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Start launches every registered job in its own goroutine
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Stop cancels all running jobs and waits for them to return
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := s.clock.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	slog.Info("job scheduled",
+		slog.String("job", job.Name),
+		slog.Duration("interval", job.Interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			start := s.clock.Now()
+			if err := job.Run(ctx); err != nil {
+				slog.Error("job failed",
+					slog.String("job", job.Name),
+					slog.String("error", err.Error()))
+				continue
+			}
+			slog.Debug("job completed",
+				slog.String("job", job.Name),
+				slog.Duration("duration", s.clock.Now().Sub(start)))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Run("runs jobs on every interval", func(t *testing.T) {
+		clk := clock.NewFake(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC))
+		runs := make(chan time.Time, 10)
+
+		s := NewScheduler(clk)
+		s.Add(Job{
+			Name:     "retention",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				runs <- clk.Now()
+				return nil
+			},
+		})
+		s.Add(Job{Name: "disabled", Interval: 0})
+		s.Start(context.Background())
+		defer s.Stop()
+
+		clk.WaitForTickers(1)
+		for i := 1; i <= 2; i++ {
+			clk.Advance(time.Hour)
+			select {
+			case at := <-runs:
+				if want := time.Date(2026, 10, 16, i, 0, 0, 0, time.UTC); !at.Equal(want) {
+					t.Errorf("run %d: expected %s, got %s", i, want, at)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("run %d: job did not run", i)
+			}
+		}
+	})
+}
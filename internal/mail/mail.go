@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// ErrInvalidHeader is returned for recipients or subjects containing line breaks
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email messages
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender logs messages instead of delivering them, for local development
+type LogSender struct{}
+
+// Send implements Sender
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "mail not delivered, no SMTP server configured",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject))
+	slog.DebugContext(ctx, "mail body", slog.String("body", msg.Body))
+	return nil
+}
+
+// SMTPSender delivers messages through an SMTP relay
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSender creates a new SMTPSender instance. PLAIN authentication is
+// used when a username is given.
+func NewSMTPSender(addr, username, password, from string) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPSender{
+		addr: addr,
+		from: from,
+		auth: auth,
+	}
+}
+
+// Send implements Sender
+func (s *SMTPSender) Send(_ context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// Package mapper converts between domain models and their protobuf
+// representations
+package mapper
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// User converts a domain user into its protobuf representation
+func User(user *model.User) *pb.User {
+	return &pb.User{
+		Id:        user.ID,
+		Uuid:      user.UUID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Metadata:  user.Metadata,
+		AvatarUrl: user.AvatarURL,
+		Timezone:  user.Timezone,
+		Locale:    user.Locale,
+		CreatedAt: Timestamp(user.CreatedAt),
+		UpdatedAt: Timestamp(user.UpdatedAt),
+		Guest:     user.Guest,
+	}
+}
+
+// Users converts domain users into their protobuf representation
+func Users(users []*model.User) []*pb.User {
+	pbUsers := make([]*pb.User, len(users))
+	for i, user := range users {
+		pbUsers[i] = User(user)
+	}
+	return pbUsers
+}
+
+// Timestamp converts t into a protobuf timestamp, leaving the zero time unset
+func Timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// Time converts a protobuf timestamp into a time, mapping unset to the zero time
+func Time(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,25 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+func TestUser(t *testing.T) {
+	t.Run("converts timestamps", func(t *testing.T) {
+		created := time.Date(2026, 10, 16, 12, 30, 0, 500, time.UTC)
+		u := User(&model.User{ID: 1, Email: "jane@example.com", Name: "Jane", CreatedAt: created})
+
+		if !Time(u.CreatedAt).Equal(created) {
+			t.Errorf("expected %s, got %s", created, Time(u.CreatedAt))
+		}
+		if u.UpdatedAt != nil {
+			t.Errorf("expected zero updated_at to be unset, got %v", u.UpdatedAt)
+		}
+		if !Time(nil).IsZero() {
+			t.Error("expected unset timestamp to map to the zero time")
+		}
+	})
+}
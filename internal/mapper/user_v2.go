@@ -0,0 +1,29 @@
+package mapper
+
+import (
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+// UserV2 converts a domain user into its v2 protobuf representation. The
+// service only hands out users that are not deleted.
+func UserV2(user *model.User) *userv2.User {
+	return &userv2.User{
+		Id:         user.ID,
+		Uuid:       user.UUID,
+		Email:      user.Email,
+		Name:       user.Name,
+		Status:     userv2.UserStatus_USER_STATUS_ACTIVE,
+		CreateTime: Timestamp(user.CreatedAt),
+		UpdateTime: Timestamp(user.UpdatedAt),
+	}
+}
+
+// UsersV2 converts domain users into their v2 protobuf representation
+func UsersV2(users []*model.User) []*userv2.User {
+	pbUsers := make([]*userv2.User, len(users))
+	for i, user := range users {
+		pbUsers[i] = UserV2(user)
+	}
+	return pbUsers
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// APIKey is a static credential of a service-to-service caller. The key
+// itself is only known to the caller; the service keeps its hash.
+type APIKey struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Subject is the caller identity requests made with the key run as
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+	// Prefix is the start of the key, shown to tell keys apart
+	Prefix string `json:"prefix"`
+	// RateLimit is the requests per minute allowed to the key; 0 applies
+	// the default limit
+	RateLimit int        `json:"rate_limit"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
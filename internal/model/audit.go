@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// AuditEvent records one call of a mutating RPC
+type AuditEvent struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+	// Actor is the authenticated subject of the caller
+	Actor string `json:"actor"`
+	// Impersonator is the subject acting as Actor with an impersonation
+	// token; empty otherwise
+	Impersonator string `json:"impersonator,omitempty"`
+	// TargetUserID is the user the call acted on, or nil
+	TargetUserID *int64 `json:"target_user_id,omitempty"`
+	// Code is the gRPC status code the call returned, e.g. OK
+	Code string `json:"code"`
+	// Diff maps the fields of the target user changed by the call to their
+	// values before and after it
+	Diff      map[string]AuditChange `json:"diff,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditChange is the value of a field before and after a call; nil when
+// the user did not exist
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter restricts a listing of audit events. Zero fields match
+// every event.
+type AuditFilter struct {
+	Actor        string
+	Impersonator string
+	Method       string
+	TargetUserID int64
+	From         time.Time
+	To           time.Time
+}
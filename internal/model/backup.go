@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// BackupStatus is the lifecycle state of a logical backup
+type BackupStatus string
+
+const (
+	BackupStatusRunning   BackupStatus = "running"
+	BackupStatusCompleted BackupStatus = "completed"
+	BackupStatusFailed    BackupStatus = "failed"
+)
+
+// VerifyStatus is the outcome of a restore verification
+type VerifyStatus string
+
+const (
+	VerifyStatusPassed VerifyStatus = "passed"
+	VerifyStatusFailed VerifyStatus = "failed"
+)
+
+// Backup is the metadata of a logical dump stored in object storage
+type Backup struct {
+	ID           int64            `json:"id"`
+	ObjectKey    string           `json:"object_key"`
+	Status       BackupStatus     `json:"status"`
+	RowCounts    map[string]int64 `json:"row_counts"`
+	SizeBytes    int64            `json:"size_bytes"`
+	Error        string           `json:"error,omitempty"`
+	StartedAt    time.Time        `json:"started_at"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+	VerifyStatus VerifyStatus     `json:"verify_status,omitempty"`
+	VerifyError  string           `json:"verify_error,omitempty"`
+	VerifiedAt   *time.Time       `json:"verified_at,omitempty"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// InvitationStatus is the lifecycle state of an invitation
+type InvitationStatus string
+
+const (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+)
+
+// Invitation is a pending user invited by an existing caller
+type Invitation struct {
+	ID           int64            `json:"id"`
+	Email        string           `json:"email"`
+	Name         string           `json:"name"`
+	InvitedBy    string           `json:"invited_by"`
+	Status       InvitationStatus `json:"status"`
+	TokenVersion int              `json:"-"`
+	SendCount    int              `json:"send_count"`
+	UserID       *int64           `json:"user_id,omitempty"`
+	ExpiresAt    time.Time        `json:"expires_at"`
+	CreatedAt    time.Time        `json:"created_at"`
+	AcceptedAt   *time.Time       `json:"accepted_at,omitempty"`
+}
+
+// Expired reports whether the invitation can no longer be accepted
+func (i *Invitation) Expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// OrgRole is the role of a user within an organization
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"
+	OrgRoleAdmin  OrgRole = "admin"
+	OrgRoleMember OrgRole = "member"
+)
+
+// Valid reports whether r is a known role
+func (r OrgRole) Valid() bool {
+	switch r {
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
+// Organization is a workspace that users belong to
+type Organization struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	// DefaultTimezone and DefaultLocale are given to joining members that
+	// have none; empty when the organization sets no default
+	DefaultTimezone string    `json:"default_timezone,omitempty"`
+	DefaultLocale   string    `json:"default_locale,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Membership is a user's role within an organization
+type Membership struct {
+	OrganizationID int64     `json:"organization_id"`
+	UserID         int64     `json:"user_id"`
+	Role           OrgRole   `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
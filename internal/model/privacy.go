@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// ErasureStatus is the lifecycle state of an erasure request
+type ErasureStatus string
+
+const (
+	ErasureStatusPending   ErasureStatus = "pending"
+	ErasureStatusCompleted ErasureStatus = "completed"
+)
+
+// ErasureRequest queues the erasure of a user's personal data
+type ErasureRequest struct {
+	ID     int64         `json:"id"`
+	UserID int64         `json:"user_id"`
+	Status ErasureStatus `json:"status"`
+	// RequestedBy is the authenticated subject that asked for the erasure
+	RequestedBy string `json:"requested_by"`
+	// Attempts counts the runs of the erasure so far and LastError holds
+	// why the latest failed one did
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// UserDataExport holds everything stored about a user, for handing it over
+// to them on request
+type UserDataExport struct {
+	User        *User               `json:"user"`
+	DeletedAt   *time.Time          `json:"deleted_at,omitempty"`
+	History     []*UserHistoryEntry `json:"history"`
+	Memberships []*Membership       `json:"memberships"`
+	Sessions    []*Session          `json:"sessions"`
+	Invitations []*Invitation       `json:"invitations"`
+	// AuditEvents are the recorded calls acting on the user or made by them
+	AuditEvents []*AuditEvent `json:"audit_events"`
+	ExportedAt  time.Time     `json:"exported_at"`
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// PendingRegistration is a self-registration awaiting email verification
+type PendingRegistration struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// ReportStatus is the lifecycle state of a user report
+type ReportStatus string
+
+const (
+	ReportStatusPending   ReportStatus = "pending"
+	ReportStatusCompleted ReportStatus = "completed"
+	// ReportStatusFailed marks reports given up on after too many attempts
+	ReportStatusFailed ReportStatus = "failed"
+)
+
+// UserReport is a spreadsheet of the users matching a filter, generated in
+// the background and stored in object storage
+type UserReport struct {
+	ID     int64        `json:"id"`
+	Format string       `json:"format"`
+	Status ReportStatus `json:"status"`
+	// RequestedBy is the authenticated subject that asked for the report
+	RequestedBy string `json:"requested_by"`
+	// Attempts counts the runs of the report so far and LastError holds
+	// why the latest failed one did
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// ObjectKey locates the file in the report store once completed
+	ObjectKey   string     `json:"object_key,omitempty"`
+	Rows        int64      `json:"rows"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
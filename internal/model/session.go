@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Session is a login of a user. It is kept alive by exchanging its refresh
+// token, which the service only stores a hash of, for new access tokens.
+type Session struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// UsageRecord is the resource consumption of one caller during one hour
+type UsageRecord struct {
+	Caller   string    `json:"caller"`
+	Hour     time.Time `json:"hour"`
+	Requests int64     `json:"requests"`
+	DBTimeMs int64     `json:"db_time_ms"`
+	CacheOps int64     `json:"cache_ops"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+}
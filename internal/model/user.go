@@ -4,9 +4,21 @@ import "time"
 
 // User represents a user in the system
 type User struct {
-	ID        int64     `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
+	ID    int64  `json:"id"`
+	UUID  string `json:"uuid"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// Metadata holds arbitrary attributes set by clients
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// AvatarURL locates the uploaded avatar; empty when there is none
+	AvatarURL string `json:"avatar_url,omitempty"`
+	// Timezone is an IANA time zone name and Locale a BCP 47 tag; empty
+	// when unknown
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	// Guest marks users created without an email, holding a placeholder
+	// one until they are upgraded
+	Guest     bool      `json:"guest,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
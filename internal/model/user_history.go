@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// HistoryOperation identifies the kind of change recorded in the user history
+type HistoryOperation string
+
+const (
+	HistoryOperationCreate  HistoryOperation = "create"
+	HistoryOperationUpdate  HistoryOperation = "update"
+	HistoryOperationDelete  HistoryOperation = "delete"
+	HistoryOperationRestore HistoryOperation = "restore"
+)
+
+// UserHistoryEntry is a snapshot of a user as it was after a change
+type UserHistoryEntry struct {
+	Version   int64             `json:"version"`
+	UserID    int64             `json:"user_id"`
+	UserUUID  string            `json:"user_uuid,omitempty"`
+	Operation HistoryOperation  `json:"operation"`
+	Email     string            `json:"email"`
+	Name      string            `json:"name"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	ChangedAt time.Time         `json:"changed_at"`
+
+	// TxID is the transaction that recorded the change, ordering differential sync
+	TxID int64 `json:"-"`
+}
@@ -0,0 +1,217 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maintenanceLockKey ensures only one replica changes partitions at a time
+const maintenanceLockKey = 0x70_61_72_74 // "part"
+
+// nameLayout is the suffix of monthly partition names, e.g. users_history_p202610
+const nameLayout = "200601"
+
+// errLocked is returned internally when another process holds the lock
+var errLocked = errors.New("partition maintenance locked by another process")
+
+// Maintainer keeps a table range-partitioned by month: it creates partitions
+// ahead of time so rows never land in the default partition, and drops
+// partitions that fall entirely outside the retention window
+type Maintainer struct {
+	db    beginner
+	table string
+	ahead int
+}
+
+// beginner starts transactions; *pgxpool.Pool in production
+type beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// NewMaintainer creates a Maintainer keeping ahead months of partitions of
+// table ready beyond the current one
+func NewMaintainer(db *pgxpool.Pool, table string, ahead int) *Maintainer {
+	return &Maintainer{
+		db:    db,
+		table: table,
+		ahead: max(ahead, 1),
+	}
+}
+
+// Run creates missing partitions unless another replica is already doing so
+func (m *Maintainer) Run(ctx context.Context) error {
+	_, err := m.Ensure(ctx, time.Now())
+	if errors.Is(err, errLocked) {
+		slog.Info("partition maintenance skipped, already running elsewhere")
+		return nil
+	}
+	return err
+}
+
+// Ensure creates the partitions for the month of now and the following
+// months that do not exist yet, returning their names. Tables that are not
+// partitioned are left alone.
+func (m *Maintainer) Ensure(ctx context.Context, now time.Time) ([]string, error) {
+	var created []string
+	err := m.locked(ctx, func(tx pgx.Tx) error {
+		existing, err := m.partitions(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		month := monthStart(now)
+		for i := 0; i <= m.ahead; i++ {
+			from, to := month.AddDate(0, i, 0), month.AddDate(0, i+1, 0)
+			name := partitionName(m.table, from)
+			if _, ok := existing[name]; ok {
+				continue
+			}
+
+			sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+				pgx.Identifier{name}.Sanitize(), pgx.Identifier{m.table}.Sanitize(),
+				from.Format(time.RFC3339), to.Format(time.RFC3339))
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return fmt.Errorf("failed to create partition %s: %w", name, err)
+			}
+			created = append(created, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(created) > 0 {
+		slog.Info("partitions created",
+			slog.String("table", m.table),
+			slog.Any("partitions", created))
+	}
+
+	return created, nil
+}
+
+// DropBefore drops the monthly partitions holding only rows older than
+// cutoff, returning their names. Rows of the partition containing cutoff are
+// left for row-level pruning.
+func (m *Maintainer) DropBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	var dropped []string
+	err := m.locked(ctx, func(tx pgx.Tx) error {
+		existing, err := m.partitions(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for name, month := range existing {
+			if month.AddDate(0, 1, 0).After(cutoff) {
+				continue
+			}
+			if _, err := tx.Exec(ctx, "DROP TABLE IF EXISTS "+pgx.Identifier{name}.Sanitize()); err != nil {
+				return fmt.Errorf("failed to drop partition %s: %w", name, err)
+			}
+			dropped = append(dropped, name)
+		}
+		return nil
+	})
+	if errors.Is(err, errLocked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(dropped)
+	if len(dropped) > 0 {
+		slog.Info("partitions dropped",
+			slog.String("table", m.table),
+			slog.Any("partitions", dropped))
+	}
+
+	return dropped, nil
+}
+
+// locked runs fn in a transaction holding the maintenance lock, skipping it
+// when the table is not partitioned
+func (m *Maintainer) locked(ctx context.Context, fn func(pgx.Tx) error) error {
+	return pgx.BeginFunc(ctx, m.db, func(tx pgx.Tx) error {
+		var acquired bool
+		if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", maintenanceLockKey).Scan(&acquired); err != nil {
+			return fmt.Errorf("failed to acquire partition maintenance lock: %w", err)
+		}
+		if !acquired {
+			return errLocked
+		}
+
+		var partitioned bool
+		query := `SELECT EXISTS (SELECT 1 FROM pg_partitioned_table pt JOIN pg_class c ON c.oid = pt.partrelid WHERE c.relname = $1)`
+		if err := tx.QueryRow(ctx, query, m.table).Scan(&partitioned); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", m.table, err)
+		}
+		if !partitioned {
+			slog.Debug("table is not partitioned, skipping maintenance", slog.String("table", m.table))
+			return nil
+		}
+
+		return fn(tx)
+	})
+}
+
+// partitions returns the monthly partitions of the table by name with the
+// month they cover. Partitions not following the naming scheme, such as the
+// default partition, are ignored.
+func (m *Maintainer) partitions(ctx context.Context, tx pgx.Tx) (map[string]time.Time, error) {
+	query := `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = $1
+	`
+
+	rows, err := tx.Query(ctx, query, m.table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	partitions := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan partition: %w", err)
+		}
+		if month, ok := parsePartitionName(m.table, name); ok {
+			partitions[name] = month
+		}
+	}
+
+	return partitions, rows.Err()
+}
+
+func partitionName(table string, month time.Time) string {
+	return table + "_p" + month.Format(nameLayout)
+}
+
+func parsePartitionName(table, name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, table+"_p")
+	if !ok {
+		return time.Time{}, false
+	}
+	month, err := time.Parse(nameLayout, suffix)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,173 @@
+package partition
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB serves the catalog queries of a Maintainer from a set of
+// partitions and records the statements it executes
+type fakeDB struct {
+	partitions  []string
+	partitioned bool
+	locked      bool
+	statements  []string
+}
+
+func (db *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (tx *fakeTx) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	tx.db.statements = append(tx.db.statements, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *fakeTx) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	if strings.Contains(sql, "pg_try_advisory_xact_lock") {
+		return fakeRow{!tx.db.locked}
+	}
+	return fakeRow{tx.db.partitioned}
+}
+
+func (tx *fakeTx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return &fakeRows{names: tx.db.partitions, i: -1}, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error   { return nil }
+func (tx *fakeTx) Rollback(context.Context) error { return nil }
+
+type fakeRow struct{ value bool }
+
+func (r fakeRow) Scan(dest ...any) error {
+	*dest[0].(*bool) = r.value
+	return nil
+}
+
+type fakeRows struct {
+	pgx.Rows
+	names []string
+	i     int
+}
+
+func (r *fakeRows) Next() bool             { r.i++; return r.i < len(r.names) }
+func (r *fakeRows) Scan(dest ...any) error { *dest[0].(*string) = r.names[r.i]; return nil }
+func (r *fakeRows) Err() error             { return nil }
+func (r *fakeRows) Close()                 {}
+
+func TestMaintainer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("creates the missing months with exact bounds", func(t *testing.T) {
+		db := &fakeDB{partitioned: true, partitions: []string{"users_history_default", "users_history_p202611"}}
+		m := &Maintainer{db: db, table: "users_history", ahead: 2}
+
+		created, err := m.Ensure(ctx, time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"users_history_p202610", "users_history_p202612"}; !slices.Equal(created, want) {
+			t.Fatalf("expected %v, got %v", want, created)
+		}
+		want := []string{
+			`CREATE TABLE IF NOT EXISTS "users_history_p202610" PARTITION OF "users_history" FOR VALUES FROM ('2026-10-01T00:00:00Z') TO ('2026-11-01T00:00:00Z')`,
+			`CREATE TABLE IF NOT EXISTS "users_history_p202612" PARTITION OF "users_history" FOR VALUES FROM ('2026-12-01T00:00:00Z') TO ('2027-01-01T00:00:00Z')`,
+		}
+		if !slices.Equal(db.statements, want) {
+			t.Errorf("expected statements\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(db.statements, "\n"))
+		}
+	})
+
+	t.Run("takes months in UTC", func(t *testing.T) {
+		db := &fakeDB{partitioned: true}
+		m := &Maintainer{db: db, table: "users_history", ahead: 1}
+
+		// Still September in New York, already October in UTC
+		created, err := m.Ensure(ctx, time.Date(2026, 9, 30, 21, 0, 0, 0, time.FixedZone("EDT", -4*3600)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"users_history_p202610", "users_history_p202611"}; !slices.Equal(created, want) {
+			t.Errorf("expected %v, got %v", want, created)
+		}
+	})
+
+	t.Run("drops only months ending by the cutoff", func(t *testing.T) {
+		db := &fakeDB{partitioned: true, partitions: []string{"users_history_default", "users_history_p202608", "users_history_p202609", "users_history_p202610"}}
+		m := &Maintainer{db: db, table: "users_history", ahead: 1}
+
+		dropped, err := m.DropBefore(ctx, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"users_history_p202608", "users_history_p202609"}; !slices.Equal(dropped, want) {
+			t.Errorf("expected %v, got %v", want, dropped)
+		}
+
+		db.statements = nil
+		dropped, err = m.DropBefore(ctx, time.Date(2026, 9, 30, 23, 59, 59, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"users_history_p202608"}; !slices.Equal(dropped, want) {
+			t.Errorf("expected %v, got %v", want, dropped)
+		}
+	})
+
+	t.Run("leaves tables that are not partitioned alone", func(t *testing.T) {
+		db := &fakeDB{}
+		m := &Maintainer{db: db, table: "users_history", ahead: 1}
+
+		created, err := m.Ensure(ctx, time.Now())
+		if err != nil || len(created) > 0 || len(db.statements) > 0 {
+			t.Errorf("expected nothing to happen, got %v, %v", created, err)
+		}
+	})
+
+	t.Run("skips while another replica holds the lock", func(t *testing.T) {
+		db := &fakeDB{partitioned: true, locked: true}
+		m := &Maintainer{db: db, table: "users_history", ahead: 1}
+
+		if err := m.Run(ctx); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		dropped, err := m.DropBefore(ctx, time.Now())
+		if err != nil || len(dropped) > 0 || len(db.statements) > 0 {
+			t.Errorf("expected nothing to happen, got %v, %v", dropped, err)
+		}
+	})
+}
+
+func TestPartitionNames(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		month := monthStart(time.Date(2026, 10, 16, 23, 0, 0, 0, time.FixedZone("", -5*3600)))
+		name := partitionName("users_history", month)
+		if name != "users_history_p202610" {
+			t.Fatalf("expected users_history_p202610, got %s", name)
+		}
+
+		parsed, ok := parsePartitionName("users_history", name)
+		if !ok || !parsed.Equal(month) {
+			t.Errorf("expected %s, got %s (ok=%v)", month, parsed, ok)
+		}
+	})
+
+	t.Run("ignores foreign partitions", func(t *testing.T) {
+		for _, name := range []string{"users_history_default", "users_p202610", "users_history_p2026"} {
+			if _, ok := parsePartitionName("users_history", name); ok {
+				t.Errorf("expected %s to be ignored", name)
+			}
+		}
+	})
+}
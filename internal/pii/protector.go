@@ -0,0 +1,65 @@
+package pii
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+)
+
+// Protector tokenizes emails before persistence and reveals them only to
+// privileged callers
+type Protector struct {
+	tokenizer  Tokenizer
+	privileged []string
+}
+
+// NewProtector creates a new Protector; privileged lists the caller
+// subjects allowed to see detokenized values
+func NewProtector(tokenizer Tokenizer, privileged []string) *Protector {
+	return &Protector{
+		tokenizer:  tokenizer,
+		privileged: privileged,
+	}
+}
+
+// Protect returns the value to persist in place of email
+func (p *Protector) Protect(ctx context.Context, email string) (string, error) {
+	token, err := p.tokenizer.Tokenize(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to protect email: %w", err)
+	}
+	return token, nil
+}
+
+// Reveal returns the real email for privileged callers and the stored token
+// for everyone else
+func (p *Protector) Reveal(ctx context.Context, stored string) (string, error) {
+	if !slices.Contains(p.privileged, auth.Subject(ctx)) {
+		return stored, nil
+	}
+
+	email, err := p.tokenizer.Detokenize(ctx, stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to reveal email: %w", err)
+	}
+	return email, nil
+}
+
+// Detokenize returns the real email regardless of the caller, for internal
+// use such as delivering mail. The result must never be returned to callers.
+func (p *Protector) Detokenize(ctx context.Context, stored string) (string, error) {
+	email, err := p.tokenizer.Detokenize(ctx, stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to reveal email: %w", err)
+	}
+	return email, nil
+}
+
+// Searchable reports whether stored emails are plain values that can be
+// matched by pattern, which is only the case without tokenization
+func (p *Protector) Searchable() bool {
+	_, ok := p.tokenizer.(Noop)
+	return ok
+}
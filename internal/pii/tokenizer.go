@@ -0,0 +1,97 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Tokenizer swaps sensitive values for opaque tokens and back. Tokenization
+// must be deterministic so that tokens can be looked up and kept unique.
+type Tokenizer interface {
+	Tokenize(ctx context.Context, value string) (string, error)
+	Detokenize(ctx context.Context, token string) (string, error)
+}
+
+// Noop stores values as they are, for deployments allowed to keep raw PII
+type Noop struct{}
+
+// Tokenize implements Tokenizer
+func (Noop) Tokenize(_ context.Context, value string) (string, error) {
+	return value, nil
+}
+
+// Detokenize implements Tokenizer
+func (Noop) Detokenize(_ context.Context, token string) (string, error) {
+	return token, nil
+}
+
+// HTTPTokenizer calls an external tokenization service exposing
+// POST /tokenize and POST /detokenize endpoints
+type HTTPTokenizer struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewHTTPTokenizer creates a new HTTPTokenizer instance
+func NewHTTPTokenizer(baseURL, apiKey string, timeout time.Duration) *HTTPTokenizer {
+	return &HTTPTokenizer{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Tokenize implements Tokenizer
+func (t *HTTPTokenizer) Tokenize(ctx context.Context, value string) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := t.call(ctx, "/tokenize", map[string]string{"value": value}, &resp); err != nil {
+		return "", fmt.Errorf("failed to tokenize: %w", err)
+	}
+	return resp.Token, nil
+}
+
+// Detokenize implements Tokenizer
+func (t *HTTPTokenizer) Detokenize(ctx context.Context, token string) (string, error) {
+	var resp struct {
+		Value string `json:"value"`
+	}
+	if err := t.call(ctx, "/detokenize", map[string]string{"token": token}, &resp); err != nil {
+		return "", fmt.Errorf("failed to detokenize: %w", err)
+	}
+	return resp.Value, nil
+}
+
+func (t *HTTPTokenizer) call(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tokenization service returned %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxCachedDecisions bounds the decision cache; it is reset when full
+const maxCachedDecisions = 10000
+
+type cachedDecision struct {
+	decision  Decision
+	expiresAt time.Time
+}
+
+// Cached memoizes the decisions of another Engine for a fixed TTL
+type Cached struct {
+	engine  Engine
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[Input]cachedDecision
+}
+
+// NewCached creates a new Cached engine wrapping engine
+func NewCached(engine Engine, ttl time.Duration) *Cached {
+	return &Cached{
+		engine:  engine,
+		ttl:     ttl,
+		entries: make(map[Input]cachedDecision),
+	}
+}
+
+// Evaluate implements Engine
+func (c *Cached) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[input]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.decision, nil
+	}
+
+	decision, err := c.engine.Evaluate(ctx, input)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= maxCachedDecisions {
+		c.entries = make(map[Input]cachedDecision)
+	}
+	c.entries[input] = cachedDecision{decision: decision, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return decision, nil
+}
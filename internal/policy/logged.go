@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Logged writes a decision log entry for every evaluation of another Engine
+type Logged struct {
+	engine Engine
+}
+
+// NewLogged creates a new Logged engine wrapping engine
+func NewLogged(engine Engine) *Logged {
+	return &Logged{engine: engine}
+}
+
+// Evaluate implements Engine
+func (l *Logged) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	start := time.Now()
+	decision, err := l.engine.Evaluate(ctx, input)
+
+	attrs := []any{
+		slog.String("subject", input.Subject),
+		slog.String("auth_method", input.AuthMethod),
+		slog.String("method", input.Method),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		slog.Error("policy decision", append(attrs, slog.String("error", err.Error()))...)
+		return decision, err
+	}
+
+	slog.Info("policy decision", append(attrs,
+		slog.Bool("allow", decision.Allow),
+		slog.String("reason", decision.Reason))...)
+
+	return decision, nil
+}
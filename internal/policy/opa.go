@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// OPA evaluates decisions with an embedded Open Policy Agent query
+type OPA struct {
+	query rego.PreparedEvalQuery
+}
+
+// NewOPA prepares query against the Rego policies found at path, which is
+// either a bundle archive (.tar.gz) or a policy file or directory
+func NewOPA(ctx context.Context, path, query string) (*OPA, error) {
+	load := rego.Load([]string{path}, nil)
+	if strings.HasSuffix(path, ".tar.gz") {
+		load = rego.LoadBundle(path)
+	}
+
+	prepared, err := rego.New(rego.Query(query), load).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare policy %s: %w", path, err)
+	}
+
+	return &OPA{query: prepared}, nil
+}
+
+// Evaluate implements Engine; an undefined result denies the request
+func (o *OPA) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	results, err := o.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+
+	if results.Allowed() {
+		return Decision{Allow: true, Reason: "allowed by policy"}, nil
+	}
+	return Decision{Allow: false, Reason: "denied by policy"}, nil
+}
@@ -0,0 +1,32 @@
+package policy
+
+import "context"
+
+// Input is the authorization question put to a policy
+type Input struct {
+	Subject    string `json:"subject"`
+	AuthMethod string `json:"auth_method"`
+	Method     string `json:"method"`
+	// Impersonator is the subject acting as Subject with an impersonation
+	// token; empty otherwise
+	Impersonator string `json:"impersonator,omitempty"`
+}
+
+// Decision is the answer of a policy for an Input
+type Decision struct {
+	Allow  bool
+	Reason string
+}
+
+// Engine evaluates authorization decisions
+type Engine interface {
+	Evaluate(ctx context.Context, input Input) (Decision, error)
+}
+
+// AllowAll is the Engine used when no policy is configured
+type AllowAll struct{}
+
+// Evaluate implements Engine
+func (AllowAll) Evaluate(context.Context, Input) (Decision, error) {
+	return Decision{Allow: true, Reason: "no policy configured"}, nil
+}
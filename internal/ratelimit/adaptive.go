@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// AdaptiveConfig tunes an Adaptive limiter
+type AdaptiveConfig struct {
+	// Initial, Min and Max bound the limit in requests per second
+	Initial float64
+	Min     float64
+	Max     float64
+	// Increase is added to the limit after each healthy interval
+	Increase float64
+	// Decrease multiplies the limit after an unhealthy interval, e.g. 0.5
+	Decrease float64
+	// MaxErrorRate is the share of failed requests above which an interval
+	// is unhealthy
+	MaxErrorRate float64
+	// MaxDBLatency is the mean database time per request above which an
+	// interval is unhealthy
+	MaxDBLatency time.Duration
+	// MinRequests is the number of requests an interval needs before its
+	// error rate and latency are trusted; quieter intervals count as healthy
+	MinRequests int
+}
+
+// Adaptive is a server-wide rate limit adjusted with AIMD: it grows by a
+// constant step while requests succeed and the database is fast, and is cut
+// by a factor when errors or database latency exceed their thresholds. This
+// sheds load during partial outages, when a static limit is too high, and
+// lets traffic through when healthy, when a static limit is too low. It is a
+// prometheus.Collector.
+type Adaptive struct {
+	cfg     AdaptiveConfig
+	limiter *rate.Limiter
+
+	mu       sync.Mutex
+	requests int
+	failures int
+	dbTime   time.Duration
+
+	limit    prometheus.GaugeFunc
+	rejected prometheus.Counter
+	cuts     prometheus.Counter
+}
+
+// NewAdaptive creates an Adaptive limiter starting at cfg.Initial
+func NewAdaptive(cfg AdaptiveConfig) *Adaptive {
+	initial := min(max(cfg.Initial, cfg.Min), cfg.Max)
+	a := &Adaptive{
+		cfg:     cfg,
+		limiter: rate.NewLimiter(rate.Limit(initial), burst(initial)),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "adaptive_rate_limit_rejected_total",
+			Help: "Number of requests rejected by the adaptive rate limit",
+		}),
+		cuts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "adaptive_rate_limit_decreases_total",
+			Help: "Number of times the adaptive rate limit was cut after an unhealthy interval",
+		}),
+	}
+	a.limit = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "adaptive_rate_limit",
+		Help: "Current adaptive rate limit in requests per second",
+	}, a.Limit)
+	return a
+}
+
+// Limit returns the current limit in requests per second
+func (a *Adaptive) Limit() float64 {
+	return float64(a.limiter.Limit())
+}
+
+// Allow reports whether a request may be served now. When it may not, the
+// returned duration is how long the caller should wait before retrying.
+func (a *Adaptive) Allow() (bool, time.Duration) {
+	now := time.Now()
+	reservation := a.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		a.rejected.Inc()
+		return false, time.Second
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		a.rejected.Inc()
+		return false, delay
+	}
+	return true, 0
+}
+
+// Observe records the outcome of a served request and the time it spent
+// waiting on the database
+func (a *Adaptive) Observe(failed bool, dbTime time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.requests++
+	if failed {
+		a.failures++
+	}
+	a.dbTime += dbTime
+}
+
+// Run ends the current interval and adjusts the limit from its requests. It
+// is meant to be scheduled at a fixed interval.
+func (a *Adaptive) Run(context.Context) error {
+	a.mu.Lock()
+	requests, failures, dbTime := a.requests, a.failures, a.dbTime
+	a.requests, a.failures, a.dbTime = 0, 0, 0
+	a.mu.Unlock()
+
+	current := a.Limit()
+	next := min(current+a.cfg.Increase, a.cfg.Max)
+
+	if requests > 0 && requests >= a.cfg.MinRequests {
+		errorRate := float64(failures) / float64(requests)
+		latency := dbTime / time.Duration(requests)
+		if errorRate > a.cfg.MaxErrorRate || (a.cfg.MaxDBLatency > 0 && latency > a.cfg.MaxDBLatency) {
+			next = max(current*a.cfg.Decrease, a.cfg.Min)
+			a.cuts.Inc()
+			slog.Warn("adaptive rate limit decreased",
+				slog.Float64("limit", next),
+				slog.Float64("error_rate", errorRate),
+				slog.Duration("db_latency", latency))
+		}
+	}
+
+	if next != current {
+		now := time.Now()
+		a.limiter.SetLimitAt(now, rate.Limit(next))
+		a.limiter.SetBurstAt(now, burst(next))
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (a *Adaptive) Describe(ch chan<- *prometheus.Desc) {
+	a.limit.Describe(ch)
+	a.rejected.Describe(ch)
+	a.cuts.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (a *Adaptive) Collect(ch chan<- prometheus.Metric) {
+	a.limit.Collect(ch)
+	a.rejected.Collect(ch)
+	a.cuts.Collect(ch)
+}
+
+// burst allows one second worth of requests at once
+func burst(limit float64) int {
+	return max(int(limit), 1)
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptive(t *testing.T) {
+	cfg := AdaptiveConfig{
+		Initial:      100,
+		Min:          10,
+		Max:          120,
+		Increase:     10,
+		Decrease:     0.5,
+		MaxErrorRate: 0.1,
+		MaxDBLatency: 50 * time.Millisecond,
+		MinRequests:  10,
+	}
+	observe := func(a *Adaptive, n, failed int, dbTime time.Duration) {
+		for i := 0; i < n; i++ {
+			a.Observe(i < failed, dbTime)
+		}
+	}
+
+	t.Run("grows additively up to the maximum while healthy", func(t *testing.T) {
+		a := NewAdaptive(cfg)
+		observe(a, 20, 1, time.Millisecond)
+		a.Run(context.Background())
+		if got := a.Limit(); got != 110 {
+			t.Errorf("expected 110, got %v", got)
+		}
+		a.Run(context.Background())
+		a.Run(context.Background())
+		if got := a.Limit(); got != 120 {
+			t.Errorf("expected the maximum, got %v", got)
+		}
+	})
+
+	t.Run("cuts multiplicatively on errors", func(t *testing.T) {
+		a := NewAdaptive(cfg)
+		observe(a, 20, 5, time.Millisecond)
+		a.Run(context.Background())
+		if got := a.Limit(); got != 50 {
+			t.Errorf("expected 50, got %v", got)
+		}
+	})
+
+	t.Run("cuts on database latency down to the minimum", func(t *testing.T) {
+		a := NewAdaptive(cfg)
+		for i := 0; i < 5; i++ {
+			observe(a, 20, 0, 100*time.Millisecond)
+			a.Run(context.Background())
+		}
+		if got := a.Limit(); got != 10 {
+			t.Errorf("expected the minimum, got %v", got)
+		}
+	})
+
+	t.Run("ignores quiet intervals", func(t *testing.T) {
+		a := NewAdaptive(cfg)
+		observe(a, 5, 5, time.Second)
+		a.Run(context.Background())
+		if got := a.Limit(); got != 110 {
+			t.Errorf("expected growth, got %v", got)
+		}
+	})
+
+	t.Run("rejects beyond the limit", func(t *testing.T) {
+		a := NewAdaptive(AdaptiveConfig{Initial: 1, Min: 1, Max: 1})
+		if ok, _ := a.Allow(); !ok {
+			t.Fatal("expected the first request to be allowed")
+		}
+		if ok, retryAfter := a.Allow(); ok || retryAfter <= 0 {
+			t.Errorf("expected a rejection with a retry delay, got %v %v", ok, retryAfter)
+		}
+	})
+}
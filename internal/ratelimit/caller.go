@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+)
+
+// ErrInvalidRule is returned for malformed caller rate limit rules
+var ErrInvalidRule = errors.New("invalid rate limit rule")
+
+// BucketStore keeps token buckets shared by all instances, such as Redis
+type BucketStore interface {
+	TakeToken(ctx context.Context, key string, perSecond float64, burst int) (bool, time.Duration, error)
+}
+
+// Rule limits each caller of the methods matching Method, a pattern in the
+// syntax of authz policies, to PerMinute calls per minute on average with
+// bursts of up to Burst calls
+type Rule struct {
+	Method    string
+	PerMinute float64
+	Burst     int
+}
+
+// ParseRules parses rules written as "<method pattern>=<per minute>:<burst>",
+// e.g. "/user.UserService/CreateUser=60:10"
+func ParseRules(values []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(values))
+	for _, v := range values {
+		method, limit, ok := strings.Cut(v, "=")
+		perMinute, burst, ok2 := strings.Cut(limit, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("%w: %q is not <method>=<per minute>:<burst>", ErrInvalidRule, v)
+		}
+		if err := authz.CheckPatterns([]string{method}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+		rule := Rule{Method: method}
+		var err error
+		if rule.PerMinute, err = strconv.ParseFloat(perMinute, 64); err != nil || rule.PerMinute <= 0 {
+			return nil, fmt.Errorf("%w: %q needs a positive rate", ErrInvalidRule, v)
+		}
+		if rule.Burst, err = strconv.Atoi(burst); err != nil || rule.Burst <= 0 {
+			return nil, fmt.Errorf("%w: %q needs a positive burst", ErrInvalidRule, v)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// PerCaller limits each caller with token buckets kept in a BucketStore, so
+// the limits hold across instances. The first rule matching a method
+// applies, and the default rule otherwise; each rule has its own buckets.
+// Calls are admitted when the store fails. It implements
+// prometheus.Collector.
+type PerCaller struct {
+	store    BucketStore
+	rules    []Rule
+	fallback Rule
+
+	rejected *prometheus.CounterVec
+	errors   prometheus.Counter
+}
+
+// NewPerCaller creates a PerCaller applying rules before fallback, whose
+// Method is ignored
+func NewPerCaller(store BucketStore, fallback Rule, rules []Rule) *PerCaller {
+	fallback.Method = "*"
+	return &PerCaller{
+		store:    store,
+		rules:    rules,
+		fallback: fallback,
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "caller_rate_limit_rejected_total",
+			Help: "Number of calls rejected by the per-caller rate limit",
+		}, []string{"method"}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "caller_rate_limit_errors_total",
+			Help: "Number of calls admitted because the rate limit store failed",
+		}),
+	}
+}
+
+// Allow reports whether caller may call method now. When it may not, the
+// returned duration is how long the caller should wait before retrying.
+func (p *PerCaller) Allow(ctx context.Context, method, caller string) (bool, time.Duration) {
+	rule := p.rule(method)
+	key := "ratelimit:" + rule.Method + ":" + caller
+
+	allowed, retryAfter, err := p.store.TakeToken(ctx, key, rule.PerMinute/60, rule.Burst)
+	if err != nil {
+		p.errors.Inc()
+		slog.Warn("rate limit unavailable, admitting call",
+			slog.String("method", method),
+			slog.String("error", err.Error()))
+		return true, 0
+	}
+	if !allowed {
+		p.rejected.WithLabelValues(method).Inc()
+	}
+	return allowed, retryAfter
+}
+
+// rule returns the rule applying to method
+func (p *PerCaller) rule(method string) Rule {
+	for _, r := range p.rules {
+		if authz.MatchAny([]string{r.Method}, method) {
+			return r
+		}
+	}
+	return p.fallback
+}
+
+// Describe implements prometheus.Collector
+func (p *PerCaller) Describe(ch chan<- *prometheus.Desc) {
+	p.rejected.Describe(ch)
+	p.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *PerCaller) Collect(ch chan<- prometheus.Metric) {
+	p.rejected.Collect(ch)
+	p.errors.Collect(ch)
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// storeFunc adapts a function to BucketStore
+type storeFunc func(key string, perSecond float64, burst int) (bool, time.Duration, error)
+
+func (f storeFunc) TakeToken(_ context.Context, key string, perSecond float64, burst int) (bool, time.Duration, error) {
+	return f(key, perSecond, burst)
+}
+
+func TestPerCaller(t *testing.T) {
+	t.Run("parses rules", func(t *testing.T) {
+		rules, err := ParseRules([]string{"/user.UserService/CreateUser=60:10"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules) != 1 || rules[0] != (Rule{Method: "/user.UserService/CreateUser", PerMinute: 60, Burst: 10}) {
+			t.Errorf("ParseRules() = %+v", rules)
+		}
+		for _, bad := range []string{"CreateUser=60:10", "/user.UserService/*=60", "*=0:10"} {
+			if _, err := ParseRules([]string{bad}); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("ParseRules(%q) error = %v, want ErrInvalidRule", bad, err)
+			}
+		}
+	})
+
+	t.Run("applies the first matching rule", func(t *testing.T) {
+		var gotKey string
+		var gotBurst int
+		store := storeFunc(func(key string, _ float64, burst int) (bool, time.Duration, error) {
+			gotKey, gotBurst = key, burst
+			return false, time.Second, nil
+		})
+		limiter := NewPerCaller(store, Rule{PerMinute: 600, Burst: 100}, []Rule{
+			{Method: "/user.UserService/CreateUser", PerMinute: 60, Burst: 5},
+		})
+
+		allowed, retryAfter := limiter.Allow(context.Background(), "/user.UserService/CreateUser", "sub:alice")
+		if allowed || retryAfter != time.Second {
+			t.Errorf("Allow() = %v, %v, want false, 1s", allowed, retryAfter)
+		}
+		if gotKey != "ratelimit:/user.UserService/CreateUser:sub:alice" || gotBurst != 5 {
+			t.Errorf("took from %q with burst %d", gotKey, gotBurst)
+		}
+
+		limiter.Allow(context.Background(), "/user.UserService/GetUser", "sub:alice")
+		if gotKey != "ratelimit:*:sub:alice" || gotBurst != 100 {
+			t.Errorf("took from %q with burst %d, want the default", gotKey, gotBurst)
+		}
+	})
+
+	t.Run("admits calls when the store fails", func(t *testing.T) {
+		store := storeFunc(func(string, float64, int) (bool, time.Duration, error) {
+			return false, 0, errors.New("connection refused")
+		})
+		limiter := NewPerCaller(store, Rule{PerMinute: 60, Burst: 1}, nil)
+		if allowed, _ := limiter.Allow(context.Background(), "/user.UserService/GetUser", "ip:10.0.0.1"); !allowed {
+			t.Error("Allow() = false, want true")
+		}
+	})
+}
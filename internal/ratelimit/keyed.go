@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTTL is how long an unused key is remembered before it is evicted
+const idleTTL = 10 * time.Minute
+
+type entry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Keyed keeps an independent token bucket per key, such as a client address
+type Keyed struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// NewKeyed creates a limiter allowing perMinute events per key on average,
+// with bursts of up to burst events
+func NewKeyed(perMinute float64, burst int) *Keyed {
+	return &Keyed{
+		limit:     rate.Limit(perMinute / 60),
+		burst:     burst,
+		entries:   make(map[string]*entry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether an event for key may happen now. When it may not,
+// the returned duration is how long the caller should wait before retrying.
+func (k *Keyed) Allow(key string) (bool, time.Duration) {
+	return k.AllowRate(key, 0)
+}
+
+// AllowRate is like Allow but limits key to perMinute events per minute
+// instead of the limiter's default, which applies when perMinute is 0
+func (k *Keyed) AllowRate(key string, perMinute float64) (bool, time.Duration) {
+	now := time.Now()
+
+	limit := k.limit
+	if perMinute > 0 {
+		limit = rate.Limit(perMinute / 60)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.sweep(now)
+
+	e, ok := k.entries[key]
+	if !ok {
+		e = &entry{limiter: rate.NewLimiter(limit, k.burst)}
+		k.entries[key] = e
+	}
+	if e.limiter.Limit() != limit {
+		e.limiter.SetLimitAt(now, limit)
+	}
+	e.lastSeen = now
+
+	reservation := e.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, idleTTL
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+func (k *Keyed) sweep(now time.Time) {
+	if now.Sub(k.lastSweep) < idleTTL {
+		return
+	}
+	for key, e := range k.entries {
+		if now.Sub(e.lastSeen) > idleTTL {
+			delete(k.entries, key)
+		}
+	}
+	k.lastSweep = now
+}
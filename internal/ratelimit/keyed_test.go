@@ -0,0 +1,39 @@
+package ratelimit
+
+import "testing"
+
+func TestKeyed(t *testing.T) {
+	t.Run("limits each key independently", func(t *testing.T) {
+		limiter := NewKeyed(1, 2)
+
+		for i := 0; i < 2; i++ {
+			if ok, _ := limiter.Allow("10.0.0.1"); !ok {
+				t.Fatalf("request %d within burst was rejected", i)
+			}
+		}
+
+		ok, retryAfter := limiter.Allow("10.0.0.1")
+		if ok {
+			t.Fatal("expected request beyond burst to be rejected")
+		}
+		if retryAfter <= 0 {
+			t.Errorf("expected positive retry delay, got %v", retryAfter)
+		}
+
+		if ok, _ := limiter.Allow("10.0.0.2"); !ok {
+			t.Error("expected other key to be unaffected")
+		}
+	})
+	t.Run("applies per-key rates", func(t *testing.T) {
+		limiter := NewKeyed(1, 1)
+
+		limiter.AllowRate("key-1", 60)
+		_, first := limiter.Allow("key-2")
+		_, fast := limiter.AllowRate("key-1", 60)
+		_, def := limiter.Allow("key-2")
+
+		if first != 0 || fast <= 0 || def <= fast {
+			t.Errorf("expected the faster key to wait less, got %v and %v", fast, def)
+		}
+	})
+}
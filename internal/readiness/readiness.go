@@ -0,0 +1,152 @@
+// Package readiness reports whether the dependencies of the server are
+// usable, one component at a time, for the /readyz endpoint
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// Check probes a dependency, returning nil when it is usable
+type Check func(ctx context.Context) error
+
+// Component statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// ComponentStatus is the outcome of the latest check of a component
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	// LastError is the most recent failure, kept after recovery so that
+	// flapping dependencies stand out
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Report is the readiness of the server and its components
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type component struct {
+	name  string
+	check Check
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Checker runs the checks of every registered component
+type Checker struct {
+	timeout    time.Duration
+	clock      clock.Clock
+	components []*component
+}
+
+// NewChecker creates a Checker giving each check up to timeout
+func NewChecker(timeout time.Duration, clk clock.Clock) *Checker {
+	return &Checker{timeout: timeout, clock: clk}
+}
+
+// Add registers a component. Components must all be added before the
+// checker serves requests.
+func (c *Checker) Add(name string, check Check) {
+	c.components = append(c.components, &component{name: name, check: check})
+}
+
+// Run checks every component concurrently. The server is up only when
+// every component is.
+func (c *Checker) Run(ctx context.Context) Report {
+	statuses := make([]ComponentStatus, len(c.components))
+
+	var wg sync.WaitGroup
+	for i, comp := range c.components {
+		wg.Add(1)
+		go func(i int, comp *component) {
+			defer wg.Done()
+			statuses[i] = c.run(ctx, comp)
+		}(i, comp)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: make(map[string]ComponentStatus, len(statuses))}
+	for i, comp := range c.components {
+		report.Components[comp.name] = statuses[i]
+		if statuses[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, comp *component) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := c.clock.Now()
+	err := comp.check(ctx)
+	status := ComponentStatus{
+		Status:    StatusUp,
+		LatencyMs: float64(c.clock.Now().Sub(start).Microseconds()) / 1000,
+	}
+
+	comp.mu.Lock()
+	defer comp.mu.Unlock()
+
+	if err != nil {
+		status.Status = StatusDown
+		comp.lastError = err.Error()
+		comp.lastErrorAt = c.clock.Now()
+	}
+	if comp.lastError != "" {
+		at := comp.lastErrorAt
+		status.LastError = comp.lastError
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+// ServeHTTP writes the report as JSON, with status 200 when the server is
+// ready and 503 otherwise
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Cached wraps check so that it runs at most once per interval, for checks
+// too expensive to run on every probe. Failures are not cached.
+func Cached(check Check, interval time.Duration, clk clock.Clock) Check {
+	var (
+		mu     sync.Mutex
+		passed time.Time
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !passed.IsZero() && clk.Now().Sub(passed) < interval {
+			return nil
+		}
+		if err := check(ctx); err != nil {
+			return err
+		}
+		passed = clk.Now()
+		return nil
+	}
+}
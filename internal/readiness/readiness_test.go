@@ -0,0 +1,104 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/schema"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+func TestChecker(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	c := NewChecker(time.Second, clk)
+	c.Add("db", func(context.Context) error { return nil })
+	c.Add("redis", func(context.Context) error { return errors.New("connection refused") })
+
+	t.Run("failing component makes the server unready", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", rec.Code)
+		}
+		var report Report
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != StatusDown {
+			t.Errorf("expected status down, got %s", report.Status)
+		}
+		if got := report.Components["db"]; got.Status != StatusUp || got.LastError != "" {
+			t.Errorf("expected db up without error, got %+v", got)
+		}
+		if got := report.Components["redis"]; got.Status != StatusDown || got.LastError != "connection refused" {
+			t.Errorf("expected redis down with its error, got %+v", got)
+		}
+	})
+
+	t.Run("last error is kept after recovery", func(t *testing.T) {
+		c.components[1].check = func(context.Context) error { return nil }
+
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rec.Code)
+		}
+		var report Report
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if got := report.Components["redis"]; got.Status != StatusUp || got.LastError != "connection refused" || got.LastErrorAt == nil {
+			t.Errorf("expected redis up with previous error, got %+v", got)
+		}
+	})
+}
+
+func TestCached(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	calls := 0
+	var err error
+	check := Cached(func(context.Context) error { calls++; return err }, time.Minute, clk)
+
+	err = errors.New("down")
+	check(context.Background())
+	check(context.Background())
+	if calls != 2 {
+		t.Errorf("expected failures not to be cached, got %d calls", calls)
+	}
+
+	err = nil
+	check(context.Background())
+	check(context.Background())
+	if calls != 3 {
+		t.Errorf("expected a pass to be reused, got %d calls", calls)
+	}
+
+	clk.Advance(time.Minute)
+	check(context.Background())
+	if calls != 4 {
+		t.Errorf("expected a check after the interval, got %d calls", calls)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	err := missing([]schema.Drift{
+		{Kind: schema.ExtraTable, Table: "legacy"},
+		{Kind: schema.MissingColumn, Table: "users", Name: "metadata"},
+		{Kind: schema.MissingTable, Table: "users_history"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "users.metadata, users_history") {
+		t.Errorf("expected missing objects to be reported, got %v", err)
+	}
+	if err := missing([]schema.Drift{{Kind: schema.ExtraIndex, Table: "users", Name: "idx_old"}}); err != nil {
+		t.Errorf("expected extra objects to be tolerated, got %v", err)
+	}
+}
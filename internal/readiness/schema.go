@@ -0,0 +1,42 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/schema"
+)
+
+// Migrations checks that the live schema has every table, column and index
+// the migrations create. Extra objects are tolerated so that the check keeps
+// passing while a newer migration is rolled out ahead of the code.
+func Migrations(db *pgxpool.Pool, expected *schema.Schema) Check {
+	return func(ctx context.Context) error {
+		live, err := schema.Inspect(ctx, db)
+		if err != nil {
+			return err
+		}
+		return missing(schema.Diff(expected, live))
+	}
+}
+
+// missing reports the drift entries that leave the schema behind the
+// migrations
+func missing(drift []schema.Drift) error {
+	var names []string
+	for _, d := range drift {
+		switch d.Kind {
+		case schema.MissingTable:
+			names = append(names, d.Table)
+		case schema.MissingColumn, schema.MissingIndex:
+			names = append(names, d.Table+"."+d.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("schema is missing %d object(s) from migrations: %s", len(names), strings.Join(names, ", "))
+}
@@ -0,0 +1,188 @@
+package region
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Role is the replication role of the region's database
+type Role string
+
+const (
+	// RolePrimary regions accept writes
+	RolePrimary Role = "primary"
+	// RoleSecondary regions run on a read-only replica and fence writes
+	RoleSecondary Role = "secondary"
+)
+
+// Status is the result of one replication check
+type Status struct {
+	Role Role
+	// Lag is the time since the last replayed transaction; zero on primaries
+	Lag       time.Duration
+	CheckedAt time.Time
+}
+
+// Monitor tracks whether the local database is a primary or a replica so
+// that a secondary region serves reads only, and detects promotion during
+// failover. It is a prometheus.Collector and is meant to run as a periodic
+// job.
+type Monitor struct {
+	db     *pgxpool.Pool
+	region string
+	maxLag time.Duration
+
+	mu        sync.RWMutex
+	status    Status
+	observers []func(prev, cur Status)
+
+	isPrimary      prometheus.Gauge
+	replicationLag prometheus.Gauge
+	promotions     prometheus.Counter
+}
+
+// NewMonitor creates a Monitor for the named region. Until the first check
+// the region is assumed to be primary.
+func NewMonitor(db *pgxpool.Pool, region string, maxLag time.Duration) *Monitor {
+	labels := prometheus.Labels{"region": region}
+	return &Monitor{
+		db:     db,
+		region: region,
+		maxLag: maxLag,
+		status: Status{Role: RolePrimary},
+		isPrimary: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "region_database_primary",
+			Help:        "1 when the region's database accepts writes, 0 on a replica",
+			ConstLabels: labels,
+		}),
+		replicationLag: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "region_replication_lag_seconds",
+			Help:        "Seconds since the replica last replayed a transaction",
+			ConstLabels: labels,
+		}),
+		promotions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "region_promotions_total",
+			Help:        "Number of times the region's database was seen promoted to primary",
+			ConstLabels: labels,
+		}),
+	}
+}
+
+// OnChange registers fn to be called after every check with the previous and
+// current status, e.g. to update health checks or react to a promotion
+func (m *Monitor) OnChange(fn func(prev, cur Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observers = append(m.observers, fn)
+}
+
+// Run checks the replication role and lag of the database. On replicas the
+// lag is measured from the last replayed transaction, so it also grows while
+// the primary is idle.
+func (m *Monitor) Run(ctx context.Context) error {
+	query := `
+		SELECT pg_is_in_recovery(),
+			COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	`
+
+	var (
+		inRecovery bool
+		lagSeconds float64
+	)
+	if err := m.db.QueryRow(ctx, query).Scan(&inRecovery, &lagSeconds); err != nil {
+		return fmt.Errorf("failed to check replication status: %w", err)
+	}
+
+	cur := Status{Role: RolePrimary, CheckedAt: time.Now()}
+	if inRecovery {
+		cur.Role = RoleSecondary
+		cur.Lag = time.Duration(lagSeconds * float64(time.Second))
+	}
+
+	m.mu.Lock()
+	prev := m.status
+	m.status = cur
+	observers := m.observers
+	m.mu.Unlock()
+
+	m.record(prev, cur)
+	for _, fn := range observers {
+		fn(prev, cur)
+	}
+
+	return nil
+}
+
+// Status returns the result of the latest check
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Writable reports whether the region currently accepts writes
+func (m *Monitor) Writable() bool {
+	return m.Status().Role == RolePrimary
+}
+
+// Healthy reports whether the region is primary or a replica within the
+// configured maximum lag
+func (m *Monitor) Healthy() bool {
+	status := m.Status()
+	return status.Role == RolePrimary || m.maxLag <= 0 || status.Lag <= m.maxLag
+}
+
+// PrimaryOnly wraps a job so that it only runs while the region is primary,
+// for background work that writes to the database
+func (m *Monitor) PrimaryOnly(run func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !m.Writable() {
+			return nil
+		}
+		return run(ctx)
+	}
+}
+
+func (m *Monitor) record(prev, cur Status) {
+	m.replicationLag.Set(cur.Lag.Seconds())
+	if cur.Role == RolePrimary {
+		m.isPrimary.Set(1)
+	} else {
+		m.isPrimary.Set(0)
+	}
+
+	switch {
+	case prev.Role == RoleSecondary && cur.Role == RolePrimary:
+		m.promotions.Inc()
+		slog.Warn("database promoted, region now accepts writes", slog.String("region", m.region))
+	case prev.Role == RolePrimary && cur.Role == RoleSecondary:
+		slog.Warn("database is a replica, region fences writes", slog.String("region", m.region))
+	}
+
+	if cur.Role == RoleSecondary && m.maxLag > 0 && cur.Lag > m.maxLag {
+		slog.Warn("replication lag above threshold",
+			slog.String("region", m.region),
+			slog.Duration("lag", cur.Lag),
+			slog.Duration("max_lag", m.maxLag))
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Monitor) Describe(ch chan<- *prometheus.Desc) {
+	m.isPrimary.Describe(ch)
+	m.replicationLag.Describe(ch)
+	m.promotions.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Monitor) Collect(ch chan<- prometheus.Metric) {
+	m.isPrimary.Collect(ch)
+	m.replicationLag.Collect(ch)
+	m.promotions.Collect(ch)
+}
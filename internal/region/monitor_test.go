@@ -0,0 +1,58 @@
+package region
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMonitor(t *testing.T) {
+	t.Run("secondary within max lag is healthy but not writable", func(t *testing.T) {
+		m := NewMonitor(nil, "eu", 30*time.Second)
+		m.status = Status{Role: RoleSecondary, Lag: 10 * time.Second}
+
+		if m.Writable() {
+			t.Error("secondary should not be writable")
+		}
+		if !m.Healthy() {
+			t.Error("secondary within max lag should be healthy")
+		}
+
+		m.status.Lag = time.Minute
+		if m.Healthy() {
+			t.Error("secondary above max lag should be unhealthy")
+		}
+	})
+
+	t.Run("primary only jobs are skipped on secondaries", func(t *testing.T) {
+		m := NewMonitor(nil, "eu", 0)
+		ran := 0
+		job := m.PrimaryOnly(func(ctx context.Context) error {
+			ran++
+			return nil
+		})
+
+		_ = job(context.Background())
+		m.status = Status{Role: RoleSecondary}
+		_ = job(context.Background())
+
+		if ran != 1 {
+			t.Errorf("expected the job to run once, ran %d times", ran)
+		}
+	})
+
+	t.Run("promotion is counted", func(t *testing.T) {
+		m := NewMonitor(nil, "eu", 0)
+		m.record(Status{Role: RolePrimary}, Status{Role: RoleSecondary})
+		m.record(Status{Role: RoleSecondary}, Status{Role: RolePrimary})
+
+		if got := testutil.ToFloat64(m.promotions); got != 1 {
+			t.Errorf("expected 1 promotion, got %v", got)
+		}
+		if got := testutil.ToFloat64(m.isPrimary); got != 1 {
+			t.Errorf("expected primary gauge 1, got %v", got)
+		}
+	})
+}
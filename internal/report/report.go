@@ -0,0 +1,84 @@
+// Package report writes tabular reports as CSV or XLSX spreadsheets, one
+// row at a time, so reports of any size are written in constant memory
+package report
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Format is the file format of a report
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+var (
+	// ErrUnknownFormat is returned for formats other than CSV and XLSX
+	ErrUnknownFormat = errors.New("unknown report format, expected csv or xlsx")
+	// ErrTooManyRows is returned for rows beyond what spreadsheets open
+	ErrTooManyRows = errors.New("report exceeds the row limit of spreadsheets")
+)
+
+// maxRows is the number of rows Excel and LibreOffice open, header included
+const maxRows = 1 << 20
+
+// Writer writes the rows of a report. Close completes the file; it does
+// not close the underlying writer.
+type Writer interface {
+	WriteRow(cells ...string) error
+	Close() error
+}
+
+// NewWriter creates a Writer encoding rows in format to w
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case XLSX:
+		return newXLSXWriter(w), nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType is the media type of files in the format
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv"
+}
+
+// csvWriter writes RFC 4180 CSV
+type csvWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+// WriteRow implements Writer. Cells that spreadsheets would evaluate as
+// formulas are prefixed with a quote, so that opening a report cannot run
+// a formula planted in user data.
+func (c *csvWriter) WriteRow(cells ...string) error {
+	if c.rows++; c.rows > maxRows {
+		return ErrTooManyRows
+	}
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cell = "'" + cell
+		}
+		escaped[i] = cell
+	}
+	return c.w.Write(escaped)
+}
+
+// Close implements Writer
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
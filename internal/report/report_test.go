@@ -0,0 +1,62 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	t.Run("csv defuses formulas", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(CSV, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteRow("name", "email")
+		w.WriteRow("=HYPERLINK(\"http://evil\")", "a@example.com")
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "name,email\n\"'=HYPERLINK(\"\"http://evil\"\")\",a@example.com\n"
+		if buf.String() != want {
+			t.Errorf("expected %q, got %q", want, buf.String())
+		}
+	})
+
+	t.Run("xlsx holds escaped inline strings", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(XLSX, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteRow("name", "metadata")
+		w.WriteRow("Ann <admin>", `{"plan":"pro"}`)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("expected a zip archive: %v", err)
+		}
+		sheet, err := archive.Open("xl/worksheets/sheet1.xml")
+		if err != nil {
+			t.Fatalf("expected a sheet: %v", err)
+		}
+		data, _ := io.ReadAll(sheet)
+		if !strings.Contains(string(data), "<t xml:space=\"preserve\">Ann &lt;admin&gt;</t>") || strings.Count(string(data), "<row>") != 2 {
+			t.Errorf("unexpected sheet %s", data)
+		}
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		if _, err := NewWriter("pdf", io.Discard); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("expected ErrUnknownFormat, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package report
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// xlsxParts are the fixed parts of a workbook with one sheet, written
+// before the sheet
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Report" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// maxCellLength is the number of characters a spreadsheet cell holds
+const maxCellLength = 32767
+
+// xlsxWriter writes an Office Open XML workbook whose single sheet holds
+// every cell as an inline string. Strings are never evaluated as formulas.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	err   error
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	x := &xlsxWriter{zip: zip.NewWriter(w)}
+	for _, part := range xlsxParts {
+		if x.err = x.writePart(part.name, part.content); x.err != nil {
+			return x
+		}
+	}
+
+	sheet, err := x.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		x.err = fmt.Errorf("failed to write sheet: %w", err)
+		return x
+	}
+	x.sheet = bufio.NewWriter(sheet)
+	x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x
+}
+
+func (x *xlsxWriter) writePart(name, content string) error {
+	part, err := x.zip.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	_, err = io.WriteString(part, content)
+	return err
+}
+
+// WriteRow implements Writer
+func (x *xlsxWriter) WriteRow(cells ...string) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.rows++; x.rows > maxRows {
+		return ErrTooManyRows
+	}
+
+	x.sheet.WriteString("<row>")
+	for _, cell := range cells {
+		if runes := []rune(cell); len(runes) > maxCellLength {
+			cell = string(runes[:maxCellLength])
+		}
+		x.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		// Characters XML cannot carry are replaced rather than failing
+		xml.EscapeText(x.sheet, []byte(cell))
+		x.sheet.WriteString("</t></is></c>")
+	}
+	_, x.err = x.sheet.WriteString("</row>")
+	return x.err
+}
+
+// Close implements Writer
+func (x *xlsxWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	x.sheet.WriteString("</sheetData></worksheet>")
+	if err := x.sheet.Flush(); err != nil {
+		return fmt.Errorf("failed to write sheet: %w", err)
+	}
+	return x.zip.Close()
+}
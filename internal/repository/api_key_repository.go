@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// APIKeyRepository handles API key persistence. Keys are stored and looked
+// up by the hex SHA-256 hash of the key.
+type APIKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository instance
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `
+	id, name, subject, roles, prefix, rate_limit, created_by, created_at,
+	expires_at, rotated_at, revoked_at
+`
+
+// Create stores a new API key with the given hash
+func (r *APIKeyRepository) Create(ctx context.Context, key *model.APIKey, hash string) error {
+	query := `
+		INSERT INTO api_keys (name, subject, roles, prefix, key_hash, rate_limit, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + apiKeyColumns
+
+	created, err := scanAPIKey(r.db.QueryRow(ctx, query,
+		key.Name, key.Subject, key.Roles, key.Prefix, hash, key.RateLimit, key.CreatedBy, key.CreatedAt, key.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	*key = *created
+	return nil
+}
+
+// GetByHash retrieves the key whose current hash is hash, or whose previous
+// hash is hash and still within its rotation grace period at now. For a
+// previous hash, validUntil is the end of the grace period; it is zero
+// otherwise. Revoked and expired keys are returned too.
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string, now time.Time) (key *model.APIKey, validUntil time.Time, err error) {
+	query := `
+		SELECT ` + apiKeyColumns + `, CASE WHEN key_hash = $1 THEN NULL ELSE previous_expires_at END
+		FROM api_keys
+		WHERE key_hash = $1 OR (previous_hash = $1 AND previous_expires_at > $2)
+	`
+
+	var until *time.Time
+	key, err = scanAPIKey(r.db.QueryRow(ctx, query, hash, now), &until)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("api key not found: %w", err)
+	}
+	if until != nil {
+		validUntil = *until
+	}
+
+	return key, validUntil, nil
+}
+
+// Rotate replaces the hash of an unrevoked key. The replaced hash stays
+// valid until graceUntil. It returns the updated key and the hashes whose
+// cached lookups are stale: the replaced hash and the one it superseded.
+// It returns pgx.ErrNoRows when no unrevoked key has the ID.
+func (r *APIKeyRepository) Rotate(ctx context.Context, id int64, hash, prefix string, graceUntil, now time.Time) (*model.APIKey, []string, error) {
+	query := `
+		UPDATE api_keys k
+		SET previous_hash = k.key_hash, previous_expires_at = $4, key_hash = $2, prefix = $3, rotated_at = $5
+		FROM (SELECT id, previous_hash FROM api_keys WHERE id = $1 FOR UPDATE) old
+		WHERE k.id = old.id AND k.revoked_at IS NULL
+		RETURNING k.id, k.name, k.subject, k.roles, k.prefix, k.rate_limit, k.created_by, k.created_at,
+			k.expires_at, k.rotated_at, k.revoked_at, k.previous_hash, old.previous_hash
+	`
+
+	var replaced, superseded *string
+	key, err := scanAPIKey(r.db.QueryRow(ctx, query, id, hash, prefix, graceUntil, now), &replaced, &superseded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	return key, hashes(replaced, superseded), nil
+}
+
+// Revoke revokes a key, returning the hashes it could be used with. It
+// returns pgx.ErrNoRows when no unrevoked key has the ID.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id int64, now time.Time) ([]string, error) {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING key_hash, previous_hash
+	`
+
+	var current string
+	var previous *string
+	if err := r.db.QueryRow(ctx, query, id, now).Scan(&current, &previous); err != nil {
+		return nil, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	return hashes(&current, previous), nil
+}
+
+func scanAPIKey(row pgx.Row, extra ...any) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	dest := []any{
+		&key.ID,
+		&key.Name,
+		&key.Subject,
+		&key.Roles,
+		&key.Prefix,
+		&key.RateLimit,
+		&key.CreatedBy,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.RotatedAt,
+		&key.RevokedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// hashes returns the non-nil hashes
+func hashes(candidates ...*string) []string {
+	var out []string
+	for _, h := range candidates {
+		if h != nil {
+			out = append(out, *h)
+		}
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+// AuditRepository handles audit event persistence
+type AuditRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAuditRepository creates a new AuditRepository instance
+func NewAuditRepository(db *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Insert stores an event, setting its ID
+func (r *AuditRepository) Insert(ctx context.Context, event *model.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (method, actor, impersonator, target_user_id, code, diff, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	var diff any
+	if len(event.Diff) > 0 {
+		diff = event.Diff
+	}
+
+	err := r.db.QueryRow(ctx, query,
+		event.Method,
+		event.Actor,
+		event.Impersonator,
+		event.TargetUserID,
+		event.Code,
+		diff,
+		event.CreatedAt,
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+
+	return nil
+}
+
+// List retrieves the events matching filter ordered after the cursor, most
+// recent first
+func (r *AuditRepository) List(ctx context.Context, filter model.AuditFilter, after pagination.Cursor, limit int) ([]*model.AuditEvent, error) {
+	query := `
+		SELECT id, method, actor, impersonator, target_user_id, code, diff, created_at
+		FROM audit_events
+		WHERE (created_at, id) < ($1, $2)
+			AND ($3 = '' OR actor = $3)
+			AND ($4 = '' OR method = $4)
+			AND ($5 = 0 OR target_user_id = $5)
+			AND created_at >= $6 AND created_at < $7
+			AND ($8 = '' OR impersonator = $8)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $9
+	`
+
+	rows, err := r.db.Query(ctx, query,
+		after.CreatedAt,
+		after.ID,
+		filter.Actor,
+		filter.Method,
+		filter.TargetUserID,
+		filter.From,
+		filter.To,
+		filter.Impersonator,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.AuditEvent
+	for rows.Next() {
+		event := &model.AuditEvent{}
+		err := rows.Scan(
+			&event.ID,
+			&event.Method,
+			&event.Actor,
+			&event.Impersonator,
+			&event.TargetUserID,
+			&event.Code,
+			&event.Diff,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
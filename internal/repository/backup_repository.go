@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// BackupRepository handles backup metadata persistence
+type BackupRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewBackupRepository creates a new BackupRepository instance
+func NewBackupRepository(db *pgxpool.Pool) *BackupRepository {
+	return &BackupRepository{db: db}
+}
+
+const backupColumns = `
+	id, object_key, status, row_counts, size_bytes, error, started_at,
+	completed_at, verify_status, verify_error, verified_at
+`
+
+// Start records a new running backup
+func (r *BackupRepository) Start(ctx context.Context, objectKey string) (*model.Backup, error) {
+	query := `
+		INSERT INTO backups (object_key, status)
+		VALUES ($1, $2)
+		RETURNING ` + backupColumns
+
+	backup, err := scanBackup(r.db.QueryRow(ctx, query, objectKey, model.BackupStatusRunning))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+// Complete marks a backup as completed with its row counts and size
+func (r *BackupRepository) Complete(ctx context.Context, id int64, rowCounts map[string]int64, sizeBytes int64) error {
+	query := `
+		UPDATE backups
+		SET status = $2, row_counts = $3, size_bytes = $4, completed_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, model.BackupStatusCompleted, rowCounts, sizeBytes); err != nil {
+		return fmt.Errorf("failed to complete backup: %w", err)
+	}
+
+	return nil
+}
+
+// Fail marks a backup as failed with the given reason
+func (r *BackupRepository) Fail(ctx context.Context, id int64, reason string) error {
+	query := `
+		UPDATE backups
+		SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, model.BackupStatusFailed, reason); err != nil {
+		return fmt.Errorf("failed to mark backup failed: %w", err)
+	}
+
+	return nil
+}
+
+// RecordVerification stores the outcome of a restore verification
+func (r *BackupRepository) RecordVerification(ctx context.Context, id int64, status model.VerifyStatus, reason string) error {
+	query := `
+		UPDATE backups
+		SET verify_status = $2, verify_error = $3, verified_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, status, reason); err != nil {
+		return fmt.Errorf("failed to record backup verification: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a backup by ID
+func (r *BackupRepository) GetByID(ctx context.Context, id int64) (*model.Backup, error) {
+	query := `SELECT ` + backupColumns + ` FROM backups WHERE id = $1`
+
+	backup, err := scanBackup(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+// LatestUnverified retrieves the most recent completed backup that has not
+// been verified yet, or pgx.ErrNoRows when there is none
+func (r *BackupRepository) LatestUnverified(ctx context.Context) (*model.Backup, error) {
+	query := `
+		SELECT ` + backupColumns + `
+		FROM backups
+		WHERE status = $1 AND verify_status = ''
+		ORDER BY started_at DESC
+		LIMIT 1
+	`
+
+	backup, err := scanBackup(r.db.QueryRow(ctx, query, model.BackupStatusCompleted))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unverified backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+// List retrieves the most recent backups, newest first
+func (r *BackupRepository) List(ctx context.Context, limit int) ([]*model.Backup, error) {
+	query := `
+		SELECT ` + backupColumns + `
+		FROM backups
+		ORDER BY started_at DESC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	defer rows.Close()
+
+	var backups []*model.Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan backup: %w", err)
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, rows.Err()
+}
+
+func scanBackup(row pgx.Row) (*model.Backup, error) {
+	backup := &model.Backup{}
+	err := row.Scan(
+		&backup.ID,
+		&backup.ObjectKey,
+		&backup.Status,
+		&backup.RowCounts,
+		&backup.SizeBytes,
+		&backup.Error,
+		&backup.StartedAt,
+		&backup.CompletedAt,
+		&backup.VerifyStatus,
+		&backup.VerifyError,
+		&backup.VerifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// InvitationRepository handles invitation persistence
+type InvitationRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewInvitationRepository creates a new InvitationRepository instance
+func NewInvitationRepository(db *pgxpool.Pool) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+const invitationColumns = `
+	id, email, name, invited_by, status, token_version, send_count,
+	user_id, expires_at, created_at, accepted_at
+`
+
+// Create stores a new pending invitation
+func (r *InvitationRepository) Create(ctx context.Context, inv *model.Invitation) error {
+	query := `
+		INSERT INTO invitations (email, name, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + invitationColumns
+
+	created, err := scanInvitation(r.db.QueryRow(ctx, query, inv.Email, inv.Name, inv.InvitedBy, inv.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	*inv = *created
+	return nil
+}
+
+// GetByID retrieves an invitation by ID
+func (r *InvitationRepository) GetByID(ctx context.Context, id int64) (*model.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE id = $1`
+
+	inv, err := scanInvitation(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("invitation not found: %w", err)
+	}
+
+	return inv, nil
+}
+
+// Renew extends a pending invitation and bumps its token version, which
+// invalidates every token issued for it before
+func (r *InvitationRepository) Renew(ctx context.Context, id int64, expiresAt time.Time) (*model.Invitation, error) {
+	query := `
+		UPDATE invitations
+		SET token_version = token_version + 1, send_count = send_count + 1, expires_at = $2
+		WHERE id = $1 AND status = 'pending'
+		RETURNING ` + invitationColumns
+
+	inv, err := scanInvitation(r.db.QueryRow(ctx, query, id, expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("pending invitation not found: %w", err)
+	}
+
+	return inv, nil
+}
+
+// Claim marks an unexpired pending invitation as accepted if tokenVersion is
+// current. Only one concurrent caller can claim an invitation.
+func (r *InvitationRepository) Claim(ctx context.Context, id int64, tokenVersion int) (*model.Invitation, error) {
+	query := `
+		UPDATE invitations
+		SET status = 'accepted', accepted_at = NOW()
+		WHERE id = $1 AND token_version = $2 AND status = 'pending' AND expires_at > NOW()
+		RETURNING ` + invitationColumns
+
+	inv, err := scanInvitation(r.db.QueryRow(ctx, query, id, tokenVersion))
+	if err != nil {
+		return nil, fmt.Errorf("pending invitation not found: %w", err)
+	}
+
+	return inv, nil
+}
+
+// Release returns a claimed invitation to pending, used when creating the
+// invited user fails after the claim
+func (r *InvitationRepository) Release(ctx context.Context, id int64) error {
+	query := `
+		UPDATE invitations
+		SET status = 'pending', accepted_at = NULL
+		WHERE id = $1 AND status = 'accepted' AND user_id IS NULL
+	`
+
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to release invitation: %w", err)
+	}
+
+	return nil
+}
+
+// SetUser links an accepted invitation to the user it created
+func (r *InvitationRepository) SetUser(ctx context.Context, id, userID int64) error {
+	query := `UPDATE invitations SET user_id = $2 WHERE id = $1`
+
+	if _, err := r.db.Exec(ctx, query, id, userID); err != nil {
+		return fmt.Errorf("failed to link invitation: %w", err)
+	}
+
+	return nil
+}
+
+// ListPending retrieves pending invitations with pagination, newest first
+func (r *InvitationRepository) ListPending(ctx context.Context, limit, offset int) ([]*model.Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM invitations
+		WHERE status = 'pending'
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []*model.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// CountPending returns the number of pending invitations
+func (r *InvitationRepository) CountPending(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM invitations WHERE status = 'pending'`
+
+	var count int
+	if err := r.db.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count invitations: %w", err)
+	}
+
+	return count, nil
+}
+
+func scanInvitation(row pgx.Row) (*model.Invitation, error) {
+	inv := &model.Invitation{}
+	err := row.Scan(
+		&inv.ID,
+		&inv.Email,
+		&inv.Name,
+		&inv.InvitedBy,
+		&inv.Status,
+		&inv.TokenVersion,
+		&inv.SendCount,
+		&inv.UserID,
+		&inv.ExpiresAt,
+		&inv.CreatedAt,
+		&inv.AcceptedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// OrganizationRepository handles organization and membership persistence
+type OrganizationRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewOrganizationRepository creates a new OrganizationRepository instance
+func NewOrganizationRepository(db *pgxpool.Pool) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// Create creates a new organization
+func (r *OrganizationRepository) Create(ctx context.Context, org *model.Organization) error {
+	query := `
+		INSERT INTO organizations (name, slug, default_timezone, default_locale, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(ctx, query, org.Name, org.Slug, org.DefaultTimezone, org.DefaultLocale, org.CreatedAt, org.UpdatedAt).Scan(&org.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *OrganizationRepository) GetByID(ctx context.Context, id int64) (*model.Organization, error) {
+	query := `
+		SELECT id, name, slug, default_timezone, default_locale, created_at, updated_at
+		FROM organizations
+		WHERE id = $1
+	`
+
+	org, err := scanOrganization(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("organization not found: %w", err)
+	}
+
+	return org, nil
+}
+
+// List retrieves organizations with pagination
+func (r *OrganizationRepository) List(ctx context.Context, limit, offset int) ([]*model.Organization, error) {
+	query := `
+		SELECT id, name, slug, default_timezone, default_locale, created_at, updated_at
+		FROM organizations
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*model.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Count returns the total number of organizations
+func (r *OrganizationRepository) Count(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM organizations`
+
+	var count int
+	if err := r.db.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count organizations: %w", err)
+	}
+
+	return count, nil
+}
+
+// Update updates an existing organization
+func (r *OrganizationRepository) Update(ctx context.Context, org *model.Organization) error {
+	query := `
+		UPDATE organizations
+		SET name = $1, slug = $2, default_timezone = $3, default_locale = $4, updated_at = $5
+		WHERE id = $6
+	`
+
+	_, err := r.db.Exec(ctx, query, org.Name, org.Slug, org.DefaultTimezone, org.DefaultLocale, org.UpdatedAt, org.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	return nil
+}
+
+// Delete deletes an organization and its memberships
+func (r *OrganizationRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM organizations WHERE id = $1`
+
+	_, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertMember adds a user to an organization or changes their role
+func (r *OrganizationRepository) UpsertMember(ctx context.Context, m *model.Membership) error {
+	query := `
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, m.OrganizationID, m.UserID, m.Role).Scan(&m.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add organization member: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from an organization, reporting whether they
+// were a member
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, orgID, userID int64) (bool, error) {
+	query := `DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListMembers retrieves the memberships of an organization with pagination
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID int64, limit, offset int) ([]*model.Membership, error) {
+	query := `
+		SELECT organization_id, user_id, role, created_at
+		FROM organization_members
+		WHERE organization_id = $1
+		ORDER BY created_at, user_id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(ctx, query, orgID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*model.Membership
+	for rows.Next() {
+		m := &model.Membership{}
+		if err := rows.Scan(&m.OrganizationID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization member: %w", err)
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// CountMembers returns the number of members of an organization
+func (r *OrganizationRepository) CountMembers(ctx context.Context, orgID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM organization_members WHERE organization_id = $1`
+
+	var count int
+	if err := r.db.QueryRow(ctx, query, orgID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count organization members: %w", err)
+	}
+
+	return count, nil
+}
+
+func scanOrganization(row pgx.Row) (*model.Organization, error) {
+	org := &model.Organization{}
+	err := row.Scan(
+		&org.ID,
+		&org.Name,
+		&org.Slug,
+		&org.DefaultTimezone,
+		&org.DefaultLocale,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
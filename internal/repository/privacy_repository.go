@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// PrivacyRepository handles the erasure queue and the data related to a
+// user outside of the users table, for exports and erasures
+type PrivacyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPrivacyRepository creates a new PrivacyRepository instance
+func NewPrivacyRepository(db *pgxpool.Pool) *PrivacyRepository {
+	return &PrivacyRepository{db: db}
+}
+
+const erasureColumns = `
+	id, user_id, status, requested_by, attempts, last_error, created_at, completed_at
+`
+
+// Enqueue queues the erasure of a user. While an erasure of the user is
+// pending, it is returned instead of queueing another one.
+func (r *PrivacyRepository) Enqueue(ctx context.Context, userID int64, requestedBy string) (*model.ErasureRequest, error) {
+	query := `
+		INSERT INTO erasure_requests (user_id, requested_by)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) WHERE status = 'pending' DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING ` + erasureColumns
+
+	req, err := scanErasure(r.db.QueryRow(ctx, query, userID, requestedBy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue erasure: %w", err)
+	}
+	return req, nil
+}
+
+// Claim takes the pending erasure due the longest and holds it for lease,
+// so that other instances skip it meanwhile. It returns nil when no
+// erasure is due.
+func (r *PrivacyRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (*model.ErasureRequest, error) {
+	query := `
+		UPDATE erasure_requests
+		SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id = (
+			SELECT id FROM erasure_requests
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + erasureColumns
+
+	req, err := scanErasure(r.db.QueryRow(ctx, query, now, now.Add(lease)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim erasure: %w", err)
+	}
+	return req, nil
+}
+
+// Complete marks an erasure as done
+func (r *PrivacyRepository) Complete(ctx context.Context, id int64, now time.Time) error {
+	query := `
+		UPDATE erasure_requests
+		SET status = 'completed', completed_at = $2, last_error = ''
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, now); err != nil {
+		return fmt.Errorf("failed to complete erasure: %w", err)
+	}
+	return nil
+}
+
+// Fail records why an erasure failed and when to retry it
+func (r *PrivacyRepository) Fail(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	query := `
+		UPDATE erasure_requests
+		SET last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, reason, retryAt); err != nil {
+		return fmt.Errorf("failed to record erasure failure: %w", err)
+	}
+	return nil
+}
+
+// EraseRelated removes the personal data of a user kept outside of the
+// users table in one transaction: its sessions are deleted, the invitation
+// it accepted takes email and an empty name, and the values in the diffs
+// of audit events acting on it are replaced, keeping the names of the
+// changed fields. Erasing again changes nothing.
+func (r *PrivacyRepository) EraseRelated(ctx context.Context, userID int64, email string) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE invitations SET email = $2, name = '' WHERE user_id = $1`, userID, email); err != nil {
+			return fmt.Errorf("failed to anonymize invitations: %w", err)
+		}
+
+		query := `
+			UPDATE audit_events
+			SET diff = (
+				SELECT jsonb_object_agg(field, '{"before": "[erased]", "after": "[erased]"}'::jsonb)
+				FROM jsonb_object_keys(diff) AS field
+			)
+			WHERE target_user_id = $1 AND diff IS NOT NULL
+		`
+		if _, err := tx.Exec(ctx, query, userID); err != nil {
+			return fmt.Errorf("failed to anonymize audit events: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Memberships lists the organizations a user belongs to
+func (r *PrivacyRepository) Memberships(ctx context.Context, userID int64) ([]*model.Membership, error) {
+	query := `
+		SELECT organization_id, user_id, role, created_at
+		FROM organization_members
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*model.Membership
+	for rows.Next() {
+		m := &model.Membership{}
+		if err := rows.Scan(&m.OrganizationID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		memberships = append(memberships, m)
+	}
+
+	return memberships, rows.Err()
+}
+
+// Sessions lists every session of a user, ended ones included
+func (r *PrivacyRepository) Sessions(ctx context.Context, userID int64) ([]*model.Session, error) {
+	query := `
+		SELECT id, user_id, created_at, expires_at, refreshed_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*model.Session
+	for rows.Next() {
+		s := &model.Session{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.RefreshedAt, &s.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Invitations lists the invitations a user accepted
+func (r *PrivacyRepository) Invitations(ctx context.Context, userID int64) ([]*model.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []*model.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// AuditEvents lists the audit events acting on a user or made by actor,
+// oldest first
+func (r *PrivacyRepository) AuditEvents(ctx context.Context, userID int64, actor string) ([]*model.AuditEvent, error) {
+	query := `
+		SELECT id, method, actor, target_user_id, code, diff, created_at
+		FROM audit_events
+		WHERE target_user_id = $1 OR actor = $2
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, actor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.AuditEvent
+	for rows.Next() {
+		event := &model.AuditEvent{}
+		err := rows.Scan(
+			&event.ID,
+			&event.Method,
+			&event.Actor,
+			&event.TargetUserID,
+			&event.Code,
+			&event.Diff,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func scanErasure(row pgx.Row) (*model.ErasureRequest, error) {
+	req := &model.ErasureRequest{}
+	err := row.Scan(
+		&req.ID,
+		&req.UserID,
+		&req.Status,
+		&req.RequestedBy,
+		&req.Attempts,
+		&req.LastError,
+		&req.CreatedAt,
+		&req.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
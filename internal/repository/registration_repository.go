@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// RegistrationRepository handles pending self-registration persistence
+type RegistrationRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewRegistrationRepository creates a new RegistrationRepository instance
+func NewRegistrationRepository(db *pgxpool.Pool) *RegistrationRepository {
+	return &RegistrationRepository{db: db}
+}
+
+// UpsertPending stores a pending registration, replacing the token and expiry
+// of an earlier registration for the same email
+func (r *RegistrationRepository) UpsertPending(ctx context.Context, reg *model.PendingRegistration, tokenHash []byte) error {
+	query := `
+		INSERT INTO pending_registrations (email, name, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (email) DO UPDATE SET
+			name = EXCLUDED.name,
+			token_hash = EXCLUDED.token_hash,
+			expires_at = EXCLUDED.expires_at,
+			created_at = NOW()
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, reg.Email, reg.Name, tokenHash, reg.ExpiresAt).Scan(&reg.ID, &reg.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store pending registration: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumePending removes and returns the unexpired registration matching
+// tokenHash, so that every token can be used only once
+func (r *RegistrationRepository) ConsumePending(ctx context.Context, tokenHash []byte) (*model.PendingRegistration, error) {
+	query := `
+		DELETE FROM pending_registrations
+		WHERE token_hash = $1 AND expires_at > NOW()
+		RETURNING id, email, name, expires_at, created_at
+	`
+
+	reg := &model.PendingRegistration{}
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(
+		&reg.ID,
+		&reg.Email,
+		&reg.Name,
+		&reg.ExpiresAt,
+		&reg.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("pending registration not found: %w", err)
+	}
+
+	return reg, nil
+}
+
+// PruneExpired deletes registrations that expired before the given time
+func (r *RegistrationRepository) PruneExpired(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM pending_registrations WHERE expires_at < $1`
+
+	tag, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune pending registrations: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// ReportRepository handles the queue of user reports
+type ReportRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewReportRepository creates a new ReportRepository instance
+func NewReportRepository(db *pgxpool.Pool) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+const reportColumns = `
+	id, format, filter, requested_by, status, attempts, last_error, object_key, row_count, created_at, completed_at
+`
+
+// Enqueue queues a report of the users matching filter
+func (r *ReportRepository) Enqueue(ctx context.Context, format string, filter UserFilter, requestedBy string) (*model.UserReport, error) {
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report filter: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_reports (format, filter, requested_by)
+		VALUES ($1, $2::jsonb, $3)
+		RETURNING ` + reportColumns
+
+	report, _, err := scanReport(r.db.QueryRow(ctx, query, format, string(data), requestedBy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue report: %w", err)
+	}
+	return report, nil
+}
+
+// Get retrieves a report by ID
+func (r *ReportRepository) Get(ctx context.Context, id int64) (*model.UserReport, error) {
+	report, _, err := scanReport(r.db.QueryRow(ctx, `SELECT `+reportColumns+` FROM user_reports WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Claim takes the pending report due the longest together with its filter
+// and holds it for lease, so that other instances skip it meanwhile. It
+// returns nil when no report is due.
+func (r *ReportRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (*model.UserReport, UserFilter, error) {
+	query := `
+		UPDATE user_reports
+		SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id = (
+			SELECT id FROM user_reports
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + reportColumns
+
+	report, filter, err := scanReport(r.db.QueryRow(ctx, query, now, now.Add(lease)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, UserFilter{}, nil
+	}
+	if err != nil {
+		return nil, UserFilter{}, fmt.Errorf("failed to claim report: %w", err)
+	}
+	return report, filter, nil
+}
+
+// Complete marks a report as done, stored under objectKey
+func (r *ReportRepository) Complete(ctx context.Context, id int64, objectKey string, rows int64, now time.Time) error {
+	query := `
+		UPDATE user_reports
+		SET status = 'completed', object_key = $2, row_count = $3, completed_at = $4, last_error = ''
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, objectKey, rows, now); err != nil {
+		return fmt.Errorf("failed to complete report: %w", err)
+	}
+	return nil
+}
+
+// Fail records why a report failed and when to retry it, or gives up on
+// it when retryAt is zero
+func (r *ReportRepository) Fail(ctx context.Context, id int64, reason string, retryAt, now time.Time) error {
+	query := `
+		UPDATE user_reports
+		SET last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`
+	args := []any{id, reason, retryAt}
+	if retryAt.IsZero() {
+		query = `
+			UPDATE user_reports
+			SET status = 'failed', last_error = $2, completed_at = $3
+			WHERE id = $1
+		`
+		args = []any{id, reason, now}
+	}
+
+	if _, err := r.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to record report failure: %w", err)
+	}
+	return nil
+}
+
+func scanReport(row pgx.Row) (*model.UserReport, UserFilter, error) {
+	report := &model.UserReport{}
+	var filter UserFilter
+	err := row.Scan(
+		&report.ID,
+		&report.Format,
+		&filter,
+		&report.RequestedBy,
+		&report.Status,
+		&report.Attempts,
+		&report.LastError,
+		&report.ObjectKey,
+		&report.Rows,
+		&report.CreatedAt,
+		&report.CompletedAt,
+	)
+	if err != nil {
+		return nil, UserFilter{}, err
+	}
+	return report, filter, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/sharding"
+)
+
+// Router picks the database holding the rows of a shard key
+type Router interface {
+	Pool(key sharding.Key) *pgxpool.Pool
+}
+
+// SinglePool routes every key to one database, the unsharded default
+type SinglePool struct {
+	DB *pgxpool.Pool
+}
+
+// Pool implements Router
+func (s SinglePool) Pool(sharding.Key) *pgxpool.Pool {
+	return s.DB
+}
+
+// RingRouter routes keys to per-shard databases with a consistent hash ring
+type RingRouter struct {
+	ring  *sharding.Ring
+	pools map[string]*pgxpool.Pool
+}
+
+// NewRingRouter creates a RingRouter over pools keyed by shard name
+func NewRingRouter(pools map[string]*pgxpool.Pool, vnodes int) *RingRouter {
+	shards := make([]string, 0, len(pools))
+	for shard := range pools {
+		shards = append(shards, shard)
+	}
+	return &RingRouter{
+		ring:  sharding.NewRing(shards, vnodes),
+		pools: pools,
+	}
+}
+
+// Pool implements Router
+func (r *RingRouter) Pool(key sharding.Key) *pgxpool.Pool {
+	return r.pools[r.ring.Locate(key)]
+}
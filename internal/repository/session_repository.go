@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// SessionRepository handles login session persistence. Sessions are looked
+// up by the hex SHA-256 hash of their refresh token.
+type SessionRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewSessionRepository creates a new SessionRepository instance
+func NewSessionRepository(db *pgxpool.Pool) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, created_at, expires_at, refreshed_at, revoked_at`
+
+// Create stores a new session with the given refresh token hash
+func (r *SessionRepository) Create(ctx context.Context, session *model.Session, hash string) error {
+	query := `
+		INSERT INTO sessions (user_id, refresh_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + sessionColumns
+
+	created, err := scanSession(r.db.QueryRow(ctx, query, session.UserID, hash, session.CreatedAt, session.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	*session = *created
+	return nil
+}
+
+// Refresh replaces the refresh token hash of the active session holding
+// hash. It returns pgx.ErrNoRows when no session active at now holds it.
+func (r *SessionRepository) Refresh(ctx context.Context, hash, newHash string, now time.Time) (*model.Session, error) {
+	query := `
+		UPDATE sessions
+		SET previous_hash = refresh_hash, refresh_hash = $2, refreshed_at = $3
+		WHERE refresh_hash = $1 AND revoked_at IS NULL AND expires_at > $3
+		RETURNING ` + sessionColumns
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, hash, newHash, now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh session: %w", err)
+	}
+
+	return session, nil
+}
+
+// RevokeReplaced revokes the active session whose replaced refresh token
+// hash is hash, returning its ID. It returns pgx.ErrNoRows when there is
+// none.
+func (r *SessionRepository) RevokeReplaced(ctx context.Context, hash string, now time.Time) (int64, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $2
+		WHERE previous_hash = $1 AND revoked_at IS NULL
+		RETURNING id
+	`
+
+	var id int64
+	if err := r.db.QueryRow(ctx, query, hash, now).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return id, nil
+}
+
+// Revoke revokes the active session holding hash. It returns pgx.ErrNoRows
+// when no active session holds it.
+func (r *SessionRepository) Revoke(ctx context.Context, hash string, now time.Time) (*model.Session, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $2
+		WHERE refresh_hash = $1 AND revoked_at IS NULL
+		RETURNING ` + sessionColumns
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, hash, now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return session, nil
+}
+
+// RevokeAll revokes every active session of a user, returning their IDs
+func (r *SessionRepository) RevokeAll(ctx context.Context, userID int64, now time.Time) ([]int64, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+		RETURNING id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return ids, nil
+}
+
+// DeleteExpired deletes sessions that expired before cutoff
+func (r *SessionRepository) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func scanSession(row pgx.Row) (*model.Session, error) {
+	s := &model.Session{}
+	if err := row.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.RefreshedAt, &s.RevokedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// conn is the subset of a pool or transaction the user queries need
+type conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+// scopedTx is a transaction carried by a context together with its database
+type scopedTx struct {
+	tx   pgx.Tx
+	pool *pgxpool.Pool
+}
+
+// InTx runs fn in a transaction on the primary database. Writes made through
+// the context passed to fn join the transaction, each under its own
+// savepoint, and commit or roll back with it. Writes to users on another
+// shard are not part of the transaction. Nested calls join the outermost
+// transaction.
+func (r *UserRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*scopedTx); ok {
+		return fn(ctx)
+	}
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, &scopedTx{tx: tx, pool: r.db}))
+	})
+}
+
+// conn returns the transaction of ctx when it runs on pool, and pool otherwise
+func (r *UserRepository) conn(ctx context.Context, pool *pgxpool.Pool) conn {
+	if scoped, ok := ctx.Value(txKey{}).(*scopedTx); ok && scoped.pool == pool {
+		return scoped.tx
+	}
+	return pool
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// UsageRepository handles per-caller usage persistence
+type UsageRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewUsageRepository creates a new UsageRepository instance
+func NewUsageRepository(db *pgxpool.Pool) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// AddUsage adds the given records to the stored hourly totals
+func (r *UsageRepository) AddUsage(ctx context.Context, records []*model.UsageRecord) error {
+	query := `
+		INSERT INTO usage_hourly (caller, hour, requests, db_time_ms, cache_ops, bytes_in, bytes_out)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (caller, hour) DO UPDATE SET
+			requests = usage_hourly.requests + EXCLUDED.requests,
+			db_time_ms = usage_hourly.db_time_ms + EXCLUDED.db_time_ms,
+			cache_ops = usage_hourly.cache_ops + EXCLUDED.cache_ops,
+			bytes_in = usage_hourly.bytes_in + EXCLUDED.bytes_in,
+			bytes_out = usage_hourly.bytes_out + EXCLUDED.bytes_out
+	`
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, record := range records {
+			batch.Queue(query,
+				record.Caller,
+				record.Hour,
+				record.Requests,
+				record.DBTimeMs,
+				record.CacheOps,
+				record.BytesIn,
+				record.BytesOut,
+			)
+		}
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to add usage: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Report retrieves hourly usage between from and to, optionally for a single caller
+func (r *UsageRepository) Report(ctx context.Context, caller string, from, to time.Time) ([]*model.UsageRecord, error) {
+	query := `
+		SELECT caller, hour, requests, db_time_ms, cache_ops, bytes_in, bytes_out
+		FROM usage_hourly
+		WHERE hour >= $1 AND hour < $2 AND ($3 = '' OR caller = $3)
+		ORDER BY hour, caller
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, caller)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage report: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*model.UsageRecord
+	for rows.Next() {
+		record := &model.UsageRecord{}
+		err := rows.Scan(
+			&record.Caller,
+			&record.Hour,
+			&record.Requests,
+			&record.DBTimeMs,
+			&record.CacheOps,
+			&record.BytesIn,
+			&record.BytesOut,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/crypto"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// MetadataEncryption selects the user metadata values encrypted at rest.
+// The zero value encrypts nothing.
+type MetadataEncryption struct {
+	Cipher crypto.Cipher
+	// Keys are the metadata keys whose values are encrypted; "*" encrypts
+	// the values of every key
+	Keys []string
+}
+
+// encrypts reports whether the values of key are encrypted
+func (e MetadataEncryption) encrypts(key string) bool {
+	return e.Cipher != nil && (slices.Contains(e.Keys, "*") || slices.Contains(e.Keys, key))
+}
+
+// MetadataSearchable reports whether users can be searched by the value of
+// a metadata key, which is not the case for encrypted values
+func (r *UserRepository) MetadataSearchable(key string) bool {
+	return !r.encryption.encrypts(key)
+}
+
+// sealMetadata encodes metadata for a jsonb parameter like metadataJSON,
+// with the values of the encrypted keys sealed
+func (r *UserRepository) sealMetadata(ctx context.Context, metadata map[string]string) (string, error) {
+	sealed := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if r.encryption.encrypts(key) {
+			var err error
+			if value, err = r.encryption.Cipher.Seal(ctx, value, metadataField(key)); err != nil {
+				return "", fmt.Errorf("failed to encrypt metadata %s: %w", key, err)
+			}
+		}
+		sealed[key] = value
+	}
+	return metadataJSON(sealed), nil
+}
+
+// openMetadata decrypts the sealed values of metadata in place. Values are
+// decrypted whether or not their key is still encrypted, so keys can be
+// taken off the list without losing data.
+func (r *UserRepository) openMetadata(ctx context.Context, metadata map[string]string) error {
+	if r.encryption.Cipher == nil {
+		return nil
+	}
+	for key, value := range metadata {
+		if !strings.HasPrefix(value, crypto.Prefix) {
+			continue
+		}
+		plaintext, err := r.encryption.Cipher.Open(ctx, value, metadataField(key))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt metadata %s: %w", key, err)
+		}
+		metadata[key] = plaintext
+	}
+	return nil
+}
+
+// openUsers decrypts the metadata of users in place
+func (r *UserRepository) openUsers(ctx context.Context, users ...*model.User) error {
+	for _, user := range users {
+		if err := r.openMetadata(ctx, user.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openHistory decrypts the metadata of history entries in place
+func (r *UserRepository) openHistory(ctx context.Context, entries []*model.UserHistoryEntry) error {
+	for _, entry := range entries {
+		if err := r.openMetadata(ctx, entry.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metadataField is the associated data of a sealed metadata value, so a
+// value cannot be moved to another key
+func metadataField(key string) string {
+	return "users.metadata." + key
+}
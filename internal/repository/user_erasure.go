@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// GetStored retrieves a user whether or not it is deleted, with the time
+// it was deleted at or nil
+func (r *UserRepository) GetStored(ctx context.Context, id int64) (*model.User, *time.Time, error) {
+	query := `
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at, deleted_at
+		FROM users
+		WHERE id = $1
+	`
+
+	user := &model.User{}
+	var deletedAt *time.Time
+	err := r.shard(id).QueryRow(ctx, query, id).Scan(
+		&user.ID,
+		&user.UUID,
+		&user.Email,
+		&user.Name,
+		&user.Metadata,
+		&user.AvatarURL,
+		&user.Timezone,
+		&user.Locale,
+		&user.Guest,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&deletedAt,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("user not found: %w", err)
+	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, nil, err
+	}
+
+	return user, deletedAt, nil
+}
+
+// Anonymize replaces the personal data of a user and of its history with
+// email and empty values, and soft-deletes the user when it is active, in
+// which case it returns true. It returns pgx.ErrNoRows when the user does
+// not exist. Anonymizing a user again changes nothing.
+func (r *UserRepository) Anonymize(ctx context.Context, id int64, email string) (bool, error) {
+	query := `
+		UPDATE users u
+		SET email = $2, name = '', metadata = '{}', avatar_url = '', timezone = '', locale = '',
+			password_hash = NULL, deleted_at = COALESCE(old.deleted_at, NOW()), updated_at = NOW()
+		FROM (SELECT id, deleted_at FROM users WHERE id = $1 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING u.id, u.uuid, u.email, u.name, u.metadata, u.avatar_url, u.timezone, u.locale, u.guest, u.created_at, u.updated_at,
+			old.deleted_at IS NULL
+	`
+
+	var deleted bool
+	err := pgx.BeginFunc(ctx, r.conn(ctx, r.shard(id)), func(tx pgx.Tx) error {
+		user := &model.User{}
+		err := tx.QueryRow(ctx, query, id, email).Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&deleted,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE users_history SET email = $2, name = '', metadata = '{}' WHERE user_id = $1`, id, email)
+		if err != nil {
+			return fmt.Errorf("failed to anonymize user history: %w", err)
+		}
+
+		if !deleted {
+			return nil
+		}
+		return recordHistory(ctx, tx, model.HistoryOperationDelete, user)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// UpgradeGuest gives a guest its email and password hash, turning it into
+// a regular user with the same ID and history. It returns pgx.ErrNoRows
+// when no active guest has the ID, and ErrEmailTaken when an active user
+// already has the email.
+func (r *UserRepository) UpgradeGuest(ctx context.Context, id int64, email, passwordHash string, upgradedAt time.Time) (*model.User, error) {
+	query := `
+		UPDATE users
+		SET email = $2, password_hash = $3, guest = false, updated_at = $4
+		WHERE id = $1 AND guest AND deleted_at IS NULL
+		RETURNING id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+	`
+
+	user := &model.User{}
+	err := pgx.BeginFunc(ctx, r.conn(ctx, r.shard(id)), func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, id, email, passwordHash, upgradedAt).Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade guest: %w", mapWriteError(err))
+		}
+
+		return recordHistory(ctx, tx, model.HistoryOperationUpdate, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// recordHistory appends a snapshot of the user to users_history within tx.
+// The metadata is copied as stored in the users row, encrypted values
+// included, so the user must be written in tx first.
+func recordHistory(ctx context.Context, tx pgx.Tx, op model.HistoryOperation, user *model.User) error {
+	query := `
+		INSERT INTO users_history (user_id, user_uuid, operation, email, name, metadata, created_at, updated_at)
+		SELECT $1, NULLIF($2, '')::uuid, $3, $4, $5, metadata, $6, $7
+		FROM users
+		WHERE id = $1
+	`
+
+	_, err := tx.Exec(ctx, query, user.ID, user.UUID, string(op), user.Email, user.Name, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record user history: %w", err)
+	}
+
+	return nil
+}
+
+// History retrieves the change history of a user, newest first
+func (r *UserRepository) History(ctx context.Context, userID int64, limit, offset int) ([]*model.UserHistoryEntry, error) {
+	query := `
+		SELECT id, user_id, COALESCE(user_uuid::text, ''), operation, email, name, metadata, created_at, updated_at, changed_at
+		FROM users_history
+		WHERE user_id = $1
+		ORDER BY changed_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.shard(userID).Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*model.UserHistoryEntry
+	for rows.Next() {
+		entry := &model.UserHistoryEntry{}
+		err := rows.Scan(
+			&entry.Version,
+			&entry.UserID,
+			&entry.UserUUID,
+			&entry.Operation,
+			&entry.Email,
+			&entry.Name,
+			&entry.Metadata,
+			&entry.CreatedAt,
+			&entry.UpdatedAt,
+			&entry.ChangedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := r.openHistory(ctx, entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetAsOf reconstructs a user as it was at the given time from its history
+func (r *UserRepository) GetAsOf(ctx context.Context, id int64, asOf time.Time) (*model.User, error) {
+	query := `
+		SELECT operation, user_id, COALESCE(user_uuid::text, ''), email, name, metadata, created_at, updated_at, changed_at
+		FROM users_history
+		WHERE user_id = $1 AND changed_at <= $2
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1
+	`
+
+	var (
+		op        model.HistoryOperation
+		changedAt time.Time
+	)
+	user := &model.User{}
+	err := r.shard(id).QueryRow(ctx, query, id, asOf).Scan(
+		&op,
+		&user.ID,
+		&user.UUID,
+		&user.Email,
+		&user.Name,
+		&user.Metadata,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&changedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if op == model.HistoryOperationDelete {
+		return nil, fmt.Errorf("user not found: deleted at %s", changedAt.Format(time.RFC3339))
+	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangesSince retrieves history entries after the position (txid, since),
+// ordered by the transaction that recorded them, then by version. Only
+// entries of transactions older than every transaction still running are
+// returned, so no entry can later appear before the last one returned.
+func (r *UserRepository) ChangesSince(ctx context.Context, txid, since int64, limit int) ([]*model.UserHistoryEntry, error) {
+	query := `
+		SELECT id, txid, user_id, COALESCE(user_uuid::text, ''), operation, email, name, metadata, created_at, updated_at, changed_at
+		FROM users_history
+		WHERE (txid, id) > ($1, $2)
+		  AND txid < (SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint)
+		ORDER BY txid, id
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(ctx, query, txid, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user changes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*model.UserHistoryEntry
+	for rows.Next() {
+		entry := &model.UserHistoryEntry{}
+		err := rows.Scan(
+			&entry.Version,
+			&entry.TxID,
+			&entry.UserID,
+			&entry.UserUUID,
+			&entry.Operation,
+			&entry.Email,
+			&entry.Name,
+			&entry.Metadata,
+			&entry.CreatedAt,
+			&entry.UpdatedAt,
+			&entry.ChangedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user change: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.openHistory(ctx, entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// HistoryWatermark returns the position ChangesSince continues from to
+// return every change not yet visible to a read started now: the
+// transaction before the oldest one still running, with the highest
+// version currently stored. Changes of that transaction and older ones are
+// all visible already.
+func (r *UserRepository) HistoryWatermark(ctx context.Context) (txid, version int64, err error) {
+	query := `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint - 1, COALESCE(MAX(id), 0) FROM users_history`
+
+	err = r.db.QueryRow(ctx, query).Scan(&txid, &version)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get history watermark: %w", err)
+	}
+
+	return txid, version, nil
+}
+
+// HistoryRange retrieves history entries recorded in [from, to) with a
+// version greater than afterVersion, oldest first. Empty ops or userIDs
+// match every operation or user.
+func (r *UserRepository) HistoryRange(ctx context.Context, from, to time.Time, ops []model.HistoryOperation, userIDs []int64, afterVersion int64, limit int) ([]*model.UserHistoryEntry, error) {
+	query := `
+		SELECT id, user_id, COALESCE(user_uuid::text, ''), operation, email, name, metadata, created_at, updated_at, changed_at
+		FROM users_history
+		WHERE changed_at >= $1 AND changed_at < $2 AND id > $3
+		  AND (cardinality($4::text[]) = 0 OR operation = ANY($4))
+		  AND (cardinality($5::bigint[]) = 0 OR user_id = ANY($5))
+		ORDER BY id
+		LIMIT $6
+	`
+
+	opNames := make([]string, len(ops))
+	for i, op := range ops {
+		opNames[i] = string(op)
+	}
+	if userIDs == nil {
+		userIDs = []int64{}
+	}
+
+	rows, err := r.db.Query(ctx, query, from, to, afterVersion, opNames, userIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user history range: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*model.UserHistoryEntry
+	for rows.Next() {
+		entry := &model.UserHistoryEntry{}
+		err := rows.Scan(
+			&entry.Version,
+			&entry.UserID,
+			&entry.UserUUID,
+			&entry.Operation,
+			&entry.Email,
+			&entry.Name,
+			&entry.Metadata,
+			&entry.CreatedAt,
+			&entry.UpdatedAt,
+			&entry.ChangedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.openHistory(ctx, entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// HistoryBounds returns the lowest and highest history versions currently stored
+func (r *UserRepository) HistoryBounds(ctx context.Context) (minVersion, maxVersion int64, err error) {
+	query := `SELECT COALESCE(MIN(id), 0), COALESCE(MAX(id), 0) FROM users_history`
+
+	err = r.db.QueryRow(ctx, query).Scan(&minVersion, &maxVersion)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get history bounds: %w", err)
+	}
+
+	return minVersion, maxVersion, nil
+}
+
+// CountHistory returns the number of history entries for a user
+func (r *UserRepository) CountHistory(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM users_history WHERE user_id = $1`
+
+	var count int
+	err := r.shard(userID).QueryRow(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count user history: %w", err)
+	}
+
+	return count, nil
+}
+
+// PruneHistory deletes history entries recorded before the given time
+func (r *UserRepository) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM users_history WHERE changed_at < $1`
+
+	tag, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune user history: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// Import inserts a batch of users with COPY and returns the users inserted.
+// Users whose email already belongs to an active user, or appears earlier in
+// the batch, are skipped rather than failing the batch. The history of the
+// inserted users is recorded in the same transaction.
+func (r *UserRepository) Import(ctx context.Context, users []*model.User, createdAt time.Time) ([]*model.User, error) {
+	query := `
+		WITH inserted AS (
+			INSERT INTO users (email, name, created_at, updated_at)
+			SELECT DISTINCT ON (email) email, name, $1::timestamptz, $1::timestamptz
+			FROM users_import
+			ORDER BY email, position
+			ON CONFLICT (email) WHERE deleted_at IS NULL DO NOTHING
+			RETURNING id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+		), history AS (
+			INSERT INTO users_history (user_id, user_uuid, operation, email, name, metadata, created_at, updated_at)
+			SELECT id, uuid, $2, email, name, metadata, created_at, updated_at FROM inserted
+		)
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at FROM inserted ORDER BY id
+	`
+
+	var imported []*model.User
+	err := pgx.BeginFunc(ctx, r.conn(ctx, r.db), func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			CREATE TEMPORARY TABLE IF NOT EXISTS users_import (
+				position INT NOT NULL,
+				email VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL
+			) ON COMMIT DELETE ROWS
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to create import table: %w", err)
+		}
+		// The table outlives savepoints, so clear rows of an earlier batch
+		// of the same transaction
+		if _, err := tx.Exec(ctx, `TRUNCATE users_import`); err != nil {
+			return fmt.Errorf("failed to clear import table: %w", err)
+		}
+
+		_, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"users_import"},
+			[]string{"position", "email", "name"},
+			pgx.CopyFromSlice(len(users), func(i int) ([]any, error) {
+				return []any{i, users[i].Email, users[i].Name}, nil
+			}),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to copy users: %w", err)
+		}
+
+		rows, err := tx.Query(ctx, query, createdAt, string(model.HistoryOperationCreate))
+		if err != nil {
+			return fmt.Errorf("failed to import users: %w", err)
+		}
+		imported, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.User, error) {
+			user := &model.User{}
+			err := row.Scan(
+				&user.ID,
+				&user.UUID,
+				&user.Email,
+				&user.Name,
+				&user.Metadata,
+				&user.AvatarURL,
+				&user.Timezone,
+				&user.Locale,
+				&user.Guest,
+				&user.CreatedAt,
+				&user.UpdatedAt,
+			)
+			return user, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan imported user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return imported, nil
+}
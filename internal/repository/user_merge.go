@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// Merge folds the user sourceID into target, which holds the merged fields
+// to store. In one transaction on the primary database it:
+//   - moves the organization memberships of the source to the target,
+//     keeping the higher role where both are members;
+//   - re-points accepted invitations and audit events at the target;
+//   - soft-deletes the source, marking it merged so it cannot be restored;
+//   - writes the target and records both changes in the history.
+//
+// It returns pgx.ErrNoRows unless both users exist and are active.
+func (r *UserRepository) Merge(ctx context.Context, sourceID int64, target *model.User) error {
+	lockQuery := `
+		SELECT id
+		FROM users
+		WHERE id IN ($1, $2) AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	tombstoneQuery := `
+		UPDATE users
+		SET deleted_at = $3, merged_into = $2
+		WHERE id = $1
+		RETURNING id, uuid, email, name, created_at, updated_at
+	`
+	// Deleting the source's memberships after the tombstone keeps the
+	// counters right: the user trigger has already counted them as deleted.
+	membershipsQuery := `
+		WITH moved AS (
+			DELETE FROM organization_members
+			WHERE user_id = $1
+			RETURNING organization_id, role, created_at
+		)
+		INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		SELECT organization_id, $2, role, created_at FROM moved
+		ON CONFLICT (organization_id, user_id) DO UPDATE SET role = CASE
+			WHEN 'owner' IN (organization_members.role, EXCLUDED.role) THEN 'owner'
+			WHEN 'admin' IN (organization_members.role, EXCLUDED.role) THEN 'admin'
+			ELSE organization_members.role
+		END
+	`
+	updateTargetQuery := `
+		UPDATE users
+		SET metadata = $1::jsonb, timezone = $2, locale = $3, updated_at = $4
+		WHERE id = $5
+	`
+
+	metadata, err := r.sealMetadata(ctx, target.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, r.conn(ctx, r.db), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, lockQuery, sourceID, target.ID)
+		if err != nil {
+			return fmt.Errorf("failed to lock users: %w", err)
+		}
+		active, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return fmt.Errorf("failed to lock users: %w", err)
+		}
+		if len(active) != 2 {
+			return pgx.ErrNoRows
+		}
+
+		source := &model.User{}
+		err = tx.QueryRow(ctx, tombstoneQuery, sourceID, target.ID, target.UpdatedAt).Scan(
+			&source.ID,
+			&source.UUID,
+			&source.Email,
+			&source.Name,
+			&source.CreatedAt,
+			&source.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to delete merged user: %w", err)
+		}
+		if err := recordHistory(ctx, tx, model.HistoryOperationDelete, source); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, membershipsQuery, sourceID, target.ID); err != nil {
+			return fmt.Errorf("failed to move memberships: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE invitations SET user_id = $2 WHERE user_id = $1`, sourceID, target.ID); err != nil {
+			return fmt.Errorf("failed to move invitations: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE audit_events SET target_user_id = $2 WHERE target_user_id = $1`, sourceID, target.ID); err != nil {
+			return fmt.Errorf("failed to move audit events: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, updateTargetQuery, metadata, target.Timezone, target.Locale, target.UpdatedAt, target.ID); err != nil {
+			return fmt.Errorf("failed to update merged user: %w", err)
+		}
+		return recordHistory(ctx, tx, model.HistoryOperationUpdate, target)
+	})
+}
@@ -2,58 +2,201 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/sharding"
 )
 
-// UserRepository handles user data persistence
+// ErrEmailTaken is returned when writing a user whose email belongs to
+// another active user
+var ErrEmailTaken = errors.New("email already in use")
+
+// uniqueViolation is the Postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// mapWriteError maps violations of the active email uniqueness index to
+// ErrEmailTaken
+func mapWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "idx_users_email_active" {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// UserRepository handles user data persistence. Queries addressing a single
+// user by ID go through the shard router; creates, listings and other
+// cross-user queries still run on the primary database until user IDs are
+// allocated per shard.
 type UserRepository struct {
-	db *pgxpool.Pool
+	db         *pgxpool.Pool
+	router     Router
+	encryption MetadataEncryption
 }
 
 // NewUserRepository creates a new UserRepository instance
-func NewUserRepository(db *pgxpool.Pool) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *pgxpool.Pool, encryption MetadataEncryption) *UserRepository {
+	return NewShardedUserRepository(db, SinglePool{DB: db}, encryption)
+}
+
+// NewShardedUserRepository creates a UserRepository routing single-user
+// queries through router
+func NewShardedUserRepository(db *pgxpool.Pool, router Router, encryption MetadataEncryption) *UserRepository {
+	return &UserRepository{db: db, router: router, encryption: encryption}
+}
+
+// shard returns the database holding the user with the given ID
+func (r *UserRepository) shard(id int64) *pgxpool.Pool {
+	return r.router.Pool(sharding.UserKey(id))
 }
 
-// Create creates a new user in the database
+// Create creates a new user in the database. It returns ErrEmailTaken when
+// an active user already has the email.
 func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
 	query := `
-		INSERT INTO users (email, name, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id
+		INSERT INTO users (email, name, metadata, timezone, locale, guest, created_at, updated_at)
+		VALUES ($1, $2, $3::jsonb, $4, $5, $6, $7, $8)
+		RETURNING id, uuid
 	`
 
-	err := r.db.QueryRow(ctx, query, user.Email, user.Name, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+	metadata, err := r.sealMetadata(ctx, user.Metadata)
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return err
 	}
 
-	return nil
+	return pgx.BeginFunc(ctx, r.conn(ctx, r.db), func(tx pgx.Tx) error {
+		// The check fails fast with a clear error in the common case; the
+		// unique index still settles concurrent creates
+		var taken bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND deleted_at IS NULL)`, user.Email).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("failed to check email: %w", err)
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+
+		err = tx.QueryRow(ctx, query, user.Email, user.Name, metadata, user.Timezone, user.Locale, user.Guest, user.CreatedAt, user.UpdatedAt).Scan(&user.ID, &user.UUID)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", mapWriteError(err))
+		}
+
+		return recordHistory(ctx, tx, model.HistoryOperationCreate, user)
+	})
+}
+
+// CreateMany creates users in a single transaction, returning one error per
+// user. Each insert runs under its own savepoint so a failing user does not
+// abort the others; with atomic the first failure rolls back the whole
+// transaction and the remaining users are not attempted.
+func (r *UserRepository) CreateMany(ctx context.Context, users []*model.User, atomic bool) ([]error, error) {
+	query := `
+		INSERT INTO users (email, name, metadata, timezone, locale, created_at, updated_at)
+		VALUES ($1, $2, $3::jsonb, $4, $5, $6, $7)
+		RETURNING id, uuid
+	`
+
+	metadata := make([]string, len(users))
+	for i, user := range users {
+		var err error
+		if metadata[i], err = r.sealMetadata(ctx, user.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	errs := make([]error, len(users))
+	var failed bool
+
+	err := pgx.BeginFunc(ctx, r.conn(ctx, r.db), func(tx pgx.Tx) error {
+		for i, user := range users {
+			errs[i] = pgx.BeginFunc(ctx, tx, func(sp pgx.Tx) error {
+				if err := sp.QueryRow(ctx, query, user.Email, user.Name, metadata[i], user.Timezone, user.Locale, user.CreatedAt, user.UpdatedAt).Scan(&user.ID, &user.UUID); err != nil {
+					return fmt.Errorf("failed to create user: %w", mapWriteError(err))
+				}
+				return recordHistory(ctx, sp, model.HistoryOperationCreate, user)
+			})
+			if errs[i] != nil && atomic {
+				failed = true
+				return errs[i]
+			}
+		}
+		return nil
+	})
+	if err != nil && !failed {
+		return nil, fmt.Errorf("failed to create users: %w", err)
+	}
+
+	return errs, nil
 }
 
 // GetByID retrieves a user by ID
 func (r *UserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
 	query := `
-		SELECT id, email, name, created_at, updated_at
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	user := &model.User{}
-	err := r.db.QueryRow(ctx, query, id).Scan(
+	err := r.shard(id).QueryRow(ctx, query, id).Scan(
 		&user.ID,
+		&user.UUID,
 		&user.Email,
 		&user.Name,
+		&user.Metadata,
+		&user.AvatarURL,
+		&user.Timezone,
+		&user.Locale,
+		&user.Guest,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetByUUID retrieves a user by UUID
+func (r *UserRepository) GetByUUID(ctx context.Context, uuid string) (*model.User, error) {
+	query := `
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+		FROM users
+		WHERE uuid = $1 AND deleted_at IS NULL
+	`
+
+	user := &model.User{}
+	err := r.db.QueryRow(ctx, query, uuid).Scan(
+		&user.ID,
+		&user.UUID,
+		&user.Email,
+		&user.Name,
+		&user.Metadata,
+		&user.AvatarURL,
+		&user.Timezone,
+		&user.Locale,
+		&user.Guest,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -61,22 +204,31 @@ func (r *UserRepository) GetByID(ctx context.Context, id int64) (*model.User, er
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
 	query := `
-		SELECT id, email, name, created_at, updated_at
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 
 	user := &model.User{}
 	err := r.db.QueryRow(ctx, query, email).Scan(
 		&user.ID,
+		&user.UUID,
 		&user.Email,
 		&user.Name,
+		&user.Metadata,
+		&user.AvatarURL,
+		&user.Timezone,
+		&user.Locale,
+		&user.Guest,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -84,9 +236,10 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.U
 // List retrieves users with pagination
 func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*model.User, error) {
 	query := `
-		SELECT id, email, name, created_at, updated_at
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
 		FROM users
-		ORDER BY created_at DESC
+		WHERE deleted_at IS NULL
+		ORDER BY created_at DESC, id DESC
 		LIMIT $1 OFFSET $2
 	`
 
@@ -101,8 +254,14 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*model.
 		user := &model.User{}
 		err := rows.Scan(
 			&user.ID,
+			&user.UUID,
 			&user.Email,
 			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -111,16 +270,272 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*model.
 		}
 		users = append(users, user)
 	}
+	if err := r.openUsers(ctx, users...); err != nil {
+		return nil, err
+	}
 
 	return users, nil
 }
 
-// Count returns the total number of users
+// ListAfter retrieves users ordered after the cursor using keyset
+// pagination, optionally restricted to the members of an organization
+func (r *UserRepository) ListAfter(ctx context.Context, orgID int64, after pagination.Cursor, limit int) ([]*model.User, error) {
+	query := `
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+		FROM users
+		WHERE deleted_at IS NULL AND (created_at, id) < ($1, $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+	args := []any{after.CreatedAt, after.ID, limit}
+
+	if orgID > 0 {
+		query = `
+			SELECT u.id, u.uuid, u.email, u.name, u.metadata, u.avatar_url, u.timezone, u.locale, u.guest, u.created_at, u.updated_at
+			FROM users u
+			JOIN organization_members m ON m.user_id = u.id
+			WHERE m.organization_id = $4 AND u.deleted_at IS NULL AND (u.created_at, u.id) < ($1, $2)
+			ORDER BY u.created_at DESC, u.id DESC
+			LIMIT $3
+		`
+		args = append(args, orgID)
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user := &model.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.openUsers(ctx, users...); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListAfterID retrieves users with an ID greater than afterID, ordered by ID
+func (r *UserRepository) ListAfterID(ctx context.Context, afterID int64, limit int) ([]*model.User, error) {
+	query := `
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+		FROM users
+		WHERE id > $1 AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user := &model.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := r.openUsers(ctx, users...); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListByOrganization retrieves the members of an organization with pagination
+func (r *UserRepository) ListByOrganization(ctx context.Context, orgID int64, limit, offset int) ([]*model.User, error) {
+	query := `
+		SELECT u.id, u.uuid, u.email, u.name, u.metadata, u.avatar_url, u.timezone, u.locale, u.guest, u.created_at, u.updated_at
+		FROM users u
+		JOIN organization_members m ON m.user_id = u.id
+		WHERE m.organization_id = $1 AND u.deleted_at IS NULL
+		ORDER BY u.created_at DESC, u.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(ctx, query, orgID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user := &model.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := r.openUsers(ctx, users...); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Stream iterates over all users ordered by ID and passes them to fn in
+// chunks of up to chunkSize. Rows are decoded as they arrive from the server,
+// so memory use is bounded by the chunk size rather than the table size.
+func (r *UserRepository) Stream(ctx context.Context, chunkSize int, fn func([]*model.User) error) error {
+	return r.StreamMatching(ctx, UserFilter{}, chunkSize, fn)
+}
+
+// StreamMatching is Stream restricted to the users matching filter
+func (r *UserRepository) StreamMatching(ctx context.Context, filter UserFilter, chunkSize int, fn func([]*model.User) error) error {
+	where, args := filter.where()
+	query := `
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+		FROM users
+		WHERE ` + where + `
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream users: %w", err)
+	}
+	defer rows.Close()
+
+	chunk := make([]*model.User, 0, chunkSize)
+	for rows.Next() {
+		user := &model.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		if err := r.openUsers(ctx, user); err != nil {
+			return err
+		}
+
+		chunk = append(chunk, user)
+		if len(chunk) == chunkSize {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = make([]*model.User, 0, chunkSize)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to stream users: %w", err)
+	}
+
+	if len(chunk) > 0 {
+		return fn(chunk)
+	}
+	return nil
+}
+
+// ExistingIDs returns the subset of ids that belong to existing users
+func (r *UserRepository) ExistingIDs(ctx context.Context, ids []int64) ([]int64, error) {
+	query := `SELECT id FROM users WHERE id = ANY($1) AND deleted_at IS NULL`
+
+	rows, err := r.db.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check users: %w", err)
+	}
+	defer rows.Close()
+
+	var existing []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		existing = append(existing, id)
+	}
+
+	return existing, rows.Err()
+}
+
+// Count returns the total number of users, read from the counters kept by
+// triggers rather than by scanning the table
 func (r *UserRepository) Count(ctx context.Context) (int, error) {
-	query := `SELECT COUNT(*) FROM users`
+	return r.countActive(ctx, 0)
+}
+
+// CountByOrganization returns the number of users that are members of an organization
+func (r *UserRepository) CountByOrganization(ctx context.Context, orgID int64) (int, error) {
+	return r.countActive(ctx, orgID)
+}
+
+// countActive sums the slots of the active users counter of an
+// organization, or of all users for 0
+func (r *UserRepository) countActive(ctx context.Context, orgID int64) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(count), 0)
+		FROM users_counters
+		WHERE organization_id = $1 AND status = 'active'
+	`
 
 	var count int
-	err := r.db.QueryRow(ctx, query).Scan(&count)
+	err := r.db.QueryRow(ctx, query, orgID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count users: %w", err)
 	}
@@ -132,26 +547,224 @@ func (r *UserRepository) Count(ctx context.Context) (int, error) {
 func (r *UserRepository) Update(ctx context.Context, user *model.User) error {
 	query := `
 		UPDATE users
-		SET email = $1, name = $2, updated_at = $3
-		WHERE id = $4
+		SET email = $1, name = $2, metadata = $3::jsonb, timezone = $4, locale = $5, updated_at = $6
+		WHERE id = $7 AND deleted_at IS NULL
 	`
 
-	_, err := r.db.Exec(ctx, query, user.Email, user.Name, user.UpdatedAt, user.ID)
+	metadata, err := r.sealMetadata(ctx, user.Metadata)
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, r.conn(ctx, r.shard(user.ID)), func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query, user.Email, user.Name, metadata, user.Timezone, user.Locale, user.UpdatedAt, user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", mapWriteError(err))
+		}
+
+		return recordHistory(ctx, tx, model.HistoryOperationUpdate, user)
+	})
+}
+
+// SetAvatarURL sets the avatar URL of a user. It returns pgx.ErrNoRows when
+// the user does not exist or is deleted.
+func (r *UserRepository) SetAvatarURL(ctx context.Context, id int64, avatarURL string, updatedAt time.Time) error {
+	query := `
+		UPDATE users
+		SET avatar_url = $1, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`
+
+	tag, err := r.conn(ctx, r.shard(id)).Exec(ctx, query, avatarURL, updatedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to set avatar: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
 	}
 
 	return nil
 }
 
-// Delete deletes a user by ID
-func (r *UserRepository) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
+// GetPasswordHash retrieves the ID and password hash of the active user
+// with the given email. The hash is empty when the user has no password.
+func (r *UserRepository) GetPasswordHash(ctx context.Context, email string) (int64, string, error) {
+	query := `
+		SELECT id, COALESCE(password_hash, '')
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL
+	`
+
+	var id int64
+	var hash string
+	if err := r.db.QueryRow(ctx, query, email).Scan(&id, &hash); err != nil {
+		return 0, "", fmt.Errorf("user not found: %w", err)
+	}
+
+	return id, hash, nil
+}
+
+// GetPasswordHashByID returns the stored email and the password hash of a
+// user, the hash empty when the user has none. It returns pgx.ErrNoRows when
+// the user does not exist or is deleted.
+func (r *UserRepository) GetPasswordHashByID(ctx context.Context, id int64) (string, string, error) {
+	query := `
+		SELECT email, COALESCE(password_hash, '')
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	var email, hash string
+	if err := r.shard(id).QueryRow(ctx, query, id).Scan(&email, &hash); err != nil {
+		return "", "", err
+	}
+	return email, hash, nil
+}
+
+// SetPasswordHash sets the password hash of a user. It returns
+// pgx.ErrNoRows when the user does not exist or is deleted.
+func (r *UserRepository) SetPasswordHash(ctx context.Context, id int64, hash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`
 
-	_, err := r.db.Exec(ctx, query, id)
+	tag, err := r.conn(ctx, r.shard(id)).Exec(ctx, query, hash, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
 	}
 
 	return nil
 }
+
+// Delete soft-deletes a user by ID. The row is kept, hidden from every
+// other query, until it is restored or purged.
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	query := `
+		UPDATE users
+		SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+	`
+
+	return pgx.BeginFunc(ctx, r.conn(ctx, r.shard(id)), func(tx pgx.Tx) error {
+		user := &model.User{}
+		err := tx.QueryRow(ctx, query, id).Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return recordHistory(ctx, tx, model.HistoryOperationDelete, user)
+	})
+}
+
+// DeleteMany soft-deletes the users with the given IDs and records their
+// history with one statement per shard, returning the IDs actually deleted.
+// IDs of missing or already deleted users are skipped.
+func (r *UserRepository) DeleteMany(ctx context.Context, ids []int64) ([]int64, error) {
+	query := `
+		WITH deleted AS (
+			UPDATE users
+			SET deleted_at = NOW()
+			WHERE id = ANY($1) AND deleted_at IS NULL
+			RETURNING id, uuid, email, name, metadata, created_at, updated_at
+		)
+		INSERT INTO users_history (user_id, user_uuid, operation, email, name, metadata, created_at, updated_at)
+		SELECT id, uuid, $2, email, name, metadata, created_at, updated_at FROM deleted
+		RETURNING user_id
+	`
+
+	byShard := make(map[*pgxpool.Pool][]int64)
+	for _, id := range ids {
+		pool := r.shard(id)
+		byShard[pool] = append(byShard[pool], id)
+	}
+
+	var deleted []int64
+	for pool, shardIDs := range byShard {
+		rows, err := r.conn(ctx, pool).Query(ctx, query, shardIDs, string(model.HistoryOperationDelete))
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete users: %w", err)
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete users: %w", err)
+		}
+		deleted = append(deleted, ids...)
+	}
+
+	return deleted, nil
+}
+
+// Restore undoes the soft deletion of a user. It returns pgx.ErrNoRows when
+// no deleted user has the ID, or the user was merged into another.
+func (r *UserRepository) Restore(ctx context.Context, id int64, restoredAt time.Time) (*model.User, error) {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = $2
+		WHERE id = $1 AND deleted_at IS NOT NULL AND merged_into IS NULL
+		RETURNING id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+	`
+
+	user := &model.User{}
+	err := pgx.BeginFunc(ctx, r.conn(ctx, r.shard(id)), func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, id, restoredAt).Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to restore user: %w", mapWriteError(err))
+		}
+
+		return recordHistory(ctx, tx, model.HistoryOperationRestore, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.openUsers(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Purge permanently removes a soft-deleted user, reporting whether one was
+// removed. Its history is kept until pruned by the retention job.
+func (r *UserRepository) Purge(ctx context.Context, id int64) (bool, error) {
+	query := `DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	tag, err := r.conn(ctx, r.shard(id)).Exec(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to purge user: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMapWriteError(t *testing.T) {
+	t.Run("active email index violations", func(t *testing.T) {
+		err := fmt.Errorf("insert: %w", &pgconn.PgError{Code: uniqueViolation, ConstraintName: "idx_users_email_active"})
+		if !errors.Is(mapWriteError(err), ErrEmailTaken) {
+			t.Errorf("expected ErrEmailTaken, got %v", mapWriteError(err))
+		}
+	})
+
+	t.Run("other violations are kept", func(t *testing.T) {
+		err := &pgconn.PgError{Code: uniqueViolation, ConstraintName: "idx_users_uuid"}
+		if errors.Is(mapWriteError(err), ErrEmailTaken) {
+			t.Error("expected the error to be kept")
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// sortColumns maps the sort fields accepted from callers to their columns.
+// Only these columns are ever interpolated into search queries.
+var sortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// UserFilter narrows a user search; zero fields do not filter
+type UserFilter struct {
+	NamePrefix    string
+	EmailDomain   string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Metadata matches users having all of these metadata values
+	Metadata map[string]string
+	// MetadataKeys matches users having all of these metadata keys
+	MetadataKeys []string
+}
+
+// Empty reports whether the filter matches every user
+func (f UserFilter) Empty() bool {
+	return f.NamePrefix == "" && f.EmailDomain == "" &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero() &&
+		len(f.Metadata) == 0 && len(f.MetadataKeys) == 0
+}
+
+// UserSort orders a user search by one of the sortable columns
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// SortableField reports whether users can be sorted by field
+func SortableField(field string) bool {
+	_, ok := sortColumns[field]
+	return ok
+}
+
+// Search retrieves the users matching filter, ordered by sort with the ID as
+// tie-breaker, together with the number of matching users
+func (r *UserRepository) Search(ctx context.Context, filter UserFilter, sort UserSort, limit, offset int) ([]*model.User, int, error) {
+	column, ok := sortColumns[sort.Field]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported sort field %q", sort.Field)
+	}
+	direction := "ASC"
+	if sort.Desc {
+		direction = "DESC"
+	}
+
+	total, err := r.CountMatching(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, args := filter.where()
+
+	query := fmt.Sprintf(`
+		SELECT id, uuid, email, name, metadata, avatar_url, timezone, locale, guest, created_at, updated_at
+		FROM users
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT $%d OFFSET $%d
+	`, where, column, direction, direction, len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user := &model.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.Name,
+			&user.Metadata,
+			&user.AvatarURL,
+			&user.Timezone,
+			&user.Locale,
+			&user.Guest,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := r.openUsers(ctx, users...); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// CountMatching returns the number of users matching filter. Without a
+// filter the counters are read instead of scanning the table.
+func (r *UserRepository) CountMatching(ctx context.Context, filter UserFilter) (int, error) {
+	if filter.Empty() {
+		return r.Count(ctx)
+	}
+	where, args := filter.where()
+
+	var count int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// where builds the WHERE clause of the filter. Values are always passed as
+// arguments, never interpolated.
+func (f UserFilter) where() (string, []any) {
+	conds := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.NamePrefix != "" {
+		add(`lower(name) LIKE $%d ESCAPE '\'`, escapeLike(strings.ToLower(f.NamePrefix))+"%")
+	}
+	if f.EmailDomain != "" {
+		add(`lower(email) LIKE $%d ESCAPE '\'`, "%@"+escapeLike(strings.ToLower(f.EmailDomain)))
+	}
+	if !f.CreatedAfter.IsZero() {
+		add("created_at >= $%d", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		add("created_at < $%d", f.CreatedBefore)
+	}
+	if len(f.Metadata) > 0 {
+		add("metadata @> $%d::jsonb", metadataJSON(f.Metadata))
+	}
+	if len(f.MetadataKeys) > 0 {
+		add("metadata ?& $%d::text[]", f.MetadataKeys)
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// metadataJSON encodes metadata for a jsonb parameter. Maps are encoded up
+// front because the simple protocol, used behind pgbouncer, cannot encode them.
+func metadataJSON(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return "{}"
+	}
+	// Marshaling a map of strings cannot fail
+	data, _ := json.Marshal(metadata)
+	return string(data)
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestUserFilterWhere(t *testing.T) {
+	t.Run("no filters", func(t *testing.T) {
+		where, args := UserFilter{}.where()
+		if where != "deleted_at IS NULL" || len(args) != 0 {
+			t.Errorf("unexpected clause %q with args %v", where, args)
+		}
+	})
+
+	t.Run("all filters are parameterized", func(t *testing.T) {
+		after := time.Unix(100, 0)
+		before := time.Unix(200, 0)
+		where, args := UserFilter{
+			NamePrefix:    "50%_Off' OR 1=1",
+			EmailDomain:   "Example.COM",
+			CreatedAfter:  after,
+			CreatedBefore: before,
+		}.where()
+
+		want := `deleted_at IS NULL AND lower(name) LIKE $1 ESCAPE '\' AND lower(email) LIKE $2 ESCAPE '\' AND created_at >= $3 AND created_at < $4`
+		if where != want {
+			t.Errorf("expected %q, got %q", want, where)
+		}
+		wantArgs := []any{`50\%\_off' or 1=1%`, "%@example.com", after, before}
+		if !slices.Equal(args, wantArgs) {
+			t.Errorf("expected args %v, got %v", wantArgs, args)
+		}
+	})
+
+	t.Run("metadata filters", func(t *testing.T) {
+		metadata := map[string]string{"plan": "pro"}
+		where, args := UserFilter{Metadata: metadata, MetadataKeys: []string{"team"}}.where()
+
+		want := `deleted_at IS NULL AND metadata @> $1::jsonb AND metadata ?& $2::text[]`
+		if where != want {
+			t.Errorf("expected %q, got %q", want, where)
+		}
+		if len(args) != 2 || args[0] != `{"plan":"pro"}` {
+			t.Errorf("unexpected args %v", args)
+		}
+	})
+}
+
+func TestUserFilterEmpty(t *testing.T) {
+	if !(UserFilter{}).Empty() {
+		t.Error("expected the zero filter to be empty")
+	}
+	if (UserFilter{MetadataKeys: []string{"team"}}).Empty() {
+		t.Error("expected a metadata key filter not to be empty")
+	}
+}
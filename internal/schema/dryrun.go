@@ -0,0 +1,45 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DryRun applies every .sql file at the root of fsys in a transaction that
+// is rolled back, reporting the first migration that fails. Statements wait
+// at most lockTimeout for locks, so a dry run against a busy database fails
+// instead of queueing traffic behind it.
+func DryRun(ctx context.Context, db *pgxpool.Pool, fsys fs.FS, lockTimeout time.Duration) error {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin dry run: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL lock_timeout = %d", lockTimeout.Milliseconds())); err != nil {
+		return fmt.Errorf("failed to set lock timeout: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+		if _, err := tx.Exec(ctx, string(data)); err != nil {
+			return fmt.Errorf("migration %s does not apply: %w", file, err)
+		}
+	}
+
+	return nil
+}
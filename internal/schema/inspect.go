@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Inspect reads the live schema of the public schema. Indexes backing
+// primary key and unique constraints are omitted since migrations declare
+// them as constraints rather than indexes. Partitions and their indexes are
+// omitted too since they are created at runtime rather than by migrations.
+func Inspect(ctx context.Context, db *pgxpool.Pool) (*Schema, error) {
+	s := New()
+
+	columnsQuery := `
+		SELECT c.table_name, c.column_name
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+			ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+			AND NOT EXISTS (
+				SELECT 1 FROM pg_class p
+				WHERE p.relname = c.table_name AND p.relispartition
+			)
+		ORDER BY c.table_name, c.ordinal_position
+	`
+
+	rows, err := db.Query(ctx, columnsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect columns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		s.Tables[table] = append(s.Tables[table], column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to inspect columns: %w", err)
+	}
+
+	indexesQuery := `
+		SELECT i.indexname, i.tablename
+		FROM pg_indexes i
+		WHERE i.schemaname = 'public'
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conname = i.indexname)
+			AND NOT EXISTS (SELECT 1 FROM pg_class p WHERE p.relname = i.tablename AND p.relispartition)
+	`
+
+	rows, err = db.Query(ctx, indexesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect indexes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index, table string
+		if err := rows.Scan(&index, &table); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		s.Indexes[index] = table
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to inspect indexes: %w", err)
+	}
+
+	return s, nil
+}
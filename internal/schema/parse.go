@@ -0,0 +1,131 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var (
+	lineComment = regexp.MustCompile(`--[^\n]*`)
+	createTable = regexp.MustCompile(`(?is)CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\((.*?)\)\s*(?:PARTITION\s+BY\s+[^;]*)?;`)
+	createIndex = regexp.MustCompile(`(?is)CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s+ON\s+(?:ONLY\s+)?(\w+)`)
+	dropIndex   = regexp.MustCompile(`(?is)DROP\s+INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+EXISTS\s+)?(\w+)`)
+	addColumn   = regexp.MustCompile(`(?is)ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(\w+)\s+ADD\s+COLUMN\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)`)
+	dropColumn  = regexp.MustCompile(`(?is)ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(\w+)\s+DROP\s+COLUMN\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+)
+
+// tableConstraints are leading keywords of CREATE TABLE entries that are not columns
+var tableConstraints = []string{"PRIMARY", "UNIQUE", "CONSTRAINT", "FOREIGN", "CHECK", "EXCLUDE"}
+
+// MigrationFiles lists the .sql files in dir in the order they are applied
+func MigrationFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ParseMigrations builds the schema expected after applying every migration in dir
+func ParseMigrations(dir string) (*Schema, error) {
+	return ParseMigrationsFS(os.DirFS(dir))
+}
+
+// ParseMigrationsFS builds the schema expected after applying every .sql
+// file at the root of fsys, such as the migrations embedded in the binary
+func ParseMigrationsFS(fsys fs.FS) (*Schema, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	s := New()
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+		s.apply(string(data))
+	}
+
+	return s, nil
+}
+
+// apply applies the DDL statements of one migration file, in order
+func (s *Schema) apply(sql string) {
+	sql = lineComment.ReplaceAllString(sql, "")
+
+	for _, stmt := range strings.Split(sql, ";") {
+		stmt += ";"
+		switch {
+		case createTable.MatchString(stmt):
+			m := createTable.FindStringSubmatch(stmt)
+			table := strings.ToLower(m[1])
+			if _, exists := s.Tables[table]; !exists {
+				s.Tables[table] = parseColumns(m[2])
+			}
+		case createIndex.MatchString(stmt):
+			m := createIndex.FindStringSubmatch(stmt)
+			s.Indexes[strings.ToLower(m[1])] = strings.ToLower(m[2])
+		case dropIndex.MatchString(stmt):
+			delete(s.Indexes, strings.ToLower(dropIndex.FindStringSubmatch(stmt)[1]))
+		case addColumn.MatchString(stmt):
+			m := addColumn.FindStringSubmatch(stmt)
+			table, column := strings.ToLower(m[1]), strings.ToLower(m[2])
+			if !slices.Contains(s.Tables[table], column) {
+				s.Tables[table] = append(s.Tables[table], column)
+			}
+		case dropColumn.MatchString(stmt):
+			m := dropColumn.FindStringSubmatch(stmt)
+			table, column := strings.ToLower(m[1]), strings.ToLower(m[2])
+			s.Tables[table] = slices.DeleteFunc(s.Tables[table], func(c string) bool { return c == column })
+		}
+	}
+}
+
+// parseColumns extracts column names from the body of a CREATE TABLE
+func parseColumns(body string) []string {
+	var columns []string
+	for _, entry := range splitTopLevel(body) {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if slices.Contains(tableConstraints, strings.ToUpper(fields[0])) {
+			continue
+		}
+		columns = append(columns, strings.ToLower(strings.Trim(fields[0], `"`)))
+	}
+	return columns
+}
+
+// splitTopLevel splits on commas that are not nested in parentheses
+func splitTopLevel(body string) []string {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, body[start:])
+}
@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/migrations"
+)
+
+func TestParseMigrations(t *testing.T) {
+	dir := t.TempDir()
+	sql := `
+-- Create users table
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    amount NUMERIC(10, 2),
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS name TEXT;
+ALTER TABLE users DROP COLUMN amount;
+`
+	if err := os.WriteFile(filepath.Join(dir, "001_init.sql"), []byte(sql), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ParseMigrations(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"id", "email", "name"}; !slices.Equal(s.Tables["users"], want) {
+		t.Errorf("expected columns %v, got %v", want, s.Tables["users"])
+	}
+	if s.Indexes["idx_users_email"] != "users" {
+		t.Errorf("expected idx_users_email on users, got %v", s.Indexes)
+	}
+}
+
+func TestParseMigrationsFS(t *testing.T) {
+	// Function bodies in the migrations contain semicolons, which must not
+	// confuse the statement splitting
+	s, err := ParseMigrationsFS(migrations.FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"organization_id", "status", "slot", "count"}; !slices.Equal(s.Tables["users_counters"], want) {
+		t.Errorf("expected columns %v, got %v", want, s.Tables["users_counters"])
+	}
+	if !slices.Contains(s.Tables["users"], "locale") {
+		t.Errorf("expected users to have locale, got %v", s.Tables["users"])
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := New()
+	expected.Tables["users"] = []string{"id", "email"}
+	expected.Indexes["idx_users_email"] = "users"
+
+	live := New()
+	live.Tables["users"] = []string{"id", "email", "legacy"}
+
+	drift := Diff(expected, live)
+	want := []Drift{
+		{Kind: ExtraColumn, Table: "users", Name: "legacy"},
+		{Kind: MissingIndex, Table: "users", Name: "idx_users_email"},
+	}
+	if !slices.Equal(drift, want) {
+		t.Errorf("expected %v, got %v", want, drift)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	a, b := New(), New()
+	a.Tables["users"] = []string{"id", "email"}
+	b.Tables["users"] = []string{"id", "email"}
+	if a.Version() != b.Version() {
+		t.Error("expected equal schemas to share a version")
+	}
+
+	b.Tables["users"] = append(b.Tables["users"], "name")
+	if a.Version() == b.Version() {
+		t.Error("expected a new column to change the version")
+	}
+}
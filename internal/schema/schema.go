@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Schema is the set of tables, columns and indexes of a database
+type Schema struct {
+	Tables  map[string][]string
+	Indexes map[string]string
+}
+
+// New creates an empty Schema
+func New() *Schema {
+	return &Schema{
+		Tables:  make(map[string][]string),
+		Indexes: make(map[string]string),
+	}
+}
+
+// Version fingerprints the schema, so binaries expecting the same tables,
+// columns and indexes report the same version
+func (s *Schema) Version() string {
+	h := sha256.New()
+	for _, table := range sortedKeys(s.Tables) {
+		h.Write([]byte("table " + table + " " + strings.Join(s.Tables[table], ",") + "\n"))
+	}
+	for _, index := range sortedKeys(s.Indexes) {
+		h.Write([]byte("index " + index + " " + s.Indexes[index] + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// DriftKind classifies a difference between expected and live schema
+type DriftKind string
+
+const (
+	MissingTable  DriftKind = "missing_table"
+	ExtraTable    DriftKind = "extra_table"
+	MissingColumn DriftKind = "missing_column"
+	ExtraColumn   DriftKind = "extra_column"
+	MissingIndex  DriftKind = "missing_index"
+	ExtraIndex    DriftKind = "extra_index"
+)
+
+// Drift is a single difference between expected and live schema
+type Drift struct {
+	Kind  DriftKind `json:"kind"`
+	Table string    `json:"table"`
+	Name  string    `json:"name,omitempty"`
+}
+
+// Diff compares the live schema against the schema expected from migrations
+func Diff(expected, live *Schema) []Drift {
+	var drift []Drift
+
+	for _, table := range sortedKeys(expected.Tables) {
+		liveColumns, ok := live.Tables[table]
+		if !ok {
+			drift = append(drift, Drift{Kind: MissingTable, Table: table})
+			continue
+		}
+		for _, column := range expected.Tables[table] {
+			if !slices.Contains(liveColumns, column) {
+				drift = append(drift, Drift{Kind: MissingColumn, Table: table, Name: column})
+			}
+		}
+		for _, column := range liveColumns {
+			if !slices.Contains(expected.Tables[table], column) {
+				drift = append(drift, Drift{Kind: ExtraColumn, Table: table, Name: column})
+			}
+		}
+	}
+	for _, table := range sortedKeys(live.Tables) {
+		if _, ok := expected.Tables[table]; !ok {
+			drift = append(drift, Drift{Kind: ExtraTable, Table: table})
+		}
+	}
+
+	for _, index := range sortedKeys(expected.Indexes) {
+		if _, ok := live.Indexes[index]; !ok {
+			drift = append(drift, Drift{Kind: MissingIndex, Table: expected.Indexes[index], Name: index})
+		}
+	}
+	for _, index := range sortedKeys(live.Indexes) {
+		if _, ok := expected.Indexes[index]; !ok {
+			drift = append(drift, Drift{Kind: ExtraIndex, Table: live.Indexes[index], Name: index})
+		}
+	}
+
+	return drift
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
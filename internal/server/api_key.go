@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// CreateAPIKey creates an API key for a service-to-service caller
+func (s *UserServer) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.APIKeyResponse, error) {
+	slog.Info("creating api key",
+		slog.String("name", req.Name),
+		slog.String("subject", req.Subject))
+
+	key, secret, err := s.apiKeyService.CreateAPIKey(ctx, req.Name, req.Subject, req.Roles, int(req.RateLimit), time.Duration(req.TtlSeconds)*time.Second)
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotAllowed), errors.Is(err, service.ErrAPIKeyRoleNotHeld):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		slog.Error("failed to create api key", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to create api key: %v", err)
+	}
+
+	return &pb.APIKeyResponse{ApiKey: toProtoAPIKey(key), Key: secret}, nil
+}
+
+// RotateAPIKey issues a new key replacing an existing one
+func (s *UserServer) RotateAPIKey(ctx context.Context, req *pb.RotateAPIKeyRequest) (*pb.APIKeyResponse, error) {
+	slog.Info("rotating api key", slog.Int64("id", req.Id))
+
+	var grace *time.Duration
+	if req.GraceSeconds != nil {
+		d := time.Duration(*req.GraceSeconds) * time.Second
+		grace = &d
+	}
+
+	key, secret, err := s.apiKeyService.RotateAPIKey(ctx, req.Id, grace)
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotAllowed):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		slog.Error("failed to rotate api key", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to rotate api key: %v", err)
+	}
+
+	return &pb.APIKeyResponse{ApiKey: toProtoAPIKey(key), Key: secret}, nil
+}
+
+// RevokeAPIKey revokes an API key immediately
+func (s *UserServer) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*emptypb.Empty, error) {
+	slog.Info("revoking api key", slog.Int64("id", req.Id))
+
+	err := s.apiKeyService.RevokeAPIKey(ctx, req.Id)
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotAllowed):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		slog.Error("failed to revoke api key", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to revoke api key: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func toProtoAPIKey(key *model.APIKey) *pb.APIKey {
+	out := &pb.APIKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		Subject:   key.Subject,
+		Roles:     key.Roles,
+		Prefix:    key.Prefix,
+		RateLimit: int32(key.RateLimit),
+		CreatedBy: key.CreatedBy,
+		CreatedAt: key.CreatedAt.Unix(),
+	}
+	if key.ExpiresAt != nil {
+		out.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	if key.RotatedAt != nil {
+		out.RotatedAt = key.RotatedAt.Unix()
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/audit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+// NewAuditInterceptor records every call of a method not listed in
+// readOnly, failed calls included, and every call made with an
+// impersonation token. For calls acting on a single user, the
+// user is loaded before and after the handler runs and the changed fields
+// are recorded; methods in creates diff against a user that did not exist.
+// It must run after the auth interceptor.
+func NewAuditInterceptor(recorder *audit.Recorder, readOnly, creates map[string]bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if (readOnly[info.FullMethod] && auth.Impersonator(ctx) == "") || strings.HasPrefix(info.FullMethod, "/grpc.") {
+			return handler(ctx, req)
+		}
+
+		target := targetUserID(req)
+		var before map[string]interface{}
+		if target != 0 {
+			before = recorder.Snapshot(ctx, target)
+		}
+
+		resp, err := handler(ctx, req)
+
+		event := &model.AuditEvent{
+			Method: info.FullMethod,
+			Actor:  auth.Subject(ctx),
+			Code:   status.Code(err).String(),
+		}
+		if err == nil {
+			if target == 0 {
+				target = targetUserID(resp)
+			}
+			if target != 0 && (before != nil || creates[info.FullMethod]) {
+				event.Diff = audit.Diff(before, recorder.Snapshot(ctx, target))
+			}
+		}
+		if target != 0 {
+			event.TargetUserID = &target
+		}
+		recorder.Record(ctx, event)
+
+		return resp, err
+	}
+}
+
+// NewAuditStreamInterceptor records every call of the given streaming
+// methods, and every streaming call made with an impersonation token,
+// without a target or diff. It must run after the auth interceptor.
+func NewAuditStreamInterceptor(recorder *audit.Recorder, audited map[string]bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !audited[info.FullMethod] && auth.Impersonator(ss.Context()) == "" {
+			return handler(srv, ss)
+		}
+
+		err := handler(srv, ss)
+
+		recorder.Record(ss.Context(), &model.AuditEvent{
+			Method: info.FullMethod,
+			Actor:  auth.Subject(ss.Context()),
+			Code:   status.Code(err).String(),
+		})
+		return err
+	}
+}
+
+// AuditLockout returns a callback recording the lock of an account in the
+// audit trail, as a change of its locked state by the call whose failed
+// attempt triggered it
+func AuditLockout(recorder *audit.Recorder) func(ctx context.Context, userID int64) {
+	return func(ctx context.Context, userID int64) {
+		method, _ := grpc.Method(ctx)
+		recorder.Record(ctx, &model.AuditEvent{
+			Method:       method,
+			Actor:        auth.Subject(ctx),
+			TargetUserID: &userID,
+			Code:         codes.ResourceExhausted.String(),
+			Diff:         map[string]model.AuditChange{"locked": {Before: false, After: true}},
+		})
+	}
+}
+
+// targetUserID returns the ID of the user a request or response is about:
+// its user_id field, the id of the user it carries, or the id field of
+// requests named after a single user operation such as DeleteUserRequest
+func targetUserID(msg interface{}) int64 {
+	if m, ok := msg.(interface{ GetUserId() int64 }); ok && m.GetUserId() != 0 {
+		return m.GetUserId()
+	}
+	if m, ok := msg.(interface{ GetUser() *pb.User }); ok {
+		return m.GetUser().GetId()
+	}
+	if m, ok := msg.(interface{ GetUser() *userv2.User }); ok {
+		return m.GetUser().GetId()
+	}
+	m, ok := msg.(interface {
+		proto.Message
+		GetId() int64
+	})
+	if !ok {
+		return 0
+	}
+	name := string(m.ProtoReflect().Descriptor().Name())
+	if name == "User" || strings.HasSuffix(name, "UserRequest") {
+		return m.GetId()
+	}
+	return 0
+}
+
+// ListAuditEvents lists the audit trail, most recent first
+func (s *UserServer) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	slog.Info("listing audit events",
+		slog.String("actor", req.Actor),
+		slog.String("method", req.Method),
+		slog.Int64("target_user_id", req.TargetUserId))
+
+	filter := model.AuditFilter{
+		Actor:        req.Actor,
+		Impersonator: req.Impersonator,
+		Method:       req.Method,
+		TargetUserID: req.TargetUserId,
+	}
+	if req.From > 0 {
+		filter.From = time.Unix(req.From, 0)
+	}
+	if req.To > 0 {
+		filter.To = time.Unix(req.To, 0)
+	}
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	events, next, err := s.auditRecorder.List(ctx, filter, req.PageToken, pageSize)
+	if errors.Is(err, audit.ErrInvalidPageToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		slog.Error("failed to list audit events", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to list audit events: %v", err)
+	}
+
+	pbEvents := make([]*pb.AuditEvent, len(events))
+	for i, event := range events {
+		pbEvents[i] = toProtoAuditEvent(event)
+	}
+
+	return &pb.ListAuditEventsResponse{Events: pbEvents, NextPageToken: next}, nil
+}
+
+// toProtoAuditEvent converts an audit event into its protobuf
+// representation, with changes sorted by field
+func toProtoAuditEvent(event *model.AuditEvent) *pb.AuditEvent {
+	pbEvent := &pb.AuditEvent{
+		Id:           event.ID,
+		Method:       event.Method,
+		Actor:        event.Actor,
+		Impersonator: event.Impersonator,
+		Code:         event.Code,
+		CreatedAt:    event.CreatedAt.Unix(),
+	}
+	if event.TargetUserID != nil {
+		pbEvent.TargetUserId = *event.TargetUserID
+	}
+
+	for field, change := range event.Diff {
+		before, _ := json.Marshal(change.Before)
+		after, _ := json.Marshal(change.After)
+		pbEvent.Changes = append(pbEvent.Changes, &pb.AuditChange{
+			Field:  field,
+			Before: string(before),
+			After:  string(after),
+		})
+	}
+	sort.Slice(pbEvent.Changes, func(i, j int) bool {
+		return pbEvent.Changes[i].Field < pbEvent.Changes[j].Field
+	})
+
+	return pbEvent
+}
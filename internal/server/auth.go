@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/policy"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+// impersonationDenied are the methods impersonation tokens may not call
+// whatever the policy says: those changing the credentials or the
+// existence of the impersonated user, and impersonation itself
+var impersonationDenied = map[string]bool{
+	pb.UserService_SetPassword_FullMethodName:        true,
+	pb.UserService_UpgradeGuest_FullMethodName:       true,
+	pb.UserService_DeleteUser_FullMethodName:         true,
+	pb.UserService_Logout_FullMethodName:             true,
+	pb.UserService_ImpersonationToken_FullMethodName: true,
+	userv2.UserService_DeleteUser_FullMethodName:     true,
+}
+
+// adminOnly are the methods that require auth.AdminRole whatever the policy
+// says, as the default policy allows every identified caller
+var adminOnly = map[string]bool{
+	pb.UserService_ImpersonationToken_FullMethodName: true,
+	pb.UserService_FlushCache_FullMethodName:         true,
+	pb.UserService_CreateAPIKey_FullMethodName:       true,
+	pb.UserService_RotateAPIKey_FullMethodName:       true,
+	pb.UserService_RevokeAPIKey_FullMethodName:       true,
+	pb.UserService_GetTrafficDump_FullMethodName:     true,
+	pb.UserService_PurgeUser_FullMethodName:          true,
+	pb.UserService_BulkDeleteUsers_FullMethodName:    true,
+	pb.UserService_ReplayEvents_FullMethodName:       true,
+	pb.UserService_UnlockUser_FullMethodName:         true,
+	pb.UserService_ListAuditEvents_FullMethodName:    true,
+	pb.UserService_ListDataIssues_FullMethodName:     true,
+	pb.UserService_GetServerInfo_FullMethodName:      true,
+}
+
+// adminOrSession are the methods acting on a user that only admins and
+// callers with an access token may call; the service then checks that the
+// token is a session of the user
+var adminOrSession = map[string]bool{
+	pb.UserService_ExportUserData_FullMethodName: true,
+	pb.UserService_EraseUser_FullMethodName:      true,
+}
+
+// NewAuthInterceptor identifies the caller with the first authenticator that
+// recognizes the request's credentials, then asks the policy engine whether
+// the caller may invoke the method. Requests without credentials are
+// evaluated as anonymous.
+func NewAuthInterceptor(engine policy.Engine, authenticators ...auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, info.FullMethod, engine, authenticators)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewAuthStreamInterceptor is the streaming counterpart of NewAuthInterceptor
+func NewAuthStreamInterceptor(engine policy.Engine, authenticators ...auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), info.FullMethod, engine, authenticators)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorize returns a context carrying the caller's principal, or a status
+// error when the caller is not allowed to invoke fullMethod
+func authorize(ctx context.Context, fullMethod string, engine policy.Engine, authenticators []auth.Authenticator) (context.Context, error) {
+	principal := &auth.Principal{Subject: auth.Anonymous, Method: "none"}
+
+	for _, authenticator := range authenticators {
+		p, err := authenticator.Authenticate(ctx)
+		if errors.Is(err, auth.ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			slog.Warn("authentication failed",
+				slog.String("method", fullMethod),
+				slog.String("error", err.Error()))
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		}
+		principal = p
+		break
+	}
+
+	if principal.Impersonator != "" {
+		if impersonationDenied[fullMethod] {
+			slog.Warn("impersonated call denied",
+				slog.String("method", fullMethod),
+				slog.String("subject", principal.Subject),
+				slog.String("impersonator", principal.Impersonator))
+			return nil, status.Error(codes.PermissionDenied, "permission denied while impersonating")
+		}
+		slog.Info("impersonated call",
+			slog.String("method", fullMethod),
+			slog.String("subject", principal.Subject),
+			slog.String("impersonator", principal.Impersonator))
+	}
+
+	admin := slices.Contains(principal.Roles, auth.AdminRole)
+	if !admin && (adminOnly[fullMethod] || adminOrSession[fullMethod] && principal.Method != "access_token") {
+		slog.Warn("admin call denied",
+			slog.String("method", fullMethod),
+			slog.String("subject", principal.Subject))
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	input := policy.Input{
+		Subject:      principal.Subject,
+		AuthMethod:   principal.Method,
+		Method:       fullMethod,
+		Impersonator: principal.Impersonator,
+	}
+
+	decision, err := engine.Evaluate(ctx, input)
+	if err != nil {
+		slog.Error("policy evaluation failed",
+			slog.String("method", fullMethod),
+			slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "authorization unavailable")
+	}
+
+	if !decision.Allow {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return auth.NewContext(ctx, principal), nil
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// errAvatarUserChanged is returned when a chunk of an upload names another user
+var errAvatarUserChanged = errors.New("user_id must not change during an upload")
+
+// UploadAvatar stores the avatar streamed in chunks by the client
+func (s *UserServer) UploadAvatar(stream pb.UserService_UploadAvatarServer) error {
+	if s.avatarService == nil {
+		return status.Error(codes.Unimplemented, "avatar storage is not configured")
+	}
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if err != nil {
+		return err
+	}
+	if first.UserId <= 0 {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	slog.Info("uploading avatar", slog.Int64("user_id", first.UserId))
+
+	r := &avatarReader{stream: stream, userID: first.UserId, buf: first.Chunk}
+	user, err := s.avatarService.Upload(ctx, first.UserId, r)
+	switch {
+	case errors.Is(err, service.ErrAvatarTooLarge), errors.Is(err, service.ErrUnsupportedAvatar), errors.Is(err, errAvatarUserChanged):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		slog.Error("failed to upload avatar", slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to upload avatar: %v", err)
+	}
+
+	return stream.SendAndClose(&pb.UserResponse{User: mapper.User(user)})
+}
+
+// GetAvatar returns the avatar of a user
+func (s *UserServer) GetAvatar(ctx context.Context, req *pb.GetAvatarRequest) (*pb.GetAvatarResponse, error) {
+	if s.avatarService == nil {
+		return nil, status.Error(codes.Unimplemented, "avatar storage is not configured")
+	}
+
+	slog.Info("getting avatar", slog.Int64("user_id", req.UserId))
+
+	data, contentType, err := s.avatarService.Get(ctx, req.UserId)
+	switch {
+	case errors.Is(err, service.ErrAvatarNotFound), errors.Is(err, service.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		slog.Error("failed to get avatar", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to get avatar: %v", err)
+	}
+
+	return &pb.GetAvatarResponse{ContentType: contentType, Data: data}, nil
+}
+
+// avatarReader reads the chunks of an UploadAvatar stream as one byte stream
+type avatarReader struct {
+	stream pb.UserService_UploadAvatarServer
+	userID int64
+	buf    []byte
+}
+
+// Read implements io.Reader
+func (r *avatarReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if req.UserId != 0 && req.UserId != r.userID {
+			return 0, errAvatarUserChanged
+		}
+		r.buf = req.Chunk
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// batchGetMetrics counts the failed lookups of BatchGetUsers
+type batchGetMetrics struct {
+	itemFailures    *prometheus.CounterVec
+	partialFailures prometheus.Counter
+}
+
+func newBatchGetMetrics() *batchGetMetrics {
+	return &batchGetMetrics{
+		itemFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "batch_get_users_item_failures_total",
+			Help: "Number of BatchGetUsers lookups that failed, by gRPC code",
+		}, []string{"code"}),
+		partialFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "batch_get_users_partial_failures_total",
+			Help: "Number of BatchGetUsers calls answered although some lookups failed for a reason other than NotFound",
+		}),
+	}
+}
+
+// BatchGetUsers gets users by ID with one result per ID
+func (s *UserServer) BatchGetUsers(ctx context.Context, req *pb.BatchGetUsersRequest) (*pb.BatchGetUsersResponse, error) {
+	slog.Debug("batch getting users", slog.Int("ids", len(req.Ids)))
+
+	results := s.userService.BatchGetUsers(ctx, req.Ids)
+
+	resp := &pb.BatchGetUsersResponse{Results: make([]*pb.BatchGetUserResult, len(results))}
+	var failed int
+	for i, result := range results {
+		pbResult := &pb.BatchGetUserResult{Id: req.Ids[i]}
+		if result.Err != nil {
+			pbResult.Error = toBatchGetError(result.Err)
+			code := codes.Code(pbResult.Error.Code)
+			s.batchGets.itemFailures.WithLabelValues(code.String()).Inc()
+			if code != codes.NotFound {
+				failed++
+			}
+		} else {
+			pbResult.User = mapper.User(result.User)
+			resp.Found++
+		}
+		resp.Results[i] = pbResult
+	}
+
+	switch {
+	case failed > 0 && failed == len(results):
+		return nil, status.Errorf(codes.Unavailable, "failed to get users: %s", resp.Results[0].Error.Message)
+	case failed > 0:
+		s.batchGets.partialFailures.Inc()
+		slog.Warn("users batch partially failed",
+			slog.Int("requested", len(results)),
+			slog.Int("failed", failed))
+	}
+
+	return resp, nil
+}
+
+// toBatchGetError maps a failed lookup to its error details, telling users
+// that do not exist apart from lookups that may succeed when retried
+func toBatchGetError(err error) *pb.BatchItemError {
+	code := codes.Unavailable
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		code = codes.NotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		slog.Error("failed to get user in batch", slog.String("error", err.Error()))
+	}
+	return &pb.BatchItemError{Code: int32(code), Message: err.Error()}
+}
+
+// Describe implements prometheus.Collector
+func (s *UserServer) Describe(ch chan<- *prometheus.Desc) {
+	s.batchGets.itemFailures.Describe(ch)
+	s.batchGets.partialFailures.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (s *UserServer) Collect(ch chan<- prometheus.Metric) {
+	s.batchGets.itemFailures.Collect(ch)
+	s.batchGets.partialFailures.Collect(ch)
+}
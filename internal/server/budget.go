@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/budget"
+)
+
+// NewBudgetInterceptor enforces per-method budgets. Requests larger than
+// their method allows are rejected with InvalidArgument; handlers running
+// past their latency budget are logged and counted but still answered.
+func NewBudgetInterceptor(budgets *budget.Budgets) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		b, ok := budgets.For(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if size := messageSize(req); b.MaxRequestBytes > 0 && size > b.MaxRequestBytes {
+			budgets.Violated(info.FullMethod, budget.Size)
+			return nil, status.Errorf(codes.InvalidArgument, "request of %d bytes exceeds the limit of %d bytes", size, b.MaxRequestBytes)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		if elapsed := time.Since(start); b.MaxLatency > 0 && elapsed > b.MaxLatency {
+			budgets.Violated(info.FullMethod, budget.Latency)
+			slog.Warn("latency budget exceeded",
+				slog.String("method", info.FullMethod),
+				slog.Duration("duration", elapsed),
+				slog.Duration("budget", b.MaxLatency),
+				slog.String("code", status.Code(err).String()))
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/diagnostics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// ListDataIssues returns the anomalies found by the latest data quality
+// scan of this instance
+func (s *UserServer) ListDataIssues(ctx context.Context, req *pb.ListDataIssuesRequest) (*pb.ListDataIssuesResponse, error) {
+	if s.dataQuality == nil {
+		return nil, status.Error(codes.FailedPrecondition, "data quality checks are disabled")
+	}
+
+	kind := diagnostics.IssueKind(req.Kind)
+	if kind != "" && !slices.Contains(diagnostics.IssueKinds, kind) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown issue kind %q", req.Kind)
+	}
+
+	report := s.dataQuality.Report(kind)
+	if report == nil {
+		return nil, status.Error(codes.Unavailable, "no data quality scan has completed yet")
+	}
+
+	resp := &pb.ListDataIssuesResponse{
+		Issues:    make([]*pb.DataIssue, len(report.Issues)),
+		Counts:    make(map[string]int64, len(report.Counts)),
+		ScannedAt: mapper.Timestamp(report.ScannedAt),
+	}
+	for i, issue := range report.Issues {
+		resp.Issues[i] = &pb.DataIssue{
+			Kind:     string(issue.Kind),
+			Table:    issue.Table,
+			Ids:      issue.IDs,
+			Detail:   issue.Detail,
+			Repaired: issue.Repaired,
+		}
+	}
+	for kind, count := range report.Counts {
+		resp.Counts[string(kind)] = count
+	}
+	return resp, nil
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/deadline"
+)
+
+// NewDeadlineBudgetInterceptor bounds the database and cache calls of each
+// request by its share of the remaining deadline, keeping the rest in
+// reserve for the handler to finish
+func NewDeadlineBudgetInterceptor(budget *deadline.Budget) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(deadline.NewContext(ctx, budget), req)
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// TrafficRecord summarizes one call as it went over the wire. It holds no
+// message contents and no metadata values, so it is safe to hand out.
+type TrafficRecord struct {
+	Method    string
+	Peer      string
+	UserAgent string
+	// MetadataKeys are the names of the request metadata entries, sorted
+	MetadataKeys []string
+	// RequestBytes and ResponseBytes are the encoded sizes of the messages
+	// received and sent, summed over a stream
+	RequestBytes     int64
+	ResponseBytes    int64
+	MessagesReceived int
+	MessagesSent     int
+	Code             string
+	StartedAt        time.Time
+	Duration         time.Duration
+}
+
+// TrafficFilter selects records from a TrafficDump. Zero fields match
+// every record.
+type TrafficFilter struct {
+	Method string
+	Peer   string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// TrafficDump keeps summaries of the latest calls in a ring buffer, to
+// find out what a client sent without capturing TLS traffic
+type TrafficDump struct {
+	methods []string
+
+	mu      sync.Mutex
+	records []TrafficRecord
+	next    int
+	full    bool
+}
+
+// NewTrafficDump creates a TrafficDump keeping the size latest calls of the
+// methods matching the patterns
+func NewTrafficDump(size int, methods []string) *TrafficDump {
+	return &TrafficDump{methods: methods, records: make([]TrafficRecord, size)}
+}
+
+// UnaryInterceptor records every unary call of the dumped methods. It
+// should run early so that rejected calls are recorded too.
+func (d *TrafficDump) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !authz.MatchAny(d.methods, info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	record := newTrafficRecord(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+
+	record.RequestBytes, record.MessagesReceived = int64(messageSize(req)), 1
+	if err == nil {
+		record.ResponseBytes, record.MessagesSent = int64(messageSize(resp)), 1
+	}
+	d.add(record, err)
+
+	return resp, err
+}
+
+// StreamInterceptor records every streaming call of the dumped methods
+func (d *TrafficDump) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !authz.MatchAny(d.methods, info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	counted := &countingStream{ServerStream: ss, record: newTrafficRecord(ss.Context(), info.FullMethod)}
+	err := handler(srv, counted)
+	d.add(counted.record, err)
+
+	return err
+}
+
+// Records returns the records matching filter, the calls that finished
+// last first
+func (d *TrafficDump) Records(filter TrafficFilter) []TrafficRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	count := d.next
+	if d.full {
+		count = len(d.records)
+	}
+
+	var records []TrafficRecord
+	for i := 1; i <= count; i++ {
+		record := d.records[(d.next-i+len(d.records))%len(d.records)]
+		if filter.matches(record) {
+			records = append(records, record)
+			if filter.Limit > 0 && len(records) == filter.Limit {
+				break
+			}
+		}
+	}
+	return records
+}
+
+func (d *TrafficDump) add(record TrafficRecord, err error) {
+	record.Code = status.Code(err).String()
+	record.Duration = time.Since(record.StartedAt)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.records[d.next] = record
+	d.next = (d.next + 1) % len(d.records)
+	if d.next == 0 {
+		d.full = true
+	}
+}
+
+func (f TrafficFilter) matches(record TrafficRecord) bool {
+	switch {
+	case f.Method != "" && !authz.MatchAny([]string{f.Method}, record.Method):
+		return false
+	case f.Peer != "" && record.Peer != f.Peer:
+		return false
+	case !f.Since.IsZero() && record.StartedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !record.StartedAt.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+func newTrafficRecord(ctx context.Context, method string) TrafficRecord {
+	record := TrafficRecord{Method: method, Peer: peerHost(ctx), StartedAt: time.Now()}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key := range md {
+		record.MetadataKeys = append(record.MetadataKeys, key)
+	}
+	sort.Strings(record.MetadataKeys)
+	record.UserAgent = strings.Join(md.Get("user-agent"), " ")
+
+	return record
+}
+
+// countingStream adds the messages a stream carries to its record
+type countingStream struct {
+	grpc.ServerStream
+	record TrafficRecord
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.record.MessagesReceived++
+	s.record.RequestBytes += int64(messageSize(m))
+	return nil
+}
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.record.MessagesSent++
+	s.record.ResponseBytes += int64(messageSize(m))
+	return nil
+}
+
+// GetTrafficDump returns the summaries of the latest calls matching the
+// request, the calls that finished last first. It requires the admin role.
+func (s *UserServer) GetTrafficDump(ctx context.Context, req *pb.GetTrafficDumpRequest) (*pb.GetTrafficDumpResponse, error) {
+	if !auth.HasRole(ctx, auth.AdminRole) {
+		return nil, status.Error(codes.PermissionDenied, "reading the traffic dump requires the admin role")
+	}
+	if s.trafficDump == nil {
+		return nil, status.Error(codes.FailedPrecondition, "traffic dump is disabled")
+	}
+
+	filter := TrafficFilter{Method: req.Method, Peer: req.Peer, Limit: int(req.Limit)}
+	if req.Since != nil {
+		filter.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		filter.Until = req.Until.AsTime()
+	}
+
+	records := s.trafficDump.Records(filter)
+	resp := &pb.GetTrafficDumpResponse{Records: make([]*pb.TrafficRecord, len(records))}
+	for i, record := range records {
+		resp.Records[i] = &pb.TrafficRecord{
+			Method:           record.Method,
+			Peer:             record.Peer,
+			UserAgent:        record.UserAgent,
+			MetadataKeys:     record.MetadataKeys,
+			RequestBytes:     record.RequestBytes,
+			ResponseBytes:    record.ResponseBytes,
+			MessagesReceived: int32(record.MessagesReceived),
+			MessagesSent:     int32(record.MessagesSent),
+			Code:             record.Code,
+			StartedAt:        mapper.Timestamp(record.StartedAt),
+			DurationUs:       record.Duration.Microseconds(),
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the google.rpc.ErrorInfo domain of errors raised here
+const errorDomain = "userservice"
+
+// errEmailExists is the status of writes conflicting with another user's email
+var errEmailExists = alreadyExistsError("email", "EMAIL_ALREADY_EXISTS", "a user with this email already exists")
+
+// alreadyExistsError builds an AlreadyExists status error carrying a
+// google.rpc.ErrorInfo detail that names the conflicting field, so clients
+// can point at the field without parsing the message
+func alreadyExistsError(field, reason, msg string) error {
+	st := status.New(codes.AlreadyExists, msg)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: map[string]string{"field": field},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+)
+
+func TestAlreadyExistsError(t *testing.T) {
+	st := status.Convert(errEmailExists)
+	if st.Code() != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists, got %v", st.Code())
+	}
+
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected one detail, got %v", details)
+	}
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	if !ok {
+		t.Fatalf("expected ErrorInfo, got %T", details[0])
+	}
+	if info.Reason != "EMAIL_ALREADY_EXISTS" || info.Metadata["field"] != "email" {
+		t.Errorf("unexpected error info %v", info)
+	}
+}
+
+func TestToBatchGetError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"missing user", fmt.Errorf("lookup: %w", service.ErrUserNotFound), codes.NotFound},
+		{"expired deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{"unreachable shard", errors.New("dial tcp: connection refused"), codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codes.Code(toBatchGetError(tt.err).Code); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"google.golang.org/grpc"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+)
+
+// Exemptions are the methods served without authentication, authorization
+// and per-caller rate limits, such as health checks and Login. Patterns use
+// the authz syntax; "*" is refused so everything cannot be exempted at once,
+// and so are admin methods.
+type Exemptions struct {
+	patterns []string
+}
+
+// NewExemptions creates Exemptions for the given method patterns
+func NewExemptions(patterns []string) (*Exemptions, error) {
+	if err := authz.CheckPatterns(patterns); err != nil {
+		return nil, err
+	}
+	if slices.Contains(patterns, "*") {
+		return nil, fmt.Errorf("pattern \"*\" would exempt every method")
+	}
+	for method := range adminOnly {
+		if authz.MatchAny(patterns, method) {
+			return nil, fmt.Errorf("admin method %s cannot be exempted", method)
+		}
+	}
+	return &Exemptions{patterns: patterns}, nil
+}
+
+// Exempt reports whether method bypasses the wrapped interceptors
+func (e *Exemptions) Exempt(method string) bool {
+	return authz.MatchAny(e.patterns, method)
+}
+
+// Check reports patterns matching none of the methods registered on a
+// server, as returned by grpc.Server.GetServiceInfo, so that a misspelled
+// method fails startup instead of leaving the intended one protected and
+// a future one exposed
+func (e *Exemptions) Check(services map[string]grpc.ServiceInfo) error {
+	for _, pattern := range e.patterns {
+		found := false
+		for name, info := range services {
+			for _, method := range info.Methods {
+				if authz.MatchAny([]string{pattern}, "/"+name+"/"+method.Name) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("exempt method %q is not registered", pattern)
+		}
+	}
+	return nil
+}
+
+// Unary wraps interceptor so that exempt methods skip it
+func (e *Exemptions) Unary(interceptor grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if e.Exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// Stream wraps interceptor so that exempt methods skip it
+func (e *Exemptions) Stream(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if e.Exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return interceptor(srv, ss, info, handler)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Fence reports whether writes are currently accepted
+type Fence interface {
+	Writable() bool
+}
+
+// NewWriteFenceInterceptor rejects every method not listed in readOnly while
+// the fence is closed, e.g. in a secondary region whose database is a
+// replica. Clients should send writes to the primary region.
+func NewWriteFenceInterceptor(fence Fence, readOnly map[string]bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if readOnly[info.FullMethod] || fence.Writable() {
+			return handler(ctx, req)
+		}
+
+		return nil, status.Error(codes.FailedPrecondition, "region is read-only, send writes to the primary region")
+	}
+}
+
+// NewWriteFenceStreamInterceptor is the streaming counterpart of
+// NewWriteFenceInterceptor, rejecting streams such as ImportUsers before
+// any message is read
+func NewWriteFenceStreamInterceptor(fence Fence, readOnly map[string]bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if readOnly[info.FullMethod] || fence.Writable() {
+			return handler(srv, ss)
+		}
+
+		return status.Error(codes.FailedPrecondition, "region is read-only, send writes to the primary region")
+	}
+}
@@ -2,27 +2,98 @@ package server
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/audit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/buildinfo"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/captcha"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/diagnostics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
 	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
 )
 
-// UserServer implements the gRPC UserService
+const (
+	// maxStreamChunkSize caps the number of users sent per stream message
+	maxStreamChunkSize = 5000
+	// importBatchSize is the number of users inserted per ImportUsers batch
+	importBatchSize = 1000
+	// maxBulkDeleteUsers caps the users deleted by one BulkDeleteUsers call
+	maxBulkDeleteUsers = 1000
+	// maxFlushBatchSize caps the keys scanned per FlushCache batch
+	maxFlushBatchSize = 10000
+)
+
+// syncLimits bounds SyncUsers pages, which are read by machines and so are
+// larger than interactive listings
+var syncLimits = pagination.Limits{Default: 500, Max: 1000}
+
+// UserServer implements the gRPC UserService. It is also a
+// prometheus.Collector of the metrics of its handlers.
 type UserServer struct {
 	pb.UnimplementedUserServiceServer
-	userService *service.UserService
+	userService         *service.UserService
+	usageService        *service.UsageService
+	registrationService *service.RegistrationService
+	invitationService   *service.InvitationService
+	organizationService *service.OrganizationService
+	avatarService       *service.AvatarService
+	apiKeyService       *service.APIKeyService
+	passwordService     *service.PasswordService
+	sessionService      *service.SessionService
+	privacyService      *service.PrivacyService
+	auditRecorder       *audit.Recorder
+	streamChunkSize     int
+	info                buildinfo.Info
+	// trafficDump is nil unless the traffic dump is on
+	trafficDump *TrafficDump
+	// reportService is nil unless a report store is configured
+	reportService *service.ReportService
+	// guestService is nil unless guest users are on
+	guestService *service.GuestService
+	// dataQuality is nil unless data quality scans are on
+	dataQuality *diagnostics.DataQualityChecker
+	watches     *WatchSessions
+	batchGets   *batchGetMetrics
 }
 
 // NewUserServer creates a new UserServer instance
-func NewUserServer(userService *service.UserService) *UserServer {
+func NewUserServer(userService *service.UserService, usageService *service.UsageService, registrationService *service.RegistrationService, invitationService *service.InvitationService, organizationService *service.OrganizationService, avatarService *service.AvatarService, apiKeyService *service.APIKeyService, passwordService *service.PasswordService, sessionService *service.SessionService, privacyService *service.PrivacyService, reportService *service.ReportService, guestService *service.GuestService, auditRecorder *audit.Recorder, streamChunkSize int, info buildinfo.Info, trafficDump *TrafficDump, dataQuality *diagnostics.DataQualityChecker, watches *WatchSessions) *UserServer {
 	return &UserServer{
-		userService: userService,
+		userService:         userService,
+		usageService:        usageService,
+		registrationService: registrationService,
+		invitationService:   invitationService,
+		organizationService: organizationService,
+		avatarService:       avatarService,
+		apiKeyService:       apiKeyService,
+		passwordService:     passwordService,
+		sessionService:      sessionService,
+		privacyService:      privacyService,
+		reportService:       reportService,
+		guestService:        guestService,
+		auditRecorder:       auditRecorder,
+		streamChunkSize:     streamChunkSize,
+		info:                info,
+		trafficDump:         trafficDump,
+		dataQuality:         dataQuality,
+		watches:             watches,
+		batchGets:           newBatchGetMetrics(),
 	}
 }
 
@@ -32,103 +103,478 @@ func (s *UserServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest)
 		slog.String("email", req.Email),
 		slog.String("name", req.Name))
 
-	user, err := s.userService.CreateUser(ctx, req.Email, req.Name)
+	user, err := s.userService.CreateUser(ctx, req.Email, req.Name, req.Metadata, req.Timezone, req.Locale)
+	if errors.Is(err, service.ErrInvalidMetadata) || errors.Is(err, service.ErrInvalidTimezone) || errors.Is(err, service.ErrInvalidLocale) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrUserExists) {
+		return nil, errEmailExists
+	}
 	if err != nil {
 		slog.Error("failed to create user", slog.String("error", err.Error()))
 		return nil, status.Errorf(codes.Internal, "failed to create user: %v", err)
 	}
 
-	return &pb.UserResponse{
-		User: &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Unix(),
-			UpdatedAt: user.UpdatedAt.Unix(),
-		},
-	}, nil
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// BatchCreateUsers creates many users in one transaction with per-user results
+func (s *UserServer) BatchCreateUsers(ctx context.Context, req *pb.BatchCreateUsersRequest) (*pb.BatchCreateUsersResponse, error) {
+	slog.Info("batch creating users",
+		slog.Int("count", len(req.Users)),
+		slog.Bool("atomic", req.Atomic))
+
+	inputs := make([]service.NewUser, len(req.Users))
+	for i, u := range req.Users {
+		inputs[i] = service.NewUser{Email: u.Email, Name: u.Name}
+	}
+
+	results, err := s.userService.BatchCreateUsers(ctx, inputs, req.Atomic)
+	if err != nil {
+		slog.Error("failed to batch create users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to create users: %v", err)
+	}
+
+	resp := &pb.BatchCreateUsersResponse{Results: make([]*pb.BatchCreateUserResult, len(results))}
+	for i, result := range results {
+		pbResult := &pb.BatchCreateUserResult{Index: int32(i)}
+		if result.Err != nil {
+			pbResult.Error = toBatchItemError(result.Err)
+		} else {
+			pbResult.User = mapper.User(result.User)
+			resp.Created++
+		}
+		resp.Results[i] = pbResult
+	}
+
+	return resp, nil
+}
+
+// ImportUsers inserts the users streamed by the client in batches and
+// replies with a summary once the stream ends
+func (s *UserServer) ImportUsers(stream pb.UserService_ImportUsersServer) error {
+	ctx := stream.Context()
+	importer := s.userService.NewImporter(importBatchSize)
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, user := range req.Users {
+			if err := importer.Add(ctx, user.Email, user.Name); err != nil {
+				slog.Error("failed to import users", slog.String("error", err.Error()))
+				return status.Errorf(codes.Internal, "failed to import users: %v", err)
+			}
+		}
+	}
+
+	summary, err := importer.Close(ctx)
+	if err != nil {
+		slog.Error("failed to import users", slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to import users after inserting %d: %v", summary.Inserted, err)
+	}
+
+	resp := &pb.ImportUsersResponse{
+		Received:          summary.Received,
+		Inserted:          summary.Inserted,
+		SkippedDuplicates: summary.Duplicates,
+		Errored:           summary.Errored,
+	}
+	for _, e := range summary.Errors {
+		resp.Errors = append(resp.Errors, &pb.ImportUserError{Row: e.Row, Error: toBatchItemError(e.Err)})
+	}
+
+	return stream.SendAndClose(resp)
+}
+
+// toBatchItemError maps a per-user batch failure to its error details
+func toBatchItemError(err error) *pb.BatchItemError {
+	code, field := codes.Internal, ""
+	switch {
+	case errors.Is(err, service.ErrEmailRequired):
+		code, field = codes.InvalidArgument, "email"
+	case errors.Is(err, service.ErrNameRequired):
+		code, field = codes.InvalidArgument, "name"
+	case errors.Is(err, service.ErrDuplicateInBatch):
+		code, field = codes.InvalidArgument, "email"
+	case errors.Is(err, service.ErrUserExists):
+		code, field = codes.AlreadyExists, "email"
+	case errors.Is(err, service.ErrBatchAborted):
+		code = codes.Aborted
+	default:
+		slog.Error("failed to create user in batch", slog.String("error", err.Error()))
+	}
+	return &pb.BatchItemError{Code: int32(code), Message: err.Error(), Field: field}
 }
 
 // GetUser retrieves a user by ID
 func (s *UserServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.UserResponse, error) {
-	slog.Info("getting user", slog.Int64("id", req.Id))
+	slog.Info("getting user",
+		slog.Int64("id", req.Id),
+		slog.String("uuid", req.Uuid),
+		slog.Int64("as_of", req.AsOf))
 
-	user, err := s.userService.GetUser(ctx, req.Id)
+	var (
+		user *model.User
+		err  error
+	)
+	switch {
+	case req.Uuid != "" && req.AsOf > 0:
+		return nil, status.Error(codes.InvalidArgument, "as_of is only supported for lookups by id")
+	case req.Uuid != "":
+		user, err = s.userService.GetUserByUUID(ctx, req.Uuid)
+	case req.AsOf > 0:
+		user, err = s.userService.GetUserAsOf(ctx, req.Id, time.Unix(req.AsOf, 0))
+	default:
+		user, err = s.userService.GetUser(ctx, req.Id)
+	}
+	if errors.Is(err, service.ErrInvalidUUID) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		slog.Error("failed to get user", slog.String("error", err.Error()))
 		return nil, status.Errorf(codes.NotFound, "user not found: %v", err)
 	}
 
-	return &pb.UserResponse{
-		User: &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Unix(),
-			UpdatedAt: user.UpdatedAt.Unix(),
-		},
-	}, nil
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *UserServer) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.UserResponse, error) {
+	slog.Info("getting user by email", slog.String("email", req.Email))
+
+	user, err := s.userService.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		slog.Error("failed to get user by email", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to get user: %v", err)
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
 }
 
 // ListUsers lists all users with pagination
 func (s *UserServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
 	slog.Info("listing users",
 		slog.Int("page", int(req.Page)),
-		slog.Int("page_size", int(req.PageSize)))
+		slog.Int("page_size", int(req.PageSize)),
+		slog.Int64("organization_id", req.OrganizationId))
 
-	// Go 1.21: min/max built-in functions
-	pageSize := min(int(req.PageSize), 100)
-	page := max(int(req.Page), 1)
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	page := pagination.Page(int(req.Page))
 
-	users, total, err := s.userService.ListUsers(ctx, page, pageSize)
+	var (
+		users []*model.User
+		total int
+		next  string
+		err   error
+	)
+	switch {
+	case req.PageToken != "":
+		users, next, err = s.userService.ListUsersAfter(ctx, req.OrganizationId, req.PageToken, pageSize)
+	case req.OrganizationId > 0:
+		users, total, err = s.organizationService.ListUsers(ctx, req.OrganizationId, page, pageSize)
+		next = service.NextPageToken(users, pageSize)
+	default:
+		users, total, err = s.userService.ListUsers(ctx, page, pageSize)
+		next = service.NextPageToken(users, pageSize)
+	}
+	if errors.Is(err, service.ErrInvalidPageToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		slog.Error("failed to list users", slog.String("error", err.Error()))
 		return nil, status.Errorf(codes.Internal, "failed to list users: %v", err)
 	}
 
-	pbUsers := make([]*pb.User, len(users))
-	for i, user := range users {
-		pbUsers[i] = &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Unix(),
-			UpdatedAt: user.UpdatedAt.Unix(),
-		}
+	return &pb.ListUsersResponse{
+		Users:         mapper.Users(users),
+		Total:         int32(total),
+		NextPageToken: next,
+	}, nil
+}
+
+// SearchUsers lists users matching filters in the requested order
+func (s *UserServer) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.ListUsersResponse, error) {
+	slog.Info("searching users",
+		slog.String("name_prefix", req.NamePrefix),
+		slog.String("email_domain", req.EmailDomain),
+		slog.String("sort_by", req.SortBy),
+		slog.Int("page", int(req.Page)),
+		slog.Int("page_size", int(req.PageSize)))
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	page := pagination.Page(int(req.Page))
+
+	filter := repository.UserFilter{
+		NamePrefix:   req.NamePrefix,
+		EmailDomain:  req.EmailDomain,
+		Metadata:     req.Metadata,
+		MetadataKeys: req.MetadataKeys,
+	}
+	if req.CreatedAfter > 0 {
+		filter.CreatedAfter = time.Unix(req.CreatedAfter, 0)
+	}
+	if req.CreatedBefore > 0 {
+		filter.CreatedBefore = time.Unix(req.CreatedBefore, 0)
+	}
+	sort := repository.UserSort{
+		Field: req.SortBy,
+		Desc:  req.SortDirection != pb.SortDirection_SORT_DIRECTION_ASC,
+	}
+
+	users, total, err := s.userService.SearchUsers(ctx, filter, sort, page, pageSize)
+	switch {
+	case errors.Is(err, service.ErrInvalidSortField), errors.Is(err, service.ErrInvalidCreatedRange), errors.Is(err, service.ErrInvalidMetadata):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrEmailNotSearchable), errors.Is(err, service.ErrMetadataNotSearchable):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		slog.Error("failed to search users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to search users: %v", err)
 	}
 
 	return &pb.ListUsersResponse{
-		Users: pbUsers,
+		Users: mapper.Users(users),
 		Total: int32(total),
 	}, nil
 }
 
+// CountUsers counts the users matching an optional filter
+func (s *UserServer) CountUsers(ctx context.Context, req *pb.CountUsersRequest) (*pb.CountUsersResponse, error) {
+	slog.Info("counting users",
+		slog.Bool("filter", req.Filter != nil))
+
+	count, err := s.userService.CountUsers(ctx, userFilter(req.Filter))
+	switch {
+	case errors.Is(err, service.ErrInvalidCreatedRange), errors.Is(err, service.ErrInvalidMetadata):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrEmailNotSearchable), errors.Is(err, service.ErrMetadataNotSearchable):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		slog.Error("failed to count users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to count users: %v", err)
+	}
+
+	return &pb.CountUsersResponse{Count: int64(count)}, nil
+}
+
+// userFilter converts an API filter, which may be nil, to a repository filter
+func userFilter(f *pb.UserFilter) repository.UserFilter {
+	filter := repository.UserFilter{
+		NamePrefix:   f.GetNamePrefix(),
+		EmailDomain:  f.GetEmailDomain(),
+		Metadata:     f.GetMetadata(),
+		MetadataKeys: f.GetMetadataKeys(),
+	}
+	if f.GetCreatedAfter() > 0 {
+		filter.CreatedAfter = time.Unix(f.GetCreatedAfter(), 0)
+	}
+	if f.GetCreatedBefore() > 0 {
+		filter.CreatedBefore = time.Unix(f.GetCreatedBefore(), 0)
+	}
+	return filter
+}
+
+// StreamUsers streams every user in chunks so that clients can iterate over
+// the whole table without paging
+func (s *UserServer) StreamUsers(req *pb.StreamUsersRequest, stream pb.UserService_StreamUsersServer) error {
+	chunkSize := int(req.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = s.streamChunkSize
+	}
+	chunkSize = min(chunkSize, maxStreamChunkSize)
+
+	slog.Info("streaming users", slog.Int("chunk_size", chunkSize))
+
+	var sent int
+	err := s.userService.StreamUsers(stream.Context(), chunkSize, func(users []*model.User) error {
+		sent += len(users)
+		return stream.Send(&pb.StreamUsersResponse{Users: mapper.Users(users)})
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		slog.Error("failed to stream users",
+			slog.Int("sent", sent),
+			slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to stream users: %v", err)
+	}
+
+	return nil
+}
+
+// ExportUsers streams every user serialized as CSV or NDJSON
+func (s *UserServer) ExportUsers(req *pb.ExportUsersRequest, stream pb.UserService_ExportUsersServer) error {
+	chunkSize := int(req.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = s.streamChunkSize
+	}
+	chunkSize = min(chunkSize, maxStreamChunkSize)
+
+	format := service.ExportCSV
+	if req.Format == pb.ExportFormat_EXPORT_FORMAT_NDJSON {
+		format = service.ExportNDJSON
+	}
+
+	slog.Info("exporting users",
+		slog.String("format", string(format)),
+		slog.Int("chunk_size", chunkSize))
+
+	exported, err := s.userService.ExportUsers(stream.Context(), format, chunkSize, func(data []byte) error {
+		return stream.Send(&pb.ExportUsersChunk{Data: data})
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		slog.Error("failed to export users",
+			slog.Int64("exported", exported),
+			slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to export users: %v", err)
+	}
+
+	return nil
+}
+
+// WatchUsers streams live user changes until the client disconnects. Every
+// stream carries a resume token in its header and trailer; when the stream
+// ends, clients catch up with SyncUsers from the token and watch again.
+// Clients that fall behind are disconnected with ResourceExhausted, and
+// idle streams and streams of a stopping server with Unavailable.
+func (s *UserServer) WatchUsers(req *pb.WatchUsersRequest, stream pb.UserService_WatchUsersServer) error {
+	slog.Info("watching users",
+		slog.Any("types", req.Types),
+		slog.Int("user_ids", len(req.UserIds)))
+
+	types := make([]events.Type, len(req.Types))
+	for i, t := range req.Types {
+		types[i] = events.Type(t)
+	}
+
+	session, err := s.watches.begin(stream.Context())
+	if err != nil {
+		return err
+	}
+	reason := "error"
+	defer func() { session.end(reason) }()
+
+	// The token is taken before subscribing, so resuming from it cannot
+	// miss a change, at the cost of receiving some twice
+	token, err := s.userService.ResumeToken(session.ctx)
+	if err != nil {
+		slog.Error("failed to watch users", slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to watch users: %v", err)
+	}
+	resume := metadata.Pairs(ResumeTokenKey, token)
+	if err := stream.SendHeader(resume); err != nil {
+		return err
+	}
+	stream.SetTrailer(resume)
+
+	err = s.userService.WatchUsers(session.ctx, types, req.UserIds, func(event events.Event) error {
+		change := &pb.UserChange{
+			Type:       string(event.Type),
+			UserId:     event.UserID,
+			OccurredAt: event.OccurredAt.Unix(),
+			MergedInto: event.MergedInto,
+		}
+		if event.User != nil {
+			change.User = mapper.User(event.User)
+		}
+		if err := stream.Send(change); err != nil {
+			return err
+		}
+		session.touch()
+		return nil
+	})
+	if err != nil {
+		switch cause := context.Cause(session.ctx); {
+		case errors.Is(cause, errWatchIdle):
+			err, reason = cause, "idle"
+		case errors.Is(cause, errWatchDrained):
+			err, reason = cause, "drained"
+		}
+	}
+	switch {
+	case errors.Is(err, errWatchIdle):
+		return status.Error(codes.Unavailable, "no change for too long, resume and watch again")
+	case errors.Is(err, errWatchDrained):
+		return status.Error(codes.Unavailable, "server is shutting down, resume and watch again")
+	case errors.Is(err, service.ErrUnknownEventType):
+		reason = "invalid"
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrWatcherLagging):
+		reason = "lagging"
+		return status.Error(codes.ResourceExhausted, "watcher fell behind, resync with SyncUsers and watch again")
+	case errors.Is(err, service.ErrWatchClosed):
+		reason = "drained"
+		return status.Error(codes.Unavailable, "server is shutting down, watch again")
+	case errors.Is(err, service.ErrWatchUnavailable):
+		reason = "unavailable"
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		reason = "client"
+		return status.FromContextError(err).Err()
+	case err != nil:
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		slog.Error("failed to watch users", slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to watch users: %v", err)
+	}
+
+	reason = "client"
+	return nil
+}
+
+// UsersExist reports which of the given IDs belong to existing users
+func (s *UserServer) UsersExist(ctx context.Context, req *pb.UsersExistRequest) (*pb.UsersExistResponse, error) {
+	slog.Debug("checking users exist", slog.Int("ids", len(req.Ids)))
+
+	exists, err := s.userService.UsersExist(ctx, req.Ids)
+	if err != nil {
+		slog.Error("failed to check users exist", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to check users exist: %v", err)
+	}
+
+	return &pb.UsersExistResponse{Exists: exists}, nil
+}
+
 // UpdateUser updates an existing user
 func (s *UserServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UserResponse, error) {
 	slog.Info("updating user",
 		slog.Int64("id", req.Id),
 		slog.String("email", req.Email),
-		slog.String("name", req.Name))
+		slog.String("name", req.Name),
+		slog.Any("update_mask", req.UpdateMask.GetPaths()))
 
-	user, err := s.userService.UpdateUser(ctx, req.Id, req.Email, req.Name)
+	user, err := s.userService.UpdateUser(ctx, req.Id, req.Email, req.Name, req.Metadata, req.Timezone, req.Locale, req.UpdateMask.GetPaths())
+	if errors.Is(err, service.ErrInvalidFieldMask) || errors.Is(err, service.ErrInvalidMetadata) ||
+		errors.Is(err, service.ErrInvalidTimezone) || errors.Is(err, service.ErrInvalidLocale) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrUserExists) {
+		return nil, errEmailExists
+	}
 	if err != nil {
 		slog.Error("failed to update user", slog.String("error", err.Error()))
 		return nil, status.Errorf(codes.Internal, "failed to update user: %v", err)
 	}
 
-	return &pb.UserResponse{
-		User: &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Unix(),
-			UpdatedAt: user.UpdatedAt.Unix(),
-		},
-	}, nil
+	return &pb.UserResponse{User: mapper.User(user)}, nil
 }
 
-// DeleteUser deletes a user by ID
-func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.Empty, error) {
+// DeleteUser soft-deletes a user by ID
+func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error) {
 	slog.Info("deleting user", slog.Int64("id", req.Id))
 
 	err := s.userService.DeleteUser(ctx, req.Id)
@@ -137,32 +583,445 @@ func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest)
 		return nil, status.Errorf(codes.Internal, "failed to delete user: %v", err)
 	}
 
-	return &pb.Empty{}, nil
+	return &emptypb.Empty{}, nil
 }
 
-// LoggingInterceptor logs all gRPC requests
-func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	start := time.Now()
+// BulkDeleteUsers soft-deletes users selected by ID or by filter
+func (s *UserServer) BulkDeleteUsers(ctx context.Context, req *pb.BulkDeleteUsersRequest) (*pb.BulkDeleteUsersResponse, error) {
+	slog.Info("bulk deleting users",
+		slog.Int("ids", len(req.Ids)),
+		slog.Bool("filter", req.Filter != nil),
+		slog.Bool("dry_run", req.DryRun))
 
-	resp, err := handler(ctx, req)
+	var (
+		result *service.BulkDeleteResult
+		err    error
+	)
+	switch {
+	case len(req.Ids) > 0 && req.Filter != nil:
+		return nil, status.Error(codes.InvalidArgument, "ids and filter are exclusive")
+	case len(req.Ids) > maxBulkDeleteUsers:
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d ids per call", maxBulkDeleteUsers)
+	case len(req.Ids) > 0:
+		result, err = s.userService.BulkDeleteUsers(ctx, req.Ids, req.DryRun)
+	case req.Filter != nil:
+		result, err = s.userService.BulkDeleteMatching(ctx, userFilter(req.Filter), maxBulkDeleteUsers, req.DryRun)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "ids or filter is required")
+	}
+	switch {
+	case errors.Is(err, service.ErrEmptyFilter), errors.Is(err, service.ErrInvalidCreatedRange), errors.Is(err, service.ErrInvalidMetadata):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrBulkDeleteTooLarge), errors.Is(err, service.ErrEmailNotSearchable), errors.Is(err, service.ErrMetadataNotSearchable):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		slog.Error("failed to bulk delete users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to bulk delete users: %v", err)
+	}
 
-	slog.Info("grpc request",
-		slog.String("method", info.FullMethod),
-		slog.Duration("duration", time.Since(start)),
-		slog.Bool("error", err != nil))
+	resp := &pb.BulkDeleteUsersResponse{
+		Deleted:    int32(len(result.Deleted)),
+		DeletedIds: result.Deleted,
+	}
+	for _, id := range result.Missing {
+		resp.Failures = append(resp.Failures, &pb.BulkDeleteFailure{
+			Id: id,
+			Error: &pb.BatchItemError{
+				Code:    int32(codes.NotFound),
+				Message: "no user with this ID or already deleted",
+			},
+		})
+	}
 
-	return resp, err
+	return resp, nil
+}
+
+// RestoreUser restores a soft-deleted user
+func (s *UserServer) RestoreUser(ctx context.Context, req *pb.RestoreUserRequest) (*pb.UserResponse, error) {
+	slog.Info("restoring user", slog.Int64("id", req.Id))
+
+	user, err := s.userService.RestoreUser(ctx, req.Id)
+	switch {
+	case errors.Is(err, service.ErrDeletedUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrUserExists):
+		return nil, status.Error(codes.FailedPrecondition, "email has been reused by another user")
+	case err != nil:
+		slog.Error("failed to restore user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to restore user: %v", err)
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// PurgeUser permanently removes a soft-deleted user
+func (s *UserServer) PurgeUser(ctx context.Context, req *pb.PurgeUserRequest) (*emptypb.Empty, error) {
+	slog.Info("purging user", slog.Int64("id", req.Id))
+
+	err := s.userService.PurgeUser(ctx, req.Id)
+	if errors.Is(err, service.ErrDeletedUserNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		slog.Error("failed to purge user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to purge user: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// MergeUsers folds a duplicate account into another, then ends the sessions
+// of the duplicate
+func (s *UserServer) MergeUsers(ctx context.Context, req *pb.MergeUsersRequest) (*pb.UserResponse, error) {
+	slog.Info("merging users",
+		slog.Int64("source_id", req.SourceId),
+		slog.Int64("target_id", req.TargetId))
+
+	var conflict service.MetadataConflict
+	switch req.MetadataConflict {
+	case pb.MetadataConflict_METADATA_CONFLICT_KEEP_TARGET:
+		conflict = service.MetadataKeepTarget
+	case pb.MetadataConflict_METADATA_CONFLICT_PREFER_SOURCE:
+		conflict = service.MetadataPreferSource
+	case pb.MetadataConflict_METADATA_CONFLICT_FAIL:
+		conflict = service.MetadataFail
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metadata conflict %v", req.MetadataConflict)
+	}
+
+	user, err := s.userService.MergeUsers(ctx, req.SourceId, req.TargetId, conflict)
+	switch {
+	case errors.Is(err, service.ErrMergeSameUser), errors.Is(err, service.ErrInvalidMetadata):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrMergeUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrMetadataConflict):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		slog.Error("failed to merge users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to merge users: %v", err)
+	}
+
+	// The merge stands either way; sessions left behind end when they expire
+	if _, err := s.sessionService.RevokeAllSessions(ctx, req.SourceId); err != nil {
+		slog.Warn("failed to revoke sessions of merged user",
+			slog.Int64("user_id", req.SourceId),
+			slog.String("error", err.Error()))
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// GetUserHistory lists the recorded changes of a user with pagination
+func (s *UserServer) GetUserHistory(ctx context.Context, req *pb.GetUserHistoryRequest) (*pb.GetUserHistoryResponse, error) {
+	slog.Info("getting user history",
+		slog.Int64("user_id", req.UserId),
+		slog.Int("page", int(req.Page)),
+		slog.Int("page_size", int(req.PageSize)))
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	page := pagination.Page(int(req.Page))
+
+	entries, total, err := s.userService.GetUserHistory(ctx, req.UserId, page, pageSize)
+	if err != nil {
+		slog.Error("failed to get user history", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to get user history: %v", err)
+	}
+
+	pbEntries := make([]*pb.UserHistoryEntry, len(entries))
+	for i, entry := range entries {
+		pbEntries[i] = &pb.UserHistoryEntry{
+			Version:   entry.Version,
+			UserId:    entry.UserID,
+			Operation: string(entry.Operation),
+			Email:     entry.Email,
+			Name:      entry.Name,
+			CreatedAt: entry.CreatedAt.Unix(),
+			UpdatedAt: entry.UpdatedAt.Unix(),
+			ChangedAt: entry.ChangedAt.Unix(),
+		}
+	}
+
+	return &pb.GetUserHistoryResponse{
+		Entries: pbEntries,
+		Total:   int32(total),
+	}, nil
+}
+
+// ReplayEvents re-emits historical user events to the event bus
+func (s *UserServer) ReplayEvents(ctx context.Context, req *pb.ReplayEventsRequest) (*pb.ReplayEventsResponse, error) {
+	slog.Info("replaying events",
+		slog.Int64("from", req.From),
+		slog.Int64("to", req.To),
+		slog.Any("types", req.Types),
+		slog.Int("user_ids", len(req.UserIds)))
+
+	to := time.Now()
+	if req.To != 0 {
+		to = time.Unix(req.To, 0)
+	}
+
+	types := make([]events.Type, len(req.Types))
+	for i, t := range req.Types {
+		types[i] = events.Type(t)
+	}
+
+	replayed, err := s.userService.ReplayEvents(ctx, time.Unix(req.From, 0), to, types, req.UserIds)
+	if errors.Is(err, service.ErrInvalidReplayRange) || errors.Is(err, service.ErrUnknownEventType) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		slog.Error("failed to replay events",
+			slog.Int64("replayed", replayed),
+			slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to replay events after %d: %v", replayed, err)
+	}
+
+	return &pb.ReplayEventsResponse{Replayed: replayed}, nil
+}
+
+// FlushCache removes the cached entries matching a pattern, reporting the
+// progress after each batch. It requires the admin role.
+func (s *UserServer) FlushCache(req *pb.FlushCacheRequest, stream pb.UserService_FlushCacheServer) error {
+	if !auth.HasRole(stream.Context(), auth.AdminRole) {
+		return status.Error(codes.PermissionDenied, "flushing the cache requires the admin role")
+	}
+	slog.Warn("flushing cache",
+		slog.String("pattern", req.Pattern),
+		slog.Int("batch_size", int(req.BatchSize)))
+
+	batchSize := int(req.BatchSize)
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	batchSize = min(batchSize, maxFlushBatchSize)
+
+	progress, err := s.userService.FlushCache(stream.Context(), req.Pattern, batchSize, func(p cache.FlushProgress) error {
+		return stream.Send(&pb.FlushCacheProgress{Scanned: p.Scanned, Deleted: p.Deleted})
+	})
+	switch {
+	case errors.Is(err, service.ErrEmptyPattern):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case err != nil:
+		slog.Error("failed to flush cache",
+			slog.Int64("deleted", progress.Deleted),
+			slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "failed to flush cache after deleting %d keys: %v", progress.Deleted, err)
+	}
+
+	return stream.Send(&pb.FlushCacheProgress{Scanned: progress.Scanned, Deleted: progress.Deleted, Done: true})
+}
+
+// SyncUsers returns users changed or deleted since the given sync token
+func (s *UserServer) SyncUsers(ctx context.Context, req *pb.SyncUsersRequest) (*pb.SyncUsersResponse, error) {
+	slog.Info("syncing users", slog.Int("page_size", int(req.PageSize)))
+
+	pageSize := syncLimits.Clamp(int(req.PageSize))
+
+	page, err := s.userService.SyncUsers(ctx, req.SinceToken, pageSize)
+	switch {
+	case errors.Is(err, service.ErrInvalidSyncToken):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrSyncTokenExpired):
+		return nil, status.Error(codes.FailedPrecondition, "sync token expired, restart with an empty token")
+	case err != nil:
+		slog.Error("failed to sync users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to sync users: %v", err)
+	}
+
+	return &pb.SyncUsersResponse{
+		Changed:    mapper.Users(page.Changed),
+		DeletedIds: page.DeletedIDs,
+		NextToken:  page.NextToken,
+		HasMore:    page.HasMore,
+	}, nil
+}
+
+// GetUsageReport returns per-caller hourly usage, as rows or as CSV
+func (s *UserServer) GetUsageReport(ctx context.Context, req *pb.GetUsageReportRequest) (*pb.GetUsageReportResponse, error) {
+	slog.Info("getting usage report",
+		slog.String("caller", req.Caller),
+		slog.Int64("from", req.From),
+		slog.Int64("to", req.To))
+
+	to := time.Now()
+	if req.To > 0 {
+		to = time.Unix(req.To, 0)
+	}
+	from := to.Add(-24 * time.Hour)
+	if req.From > 0 {
+		from = time.Unix(req.From, 0)
+	}
+	if !from.Before(to) {
+		return nil, status.Error(codes.InvalidArgument, "from must be before to")
+	}
+
+	records, err := s.usageService.GetUsageReport(ctx, req.Caller, from, to)
+	if err != nil {
+		slog.Error("failed to get usage report", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to get usage report: %v", err)
+	}
+
+	if req.Format == pb.ReportFormat_REPORT_FORMAT_CSV {
+		data, err := service.UsageCSV(records)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to render usage report: %v", err)
+		}
+		return &pb.GetUsageReportResponse{Csv: data}, nil
+	}
+
+	pbRecords := make([]*pb.UsageRecord, len(records))
+	for i, record := range records {
+		pbRecords[i] = &pb.UsageRecord{
+			Caller:   record.Caller,
+			Hour:     record.Hour.Unix(),
+			Requests: record.Requests,
+			DbTimeMs: record.DBTimeMs,
+			CacheOps: record.CacheOps,
+			BytesIn:  record.BytesIn,
+			BytesOut: record.BytesOut,
+		}
+	}
+
+	return &pb.GetUsageReportResponse{Records: pbRecords}, nil
+}
+
+// RegisterUser starts a public self-registration by emailing a verification link
+func (s *UserServer) RegisterUser(ctx context.Context, req *pb.RegisterUserRequest) (*emptypb.Empty, error) {
+	slog.Info("registering user", slog.String("name", req.Name))
+
+	err := s.registrationService.Register(ctx, req.Email, req.Name, req.CaptchaToken, peerHost(ctx))
+	switch {
+	case errors.Is(err, captcha.ErrVerificationFailed):
+		return nil, status.Error(codes.PermissionDenied, "human verification failed")
+	case err != nil:
+		slog.Error("failed to register user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to register user: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// VerifyEmail completes a self-registration and returns the created user
+func (s *UserServer) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.UserResponse, error) {
+	slog.Info("verifying email")
+
+	user, err := s.registrationService.VerifyEmail(ctx, req.Token)
+	switch {
+	case errors.Is(err, service.ErrInvalidVerificationToken):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrUserExists):
+		return nil, errEmailExists
+	case err != nil:
+		slog.Error("failed to verify email", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to verify email: %v", err)
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// InviteUser invites a new user by email on behalf of the caller
+func (s *UserServer) InviteUser(ctx context.Context, req *pb.InviteUserRequest) (*pb.InvitationResponse, error) {
+	slog.Info("inviting user", slog.String("name", req.Name))
+
+	inv, err := s.invitationService.InviteUser(ctx, req.Email, req.Name)
+	switch {
+	case errors.Is(err, service.ErrUserExists), errors.Is(err, service.ErrInvitationPending):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case err != nil:
+		slog.Error("failed to invite user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to invite user: %v", err)
+	}
+
+	return &pb.InvitationResponse{Invitation: toProtoInvitation(inv)}, nil
+}
+
+// ResendInvite extends a pending invitation and emails a new link
+func (s *UserServer) ResendInvite(ctx context.Context, req *pb.ResendInviteRequest) (*pb.InvitationResponse, error) {
+	slog.Info("resending invitation", slog.Int64("id", req.Id))
+
+	inv, err := s.invitationService.ResendInvite(ctx, req.Id)
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		slog.Error("failed to resend invitation", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to resend invitation: %v", err)
+	}
+
+	return &pb.InvitationResponse{Invitation: toProtoInvitation(inv)}, nil
+}
+
+// AcceptInvite creates the invited user from an invite token
+func (s *UserServer) AcceptInvite(ctx context.Context, req *pb.AcceptInviteRequest) (*pb.UserResponse, error) {
+	slog.Info("accepting invitation")
+
+	user, err := s.invitationService.AcceptInvite(ctx, req.Token, req.Name)
+	switch {
+	case errors.Is(err, service.ErrInvalidInviteToken):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrUserExists):
+		return nil, errEmailExists
+	case err != nil:
+		slog.Error("failed to accept invitation", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to accept invitation: %v", err)
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// ListPendingInvites lists invitations that have not been accepted yet
+func (s *UserServer) ListPendingInvites(ctx context.Context, req *pb.ListPendingInvitesRequest) (*pb.ListPendingInvitesResponse, error) {
+	slog.Info("listing pending invitations",
+		slog.Int("page", int(req.Page)),
+		slog.Int("page_size", int(req.PageSize)))
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	page := pagination.Page(int(req.Page))
+
+	invitations, total, err := s.invitationService.ListPendingInvites(ctx, page, pageSize)
+	if err != nil {
+		slog.Error("failed to list invitations", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to list invitations: %v", err)
+	}
+
+	pbInvitations := make([]*pb.Invitation, len(invitations))
+	for i, inv := range invitations {
+		pbInvitations[i] = toProtoInvitation(inv)
+	}
+
+	return &pb.ListPendingInvitesResponse{
+		Invitations: pbInvitations,
+		Total:       int32(total),
+	}, nil
 }
 
-// MetricsInterceptor records metrics for gRPC requests
-func MetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+// toProtoInvitation converts an invitation into its protobuf representation
+func toProtoInvitation(inv *model.Invitation) *pb.Invitation {
+	return &pb.Invitation{
+		Id:        inv.ID,
+		Email:     inv.Email,
+		Name:      inv.Name,
+		InvitedBy: inv.InvitedBy,
+		SendCount: int32(inv.SendCount),
+		ExpiresAt: inv.ExpiresAt.Unix(),
+		CreatedAt: inv.CreatedAt.Unix(),
+		Expired:   inv.Expired(time.Now()),
+	}
+}
+
+// LoggingInterceptor logs all gRPC requests
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	start := time.Now()
 
 	resp, err := handler(ctx, req)
 
-	// Record metrics (Prometheus)
-	duration := time.Since(start).Seconds()
-	_ = duration // TODO: Record to Prometheus histogram
+	slog.InfoContext(ctx, "grpc request",
+		slog.String("method", info.FullMethod),
+		slog.Duration("duration", time.Since(start)),
+		slog.Bool("error", err != nil))
 
 	return resp, err
 }
@@ -171,7 +1030,7 @@ func MetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnarySe
 func RecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			slog.Error("panic recovered",
+			slog.ErrorContext(ctx, "panic recovered",
 				slog.String("method", info.FullMethod),
 				slog.Any("panic", r))
 			err = status.Errorf(codes.Internal, "internal server error")
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/server/servertest"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+type flushStream struct {
+	*servertest.ServerStream
+}
+
+func (flushStream) Send(*pb.FlushCacheProgress) error { return nil }
+
+func TestFlushCache(t *testing.T) {
+	t.Run("requires the admin role", func(t *testing.T) {
+		s := &UserServer{}
+		for name, ctx := range map[string]context.Context{
+			"no principal": context.Background(),
+			"user role":    auth.NewContext(context.Background(), &auth.Principal{Subject: "user:7", Roles: []string{"user"}}),
+		} {
+			t.Log(name)
+			err := s.FlushCache(&pb.FlushCacheRequest{Pattern: "user:*"}, flushStream{servertest.NewServerStream(ctx)})
+			servertest.AssertCode(t, err, codes.PermissionDenied)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/captcha"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// CreateGuestUser creates a guest and starts its session
+func (s *UserServer) CreateGuestUser(ctx context.Context, req *pb.CreateGuestUserRequest) (*pb.SessionTokens, error) {
+	if s.guestService == nil {
+		return nil, status.Error(codes.FailedPrecondition, "guest users are disabled")
+	}
+	slog.Info("creating guest user", slog.String("name", req.Name))
+
+	user, tokens, err := s.guestService.CreateGuest(ctx, req.Name, req.Timezone, req.Locale, req.CaptchaToken, peerHost(ctx))
+	switch {
+	case errors.Is(err, captcha.ErrVerificationFailed):
+		return nil, status.Error(codes.PermissionDenied, "human verification failed")
+	case errors.Is(err, service.ErrInvalidTimezone), errors.Is(err, service.ErrInvalidLocale):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		slog.Error("failed to create guest user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to create guest user: %v", err)
+	}
+
+	resp := toProtoTokens(tokens)
+	resp.User = mapper.User(user)
+	return resp, nil
+}
+
+// UpgradeGuest attaches an email and a password to a guest. Callers using
+// a session may only upgrade their own user.
+func (s *UserServer) UpgradeGuest(ctx context.Context, req *pb.UpgradeGuestRequest) (*pb.UserResponse, error) {
+	if s.guestService == nil {
+		return nil, status.Error(codes.FailedPrecondition, "guest users are disabled")
+	}
+	slog.Info("upgrading guest", slog.Int64("user_id", req.UserId))
+
+	if p, ok := auth.FromContext(ctx); ok && p.Method == "access_token" && p.Subject != service.SessionSubject(req.UserId) {
+		return nil, status.Error(codes.PermissionDenied, "sessions may only upgrade their own user")
+	}
+
+	user, err := s.guestService.UpgradeGuest(ctx, req.UserId, req.Email, req.Password)
+	switch {
+	case errors.Is(err, service.ErrWeakPassword):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrNotGuest):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrUserExists):
+		return nil, errEmailExists
+	case err != nil:
+		slog.Error("failed to upgrade guest", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to upgrade guest: %v", err)
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
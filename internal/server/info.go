@@ -0,0 +1,21 @@
+package server
+
+import (
+	"context"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// GetServerInfo describes the running binary and the features its
+// configuration enables
+func (s *UserServer) GetServerInfo(ctx context.Context, req *pb.GetServerInfoRequest) (*pb.ServerInfo, error) {
+	return &pb.ServerInfo{
+		GoVersion:     s.info.GoVersion,
+		Revision:      s.info.Revision,
+		Modules:       s.info.Modules,
+		SchemaVersion: s.info.SchemaVersion,
+		Features:      s.info.Features,
+		StartedAt:     mapper.Timestamp(s.info.StartedAt),
+	}, nil
+}
@@ -0,0 +1,536 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/budget"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/policy"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/ratelimit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/server/servertest"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+type staticFence bool
+
+func (f staticFence) Writable() bool { return bool(f) }
+
+type engineFunc func(policy.Input) bool
+
+func (f engineFunc) Evaluate(_ context.Context, input policy.Input) (policy.Decision, error) {
+	return policy.Decision{Allow: f(input)}, nil
+}
+
+// fixedPrincipal identifies every caller as the same principal
+type fixedPrincipal auth.Principal
+
+func (p fixedPrincipal) Authenticate(context.Context) (*auth.Principal, error) {
+	principal := auth.Principal(p)
+	return &principal, nil
+}
+
+type impersonating string
+
+func (i impersonating) Authenticate(context.Context) (*auth.Principal, error) {
+	return &auth.Principal{Subject: "user:42", Method: "impersonation_token", Impersonator: string(i)}, nil
+}
+
+func TestWriteFenceInterceptor(t *testing.T) {
+	readOnly := map[string]bool{pb.UserService_GetUser_FullMethodName: true}
+	interceptor := NewWriteFenceInterceptor(staticFence(false), readOnly)
+
+	t.Run("serves reads", func(t *testing.T) {
+		h := &servertest.Handler{}
+		_, err := interceptor(context.Background(), nil, servertest.UnaryInfo(pb.UserService_GetUser_FullMethodName), h.Handle)
+		if err != nil || !h.Called() {
+			t.Errorf("expected the read to be served, got %v", err)
+		}
+	})
+
+	t.Run("rejects writes", func(t *testing.T) {
+		h := &servertest.Handler{}
+		_, err := interceptor(context.Background(), nil, servertest.UnaryInfo(pb.UserService_CreateUser_FullMethodName), h.Handle)
+		servertest.AssertCode(t, err, codes.FailedPrecondition)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+	})
+
+	t.Run("rejects stream writes", func(t *testing.T) {
+		stream := NewWriteFenceStreamInterceptor(staticFence(false), map[string]bool{pb.UserService_StreamUsers_FullMethodName: true})
+		ss := servertest.NewServerStream(context.Background())
+
+		for _, method := range []string{pb.UserService_ImportUsers_FullMethodName, pb.UserService_UploadAvatar_FullMethodName} {
+			h := &servertest.StreamHandler{}
+			err := stream(nil, ss, servertest.StreamInfo(method), h.Handle)
+			servertest.AssertCode(t, err, codes.FailedPrecondition)
+			if h.Calls != 0 {
+				t.Errorf("%s: handler should not run", method)
+			}
+		}
+
+		h := &servertest.StreamHandler{}
+		if err := stream(nil, ss, servertest.StreamInfo(pb.UserService_StreamUsers_FullMethodName), h.Handle); err != nil || h.Calls != 1 {
+			t.Errorf("expected the read stream to be served, got %v", err)
+		}
+	})
+}
+
+// meshAuth believes the caller headers, roles included, of calls from the
+// mesh at 10.0.0.0/8
+var meshAuth = auth.HeaderAuthenticator{Proxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, TrustRoles: true}
+
+// fromMesh starts an incoming context of a call relayed by the mesh
+func fromMesh() *servertest.Context {
+	return servertest.NewContext().WithPeer("10.1.2.3:41000")
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	engine := engineFunc(func(input policy.Input) bool { return input.Subject != auth.Anonymous })
+	interceptor := NewAuthInterceptor(engine, meshAuth)
+	info := servertest.UnaryInfo(pb.UserService_GetUser_FullMethodName)
+
+	t.Run("passes the principal to the handler", func(t *testing.T) {
+		ctx := fromMesh().WithMetadata(auth.CallerIDHeader, "billing").Build()
+		h := &servertest.Handler{}
+
+		if _, err := interceptor(ctx, nil, info, h.Handle); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if subject := auth.Subject(h.Ctx); subject != "billing" {
+			t.Errorf("expected subject billing, got %s", subject)
+		}
+	})
+
+	t.Run("ignores the header of peers outside the mesh", func(t *testing.T) {
+		ctx := servertest.NewContext().WithPeer("203.0.113.7:51234").WithMetadata(auth.CallerIDHeader, "billing").Build()
+		h := &servertest.Handler{}
+
+		_, err := interceptor(ctx, nil, info, h.Handle)
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+	})
+
+	t.Run("denies anonymous callers", func(t *testing.T) {
+		h := &servertest.Handler{}
+		_, err := interceptor(servertest.NewContext().Build(), nil, info, h.Handle)
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("restricts impersonated callers", func(t *testing.T) {
+		var input policy.Input
+		impersonated := NewAuthInterceptor(engineFunc(func(in policy.Input) bool {
+			input = in
+			return true
+		}), impersonating("support-tool"))
+
+		h := &servertest.Handler{}
+		if _, err := impersonated(context.Background(), nil, info, h.Handle); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if auth.Impersonator(h.Ctx) != "support-tool" || input.Impersonator != "support-tool" {
+			t.Errorf("expected the impersonator in the principal and the policy input, got %q", input.Impersonator)
+		}
+
+		h = &servertest.Handler{}
+		_, err := impersonated(context.Background(), nil, servertest.UnaryInfo(pb.UserService_SetPassword_FullMethodName), h.Handle)
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+	})
+
+	t.Run("requires the admin role for impersonation", func(t *testing.T) {
+		allowAll := NewAuthInterceptor(engineFunc(func(policy.Input) bool { return true }), meshAuth)
+		impersonation := servertest.UnaryInfo(pb.UserService_ImpersonationToken_FullMethodName)
+
+		h := &servertest.Handler{}
+		ctx := fromMesh().WithMetadata(auth.CallerIDHeader, "user:7").WithMetadata(auth.CallerRolesHeader, "user").Build()
+		_, err := allowAll(ctx, nil, impersonation, h.Handle)
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+
+		ctx = fromMesh().WithMetadata(auth.CallerIDHeader, "support-tool").WithMetadata(auth.CallerRolesHeader, "admin").Build()
+		if _, err := allowAll(ctx, nil, impersonation, h.Handle); err != nil {
+			t.Errorf("expected admins to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("denies admin methods to other callers", func(t *testing.T) {
+		admin := []string{
+			pb.UserService_ImpersonationToken_FullMethodName,
+			pb.UserService_FlushCache_FullMethodName,
+			pb.UserService_CreateAPIKey_FullMethodName,
+			pb.UserService_RotateAPIKey_FullMethodName,
+			pb.UserService_RevokeAPIKey_FullMethodName,
+			pb.UserService_GetTrafficDump_FullMethodName,
+			pb.UserService_PurgeUser_FullMethodName,
+			pb.UserService_BulkDeleteUsers_FullMethodName,
+			pb.UserService_ReplayEvents_FullMethodName,
+			pb.UserService_UnlockUser_FullMethodName,
+			pb.UserService_ListAuditEvents_FullMethodName,
+			pb.UserService_ListDataIssues_FullMethodName,
+			pb.UserService_GetServerInfo_FullMethodName,
+			// Sessions may call these for their own user
+			pb.UserService_ExportUserData_FullMethodName,
+			pb.UserService_EraseUser_FullMethodName,
+		}
+		allowAll := engineFunc(func(policy.Input) bool { return true })
+		caller := fixedPrincipal{Subject: "batch-job", Method: "api_key", Roles: []string{"user", "support"}}
+
+		var methods []string
+		for _, m := range pb.UserService_ServiceDesc.Methods {
+			methods = append(methods, m.MethodName)
+		}
+		for _, m := range pb.UserService_ServiceDesc.Streams {
+			methods = append(methods, m.StreamName)
+		}
+		for _, name := range methods {
+			method := "/" + pb.UserService_ServiceDesc.ServiceName + "/" + name
+			_, err := authorize(context.Background(), method, allowAll, []auth.Authenticator{caller})
+			if slices.Contains(admin, method) {
+				if status.Code(err) != codes.PermissionDenied {
+					t.Errorf("%s: expected PermissionDenied, got %v", method, err)
+				}
+			} else if err != nil {
+				t.Errorf("%s: unexpected error: %v", method, err)
+			}
+		}
+
+		session := fixedPrincipal{Subject: "user:7", Method: "access_token", Roles: []string{"user"}}
+		if _, err := authorize(context.Background(), pb.UserService_EraseUser_FullMethodName, allowAll, []auth.Authenticator{session}); err != nil {
+			t.Errorf("expected sessions to reach EraseUser, got %v", err)
+		}
+	})
+
+	t.Run("ignores header roles unless trusted", func(t *testing.T) {
+		identityOnly := meshAuth
+		identityOnly.TrustRoles = false
+		allowAll := NewAuthInterceptor(engineFunc(func(policy.Input) bool { return true }), identityOnly)
+
+		h := &servertest.Handler{}
+		ctx := fromMesh().WithMetadata(auth.CallerIDHeader, "support-tool").WithMetadata(auth.CallerRolesHeader, "admin").Build()
+		_, err := allowAll(ctx, nil, servertest.UnaryInfo(pb.UserService_ImpersonationToken_FullMethodName), h.Handle)
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+	})
+
+	t.Run("streams carry the principal", func(t *testing.T) {
+		ctx := fromMesh().WithMetadata(auth.CallerIDHeader, "billing").Build()
+		h := &servertest.StreamHandler{}
+
+		stream := NewAuthStreamInterceptor(engine, meshAuth)
+		err := stream(nil, servertest.NewServerStream(ctx), servertest.StreamInfo(pb.UserService_StreamUsers_FullMethodName), h.Handle)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if subject := auth.Subject(h.Stream.Context()); subject != "billing" {
+			t.Errorf("expected subject billing, got %s", subject)
+		}
+	})
+}
+
+func TestExemptions(t *testing.T) {
+	exemptions, err := NewExemptions([]string{"/grpc.health.v1.Health/*", pb.UserService_Login_FullMethodName})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	denyAll := exemptions.Unary(NewAuthInterceptor(engineFunc(func(policy.Input) bool { return false })))
+
+	t.Run("exempt methods skip the interceptor", func(t *testing.T) {
+		h := &servertest.Handler{}
+		if _, err := denyAll(context.Background(), nil, servertest.UnaryInfo(pb.UserService_Login_FullMethodName), h.Handle); err != nil || !h.Called() {
+			t.Errorf("expected Login to be served, got %v", err)
+		}
+		_, err := denyAll(servertest.NewContext().Build(), nil, servertest.UnaryInfo(pb.UserService_GetUser_FullMethodName), h.Handle)
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("refuses methods that are not registered", func(t *testing.T) {
+		services := map[string]grpc.ServiceInfo{
+			"grpc.health.v1.Health": {Methods: []grpc.MethodInfo{{Name: "Check"}}},
+			"user.UserService":      {Methods: []grpc.MethodInfo{{Name: "Login"}}},
+		}
+		if err := exemptions.Check(services); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		typo, _ := NewExemptions([]string{"/user.UserService/Logn"})
+		if err := typo.Check(services); err == nil {
+			t.Error("expected the misspelled method to be refused")
+		}
+	})
+
+	t.Run("refuses exempting everything", func(t *testing.T) {
+		if _, err := NewExemptions([]string{"*"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("refuses exempting admin methods", func(t *testing.T) {
+		if _, err := NewExemptions([]string{"/user.UserService/*"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	method := pb.UserService_RegisterUser_FullMethodName
+	interceptor := NewRateLimitInterceptor(map[string]*ratelimit.Keyed{method: ratelimit.NewKeyed(1, 1)})
+	ctx := servertest.NewContext().WithPeer("203.0.113.7:51234").Build()
+
+	h := &servertest.Handler{}
+	if _, err := interceptor(ctx, nil, servertest.UnaryInfo(method), h.Handle); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := interceptor(ctx, nil, servertest.UnaryInfo(method), h.Handle)
+	servertest.AssertCode(t, err, codes.ResourceExhausted)
+	if h.Calls != 1 {
+		t.Errorf("expected 1 call, got %d", h.Calls)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	logs := servertest.CaptureLogs(t)
+	h := &servertest.Handler{Err: errors.New("boom")}
+
+	_, _ = LoggingInterceptor(context.Background(), nil, servertest.UnaryInfo(pb.UserService_GetUser_FullMethodName), h.Handle)
+
+	record, ok := logs.Find("grpc request")
+	if !ok {
+		t.Fatal("expected a request log")
+	}
+	if failed, _ := servertest.Attr(record, "error"); !failed.Bool() {
+		t.Error("expected the request to be logged as failed")
+	}
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	metrics := NewRequestMetrics()
+	interceptor := NewMetricsInterceptor(metrics)
+	method := pb.UserService_GetUser_FullMethodName
+
+	h := &servertest.Handler{Err: status.Error(codes.NotFound, "user not found")}
+	_, _ = interceptor(context.Background(), nil, servertest.UnaryInfo(method), h.Handle)
+	h = &servertest.Handler{}
+	_, _ = interceptor(context.Background(), nil, servertest.UnaryInfo(method), h.Handle)
+
+	if got := testutil.ToFloat64(metrics.handled.WithLabelValues(method, "NotFound")); got != 1 {
+		t.Errorf("expected 1 NotFound call, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.handled.WithLabelValues(method, "OK")); got != 1 {
+		t.Errorf("expected 1 OK call, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.inFlight.WithLabelValues(method)); got != 0 {
+		t.Errorf("expected no call in flight, got %v", got)
+	}
+}
+
+func TestValidationInterceptor(t *testing.T) {
+	info := servertest.UnaryInfo(pb.UserService_CreateUser_FullMethodName)
+
+	t.Run("passes valid requests", func(t *testing.T) {
+		h := &servertest.Handler{}
+		req := &pb.CreateUserRequest{Email: "ada@example.com", Name: "Ada"}
+		if _, err := ValidationInterceptor(context.Background(), req, info, h.Handle); err != nil || !h.Called() {
+			t.Errorf("expected the request to be served, got %v", err)
+		}
+	})
+
+	t.Run("reports every violation", func(t *testing.T) {
+		h := &servertest.Handler{}
+		req := &pb.CreateUserRequest{Email: "Ada <ada@example.com>"}
+		_, err := ValidationInterceptor(context.Background(), req, info, h.Handle)
+		servertest.AssertCode(t, err, codes.InvalidArgument)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+
+		var fields []string
+		for _, d := range status.Convert(err).Details() {
+			if br, ok := d.(*errdetails.BadRequest); ok {
+				for _, v := range br.FieldViolations {
+					fields = append(fields, v.Field)
+				}
+			}
+		}
+		if !slices.Equal(fields, []string{"email", "name"}) {
+			t.Errorf("expected violations for email and name, got %v", fields)
+		}
+	})
+
+	t.Run("skips rules of unset fields", func(t *testing.T) {
+		h := &servertest.Handler{}
+		req := &pb.UpdateUserRequest{Id: 1, Name: "Ada"}
+		if _, err := ValidationInterceptor(context.Background(), req, info, h.Handle); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("checks ranges and list sizes", func(t *testing.T) {
+		for _, req := range []interface{}{
+			&pb.ListUsersRequest{PageSize: -1},
+			&pb.BatchCreateUsersRequest{},
+			&pb.UsersExistRequest{Ids: make([]int64, 1001)},
+		} {
+			_, err := ValidationInterceptor(context.Background(), req, info, (&servertest.Handler{}).Handle)
+			servertest.AssertCode(t, err, codes.InvalidArgument)
+		}
+	})
+}
+
+func TestBudgetInterceptor(t *testing.T) {
+	method := pb.UserService_GetUser_FullMethodName
+	budgets := budget.New(map[string]budget.Budget{
+		method: {MaxRequestBytes: 8, MaxLatency: time.Millisecond},
+	})
+	interceptor := NewBudgetInterceptor(budgets)
+
+	t.Run("rejects oversized requests", func(t *testing.T) {
+		h := &servertest.Handler{}
+		_, err := interceptor(context.Background(), &pb.GetUserRequest{Id: 1 << 62}, servertest.UnaryInfo(method), h.Handle)
+		servertest.AssertCode(t, err, codes.InvalidArgument)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+	})
+
+	t.Run("logs slow handlers", func(t *testing.T) {
+		logs := servertest.CaptureLogs(t)
+		slow := func(ctx context.Context, req interface{}) (interface{}, error) {
+			time.Sleep(5 * time.Millisecond)
+			return nil, nil
+		}
+		if _, err := interceptor(context.Background(), &pb.GetUserRequest{Id: 1}, servertest.UnaryInfo(method), slow); err != nil {
+			t.Fatalf("slow calls should still be answered, got %v", err)
+		}
+		if _, ok := logs.Find("latency budget exceeded"); !ok {
+			t.Error("expected a budget violation log")
+		}
+		if n := servertest.MetricCount(t, budgets); n != 2 {
+			t.Errorf("expected size and latency violations, got %d series", n)
+		}
+	})
+}
+
+func TestSanitizeInterceptor(t *testing.T) {
+	interceptor := NewSanitizeInterceptor(16)
+	info := servertest.UnaryInfo(pb.UserService_CreateUser_FullMethodName)
+
+	t.Run("cleans names", func(t *testing.T) {
+		h := &servertest.Handler{}
+		req := &pb.CreateUserRequest{Name: " Jane\n\x00Doe\xff ", Email: "j@x.io"}
+		if _, err := interceptor(context.Background(), req, info, h.Handle); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if req.Name != "JaneDoe" {
+			t.Errorf("expected a cleaned name, got %q", req.Name)
+		}
+	})
+
+	t.Run("rejects oversized strings", func(t *testing.T) {
+		h := &servertest.Handler{}
+		req := &pb.CreateUserRequest{Name: "Jane", Email: strings.Repeat("j", 17) + "@x.io"}
+		_, err := interceptor(context.Background(), req, info, h.Handle)
+		servertest.AssertCode(t, err, codes.InvalidArgument)
+		if h.Called() {
+			t.Error("handler should not run")
+		}
+	})
+}
+
+func TestTrafficDump(t *testing.T) {
+	method := pb.UserService_GetUser_FullMethodName
+	ctx := servertest.NewContext().
+		WithPeer("203.0.113.7:51234").
+		WithMetadata("authorization", "Bearer secret", "user-agent", "grpc-go/1.60").
+		Build()
+
+	t.Run("records summaries without values", func(t *testing.T) {
+		dump := NewTrafficDump(4, []string{"*"})
+		h := &servertest.Handler{Err: status.Error(codes.NotFound, "user not found")}
+		_, _ = dump.UnaryInterceptor(ctx, &pb.GetUserRequest{Id: 7}, servertest.UnaryInfo(method), h.Handle)
+
+		records := dump.Records(TrafficFilter{})
+		if len(records) != 1 {
+			t.Fatalf("expected 1 record, got %d", len(records))
+		}
+		r := records[0]
+		if r.Peer != "203.0.113.7" || r.UserAgent != "grpc-go/1.60" || r.Code != codes.NotFound.String() {
+			t.Errorf("unexpected record %+v", r)
+		}
+		if !slices.Equal(r.MetadataKeys, []string{"authorization", "user-agent"}) {
+			t.Errorf("expected metadata keys, got %v", r.MetadataKeys)
+		}
+		if r.RequestBytes == 0 || r.ResponseBytes != 0 {
+			t.Errorf("expected only the request to be counted, got %d and %d bytes", r.RequestBytes, r.ResponseBytes)
+		}
+	})
+
+	t.Run("keeps the latest calls", func(t *testing.T) {
+		dump := NewTrafficDump(2, []string{"*"})
+		for _, m := range []string{"/a/One", "/a/Two", "/a/Three"} {
+			_, _ = dump.UnaryInterceptor(ctx, nil, servertest.UnaryInfo(m), (&servertest.Handler{}).Handle)
+		}
+
+		var methods []string
+		for _, r := range dump.Records(TrafficFilter{}) {
+			methods = append(methods, r.Method)
+		}
+		if !slices.Equal(methods, []string{"/a/Three", "/a/Two"}) {
+			t.Errorf("expected the two latest calls, got %v", methods)
+		}
+		if got := dump.Records(TrafficFilter{Method: "/a/Two"}); len(got) != 1 {
+			t.Errorf("expected the method filter to match 1 record, got %d", len(got))
+		}
+	})
+
+	t.Run("is read by admins only", func(t *testing.T) {
+		s := &UserServer{trafficDump: NewTrafficDump(2, []string{"*"})}
+		user := auth.NewContext(context.Background(), &auth.Principal{Subject: "user:7", Method: "access_token", Roles: []string{"user"}})
+		_, err := s.GetTrafficDump(user, &pb.GetTrafficDumpRequest{})
+		servertest.AssertCode(t, err, codes.PermissionDenied)
+
+		admin := auth.NewContext(context.Background(), &auth.Principal{Subject: "ops", Method: "api_key", Roles: []string{auth.AdminRole}})
+		if _, err := s.GetTrafficDump(admin, &pb.GetTrafficDumpRequest{}); err != nil {
+			t.Errorf("expected admins to be allowed, got %v", err)
+		}
+	})
+}
+
+func TestTargetUserID(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  interface{}
+		want int64
+	}{
+		{"user_id field", &pb.SetPasswordRequest{UserId: 7}, 7},
+		{"single user request", &pb.DeleteUserRequest{Id: 7}, 7},
+		{"user response", &pb.UserResponse{User: &pb.User{Id: 7}}, 7},
+		{"other resources", &pb.DeleteOrganizationRequest{Id: 7}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targetUserID(tt.msg); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
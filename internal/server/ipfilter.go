@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/ipfilter"
+)
+
+// NewIPFilterInterceptor rejects calls from client addresses the filter
+// does not admit with PermissionDenied
+func NewIPFilterInterceptor(filter *ipfilter.Filter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkClientAddr(ctx, filter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewIPFilterStreamInterceptor applies the filter to streaming calls
+func NewIPFilterStreamInterceptor(filter *ipfilter.Filter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkClientAddr(ss.Context(), filter, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkClientAddr(ctx context.Context, filter *ipfilter.Filter, method string) error {
+	peerAddr, _ := netip.ParseAddr(peerHost(ctx))
+	md, _ := metadata.FromIncomingContext(ctx)
+	addr := filter.ClientAddr(peerAddr, md.Get("x-forwarded-for"))
+
+	if allowed, reason := filter.Check(method, addr); !allowed {
+		slog.Warn("call rejected by ip filter",
+			slog.String("method", method),
+			slog.String("addr", addr.String()),
+			slog.String("reason", reason))
+		return status.Error(codes.PermissionDenied, "client address is not allowed")
+	}
+	return nil
+}
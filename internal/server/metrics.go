@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// RequestMetrics is a Prometheus collector of the rate, errors and duration
+// of the calls a server handles, by full method name and status code
+type RequestMetrics struct {
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// NewRequestMetrics creates a new RequestMetrics instance
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Calls completed by the server, by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time taken to complete calls, by method and status code. Streams are timed until they end.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_server_in_flight",
+			Help: "Calls started and not yet completed, by method.",
+		}, []string{"method"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *RequestMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.handled.Describe(ch)
+	m.duration.Describe(ch)
+	m.inFlight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *RequestMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.handled.Collect(ch)
+	m.duration.Collect(ch)
+	m.inFlight.Collect(ch)
+}
+
+// start counts a call in flight, returning the function recording its
+// outcome
+func (m *RequestMetrics) start(method string) func(err error) {
+	begin := time.Now()
+	inFlight := m.inFlight.WithLabelValues(method)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		code := status.Code(err).String()
+		m.handled.WithLabelValues(method, code).Inc()
+		m.duration.WithLabelValues(method, code).Observe(time.Since(begin).Seconds())
+	}
+}
+
+// NewMetricsInterceptor records every call in metrics. It goes first in the
+// chain so that calls rejected by later interceptors are counted too.
+func NewMetricsInterceptor(metrics *RequestMetrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := metrics.start(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// NewMetricsStreamInterceptor records every stream in metrics
+func NewMetricsStreamInterceptor(metrics *RequestMetrics) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := metrics.start(info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/analytics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+// NewMirrorInterceptor records a summary of every request for the analytics
+// pipeline. It must run after the auth interceptor.
+func NewMirrorInterceptor(mirror *analytics.Mirror) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		mirror.Record(analytics.Summary{
+			Method:    info.FullMethod,
+			Caller:    auth.Subject(ctx),
+			LatencyMs: time.Since(start).Milliseconds(),
+			Code:      status.Code(err).String(),
+			EntityID:  entityID(req, resp),
+			At:        start,
+		})
+
+		return resp, err
+	}
+}
+
+// entityID returns the ID of the user or organization a request targets,
+// taken from the request or, for creations, from the response
+func entityID(req, resp interface{}) int64 {
+	switch r := req.(type) {
+	case interface{ GetUserId() int64 }:
+		return r.GetUserId()
+	case interface{ GetOrganizationId() int64 }:
+		return r.GetOrganizationId()
+	case interface{ GetId() int64 }:
+		return r.GetId()
+	}
+
+	switch r := resp.(type) {
+	case interface{ GetUser() *pb.User }:
+		return r.GetUser().GetId()
+	case interface{ GetOrganization() *pb.Organization }:
+		return r.GetOrganization().GetId()
+	case *userv2.User:
+		return r.GetId()
+	}
+
+	return 0
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// CreateOrganization creates a new organization
+func (s *UserServer) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.OrganizationResponse, error) {
+	slog.Info("creating organization",
+		slog.String("name", req.Name),
+		slog.String("slug", req.Slug))
+
+	org, err := s.organizationService.CreateOrganization(ctx, req.Name, req.Slug, req.DefaultTimezone, req.DefaultLocale)
+	if err != nil {
+		return nil, organizationStatus("failed to create organization", err)
+	}
+
+	return &pb.OrganizationResponse{Organization: toProtoOrganization(org)}, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *UserServer) GetOrganization(ctx context.Context, req *pb.GetOrganizationRequest) (*pb.OrganizationResponse, error) {
+	slog.Info("getting organization", slog.Int64("id", req.Id))
+
+	org, err := s.organizationService.GetOrganization(ctx, req.Id)
+	if err != nil {
+		return nil, organizationStatus("failed to get organization", err)
+	}
+
+	return &pb.OrganizationResponse{Organization: toProtoOrganization(org)}, nil
+}
+
+// ListOrganizations lists organizations with pagination
+func (s *UserServer) ListOrganizations(ctx context.Context, req *pb.ListOrganizationsRequest) (*pb.ListOrganizationsResponse, error) {
+	slog.Info("listing organizations",
+		slog.Int("page", int(req.Page)),
+		slog.Int("page_size", int(req.PageSize)))
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	page := pagination.Page(int(req.Page))
+
+	orgs, total, err := s.organizationService.ListOrganizations(ctx, page, pageSize)
+	if err != nil {
+		return nil, organizationStatus("failed to list organizations", err)
+	}
+
+	pbOrgs := make([]*pb.Organization, len(orgs))
+	for i, org := range orgs {
+		pbOrgs[i] = toProtoOrganization(org)
+	}
+
+	return &pb.ListOrganizationsResponse{
+		Organizations: pbOrgs,
+		Total:         int32(total),
+	}, nil
+}
+
+// UpdateOrganization updates an existing organization
+func (s *UserServer) UpdateOrganization(ctx context.Context, req *pb.UpdateOrganizationRequest) (*pb.OrganizationResponse, error) {
+	slog.Info("updating organization", slog.Int64("id", req.Id))
+
+	org, err := s.organizationService.UpdateOrganization(ctx, req.Id, req.Name, req.Slug, req.DefaultTimezone, req.DefaultLocale)
+	if err != nil {
+		return nil, organizationStatus("failed to update organization", err)
+	}
+
+	return &pb.OrganizationResponse{Organization: toProtoOrganization(org)}, nil
+}
+
+// DeleteOrganization deletes an organization and its memberships
+func (s *UserServer) DeleteOrganization(ctx context.Context, req *pb.DeleteOrganizationRequest) (*emptypb.Empty, error) {
+	slog.Info("deleting organization", slog.Int64("id", req.Id))
+
+	if err := s.organizationService.DeleteOrganization(ctx, req.Id); err != nil {
+		return nil, organizationStatus("failed to delete organization", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// AddOrganizationMember adds a user to an organization or changes their role
+func (s *UserServer) AddOrganizationMember(ctx context.Context, req *pb.AddOrganizationMemberRequest) (*pb.MembershipResponse, error) {
+	slog.Info("adding organization member",
+		slog.Int64("organization_id", req.OrganizationId),
+		slog.Int64("user_id", req.UserId),
+		slog.String("role", req.Role.String()))
+
+	m, err := s.organizationService.AddMember(ctx, req.OrganizationId, req.UserId, fromProtoRole(req.Role))
+	if err != nil {
+		return nil, organizationStatus("failed to add organization member", err)
+	}
+
+	return &pb.MembershipResponse{Membership: toProtoMembership(m)}, nil
+}
+
+// RemoveOrganizationMember removes a user from an organization
+func (s *UserServer) RemoveOrganizationMember(ctx context.Context, req *pb.RemoveOrganizationMemberRequest) (*emptypb.Empty, error) {
+	slog.Info("removing organization member",
+		slog.Int64("organization_id", req.OrganizationId),
+		slog.Int64("user_id", req.UserId))
+
+	if err := s.organizationService.RemoveMember(ctx, req.OrganizationId, req.UserId); err != nil {
+		return nil, organizationStatus("failed to remove organization member", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// ListOrganizationMembers lists the memberships of an organization
+func (s *UserServer) ListOrganizationMembers(ctx context.Context, req *pb.ListOrganizationMembersRequest) (*pb.ListOrganizationMembersResponse, error) {
+	slog.Info("listing organization members",
+		slog.Int64("organization_id", req.OrganizationId),
+		slog.Int("page", int(req.Page)),
+		slog.Int("page_size", int(req.PageSize)))
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+	page := pagination.Page(int(req.Page))
+
+	members, total, err := s.organizationService.ListMembers(ctx, req.OrganizationId, page, pageSize)
+	if err != nil {
+		return nil, organizationStatus("failed to list organization members", err)
+	}
+
+	pbMembers := make([]*pb.Membership, len(members))
+	for i, m := range members {
+		pbMembers[i] = toProtoMembership(m)
+	}
+
+	return &pb.ListOrganizationMembersResponse{
+		Members: pbMembers,
+		Total:   int32(total),
+	}, nil
+}
+
+// organizationStatus maps organization service errors to gRPC status errors
+func organizationStatus(msg string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrOrganizationNotFound),
+		errors.Is(err, service.ErrMembershipNotFound),
+		errors.Is(err, service.ErrMemberNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidSlug), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrInvalidTimezone), errors.Is(err, service.ErrInvalidLocale):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrSlugTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		slog.Error(msg, slog.String("error", err.Error()))
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func toProtoOrganization(org *model.Organization) *pb.Organization {
+	return &pb.Organization{
+		Id:              org.ID,
+		Name:            org.Name,
+		Slug:            org.Slug,
+		DefaultTimezone: org.DefaultTimezone,
+		DefaultLocale:   org.DefaultLocale,
+		CreatedAt:       org.CreatedAt.Unix(),
+		UpdatedAt:       org.UpdatedAt.Unix(),
+	}
+}
+
+func toProtoMembership(m *model.Membership) *pb.Membership {
+	return &pb.Membership{
+		OrganizationId: m.OrganizationID,
+		UserId:         m.UserID,
+		Role:           toProtoRole(m.Role),
+		CreatedAt:      m.CreatedAt.Unix(),
+	}
+}
+
+func toProtoRole(role model.OrgRole) pb.OrganizationRole {
+	switch role {
+	case model.OrgRoleOwner:
+		return pb.OrganizationRole_ORGANIZATION_ROLE_OWNER
+	case model.OrgRoleAdmin:
+		return pb.OrganizationRole_ORGANIZATION_ROLE_ADMIN
+	case model.OrgRoleMember:
+		return pb.OrganizationRole_ORGANIZATION_ROLE_MEMBER
+	default:
+		return pb.OrganizationRole_ORGANIZATION_ROLE_UNSPECIFIED
+	}
+}
+
+func fromProtoRole(role pb.OrganizationRole) model.OrgRole {
+	switch role {
+	case pb.OrganizationRole_ORGANIZATION_ROLE_OWNER:
+		return model.OrgRoleOwner
+	case pb.OrganizationRole_ORGANIZATION_ROLE_ADMIN:
+		return model.OrgRoleAdmin
+	case pb.OrganizationRole_ORGANIZATION_ROLE_MEMBER:
+		return model.OrgRoleMember
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// SetPassword replaces the password of a user. Callers other than admins
+// may only replace their own, giving the current one.
+func (s *UserServer) SetPassword(ctx context.Context, req *pb.SetPasswordRequest) (*emptypb.Empty, error) {
+	slog.Info("setting password", slog.Int64("user_id", req.UserId))
+
+	err := s.passwordService.SetPassword(ctx, req.UserId, req.CurrentPassword, req.Password)
+	var throttled *service.ThrottledError
+	switch {
+	case errors.Is(err, service.ErrPasswordChangeNotAllowed), errors.Is(err, service.ErrWrongPassword):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.As(err, &throttled):
+		return nil, RetryableError(codes.ResourceExhausted, throttled.RetryAfter, throttled.Err.Error())
+	case errors.Is(err, service.ErrWeakPassword):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, "user not found")
+	case err != nil:
+		slog.Error("failed to set password", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to set password: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Authenticate returns the user matching an email and password
+func (s *UserServer) Authenticate(ctx context.Context, req *pb.AuthenticateRequest) (*pb.UserResponse, error) {
+	user, err := s.passwordService.Authenticate(ctx, req.Email, req.Password)
+	var throttled *service.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return nil, RetryableError(codes.ResourceExhausted, throttled.RetryAfter, throttled.Err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		slog.Error("failed to authenticate", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to authenticate")
+	}
+
+	return &pb.UserResponse{User: mapper.User(user)}, nil
+}
+
+// UnlockUser lifts the lockout of a user after failed authentications
+func (s *UserServer) UnlockUser(ctx context.Context, req *pb.UnlockUserRequest) (*emptypb.Empty, error) {
+	slog.Info("unlocking user", slog.Int64("user_id", req.UserId))
+
+	err := s.passwordService.UnlockUser(ctx, req.UserId)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		slog.Error("failed to unlock user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to unlock user: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
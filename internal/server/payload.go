@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/logger"
+)
+
+// NewPayloadLoggingInterceptor logs every request message at debug level,
+// with the fields the redactor covers masked or hashed at any depth.
+// Field names are those of the proto file, e.g. invited_by.
+func NewPayloadLoggingInterceptor(redactor *logger.Redactor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if m, ok := req.(proto.Message); ok && slog.Default().Enabled(ctx, slog.LevelDebug) {
+			slog.DebugContext(ctx, "grpc request payload",
+				slog.String("method", info.FullMethod),
+				slog.Any("request", redactedPayload(m, redactor)))
+		}
+		return handler(ctx, req)
+	}
+}
+
+// redactedPayload decodes a message into its JSON form and redacts it
+func redactedPayload(m proto.Message, redactor *logger.Redactor) map[string]interface{} {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil
+	}
+	redactor.RedactMap(payload)
+	return payload
+}
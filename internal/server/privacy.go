@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// ExportUserData returns everything stored about a user as JSON
+func (s *UserServer) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	slog.Info("exporting user data", slog.Int64("user_id", req.UserId))
+
+	export, err := s.privacyService.ExportUserData(ctx, req.UserId)
+	switch {
+	case errors.Is(err, service.ErrPrivacyRequestNotAllowed):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, "user not found")
+	case err != nil:
+		slog.Error("failed to export user data", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to export user data")
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode user data: %v", err)
+	}
+
+	return &pb.ExportUserDataResponse{Data: data}, nil
+}
+
+// EraseUser queues the erasure of a user's personal data
+func (s *UserServer) EraseUser(ctx context.Context, req *pb.EraseUserRequest) (*pb.EraseUserResponse, error) {
+	erasure, err := s.privacyService.EraseUser(ctx, req.UserId)
+	switch {
+	case errors.Is(err, service.ErrPrivacyRequestNotAllowed):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, "user not found")
+	case err != nil:
+		slog.Error("failed to erase user", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to erase user")
+	}
+
+	return &pb.EraseUserResponse{
+		ErasureId:   erasure.ID,
+		Status:      string(erasure.Status),
+		RequestedAt: mapper.Timestamp(erasure.CreatedAt),
+	}, nil
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/ratelimit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+)
+
+// NewRateLimitInterceptor applies per-client-address limits to the given full
+// method names, e.g. stricter limits on public RPCs. Rejections carry a
+// RetryInfo telling the client when a retry would be admitted.
+func NewRateLimitInterceptor(limits map[string]*ratelimit.Keyed) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		limiter, ok := limits[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if allowed, retryAfter := limiter.Allow(peerHost(ctx)); !allowed {
+			return nil, RetryableError(codes.ResourceExhausted, retryAfter, "rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewAPIKeyRateLimitInterceptor limits the calls made with each API key to
+// the key's own rate, or to the limiter's default for keys without one. It
+// must run after the auth interceptor; other callers are not limited.
+func NewAPIKeyRateLimitInterceptor(limiter *ratelimit.Keyed) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, ok := auth.FromContext(ctx)
+		if !ok || p.KeyID == 0 {
+			return handler(ctx, req)
+		}
+
+		if allowed, retryAfter := limiter.AllowRate(strconv.FormatInt(p.KeyID, 10), float64(p.RateLimit)); !allowed {
+			return nil, RetryableError(codes.ResourceExhausted, retryAfter, "api key rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewCallerRateLimitInterceptor limits each caller across all instances:
+// callers with an API key by key, other authenticated callers by subject
+// and anonymous callers by address. It must run after the auth interceptor.
+// Health checks are never limited.
+func NewCallerRateLimitInterceptor(limiter *ratelimit.PerCaller) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkCallerRate(ctx, limiter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewCallerRateLimitStreamInterceptor applies the per-caller limits to the
+// start of streaming calls
+func NewCallerRateLimitStreamInterceptor(limiter *ratelimit.PerCaller) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkCallerRate(ss.Context(), limiter, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkCallerRate(ctx context.Context, limiter *ratelimit.PerCaller, method string) error {
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		return nil
+	}
+	if allowed, retryAfter := limiter.Allow(ctx, method, callerKey(ctx)); !allowed {
+		return RetryableError(codes.ResourceExhausted, retryAfter, "caller rate limit exceeded")
+	}
+	return nil
+}
+
+// callerKey identifies the caller for rate limiting
+func callerKey(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		if p.KeyID != 0 {
+			return "key:" + strconv.FormatInt(p.KeyID, 10)
+		}
+		if p.Subject != "" && p.Subject != auth.Anonymous {
+			return "sub:" + p.Subject
+		}
+	}
+	return "ip:" + peerHost(ctx)
+}
+
+// NewAdaptiveRateLimitInterceptor sheds requests beyond the adaptive limit
+// and feeds it the outcome and database time of the requests it serves.
+// Health checks are never shed. It reuses the usage meter when the usage
+// interceptor runs before it.
+func NewAdaptiveRateLimitInterceptor(limiter *ratelimit.Adaptive) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, "/grpc.health.v1.Health/") {
+			return handler(ctx, req)
+		}
+
+		if allowed, retryAfter := limiter.Allow(); !allowed {
+			return nil, RetryableError(codes.ResourceExhausted, retryAfter, "server is shedding load")
+		}
+
+		meter := usage.FromContext(ctx)
+		if meter == nil {
+			meter = &usage.Meter{}
+			ctx = usage.NewContext(ctx, meter)
+		}
+		before := meter.DBTime()
+
+		resp, err := handler(ctx, req)
+
+		limiter.Observe(serverFault(err), meter.DBTime()-before)
+		return resp, err
+	}
+}
+
+// serverFault reports whether err signals a failure of the service or its
+// dependencies rather than a bad request
+func serverFault(err error) bool {
+	switch status.Code(err) {
+	case codes.Internal, codes.Unavailable, codes.DeadlineExceeded, codes.Unknown, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// peerHost returns the IP address of the calling client, or an empty string
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
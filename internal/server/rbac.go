@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+)
+
+// NewRBACInterceptor rejects calls to methods the caller's roles are not
+// granted by the authorizer. It must run after the auth interceptor, which
+// stores the caller's principal in the context.
+func NewRBACInterceptor(authorizer *authz.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkRoles(ctx, authorizer, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewRBACStreamInterceptor is the streaming counterpart of NewRBACInterceptor
+func NewRBACStreamInterceptor(authorizer *authz.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkRoles(ss.Context(), authorizer, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// checkRoles returns a PermissionDenied status naming the roles that may
+// call fullMethod when the caller holds none of them
+func checkRoles(ctx context.Context, authorizer *authz.Authorizer, fullMethod string) error {
+	var roles []string
+	if p, ok := auth.FromContext(ctx); ok {
+		roles = p.Roles
+	}
+	if authorizer.Allowed(fullMethod, roles) {
+		return nil
+	}
+
+	required := authorizer.RolesFor(fullMethod)
+	slog.Warn("role not authorized",
+		slog.String("method", fullMethod),
+		slog.String("subject", auth.Subject(ctx)),
+		slog.Any("roles", roles),
+		slog.Any("required_roles", required))
+
+	st := status.New(codes.PermissionDenied, "permission denied: missing role for "+fullMethod)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: "MISSING_ROLE",
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"method":         fullMethod,
+			"required_roles": strings.Join(required, ","),
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/report"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// GenerateUserReport queues a spreadsheet of the users matching a filter
+func (s *UserServer) GenerateUserReport(ctx context.Context, req *pb.GenerateUserReportRequest) (*pb.UserReport, error) {
+	if s.reportService == nil {
+		return nil, status.Error(codes.FailedPrecondition, "user reports are disabled")
+	}
+
+	format := report.CSV
+	if req.Format == pb.UserReportFormat_USER_REPORT_FORMAT_XLSX {
+		format = report.XLSX
+	}
+
+	rep, err := s.reportService.GenerateUserReport(ctx, format, userFilter(req.Filter))
+	switch {
+	case errors.Is(err, service.ErrInvalidCreatedRange), errors.Is(err, service.ErrInvalidMetadata):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrEmailNotSearchable), errors.Is(err, service.ErrMetadataNotSearchable):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		slog.Error("failed to generate user report", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to generate user report")
+	}
+
+	return userReport(rep, nil), nil
+}
+
+// GetUserReport returns the state of a report, with a download URL once
+// it completed
+func (s *UserServer) GetUserReport(ctx context.Context, req *pb.GetUserReportRequest) (*pb.UserReport, error) {
+	if s.reportService == nil {
+		return nil, status.Error(codes.FailedPrecondition, "user reports are disabled")
+	}
+
+	rep, download, err := s.reportService.GetUserReport(ctx, req.ReportId)
+	switch {
+	case errors.Is(err, service.ErrReportNotFound):
+		return nil, status.Error(codes.NotFound, "report not found")
+	case err != nil:
+		slog.Error("failed to get user report", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to get user report")
+	}
+
+	return userReport(rep, download), nil
+}
+
+// userReport converts a report and its download, which may be nil, into
+// their protobuf representation
+func userReport(rep *model.UserReport, download *service.ReportDownload) *pb.UserReport {
+	resp := &pb.UserReport{
+		ReportId:    rep.ID,
+		Status:      string(rep.Status),
+		Error:       rep.LastError,
+		Rows:        rep.Rows,
+		RequestedAt: mapper.Timestamp(rep.CreatedAt),
+	}
+	if report.Format(rep.Format) == report.XLSX {
+		resp.Format = pb.UserReportFormat_USER_REPORT_FORMAT_XLSX
+	}
+	if rep.CompletedAt != nil {
+		resp.CompletedAt = mapper.Timestamp(*rep.CompletedAt)
+	}
+	if download != nil {
+		resp.DownloadUrl = download.URL
+		resp.DownloadUrlExpiresAt = mapper.Timestamp(download.ExpiresAt)
+	}
+	return resp
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+)
+
+// retryJitter is the fraction by which computed retry delays are randomized
+// so that clients rejected at the same moment do not retry in lockstep
+const retryJitter = 0.2
+
+// RetryableError builds a status error with the given code carrying a
+// google.rpc.RetryInfo detail that tells clients how long to back off
+func RetryableError(code codes.Code, delay time.Duration, msg string) error {
+	return withRetryInfo(status.New(code, msg), delay).Err()
+}
+
+// NewRetryInfoInterceptor attaches google.rpc.RetryInfo to Unavailable and
+// ResourceExhausted errors that do not already carry one
+func NewRetryInfoInterceptor(cfg config.RetryHintsConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		st, ok := status.FromError(err)
+		if !ok || hasRetryInfo(st) {
+			return resp, err
+		}
+
+		switch st.Code() {
+		case codes.Unavailable:
+			return resp, withRetryInfo(st, jitter(cfg.UnavailableDelay)).Err()
+		case codes.ResourceExhausted:
+			return resp, withRetryInfo(st, jitter(cfg.ResourceExhaustedDelay)).Err()
+		default:
+			return resp, err
+		}
+	}
+}
+
+func withRetryInfo(st *status.Status, delay time.Duration) *status.Status {
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	})
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+func hasRetryInfo(st *status.Status) bool {
+	for _, detail := range st.Details() {
+		if _, ok := detail.(*errdetails.RetryInfo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func jitter(delay time.Duration) time.Duration {
+	spread := float64(delay) * retryJitter
+	return delay + time.Duration(spread*(2*rand.Float64()-1))
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// sanitizedFields are string fields cleaned of control characters and
+// invalid UTF-8 before they reach the handlers
+var sanitizedFields = map[protoreflect.Name]bool{
+	"name": true,
+}
+
+// NewSanitizeInterceptor rejects requests with a string field longer than
+// maxStringBytes, at any depth, with InvalidArgument and a
+// google.rpc.BadRequest detail. It strips control characters and invalid
+// UTF-8 from name fields in place. It must run before the validation
+// interceptor, so the cleaned values are the ones validated.
+func NewSanitizeInterceptor(maxStringBytes int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if msg, ok := req.(proto.Message); ok {
+			if err := sanitizeRequest(msg, maxStringBytes); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewSanitizeStreamInterceptor applies NewSanitizeInterceptor's checks to
+// every message received on a stream
+func NewSanitizeStreamInterceptor(maxStringBytes int) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &sanitizingStream{ServerStream: ss, maxStringBytes: maxStringBytes})
+	}
+}
+
+// sanitizingStream sanitizes messages as the handler receives them
+type sanitizingStream struct {
+	grpc.ServerStream
+	maxStringBytes int
+}
+
+func (s *sanitizingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		return sanitizeRequest(msg, s.maxStringBytes)
+	}
+	return nil
+}
+
+// sanitizeRequest cleans msg and checks its string sizes
+func sanitizeRequest(msg proto.Message, maxStringBytes int) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	sanitizeMessage(msg.ProtoReflect(), "", maxStringBytes, &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	return badRequestError(violations)
+}
+
+// sanitizeMessage walks every set field of m, including list elements and
+// map values
+func sanitizeMessage(m protoreflect.Message, prefix string, maxStringBytes int, violations *[]*errdetails.BadRequest_FieldViolation) {
+	// Cleaned values are set after ranging, as m must not change meanwhile
+	cleaned := make(map[protoreflect.FieldDescriptor]string)
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := prefix + string(fd.Name())
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				elemPath := fmt.Sprintf("%s[%d]", path, i)
+				if fd.Message() != nil {
+					sanitizeMessage(list.Get(i).Message(), elemPath+".", maxStringBytes, violations)
+				} else if fd.Kind() == protoreflect.StringKind {
+					checkStringSize(list.Get(i).String(), elemPath, maxStringBytes, violations)
+				}
+			}
+		case fd.IsMap():
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				entryPath := fmt.Sprintf("%s[%s]", path, k.String())
+				checkStringSize(k.String(), entryPath, maxStringBytes, violations)
+				if fd.MapValue().Message() != nil {
+					sanitizeMessage(mv.Message(), entryPath+".", maxStringBytes, violations)
+				} else if fd.MapValue().Kind() == protoreflect.StringKind {
+					checkStringSize(mv.String(), entryPath, maxStringBytes, violations)
+				}
+				return true
+			})
+		case fd.Message() != nil:
+			sanitizeMessage(v.Message(), path+".", maxStringBytes, violations)
+		case fd.Kind() == protoreflect.StringKind:
+			s := v.String()
+			if sanitizedFields[fd.Name()] {
+				if clean := sanitizeString(s); clean != s {
+					cleaned[fd] = clean
+					s = clean
+				}
+			}
+			checkStringSize(s, path, maxStringBytes, violations)
+		}
+		return true
+	})
+	for fd, s := range cleaned {
+		m.Set(fd, protoreflect.ValueOfString(s))
+	}
+}
+
+func checkStringSize(s, path string, maxStringBytes int, violations *[]*errdetails.BadRequest_FieldViolation) {
+	if maxStringBytes > 0 && len(s) > maxStringBytes {
+		*violations = append(*violations, &errdetails.BadRequest_FieldViolation{
+			Field:       path,
+			Description: fmt.Sprintf("value must be at most %d bytes", maxStringBytes),
+		})
+	}
+}
+
+// sanitizeString drops invalid UTF-8 and control characters, such as
+// newlines that would forge log lines, and trims the surrounding spaces
+func sanitizeString(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,85 @@
+package servertest
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Logs records the slog records emitted while it is installed
+type Logs struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+// CaptureLogs installs a Logs as the default slog logger until the test
+// ends. Tests using it must not run in parallel.
+func CaptureLogs(t testing.TB) *Logs {
+	t.Helper()
+	logs := &Logs{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(&logHandler{logs: logs}))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return logs
+}
+
+// Records returns the captured records
+func (l *Logs) Records() []slog.Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]slog.Record(nil), l.records...)
+}
+
+// Find returns the first record whose message contains msg
+func (l *Logs) Find(msg string) (slog.Record, bool) {
+	for _, r := range l.Records() {
+		if strings.Contains(r.Message, msg) {
+			return r, true
+		}
+	}
+	return slog.Record{}, false
+}
+
+// Attr returns the value of the named attribute of a record
+func Attr(r slog.Record, key string) (slog.Value, bool) {
+	var (
+		value slog.Value
+		found bool
+	)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			value, found = a.Value, true
+			return false
+		}
+		return true
+	})
+	return value, found
+}
+
+type logHandler struct {
+	logs  *Logs
+	attrs []slog.Attr
+}
+
+func (h *logHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	h.logs.mu.Lock()
+	defer h.logs.mu.Unlock()
+	h.logs.records = append(h.logs.records, r)
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{logs: h.logs, attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...)}
+}
+
+func (h *logHandler) WithGroup(string) slog.Handler {
+	return h
+}
@@ -0,0 +1,21 @@
+package servertest
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// MetricValue returns the value of a collector exposing a single counter or
+// gauge, e.g. one child of a vector obtained with WithLabelValues
+func MetricValue(t testing.TB, c prometheus.Collector) float64 {
+	t.Helper()
+	return testutil.ToFloat64(c)
+}
+
+// MetricCount returns the number of series a collector exposes
+func MetricCount(t testing.TB, c prometheus.Collector) int {
+	t.Helper()
+	return testutil.CollectAndCount(c)
+}
@@ -0,0 +1,182 @@
+// Package servertest provides fakes for testing gRPC interceptors in
+// isolation: handlers that record how they were called, server streams,
+// incoming contexts and captured logs.
+package servertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnaryInfo returns the server info of a unary call to fullMethod
+func UnaryInfo(fullMethod string) *grpc.UnaryServerInfo {
+	return &grpc.UnaryServerInfo{FullMethod: fullMethod}
+}
+
+// StreamInfo returns the server info of a server-streaming call to fullMethod
+func StreamInfo(fullMethod string) *grpc.StreamServerInfo {
+	return &grpc.StreamServerInfo{FullMethod: fullMethod, IsServerStream: true}
+}
+
+// Context builds the incoming context of a call
+type Context struct {
+	md   metadata.MD
+	addr net.Addr
+}
+
+// NewContext starts an incoming context without metadata
+func NewContext() *Context {
+	return &Context{md: metadata.MD{}}
+}
+
+// WithMetadata appends key/value pairs to the incoming metadata
+func (c *Context) WithMetadata(kv ...string) *Context {
+	for i := 0; i+1 < len(kv); i += 2 {
+		c.md.Append(kv[i], kv[i+1])
+	}
+	return c
+}
+
+// WithPeer sets the client address, e.g. "203.0.113.7:51234"
+func (c *Context) WithPeer(addr string) *Context {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	c.addr = tcpAddr
+	return c
+}
+
+// Build returns the context
+func (c *Context) Build() context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), c.md.Copy())
+	if c.addr != nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: c.addr})
+	}
+	return ctx
+}
+
+// Handler is a fake unary handler returning Resp and Err and recording the
+// context and request of every call
+type Handler struct {
+	Resp interface{}
+	Err  error
+
+	Calls int
+	Ctx   context.Context
+	Req   interface{}
+}
+
+// Handle implements grpc.UnaryHandler
+func (h *Handler) Handle(ctx context.Context, req interface{}) (interface{}, error) {
+	h.Calls++
+	h.Ctx = ctx
+	h.Req = req
+	return h.Resp, h.Err
+}
+
+// Called reports whether the handler ran at least once
+func (h *Handler) Called() bool {
+	return h.Calls > 0
+}
+
+// StreamHandler is a fake stream handler that sends Send on the stream,
+// returns Err and records the stream it was given
+type StreamHandler struct {
+	Send []interface{}
+	Err  error
+
+	Calls  int
+	Stream grpc.ServerStream
+}
+
+// Handle implements grpc.StreamHandler
+func (h *StreamHandler) Handle(_ interface{}, ss grpc.ServerStream) error {
+	h.Calls++
+	h.Stream = ss
+	for _, msg := range h.Send {
+		if err := ss.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+	return h.Err
+}
+
+// ServerStream is a fake grpc.ServerStream recording sent messages and
+// headers. Received messages are served from Recv in order.
+type ServerStream struct {
+	Ctx  context.Context
+	Recv []proto.Message
+
+	Sent    []interface{}
+	Header  metadata.MD
+	Trailer metadata.MD
+}
+
+// NewServerStream creates a ServerStream with the given context
+func NewServerStream(ctx context.Context) *ServerStream {
+	return &ServerStream{Ctx: ctx, Header: metadata.MD{}, Trailer: metadata.MD{}}
+}
+
+// Context implements grpc.ServerStream
+func (s *ServerStream) Context() context.Context {
+	return s.Ctx
+}
+
+// SetHeader implements grpc.ServerStream
+func (s *ServerStream) SetHeader(md metadata.MD) error {
+	s.Header = metadata.Join(s.Header, md)
+	return nil
+}
+
+// SendHeader implements grpc.ServerStream
+func (s *ServerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+// SetTrailer implements grpc.ServerStream
+func (s *ServerStream) SetTrailer(md metadata.MD) {
+	s.Trailer = metadata.Join(s.Trailer, md)
+}
+
+// SendMsg implements grpc.ServerStream
+func (s *ServerStream) SendMsg(m interface{}) error {
+	s.Sent = append(s.Sent, m)
+	return nil
+}
+
+// RecvMsg implements grpc.ServerStream, returning io.EOF once Recv is
+// exhausted
+func (s *ServerStream) RecvMsg(m interface{}) error {
+	if len(s.Recv) == 0 {
+		return io.EOF
+	}
+	next := s.Recv[0]
+	s.Recv = s.Recv[1:]
+
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Errorf("servertest: cannot receive into %T", m)
+	}
+	proto.Reset(msg)
+	proto.Merge(msg, next)
+	return nil
+}
+
+// AssertCode fails the test unless err carries the given status code
+func AssertCode(t testing.TB, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("expected code %s, got %s (%v)", want, got, err)
+	}
+}
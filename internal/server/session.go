@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// Login starts a session for a user authenticating with their password
+func (s *UserServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.SessionTokens, error) {
+	user, tokens, err := s.sessionService.Login(ctx, req.Email, req.Password)
+	var throttled *service.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return nil, RetryableError(codes.ResourceExhausted, throttled.RetryAfter, throttled.Err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		slog.Error("failed to log in", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to log in")
+	}
+
+	resp := toProtoTokens(tokens)
+	resp.User = mapper.User(user)
+	return resp, nil
+}
+
+// RefreshToken exchanges a refresh token for new session tokens
+func (s *UserServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.SessionTokens, error) {
+	tokens, err := s.sessionService.Refresh(ctx, req.RefreshToken)
+	switch {
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		slog.Error("failed to refresh session", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to refresh session")
+	}
+
+	return toProtoTokens(tokens), nil
+}
+
+// Logout ends the session of a refresh token
+func (s *UserServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*emptypb.Empty, error) {
+	err := s.sessionService.Logout(ctx, req.RefreshToken)
+	switch {
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		slog.Error("failed to log out", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to log out")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// RevokeAllSessions ends every session of a user
+func (s *UserServer) RevokeAllSessions(ctx context.Context, req *pb.RevokeAllSessionsRequest) (*pb.RevokeAllSessionsResponse, error) {
+	slog.Info("revoking all sessions", slog.Int64("user_id", req.UserId))
+
+	revoked, err := s.sessionService.RevokeAllSessions(ctx, req.UserId)
+	if err != nil {
+		slog.Error("failed to revoke sessions", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to revoke sessions: %v", err)
+	}
+
+	return &pb.RevokeAllSessionsResponse{Revoked: int32(revoked)}, nil
+}
+
+// ImpersonationToken issues an access token acting as a user on behalf of
+// the calling support engineer
+func (s *UserServer) ImpersonationToken(ctx context.Context, req *pb.ImpersonationTokenRequest) (*pb.ImpersonationTokenResponse, error) {
+	slog.Info("issuing impersonation token", slog.Int64("user_id", req.UserId))
+
+	impersonation, err := s.sessionService.Impersonate(ctx, req.UserId, req.Reason)
+	switch {
+	case errors.Is(err, service.ErrImpersonationNotAllowed):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrImpersonatedUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		slog.Error("failed to issue impersonation token", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Internal, "failed to issue impersonation token")
+	}
+
+	return &pb.ImpersonationTokenResponse{
+		AccessToken: impersonation.AccessToken,
+		ExpiresAt:   impersonation.ExpiresAt.Unix(),
+	}, nil
+}
+
+func toProtoTokens(tokens *service.Tokens) *pb.SessionTokens {
+	return &pb.SessionTokens{
+		AccessToken:      tokens.AccessToken,
+		AccessExpiresAt:  tokens.AccessExpiresAt.Unix(),
+		RefreshToken:     tokens.RefreshToken,
+		SessionExpiresAt: tokens.Session.ExpiresAt.Unix(),
+		SessionId:        tokens.Session.ID,
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/reqsign"
+)
+
+// NewRequestSigningInterceptor requires a valid signature, see
+// pkg/reqsign, on calls of the methods matching the patterns. Forged,
+// stale and replayed calls are rejected with Unauthenticated; when nonces
+// cannot be checked, calls are rejected with Unavailable.
+func NewRequestSigningInterceptor(verifier *reqsign.Verifier, methods []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !authz.MatchAny(methods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		body, err := reqsign.Body(req)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to check request signature")
+		}
+		if err := verifySignature(ctx, verifier, info.FullMethod, body); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewRequestSigningStreamInterceptor requires a valid signature on
+// streaming calls of the methods matching the patterns. Their signatures
+// do not cover the streamed messages.
+func NewRequestSigningStreamInterceptor(verifier *reqsign.Verifier, methods []string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !authz.MatchAny(methods, info.FullMethod) {
+			return handler(srv, ss)
+		}
+		if err := verifySignature(ss.Context(), verifier, info.FullMethod, nil); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func verifySignature(ctx context.Context, verifier *reqsign.Verifier, method string, body []byte) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	err := verifier.Verify(ctx, method, md, body)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, reqsign.ErrMissing), errors.Is(err, reqsign.ErrInvalid),
+		errors.Is(err, reqsign.ErrStale), errors.Is(err, reqsign.ErrReplayed):
+		slog.Warn("call rejected by request signing",
+			slog.String("method", method),
+			slog.String("peer", peerHost(ctx)),
+			slog.String("reason", err.Error()))
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		slog.Error("failed to verify request signature",
+			slog.String("method", method),
+			slog.String("error", err.Error()))
+		return status.Error(codes.Unavailable, "request signature cannot be checked")
+	}
+}
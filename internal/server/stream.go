@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serverStream overrides the context of a wrapped stream so that stream
+// interceptors can pass values such as the principal to handlers
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// LoggingStreamInterceptor logs all gRPC streams once they finish
+func LoggingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+
+	slog.InfoContext(ss.Context(), "grpc stream",
+		slog.String("method", info.FullMethod),
+		slog.Duration("duration", time.Since(start)),
+		slog.Bool("error", err != nil))
+
+	return err
+}
+
+// RecoveryStreamInterceptor recovers from panics in streaming handlers
+func RecoveryStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic recovered",
+				slog.String("method", info.FullMethod),
+				slog.Any("panic", r))
+			err = status.Errorf(codes.Internal, "internal server error")
+		}
+	}()
+
+	return handler(srv, ss)
+}
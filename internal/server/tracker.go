@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// RequestTracker counts served and in-flight requests for the shutdown report
+type RequestTracker struct {
+	served   atomic.Int64
+	inFlight atomic.Int64
+}
+
+// NewRequestTracker creates a new RequestTracker instance
+func NewRequestTracker() *RequestTracker {
+	return &RequestTracker{}
+}
+
+// UnaryInterceptor tracks every unary request passing through the server
+func (t *RequestTracker) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	t.inFlight.Add(1)
+	defer func() {
+		t.inFlight.Add(-1)
+		t.served.Add(1)
+	}()
+
+	return handler(ctx, req)
+}
+
+// StreamInterceptor tracks every stream passing through the server
+func (t *RequestTracker) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	t.inFlight.Add(1)
+	defer func() {
+		t.inFlight.Add(-1)
+		t.served.Add(1)
+	}()
+
+	return handler(srv, ss)
+}
+
+// Served returns the number of completed requests
+func (t *RequestTracker) Served() int64 {
+	return t.served.Load()
+}
+
+// InFlight returns the number of requests currently being handled
+func (t *RequestTracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
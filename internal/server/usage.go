@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+)
+
+// NewUsageInterceptor meters every request and records it against the
+// authenticated caller. It must run after the auth interceptor.
+func NewUsageInterceptor(aggregator *usage.Aggregator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		meter := &usage.Meter{}
+
+		resp, err := handler(usage.NewContext(ctx, meter), req)
+
+		meter.AddBytes(messageSize(req), messageSize(resp))
+		aggregator.Record(auth.Subject(ctx), meter, time.Now())
+
+		return resp, err
+	}
+}
+
+func messageSize(msg interface{}) int {
+	if m, ok := msg.(proto.Message); ok {
+		return proto.Size(m)
+	}
+	return 0
+}
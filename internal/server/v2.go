@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mapper"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+// UserServerV2 adapts the user service to the v2 API. It shares the service
+// layer with UserServer so both API versions see the same users.
+type UserServerV2 struct {
+	userv2.UnimplementedUserServiceServer
+	userService         *service.UserService
+	organizationService *service.OrganizationService
+}
+
+// NewUserServerV2 creates a new UserServerV2 instance
+func NewUserServerV2(userService *service.UserService, organizationService *service.OrganizationService) *UserServerV2 {
+	return &UserServerV2{
+		userService:         userService,
+		organizationService: organizationService,
+	}
+}
+
+// CreateUser creates a new user
+func (s *UserServerV2) CreateUser(ctx context.Context, req *userv2.CreateUserRequest) (*userv2.User, error) {
+	slog.Info("creating user",
+		slog.String("api", "v2"),
+		slog.String("email", req.GetUser().GetEmail()),
+		slog.String("name", req.GetUser().GetName()))
+
+	user, err := s.userService.CreateUser(ctx, req.GetUser().GetEmail(), req.GetUser().GetName(), nil, "", "")
+	if errors.Is(err, service.ErrUserExists) {
+		return nil, errEmailExists
+	}
+	if err != nil {
+		slog.Error("failed to create user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to create user: %v", err)
+	}
+
+	return mapper.UserV2(user), nil
+}
+
+// GetUser retrieves a user by ID, optionally as of a point in time
+func (s *UserServerV2) GetUser(ctx context.Context, req *userv2.GetUserRequest) (*userv2.User, error) {
+	slog.Info("getting user",
+		slog.String("api", "v2"),
+		slog.Int64("id", req.Id),
+		slog.String("uuid", req.Uuid))
+
+	var (
+		user *model.User
+		err  error
+	)
+	switch {
+	case req.Uuid != "" && req.AsOf != nil:
+		return nil, status.Error(codes.InvalidArgument, "as_of is only supported for lookups by id")
+	case req.Uuid != "":
+		user, err = s.userService.GetUserByUUID(ctx, req.Uuid)
+	case req.AsOf != nil:
+		user, err = s.userService.GetUserAsOf(ctx, req.Id, mapper.Time(req.AsOf))
+	default:
+		user, err = s.userService.GetUser(ctx, req.Id)
+	}
+	if errors.Is(err, service.ErrInvalidUUID) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		slog.Error("failed to get user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.NotFound, "user not found: %v", err)
+	}
+
+	return mapper.UserV2(user), nil
+}
+
+// ListUsers lists users with keyset pagination only
+func (s *UserServerV2) ListUsers(ctx context.Context, req *userv2.ListUsersRequest) (*userv2.ListUsersResponse, error) {
+	slog.Info("listing users",
+		slog.String("api", "v2"),
+		slog.Int("page_size", int(req.PageSize)),
+		slog.Int64("organization_id", req.OrganizationId))
+
+	pageSize := pagination.DefaultLimits.Clamp(int(req.PageSize))
+
+	var (
+		users []*model.User
+		next  string
+		err   error
+	)
+	switch {
+	case req.PageToken != "":
+		users, next, err = s.userService.ListUsersAfter(ctx, req.OrganizationId, req.PageToken, pageSize)
+	case req.OrganizationId > 0:
+		users, _, err = s.organizationService.ListUsers(ctx, req.OrganizationId, 1, pageSize)
+		next = service.NextPageToken(users, pageSize)
+	default:
+		users, _, err = s.userService.ListUsers(ctx, 1, pageSize)
+		next = service.NextPageToken(users, pageSize)
+	}
+	if errors.Is(err, service.ErrInvalidPageToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		slog.Error("failed to list users", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to list users: %v", err)
+	}
+
+	return &userv2.ListUsersResponse{
+		Users:         mapper.UsersV2(users),
+		NextPageToken: next,
+	}, nil
+}
+
+// UpdateUser updates the fields of a user named in the update mask
+func (s *UserServerV2) UpdateUser(ctx context.Context, req *userv2.UpdateUserRequest) (*userv2.User, error) {
+	slog.Info("updating user",
+		slog.String("api", "v2"),
+		slog.Int64("id", req.GetUser().GetId()),
+		slog.Any("update_mask", req.UpdateMask.GetPaths()))
+
+	user, err := s.userService.UpdateUser(ctx, req.GetUser().GetId(), req.GetUser().GetEmail(), req.GetUser().GetName(), nil, "", "", req.UpdateMask.GetPaths())
+	if errors.Is(err, service.ErrInvalidFieldMask) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrUserExists) {
+		return nil, errEmailExists
+	}
+	if err != nil {
+		slog.Error("failed to update user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to update user: %v", err)
+	}
+
+	return mapper.UserV2(user), nil
+}
+
+// DeleteUser soft-deletes a user by ID
+func (s *UserServerV2) DeleteUser(ctx context.Context, req *userv2.DeleteUserRequest) (*emptypb.Empty, error) {
+	slog.Info("deleting user",
+		slog.String("api", "v2"),
+		slog.Int64("id", req.Id))
+
+	if err := s.userService.DeleteUser(ctx, req.Id); err != nil {
+		slog.Error("failed to delete user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to delete user: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// RestoreUser restores a soft-deleted user
+func (s *UserServerV2) RestoreUser(ctx context.Context, req *userv2.RestoreUserRequest) (*userv2.User, error) {
+	slog.Info("restoring user",
+		slog.String("api", "v2"),
+		slog.Int64("id", req.Id))
+
+	user, err := s.userService.RestoreUser(ctx, req.Id)
+	switch {
+	case errors.Is(err, service.ErrDeletedUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrUserExists):
+		return nil, status.Error(codes.FailedPrecondition, "email has been reused by another user")
+	case err != nil:
+		slog.Error("failed to restore user", slog.String("error", err.Error()))
+		return nil, status.Errorf(codes.Internal, "failed to restore user: %v", err)
+	}
+
+	return mapper.UserV2(user), nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	validatepb "github.com/davidbadelllab/go-microservice-grpc-2023/proto/validate"
+)
+
+// ValidationInterceptor rejects requests violating the (validate.field)
+// rules declared in the proto with InvalidArgument and a
+// google.rpc.BadRequest detail listing every violation
+func ValidationInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if msg, ok := req.(proto.Message); ok {
+		if err := validateRequest(msg); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// ValidationStreamInterceptor applies the (validate.field) rules to every
+// message received on a stream
+func ValidationStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validatingStream{ServerStream: ss})
+}
+
+// validatingStream validates messages as the handler receives them
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		return validateRequest(msg)
+	}
+	return nil
+}
+
+// validateRequest checks msg against its field rules
+func validateRequest(msg proto.Message) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	validateMessage(msg.ProtoReflect(), "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return badRequestError(violations)
+}
+
+// badRequestError builds an InvalidArgument status error listing the
+// violations in its message and in a google.rpc.BadRequest detail
+func badRequestError(violations []*errdetails.BadRequest_FieldViolation) error {
+	descs := make([]string, len(violations))
+	for i, v := range violations {
+		descs[i] = v.Field + ": " + v.Description
+	}
+	st := status.New(codes.InvalidArgument, "invalid request: "+strings.Join(descs, "; "))
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// validateMessage appends the violations of m's fields, descending into set
+// singular message fields. Elements of repeated fields are not validated so
+// batch RPCs keep reporting failures per item.
+func validateMessage(m protoreflect.Message, prefix string, violations *[]*errdetails.BadRequest_FieldViolation) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+
+		if rules, _ := proto.GetExtension(fd.Options(), validatepb.E_Field).(*validatepb.FieldRules); rules != nil {
+			for _, desc := range checkField(m, fd, rules) {
+				*violations = append(*violations, &errdetails.BadRequest_FieldViolation{Field: path, Description: desc})
+			}
+		}
+
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && m.Has(fd) {
+			validateMessage(m.Get(fd).Message(), path+".", violations)
+		}
+	}
+}
+
+// checkField returns the rules the field violates. Rules other than required
+// only apply to set fields, so optional fields may be left empty.
+func checkField(m protoreflect.Message, fd protoreflect.FieldDescriptor, rules *validatepb.FieldRules) []string {
+	if !m.Has(fd) {
+		if rules.Required {
+			return []string{"value is required"}
+		}
+		return nil
+	}
+	v := m.Get(fd)
+
+	var failed []string
+	switch {
+	case fd.IsList():
+		r := rules.GetRepeated()
+		if r == nil {
+			break
+		}
+		n := uint64(v.List().Len())
+		if r.MinItems != nil && n < r.GetMinItems() {
+			failed = append(failed, fmt.Sprintf("value must contain at least %d item(s)", r.GetMinItems()))
+		}
+		if r.MaxItems != nil && n > r.GetMaxItems() {
+			failed = append(failed, fmt.Sprintf("value must contain no more than %d item(s)", r.GetMaxItems()))
+		}
+	case fd.Kind() == protoreflect.StringKind:
+		r := rules.GetString_()
+		if r == nil {
+			break
+		}
+		s := v.String()
+		n := uint64(utf8.RuneCountInString(s))
+		if r.MinLen != nil && n < r.GetMinLen() {
+			failed = append(failed, fmt.Sprintf("value length must be at least %d characters", r.GetMinLen()))
+		}
+		if r.MaxLen != nil && n > r.GetMaxLen() {
+			failed = append(failed, fmt.Sprintf("value length must be at most %d characters", r.GetMaxLen()))
+		}
+		if r.GetEmail() && !validEmail(s) {
+			failed = append(failed, "value must be a valid email address")
+		}
+	case fd.Kind() == protoreflect.Int32Kind, fd.Kind() == protoreflect.Sint32Kind, fd.Kind() == protoreflect.Sfixed32Kind:
+		r := rules.GetInt32()
+		if r == nil {
+			break
+		}
+		n := int32(v.Int())
+		if r.Gte != nil && n < r.GetGte() {
+			failed = append(failed, fmt.Sprintf("value must be greater than or equal to %d", r.GetGte()))
+		}
+		if r.Lte != nil && n > r.GetLte() {
+			failed = append(failed, fmt.Sprintf("value must be less than or equal to %d", r.GetLte()))
+		}
+	case fd.Kind() == protoreflect.Int64Kind, fd.Kind() == protoreflect.Sint64Kind, fd.Kind() == protoreflect.Sfixed64Kind:
+		r := rules.GetInt64()
+		if r == nil {
+			break
+		}
+		n := v.Int()
+		if r.Gte != nil && n < r.GetGte() {
+			failed = append(failed, fmt.Sprintf("value must be greater than or equal to %d", r.GetGte()))
+		}
+		if r.Lte != nil && n > r.GetLte() {
+			failed = append(failed, fmt.Sprintf("value must be less than or equal to %d", r.GetLte()))
+		}
+	}
+	return failed
+}
+
+// validEmail reports whether s is a bare email address, without a display
+// name or angle brackets
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Name == "" && addr.Address == s
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+)
+
+// ResumeTokenKey is the header and trailer of WatchUsers streams carrying
+// a SyncUsers token, from which a watcher catches up on the changes it
+// missed before watching again
+const ResumeTokenKey = "x-resume-token"
+
+var (
+	// errWatchIdle ends watch streams that delivered nothing for too long
+	errWatchIdle = errors.New("watch idle")
+	// errWatchDrained ends watch streams when the server stops
+	errWatchDrained = errors.New("watch drained")
+)
+
+// WatchLimits bound the WatchUsers streams an instance serves, as each one
+// holds an event buffer for as long as it lasts. Zero values disable a
+// limit.
+type WatchLimits struct {
+	MaxStreams          int
+	MaxStreamsPerClient int
+	// IdleTimeout ends streams that delivered no change for that long
+	IdleTimeout time.Duration
+}
+
+// WatchSessions tracks the open WatchUsers streams, enforcing the limits
+// and ending them all when the server stops
+type WatchSessions struct {
+	limits WatchLimits
+
+	mu        sync.Mutex
+	sessions  map[*watchSession]struct{}
+	perClient map[string]int
+	draining  bool
+
+	active   prometheus.Gauge
+	rejected *prometheus.CounterVec
+	ended    *prometheus.CounterVec
+}
+
+// NewWatchSessions creates a new WatchSessions instance
+func NewWatchSessions(limits WatchLimits) *WatchSessions {
+	return &WatchSessions{
+		limits:    limits,
+		sessions:  make(map[*watchSession]struct{}),
+		perClient: make(map[string]int),
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "watch_users_streams_active",
+			Help: "Number of open WatchUsers streams",
+		}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "watch_users_streams_rejected_total",
+			Help: "Number of WatchUsers streams refused, by reason",
+		}, []string{"reason"}),
+		ended: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "watch_users_streams_ended_total",
+			Help: "Number of WatchUsers streams ended, by reason",
+		}, []string{"reason"}),
+	}
+}
+
+// watchSession is one open WatchUsers stream
+type watchSession struct {
+	owner  *WatchSessions
+	client string
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	idle   *time.Timer
+}
+
+// begin opens a session for a stream of the calling client. The session
+// context is canceled with errWatchIdle or errWatchDrained when the
+// session must end.
+func (w *WatchSessions) begin(ctx context.Context) (*watchSession, error) {
+	client := auth.Subject(ctx)
+	if client == auth.Anonymous {
+		client = "peer:" + peerHost(ctx)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case w.draining:
+		w.rejected.WithLabelValues("draining").Inc()
+		return nil, status.Error(codes.Unavailable, "server is shutting down, watch again")
+	case w.limits.MaxStreams > 0 && len(w.sessions) >= w.limits.MaxStreams:
+		w.rejected.WithLabelValues("server_limit").Inc()
+		return nil, status.Error(codes.ResourceExhausted, "too many watch streams on this server, retry later")
+	case w.limits.MaxStreamsPerClient > 0 && w.perClient[client] >= w.limits.MaxStreamsPerClient:
+		w.rejected.WithLabelValues("client_limit").Inc()
+		return nil, status.Errorf(codes.ResourceExhausted, "at most %d watch streams per client", w.limits.MaxStreamsPerClient)
+	}
+
+	session := &watchSession{owner: w, client: client}
+	session.ctx, session.cancel = context.WithCancelCause(ctx)
+	if w.limits.IdleTimeout > 0 {
+		session.idle = time.AfterFunc(w.limits.IdleTimeout, func() { session.cancel(errWatchIdle) })
+	}
+
+	w.sessions[session] = struct{}{}
+	w.perClient[client]++
+	w.active.Inc()
+
+	return session, nil
+}
+
+// Drain ends every open stream and refuses new ones, so that a graceful
+// stop of the server does not wait for streams that never finish on their
+// own. Watchers resume on another instance.
+func (w *WatchSessions) Drain() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.draining = true
+	for session := range w.sessions {
+		session.cancel(errWatchDrained)
+	}
+}
+
+// touch pushes back the idle timeout after a change was delivered
+func (s *watchSession) touch() {
+	if s.idle != nil {
+		s.idle.Reset(s.owner.limits.IdleTimeout)
+	}
+}
+
+// end closes the session, counting why the stream ended
+func (s *watchSession) end(reason string) {
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	s.cancel(nil)
+
+	w := s.owner
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.sessions, s)
+	if w.perClient[s.client]--; w.perClient[s.client] == 0 {
+		delete(w.perClient, s.client)
+	}
+	w.active.Dec()
+	w.ended.WithLabelValues(reason).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (w *WatchSessions) Describe(ch chan<- *prometheus.Desc) {
+	w.active.Describe(ch)
+	w.rejected.Describe(ch)
+	w.ended.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (w *WatchSessions) Collect(ch chan<- prometheus.Metric) {
+	w.active.Collect(ch)
+	w.rejected.Collect(ch)
+	w.ended.Collect(ch)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/server/servertest"
+)
+
+func TestWatchSessions(t *testing.T) {
+	ctx := servertest.NewContext().WithPeer("203.0.113.7:51234").Build()
+
+	t.Run("limits streams per client", func(t *testing.T) {
+		watches := NewWatchSessions(WatchLimits{MaxStreamsPerClient: 1})
+		first, err := watches.begin(ctx)
+		if err != nil {
+			t.Fatalf("expected the first stream to open, got %v", err)
+		}
+		_, err = watches.begin(ctx)
+		servertest.AssertCode(t, err, codes.ResourceExhausted)
+
+		first.end("client")
+		if _, err := watches.begin(ctx); err != nil {
+			t.Errorf("expected a stream to open once the first ended, got %v", err)
+		}
+	})
+
+	t.Run("ends idle streams", func(t *testing.T) {
+		watches := NewWatchSessions(WatchLimits{IdleTimeout: time.Millisecond})
+		session, err := watches.begin(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer session.end("idle")
+
+		<-session.ctx.Done()
+		if cause := context.Cause(session.ctx); !errors.Is(cause, errWatchIdle) {
+			t.Errorf("expected errWatchIdle, got %v", cause)
+		}
+	})
+
+	t.Run("drains open streams and refuses new ones", func(t *testing.T) {
+		watches := NewWatchSessions(WatchLimits{})
+		session, err := watches.begin(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer session.end("drained")
+
+		watches.Drain()
+		if cause := context.Cause(session.ctx); !errors.Is(cause, errWatchDrained) {
+			t.Errorf("expected errWatchDrained, got %v", cause)
+		}
+		_, err = watches.begin(ctx)
+		servertest.AssertCode(t, err, codes.Unavailable)
+	})
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, revoked and expired API keys
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyNotFound is returned when rotating or revoking an unknown or
+	// revoked API key
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrAPIKeyNotAllowed is returned when a caller without the admin role
+	// manages API keys
+	ErrAPIKeyNotAllowed = errors.New("managing api keys requires the admin role")
+	// ErrAPIKeyRoleNotHeld is returned when creating a key with a role the
+	// caller does not hold
+	ErrAPIKeyRoleNotHeld = errors.New("api keys may only carry roles held by the caller")
+)
+
+// apiKeyPrefix starts every API key so leaked keys are easy to recognize
+const apiKeyPrefix = "usk_"
+
+// APIKeyService manages API keys and verifies the keys presented by callers.
+// Verified keys are cached by hash, so a lookup costs a database query only
+// once per cache TTL.
+type APIKeyService struct {
+	repo     *repository.APIKeyRepository
+	cache    *cache.Redis
+	clock    clock.Clock
+	cacheTTL time.Duration
+	grace    time.Duration
+}
+
+// NewAPIKeyService creates a new APIKeyService instance. Rotated keys keep
+// working for grace unless a rotation asks otherwise.
+func NewAPIKeyService(repo *repository.APIKeyRepository, cache *cache.Redis, clk clock.Clock, cacheTTL, grace time.Duration) *APIKeyService {
+	return &APIKeyService{
+		repo:     repo,
+		cache:    cache,
+		clock:    clk,
+		cacheTTL: cacheTTL,
+		grace:    grace,
+	}
+}
+
+// CreateAPIKey creates a key acting as subject with the given roles on
+// behalf of the caller, who must be an admin holding every one of them. The
+// key is returned only here; a ttl of zero never expires it.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, name, subject string, roles []string, rateLimit int, ttl time.Duration) (*model.APIKey, string, error) {
+	if !auth.HasRole(ctx, auth.AdminRole) {
+		return nil, "", ErrAPIKeyNotAllowed
+	}
+	for _, role := range roles {
+		if !auth.HasRole(ctx, role) {
+			return nil, "", fmt.Errorf("%w: %s", ErrAPIKeyRoleNotHeld, role)
+		}
+	}
+
+	secret, hash, err := newAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	now := s.clock.Now()
+	key := &model.APIKey{
+		Name:      name,
+		Subject:   subject,
+		Roles:     append([]string{}, roles...),
+		Prefix:    secret[:len(apiKeyPrefix)+8],
+		RateLimit: rateLimit,
+		CreatedBy: auth.Subject(ctx),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(ctx, key, hash); err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	slog.Info("api key created",
+		slog.Int64("api_key_id", key.ID),
+		slog.String("subject", key.Subject),
+		slog.String("created_by", key.CreatedBy))
+
+	return key, secret, nil
+}
+
+// RotateAPIKey issues a new key for an existing one. The replaced key keeps
+// working for grace, or for the service default when grace is nil. It
+// requires the admin role.
+func (s *APIKeyService) RotateAPIKey(ctx context.Context, id int64, grace *time.Duration) (*model.APIKey, string, error) {
+	if !auth.HasRole(ctx, auth.AdminRole) {
+		return nil, "", ErrAPIKeyNotAllowed
+	}
+
+	secret, hash, err := newAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	window := s.grace
+	if grace != nil {
+		window = *grace
+	}
+
+	now := s.clock.Now()
+	key, stale, err := s.repo.Rotate(ctx, id, hash, secret[:len(apiKeyPrefix)+8], now.Add(window), now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	s.forget(ctx, stale)
+
+	slog.Info("api key rotated",
+		slog.Int64("api_key_id", key.ID),
+		slog.Duration("grace", window),
+		slog.String("rotated_by", auth.Subject(ctx)))
+
+	return key, secret, nil
+}
+
+// RevokeAPIKey revokes a key along with its rotated predecessor. It
+// requires the admin role.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id int64) error {
+	if !auth.HasRole(ctx, auth.AdminRole) {
+		return ErrAPIKeyNotAllowed
+	}
+
+	stale, err := s.repo.Revoke(ctx, id, s.clock.Now())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	s.forget(ctx, stale)
+
+	slog.Info("api key revoked",
+		slog.Int64("api_key_id", id),
+		slog.String("revoked_by", auth.Subject(ctx)))
+
+	return nil
+}
+
+// VerifyAPIKey returns the principal of an active key. It implements
+// auth.APIKeyVerifier.
+func (s *APIKeyService) VerifyAPIKey(ctx context.Context, secret string) (*auth.Principal, error) {
+	key, err := s.lookup(ctx, hashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	if !key.Active(s.clock.Now()) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return &auth.Principal{
+		Subject:   key.Subject,
+		Method:    "api_key",
+		Roles:     key.Roles,
+		KeyID:     key.ID,
+		RateLimit: key.RateLimit,
+	}, nil
+}
+
+// lookup returns the key with the given hash from the cache or the database
+func (s *APIKeyService) lookup(ctx context.Context, hash string) (*model.APIKey, error) {
+	cacheKey := apiKeyCacheKey(hash)
+
+	if cached, err := s.cache.Get(ctx, cacheKey); err == nil && cached != "" {
+		var key model.APIKey
+		if err := json.Unmarshal([]byte(cached), &key); err == nil {
+			return &key, nil
+		}
+	}
+
+	now := s.clock.Now()
+	key, validUntil, err := s.repo.GetByHash(ctx, hash, now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify api key: %w", err)
+	}
+
+	// A rotated key must not outlive its grace period in the cache, so its
+	// expiration is not jittered
+	set, ttl := s.cache.Set, s.cacheTTL
+	if !validUntil.IsZero() {
+		set, ttl = s.cache.SetExact, min(ttl, validUntil.Sub(now))
+	}
+	if data, err := json.Marshal(key); err == nil && ttl > 0 {
+		if err := set(ctx, cacheKey, string(data), ttl); err != nil {
+			slog.Warn("failed to cache api key", slog.String("error", err.Error()))
+		}
+	}
+
+	return key, nil
+}
+
+// forget drops the cached lookups of hashes
+func (s *APIKeyService) forget(ctx context.Context, hashes []string) {
+	keys := make([]string, len(hashes))
+	for i, h := range hashes {
+		keys[i] = apiKeyCacheKey(h)
+	}
+	if err := s.cache.DeleteMany(ctx, keys...); err != nil {
+		slog.Warn("failed to invalidate api key cache", slog.String("error", err.Error()))
+	}
+}
+
+func apiKeyCacheKey(hash string) string {
+	return "apikey:" + hash
+}
+
+// newAPIKey returns a random key and its hash
+func newAPIKey() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+// hashSecret returns the hex SHA-256 hash API keys and refresh tokens are
+// stored under. They carry 256 bits of entropy, so an unsalted fast hash is
+// sufficient.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	secret, hash, err := newAPIKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(secret, apiKeyPrefix) || len(secret) != len(apiKeyPrefix)+43 {
+		t.Errorf("unexpected key format %q", secret)
+	}
+	if hash != hashSecret(secret) || len(hash) != 64 {
+		t.Errorf("expected the hex SHA-256 of the key, got %q", hash)
+	}
+
+	other, _, _ := newAPIKey()
+	if other == secret {
+		t.Error("expected keys to be random")
+	}
+}
+
+func TestAPIKeyActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	tests := []struct {
+		name string
+		key  model.APIKey
+		want bool
+	}{
+		{"without expiry", model.APIKey{}, true},
+		{"before expiry", model.APIKey{ExpiresAt: &future}, true},
+		{"expired", model.APIKey{ExpiresAt: &past}, false},
+		{"revoked", model.APIKey{RevokedAt: &past}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.Active(now); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestManageAPIKeysRequiresAdmin(t *testing.T) {
+	s := &APIKeyService{}
+	user := auth.NewContext(context.Background(), &auth.Principal{Subject: "user:7", Roles: []string{"user"}})
+
+	t.Run("non-admin cannot mint an admin key", func(t *testing.T) {
+		_, _, err := s.CreateAPIKey(user, "escalate", "user:7", []string{auth.AdminRole}, 0, 0)
+		if !errors.Is(err, ErrAPIKeyNotAllowed) {
+			t.Errorf("expected ErrAPIKeyNotAllowed, got %v", err)
+		}
+	})
+
+	t.Run("admin cannot grant roles it does not hold", func(t *testing.T) {
+		admin := auth.NewContext(context.Background(), &auth.Principal{Subject: "ops", Roles: []string{auth.AdminRole}})
+		_, _, err := s.CreateAPIKey(admin, "billing", "billing-job", []string{"billing"}, 0, 0)
+		if !errors.Is(err, ErrAPIKeyRoleNotHeld) {
+			t.Errorf("expected ErrAPIKeyRoleNotHeld, got %v", err)
+		}
+	})
+
+	t.Run("non-admin cannot rotate or revoke", func(t *testing.T) {
+		if _, _, err := s.RotateAPIKey(user, 1, nil); !errors.Is(err, ErrAPIKeyNotAllowed) {
+			t.Errorf("expected ErrAPIKeyNotAllowed from rotate, got %v", err)
+		}
+		if err := s.RevokeAPIKey(user, 1); !errors.Is(err, ErrAPIKeyNotAllowed) {
+			t.Errorf("expected ErrAPIKeyNotAllowed from revoke, got %v", err)
+		}
+	})
+}
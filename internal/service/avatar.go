@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+)
+
+var (
+	// ErrAvatarTooLarge is returned for uploads above the configured size
+	ErrAvatarTooLarge = errors.New("avatar too large")
+	// ErrUnsupportedAvatar is returned for uploads that are not PNG, JPEG,
+	// GIF or WebP images
+	ErrUnsupportedAvatar = errors.New("avatar must be a PNG, JPEG, GIF or WebP image")
+	// ErrAvatarNotFound is returned when getting the avatar of a user
+	// without one
+	ErrAvatarNotFound = errors.New("user has no avatar")
+)
+
+// avatarTypes are the content types accepted for avatars, as sniffed from
+// the uploaded bytes rather than declared by the client
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// AvatarService stores user avatars in object storage
+type AvatarService struct {
+	users     *UserService
+	store     storage.Store
+	maxSize   int
+	publicURL string
+}
+
+// NewAvatarService creates a new AvatarService instance. Avatar URLs are
+// built below publicURL, or are relative object keys when it is empty.
+func NewAvatarService(users *UserService, store storage.Store, maxSize int, publicURL string) *AvatarService {
+	return &AvatarService{
+		users:     users,
+		store:     store,
+		maxSize:   maxSize,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// Upload stores the avatar read from r, replacing the user's previous one,
+// and returns the user with its new avatar URL
+func (s *AvatarService) Upload(ctx context.Context, userID int64, r io.Reader) (*model.User, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(s.maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if len(data) > s.maxSize {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrAvatarTooLarge, s.maxSize)
+	}
+	if !avatarTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedAvatar
+	}
+
+	user, err := s.users.repo.GetByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload avatar: %w", err)
+	}
+
+	key := avatarKey(userID)
+	if err := s.store.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to upload avatar: %w", err)
+	}
+
+	// The version changes the URL with the content, so that caches in front
+	// of the store never serve a replaced avatar
+	sum := sha256.Sum256(data)
+	avatarURL := key + "?v=" + hex.EncodeToString(sum[:6])
+	if s.publicURL != "" {
+		avatarURL = s.publicURL + "/" + avatarURL
+	}
+
+	return s.users.setAvatarURL(ctx, user, avatarURL)
+}
+
+// Get returns the avatar of a user and its content type
+func (s *AvatarService) Get(ctx context.Context, userID int64) ([]byte, string, error) {
+	user, err := s.users.GetUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get avatar: %w", err)
+	}
+	if user.AvatarURL == "" {
+		return nil, "", ErrAvatarNotFound
+	}
+
+	rc, err := s.store.Get(ctx, avatarKey(userID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", ErrAvatarNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get avatar: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get avatar: %w", err)
+	}
+
+	return data, http.DetectContentType(data), nil
+}
+
+// Delete removes the stored avatar of a user, if any. The user keeps its
+// avatar URL.
+func (s *AvatarService) Delete(ctx context.Context, userID int64) error {
+	if err := s.store.Delete(ctx, avatarKey(userID)); err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	return nil
+}
+
+// avatarKey is the object key of a user's avatar. Uploads overwrite it, so
+// a user never has more than one stored avatar.
+func avatarKey(userID int64) string {
+	return fmt.Sprintf("avatars/%d", userID)
+}
+
+// setAvatarURL records the avatar URL of a user
+func (s *UserService) setAvatarURL(ctx context.Context, user *model.User, avatarURL string) (*model.User, error) {
+	user.AvatarURL = avatarURL
+	user.UpdatedAt = s.clock.Now()
+
+	err := s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		if err := s.repo.SetAvatarURL(ctx, user.ID, user.AvatarURL, user.UpdatedAt); err != nil {
+			return err
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", user.ID), "users:list")
+		fx.raise(events.Event{Type: events.UserUpdated, UserID: user.ID, User: user})
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set avatar: %w", err)
+	}
+
+	slog.Info("user avatar updated", slog.Int64("user_id", user.ID))
+
+	return s.revealUser(ctx, user)
+}
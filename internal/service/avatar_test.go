@@ -0,0 +1,31 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+)
+
+func TestAvatarUpload(t *testing.T) {
+	s := NewAvatarService(&UserService{}, storage.NewFileStore(t.TempDir()), 64, "")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	t.Run("rejects avatars above the size limit", func(t *testing.T) {
+		data := append(png, bytes.Repeat([]byte{0}, 64)...)
+		_, err := s.Upload(context.Background(), 1, bytes.NewReader(data))
+		if !errors.Is(err, ErrAvatarTooLarge) {
+			t.Errorf("expected ErrAvatarTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("rejects content that is not an image", func(t *testing.T) {
+		_, err := s.Upload(context.Background(), 1, strings.NewReader("<svg onload=alert(1)>"))
+		if !errors.Is(err, ErrUnsupportedAvatar) {
+			t.Errorf("expected ErrUnsupportedAvatar, got %v", err)
+		}
+	})
+}
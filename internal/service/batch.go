@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+)
+
+var (
+	// ErrEmailRequired is returned for users without an email
+	ErrEmailRequired = errors.New("email is required")
+	// ErrNameRequired is returned for users without a name
+	ErrNameRequired = errors.New("name is required")
+	// ErrDuplicateInBatch is returned for users repeating an earlier email of the same batch
+	ErrDuplicateInBatch = errors.New("email appears earlier in the batch")
+	// ErrBatchAborted is returned for users not created because another user
+	// of an atomic batch failed
+	ErrBatchAborted = errors.New("batch aborted because another user failed")
+)
+
+// NewUser describes a user to create
+type NewUser struct {
+	Email string
+	Name  string
+}
+
+// BatchResult is the outcome of creating or getting one user of a batch.
+// Exactly one of User and Err is set.
+type BatchResult struct {
+	User *model.User
+	Err  error
+}
+
+// BatchCreateUsers creates users in a single transaction and returns one
+// result per input, in input order. With atomic, no user is created unless
+// all of them can be.
+func (s *UserService) BatchCreateUsers(ctx context.Context, inputs []NewUser, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(inputs))
+
+	now := s.clock.Now()
+	var users []*model.User
+	var positions []int
+	seen := make(map[string]bool, len(inputs))
+	for i, in := range inputs {
+		switch {
+		case in.Email == "":
+			results[i].Err = ErrEmailRequired
+		case in.Name == "":
+			results[i].Err = ErrNameRequired
+		case seen[in.Email]:
+			results[i].Err = ErrDuplicateInBatch
+		default:
+			seen[in.Email] = true
+			storedEmail, err := s.pii.Protect(ctx, in.Email)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create users: %w", err)
+			}
+			users = append(users, &model.User{
+				Email:     storedEmail,
+				Name:      in.Name,
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+			positions = append(positions, i)
+		}
+	}
+
+	if atomic && len(users) < len(inputs) {
+		return abortRemaining(results), nil
+	}
+
+	var (
+		errs   []error
+		failed bool
+	)
+	err := s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		var err error
+		if errs, err = s.repo.CreateMany(ctx, users, atomic); err != nil {
+			return err
+		}
+
+		for j, err := range errs {
+			if err != nil {
+				results[positions[j]].Err = mapCreateError(err)
+				failed = true
+			}
+		}
+		if atomic && failed {
+			return nil
+		}
+
+		fx.invalidate("users:list")
+		for j, user := range users {
+			if errs[j] == nil {
+				fx.invalidate(existsKey(user.ID), emailKey(user.Email))
+				fx.raise(events.Event{Type: events.UserCreated, UserID: user.ID, User: user})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if atomic && failed {
+		return abortRemaining(results), nil
+	}
+
+	var created int
+	for j, user := range users {
+		if errs[j] != nil {
+			continue
+		}
+
+		revealed, err := s.revealUser(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create users: %w", err)
+		}
+		results[positions[j]].User = revealed
+		created++
+	}
+
+	slog.Info("users batch created",
+		slog.Int("requested", len(inputs)),
+		slog.Int("created", created),
+		slog.Bool("atomic", atomic))
+
+	return results, nil
+}
+
+// abortRemaining marks every result without an error as aborted
+func abortRemaining(results []BatchResult) []BatchResult {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+	return results
+}
+
+// mapCreateError maps email uniqueness violations to ErrUserExists
+func mapCreateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.Is(err, repository.ErrEmailTaken) || errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrUserExists
+	}
+	return err
+}
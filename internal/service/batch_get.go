@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BatchGetUsers looks users up by ID and returns one result per ID, in
+// input order. Each lookup fails on its own: users that do not exist fail
+// with ErrUserNotFound, while failures of the cache, the database or the
+// user's shard keep their error, so callers can tell them apart. Repeated
+// IDs are looked up once.
+//
+// Lookups run on the service's lookup pool, shared by every call so that
+// concurrent batches cannot take every database connection. Once its queue
+// is full, the remaining lookups run on the caller's goroutine.
+func (s *UserService) BatchGetUsers(ctx context.Context, ids []int64) []BatchResult {
+	unique := make(map[int64]*BatchResult, len(ids))
+	for _, id := range ids {
+		if _, ok := unique[id]; !ok {
+			unique[id] = &BatchResult{}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for id, result := range unique {
+		id, result := id, result
+		wg.Add(1)
+		// Lookups use the request's context rather than the pool's, which
+		// is not canceled with the request
+		err := s.lookups.Submit(ctx, func(context.Context) {
+			defer wg.Done()
+
+			user, err := s.GetUser(ctx, id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = ErrUserNotFound
+			}
+			result.User, result.Err = user, err
+		})
+		if err != nil {
+			result.Err = err
+			wg.Done()
+		}
+	}
+	wg.Wait()
+
+	results := make([]BatchResult, len(ids))
+	for i, id := range ids {
+		results[i] = *unique[id]
+	}
+	return results
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pool"
+)
+
+func TestBatchCreateUsersValidation(t *testing.T) {
+	s := &UserService{pii: pii.NewProtector(pii.Noop{}, nil), clock: clock.Real{}}
+
+	t.Run("atomic batch with invalid users is aborted before writing", func(t *testing.T) {
+		inputs := []NewUser{
+			{Email: "a@example.com", Name: "A"},
+			{Email: "", Name: "B"},
+			{Email: "c@example.com", Name: ""},
+			{Email: "a@example.com", Name: "D"},
+		}
+
+		results, err := s.BatchCreateUsers(context.Background(), inputs, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []error{ErrBatchAborted, ErrEmailRequired, ErrNameRequired, ErrDuplicateInBatch}
+		for i, result := range results {
+			if !errors.Is(result.Err, want[i]) || result.User != nil {
+				t.Errorf("result %d: expected %v, got %v", i, want[i], result.Err)
+			}
+		}
+	})
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	t.Run("looks users up on the pool in request order", func(t *testing.T) {
+		lookups := pool.New("batch_get", 2, 1, pool.CallerRuns)
+		defer lookups.Close()
+
+		cache := NewMockCache()
+		cache.data["user:1"] = `{"id":1,"name":"One"}`
+		cache.data["user:2"] = `{"id":2,"name":"Two"}`
+		s := &UserService{cache: cache, pii: pii.NewProtector(pii.Noop{}, nil), lookups: lookups}
+
+		results := s.BatchGetUsers(context.Background(), []int64{2, 1, 2})
+		for i, want := range []string{"Two", "One", "Two"} {
+			if results[i].Err != nil || results[i].User == nil || results[i].User.Name != want {
+				t.Errorf("result %d: expected %s, got %+v", i, want, results[i])
+			}
+		}
+	})
+}
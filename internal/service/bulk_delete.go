@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+)
+
+var (
+	// ErrEmptyFilter is returned for bulk deletions by a filter without criteria
+	ErrEmptyFilter = errors.New("filter must have at least one criterion")
+	// ErrBulkDeleteTooLarge is returned when a filter matches more users
+	// than may be deleted at once
+	ErrBulkDeleteTooLarge = errors.New("filter matches too many users")
+)
+
+// BulkDeleteResult lists the outcome of a bulk deletion
+type BulkDeleteResult struct {
+	// Deleted holds the users deleted, or that would be deleted on a dry run
+	Deleted []int64
+	// Missing holds requested IDs matching no user, including users that
+	// were already deleted
+	Missing []int64
+}
+
+// BulkDeleteUsers soft-deletes the users with the given IDs. A dry run only
+// reports which users would be deleted.
+func (s *UserService) BulkDeleteUsers(ctx context.Context, ids []int64, dryRun bool) (*BulkDeleteResult, error) {
+	ids = uniqueIDs(ids)
+
+	var (
+		deleted []int64
+		err     error
+	)
+	if dryRun {
+		deleted, err = s.repo.ExistingIDs(ctx, ids)
+	} else {
+		err = s.transact(ctx, func(ctx context.Context, fx *effects) error {
+			var err error
+			if deleted, err = s.repo.DeleteMany(ctx, ids); err != nil {
+				return err
+			}
+			bulkDeleteEffects(fx, deleted)
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk delete users: %w", err)
+	}
+
+	result := &BulkDeleteResult{Deleted: deleted}
+	done := make(map[int64]bool, len(deleted))
+	for _, id := range deleted {
+		done[id] = true
+	}
+	for _, id := range ids {
+		if !done[id] {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+
+	if !dryRun {
+		slog.Info("users bulk deleted", slog.Int("count", len(deleted)))
+	}
+
+	return result, nil
+}
+
+// BulkDeleteMatching soft-deletes the users matching filter, failing with
+// ErrBulkDeleteTooLarge when more than limit users match
+func (s *UserService) BulkDeleteMatching(ctx context.Context, filter repository.UserFilter, limit int, dryRun bool) (*BulkDeleteResult, error) {
+	if filter.Empty() {
+		return nil, ErrEmptyFilter
+	}
+	if err := s.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.repo.Search(ctx, filter, repository.UserSort{Field: "id"}, limit, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk delete users: %w", err)
+	}
+	if total > limit {
+		return nil, fmt.Errorf("%w: %d users match, at most %d can be deleted at once", ErrBulkDeleteTooLarge, total, limit)
+	}
+
+	ids := make([]int64, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	result, err := s.BulkDeleteUsers(ctx, ids, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	// Users deleted concurrently since the search are not failures here
+	result.Missing = nil
+
+	return result, nil
+}
+
+// bulkDeleteEffects queues the cache invalidations and events of deleted
+// users, which are invalidated together in one round trip
+func bulkDeleteEffects(fx *effects, deleted []int64) {
+	if len(deleted) == 0 {
+		return
+	}
+
+	fx.invalidate("users:list")
+	for _, id := range deleted {
+		fx.invalidate(fmt.Sprintf("user:%d", id), existsKey(id))
+		fx.raise(events.Event{Type: events.UserDeleted, UserID: id})
+	}
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
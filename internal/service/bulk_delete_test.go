@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+)
+
+func TestBulkDeleteMatching(t *testing.T) {
+	s := &UserService{pii: pii.NewProtector(pii.Noop{}, nil)}
+
+	t.Run("rejects an empty filter", func(t *testing.T) {
+		_, err := s.BulkDeleteMatching(context.Background(), repository.UserFilter{}, 10, true)
+		if !errors.Is(err, ErrEmptyFilter) {
+			t.Errorf("expected ErrEmptyFilter, got %v", err)
+		}
+	})
+
+	t.Run("rejects an empty created range", func(t *testing.T) {
+		now := time.Now()
+		filter := repository.UserFilter{CreatedAfter: now, CreatedBefore: now}
+		_, err := s.BulkDeleteMatching(context.Background(), filter, 10, true)
+		if !errors.Is(err, ErrInvalidCreatedRange) {
+			t.Errorf("expected ErrInvalidCreatedRange, got %v", err)
+		}
+	})
+}
+
+func TestUniqueIDs(t *testing.T) {
+	got := uniqueIDs([]int64{3, 1, 3, 2, 1})
+	if want := []int64{3, 1, 2}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
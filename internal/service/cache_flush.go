@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+)
+
+// ErrEmptyPattern is returned for cache flushes without a key pattern
+var ErrEmptyPattern = errors.New("pattern is required, use * to flush every key")
+
+// FlushCache removes the cached entries whose keys match a Redis glob
+// pattern, such as "user:*", passing the progress to fn after each batch.
+// Entries are reloaded from the database on their next read, so flushing is
+// always safe, though it briefly raises the database load.
+func (s *UserService) FlushCache(ctx context.Context, pattern string, batchSize int, fn func(cache.FlushProgress) error) (cache.FlushProgress, error) {
+	if pattern == "" {
+		return cache.FlushProgress{}, ErrEmptyPattern
+	}
+
+	progress, err := s.cache.DeleteMatching(ctx, pattern, int64(batchSize), fn)
+	if err != nil {
+		return progress, fmt.Errorf("failed to flush cache: %w", err)
+	}
+
+	slog.Info("cache flushed",
+		slog.String("pattern", pattern),
+		slog.Int64("scanned", progress.Scanned),
+		slog.Int64("deleted", progress.Deleted))
+
+	return progress, nil
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+)
+
+func TestFlushCache(t *testing.T) {
+	t.Run("rejects an empty pattern", func(t *testing.T) {
+		s := &UserService{}
+		_, err := s.FlushCache(context.Background(), "", 100, func(cache.FlushProgress) error { return nil })
+		if !errors.Is(err, ErrEmptyPattern) {
+			t.Errorf("expected ErrEmptyPattern, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+)
+
+// effects collects the side effects of a write, its domain events and the
+// cache entries it makes stale, so that they only take place once the
+// transaction of the write has committed. A rolled-back write then neither
+// publishes events nor evicts entries that are still valid.
+type effects struct {
+	events []events.Event
+	keys   []string
+}
+
+// raise queues a domain event for publication after commit
+func (fx *effects) raise(event events.Event) {
+	fx.events = append(fx.events, event)
+}
+
+// invalidate queues cache keys for deletion after commit
+func (fx *effects) invalidate(keys ...string) {
+	fx.keys = append(fx.keys, keys...)
+}
+
+type effectsKey struct{}
+
+// transact runs fn in a transaction and applies the effects it collected
+// once the transaction commits; nothing is applied when fn or the commit
+// fails. Nested calls add to the effects of the outermost call, which
+// applies them all after the single commit.
+func (s *UserService) transact(ctx context.Context, fn func(ctx context.Context, fx *effects) error) error {
+	if fx, ok := ctx.Value(effectsKey{}).(*effects); ok {
+		return fn(ctx, fx)
+	}
+
+	fx := &effects{}
+	err := s.repo.InTx(context.WithValue(ctx, effectsKey{}, fx), func(ctx context.Context) error {
+		return fn(ctx, fx)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.apply(ctx, fx)
+	return nil
+}
+
+// apply evicts the collected cache keys in one round trip, then publishes
+// the collected events in the order they were raised
+func (s *UserService) apply(ctx context.Context, fx *effects) {
+	if len(fx.keys) > 0 {
+		if err := s.cache.DeleteMany(ctx, fx.keys...); err != nil {
+			slog.Warn("failed to invalidate cache",
+				slog.Int("keys", len(fx.keys)),
+				slog.String("error", err.Error()))
+		}
+	}
+	for _, event := range fx.events {
+		s.publish(ctx, event)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+)
+
+func TestTransact(t *testing.T) {
+	t.Run("nested calls add to the outer effects", func(t *testing.T) {
+		s := &UserService{}
+		outer := &effects{}
+		ctx := context.WithValue(context.Background(), effectsKey{}, outer)
+
+		err := s.transact(ctx, func(ctx context.Context, fx *effects) error {
+			fx.invalidate("users:list")
+			fx.raise(events.Event{Type: events.UserDeleted, UserID: 1})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(outer.keys) != 1 || len(outer.events) != 1 {
+			t.Errorf("expected effects to join the outer call, got %d keys and %d events", len(outer.keys), len(outer.events))
+		}
+	})
+
+	t.Run("nested failures are returned to the outer call", func(t *testing.T) {
+		s := &UserService{}
+		ctx := context.WithValue(context.Background(), effectsKey{}, &effects{})
+		boom := errors.New("boom")
+
+		err := s.transact(ctx, func(context.Context, *effects) error { return boom })
+		if !errors.Is(err, boom) {
+			t.Errorf("expected %v, got %v", boom, err)
+		}
+	})
+}
+
+func TestBulkDeleteEffects(t *testing.T) {
+	fx := &effects{}
+	bulkDeleteEffects(fx, []int64{1, 2})
+
+	if len(fx.keys) != 5 {
+		t.Errorf("expected 5 keys, got %v", fx.keys)
+	}
+	if len(fx.events) != 2 || fx.events[1].UserID != 2 {
+		t.Errorf("expected deletion events in order, got %v", fx.events)
+	}
+}
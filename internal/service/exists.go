@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Existence answers are cached aggressively. Deletions invalidate positive
+// answers explicitly; negative answers expire quickly since the ID may be
+// assigned by a create that raced the lookup.
+const (
+	existsTTL    = time.Hour
+	notExistsTTL = time.Minute
+)
+
+func existsKey(id int64) string {
+	return fmt.Sprintf("user:exists:%d", id)
+}
+
+// UsersExist reports for each ID whether a user with that ID exists
+func (s *UserService) UsersExist(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	result := make(map[int64]bool, len(ids))
+
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if _, seen := result[id]; !seen {
+			result[id] = false
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(unique))
+	for i, id := range unique {
+		keys[i] = existsKey(id)
+	}
+
+	misses := unique
+	if cached, err := s.cache.MGet(ctx, keys...); err == nil {
+		misses = nil
+		for i, value := range cached {
+			switch value {
+			case "1":
+				result[unique[i]] = true
+			case "0":
+			default:
+				misses = append(misses, unique[i])
+			}
+		}
+	} else {
+		slog.Warn("exists cache unavailable", slog.String("error", err.Error()))
+	}
+
+	if len(misses) == 0 {
+		return result, nil
+	}
+
+	existing, err := s.repo.ExistingIDs(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range existing {
+		result[id] = true
+	}
+
+	found := make(map[string]string)
+	missing := make(map[string]string)
+	for _, id := range misses {
+		if result[id] {
+			found[existsKey(id)] = "1"
+		} else {
+			missing[existsKey(id)] = "0"
+		}
+	}
+	if err := s.cache.SetMany(ctx, found, existsTTL); err != nil {
+		slog.Warn("failed to cache user existence", slog.String("error", err.Error()))
+	}
+	if err := s.cache.SetMany(ctx, missing, notExistsTTL); err != nil {
+		slog.Warn("failed to cache user existence", slog.String("error", err.Error()))
+	}
+
+	return result, nil
+}
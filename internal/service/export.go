@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// ExportFormat is the serialization of exported users
+type ExportFormat string
+
+const (
+	// ExportCSV writes a header row followed by one row per user
+	ExportCSV ExportFormat = "csv"
+	// ExportNDJSON writes one JSON object per line
+	ExportNDJSON ExportFormat = "ndjson"
+)
+
+// ErrUnknownExportFormat is returned for export formats other than CSV and NDJSON
+var ErrUnknownExportFormat = errors.New("unknown export format, expected csv or ndjson")
+
+// exportColumns are the CSV columns of an export, in order
+var exportColumns = []string{"id", "uuid", "email", "name", "created_at", "updated_at"}
+
+// ExportUsers serializes every user in the given format and passes the
+// output to fn in chunks of up to chunkSize users. Each chunk holds whole
+// rows, and the first CSV chunk starts with the header, so the chunks
+// concatenate into a valid file. It returns the number of users exported.
+func (s *UserService) ExportUsers(ctx context.Context, format ExportFormat, chunkSize int, fn func([]byte) error) (int64, error) {
+	var encode func(*bytes.Buffer, []*model.User) error
+	switch format {
+	case ExportCSV:
+		encode = encodeUsersCSV
+	case ExportNDJSON:
+		encode = encodeUsersNDJSON
+	default:
+		return 0, ErrUnknownExportFormat
+	}
+
+	var (
+		buf      bytes.Buffer
+		exported int64
+	)
+	if format == ExportCSV {
+		buf.WriteString(csvHeader())
+	}
+
+	err := s.StreamUsers(ctx, chunkSize, func(users []*model.User) error {
+		if err := encode(&buf, users); err != nil {
+			return fmt.Errorf("failed to encode users: %w", err)
+		}
+		if err := fn(buf.Bytes()); err != nil {
+			return err
+		}
+		exported += int64(len(users))
+		buf.Reset()
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+
+	// An empty CSV export still consists of its header
+	if buf.Len() > 0 {
+		if err := fn(buf.Bytes()); err != nil {
+			return exported, err
+		}
+	}
+
+	slog.Info("users exported",
+		slog.String("format", string(format)),
+		slog.Int64("users", exported))
+
+	return exported, nil
+}
+
+func csvHeader() string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(exportColumns)
+	w.Flush()
+	return buf.String()
+}
+
+func encodeUsersCSV(buf *bytes.Buffer, users []*model.User) error {
+	w := csv.NewWriter(buf)
+	for _, user := range users {
+		w.Write([]string{
+			strconv.FormatInt(user.ID, 10),
+			user.UUID,
+			user.Email,
+			user.Name,
+			user.CreatedAt.UTC().Format(time.RFC3339),
+			user.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func encodeUsersNDJSON(buf *bytes.Buffer, users []*model.User) error {
+	enc := json.NewEncoder(buf)
+	for _, user := range users {
+		if err := enc.Encode(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+func TestEncodeUsers(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	users := []*model.User{
+		{ID: 1, UUID: "u-1", Email: "a@example.com", Name: "Doe, Jane", CreatedAt: created, UpdatedAt: created},
+	}
+
+	t.Run("csv quotes fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := encodeUsersCSV(&buf, users); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "1,u-1,a@example.com,\"Doe, Jane\",2024-03-01T12:00:00Z,2024-03-01T12:00:00Z\n"
+		if buf.String() != want {
+			t.Errorf("expected %q, got %q", want, buf.String())
+		}
+	})
+
+	t.Run("ndjson writes one object per line", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := encodeUsersNDJSON(&buf, append(users, users[0])); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"id":1,"uuid":"u-1"`) {
+			t.Errorf("unexpected output %q", buf.String())
+		}
+	})
+
+	t.Run("csv header", func(t *testing.T) {
+		if got := csvHeader(); got != "id,uuid,email,name,created_at,updated_at\n" {
+			t.Errorf("unexpected header %q", got)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/captcha"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// ErrNotGuest is returned when upgrading a user that is not a guest
+var ErrNotGuest = errors.New("user is not a guest")
+
+// GuestService provisions guest users, who try the product before signing
+// up, and upgrades them to regular users keeping their ID and history
+type GuestService struct {
+	users     *UserService
+	passwords *PasswordService
+	sessions  *SessionService
+	verifier  captcha.Verifier
+}
+
+// NewGuestService creates a new GuestService instance
+func NewGuestService(users *UserService, passwords *PasswordService, sessions *SessionService, verifier captcha.Verifier) *GuestService {
+	return &GuestService{
+		users:     users,
+		passwords: passwords,
+		sessions:  sessions,
+		verifier:  verifier,
+	}
+}
+
+// CreateGuest checks the human-verification token, creates a guest and
+// starts a session for it. Guests have neither an email nor a password, so
+// the session's refresh token is their only credential until they are
+// upgraded.
+func (s *GuestService) CreateGuest(ctx context.Context, name, timezone, locale, captchaToken, remoteIP string) (*model.User, *Tokens, error) {
+	if err := s.verifier.Verify(ctx, captchaToken, remoteIP); err != nil {
+		return nil, nil, err
+	}
+	timezone, locale, err := normalizeLocality(timezone, locale)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	email, err := guestEmail()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create guest: %w", err)
+	}
+	storedEmail, err := s.users.pii.Protect(ctx, email)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create guest: %w", err)
+	}
+
+	now := s.users.clock.Now()
+	user, err := s.users.insert(ctx, &model.User{
+		Email:     storedEmail,
+		Name:      name,
+		Timezone:  timezone,
+		Locale:    locale,
+		Guest:     true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.sessions.start(ctx, user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start guest session: %w", err)
+	}
+
+	return user, tokens, nil
+}
+
+// UpgradeGuest attaches an email and a password to a guest, which becomes
+// a regular user able to log in. Its ID, history and sessions are kept.
+func (s *GuestService) UpgradeGuest(ctx context.Context, userID int64, email, password string) (*model.User, error) {
+	guest, err := s.users.repo.GetByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade guest: %w", err)
+	}
+	if !guest.Guest {
+		return nil, ErrNotGuest
+	}
+
+	hash, err := s.passwords.hash(password)
+	if err != nil {
+		return nil, err
+	}
+	storedEmail, err := s.users.pii.Protect(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade guest: %w", err)
+	}
+
+	var user *model.User
+	err = s.users.transact(ctx, func(ctx context.Context, fx *effects) error {
+		var err error
+		user, err = s.users.repo.UpgradeGuest(ctx, userID, storedEmail, hash, s.users.clock.Now())
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Upgraded or deleted since it was read
+			return ErrNotGuest
+		}
+		if err != nil {
+			return mapCreateError(err)
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", userID), "users:list", emailKey(guest.Email), emailKey(storedEmail))
+		fx.raise(events.Event{Type: events.UserUpdated, UserID: userID, User: user})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("guest upgraded", slog.Int64("user_id", userID))
+
+	return s.users.revealUser(ctx, user)
+}
+
+// guestEmail returns a random placeholder email for a guest. It is under a
+// reserved domain, so it can never be delivered to.
+func guestEmail() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "guest-" + hex.EncodeToString(b) + "@guest.invalid", nil
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGuestEmail(t *testing.T) {
+	t.Run("is random and undeliverable", func(t *testing.T) {
+		pattern := regexp.MustCompile(`^guest-[0-9a-f]{24}@guest\.invalid$`)
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			email, err := guestEmail()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !pattern.MatchString(email) {
+				t.Fatalf("unexpected guest email %q", email)
+			}
+			if seen[email] {
+				t.Fatalf("guest email %q repeated", email)
+			}
+			seen[email] = true
+		}
+	})
+}
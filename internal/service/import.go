@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// maxImportErrors caps the row failures detailed in an import summary; the
+// failures beyond it are only counted
+const maxImportErrors = 100
+
+// ImportError describes a row of an import that could not be inserted
+type ImportError struct {
+	// Row is the 1-based position of the user in the import
+	Row int64
+	Err error
+}
+
+// ImportSummary is the outcome of an import
+type ImportSummary struct {
+	Received   int64
+	Inserted   int64
+	Duplicates int64
+	Errored    int64
+	// Errors details the first failed rows
+	Errors []ImportError
+}
+
+// Importer inserts users received one by one in batches. It is not safe for
+// concurrent use.
+type Importer struct {
+	users     *UserService
+	batchSize int
+	pending   []*model.User
+	seen      map[string]bool
+	summary   ImportSummary
+}
+
+// NewImporter creates an Importer inserting users in batches of batchSize
+func (s *UserService) NewImporter(batchSize int) *Importer {
+	return &Importer{
+		users:     s,
+		batchSize: batchSize,
+		seen:      make(map[string]bool),
+	}
+}
+
+// Add queues a user for insertion, inserting the queued batch once full.
+// Invalid users are recorded in the summary; only failures to insert a
+// batch are returned, after which the import should be abandoned.
+func (im *Importer) Add(ctx context.Context, email, name string) error {
+	im.summary.Received++
+	row := im.summary.Received
+
+	switch {
+	case email == "":
+		im.fail(row, ErrEmailRequired)
+		return nil
+	case name == "":
+		im.fail(row, ErrNameRequired)
+		return nil
+	}
+
+	storedEmail, err := im.users.pii.Protect(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to import users: %w", err)
+	}
+	// Duplicates within a batch are skipped by the database as well, but
+	// counting them here keeps them apart from duplicates of existing users
+	if im.seen[storedEmail] {
+		im.summary.Duplicates++
+		return nil
+	}
+	im.seen[storedEmail] = true
+
+	im.pending = append(im.pending, &model.User{Email: storedEmail, Name: name})
+	if len(im.pending) >= im.batchSize {
+		return im.flush(ctx)
+	}
+	return nil
+}
+
+// Close inserts the remaining queued users and returns the summary
+func (im *Importer) Close(ctx context.Context) (*ImportSummary, error) {
+	if err := im.flush(ctx); err != nil {
+		return &im.summary, err
+	}
+
+	slog.Info("users imported",
+		slog.Int64("received", im.summary.Received),
+		slog.Int64("inserted", im.summary.Inserted),
+		slog.Int64("duplicates", im.summary.Duplicates),
+		slog.Int64("errored", im.summary.Errored))
+
+	return &im.summary, nil
+}
+
+func (im *Importer) flush(ctx context.Context) error {
+	if len(im.pending) == 0 {
+		return nil
+	}
+
+	var imported []*model.User
+	err := im.users.transact(ctx, func(ctx context.Context, fx *effects) error {
+		var err error
+		if imported, err = im.users.repo.Import(ctx, im.pending, im.users.clock.Now()); err != nil {
+			return err
+		}
+
+		fx.invalidate("users:list")
+		for _, user := range imported {
+			fx.invalidate(existsKey(user.ID), emailKey(user.Email))
+			fx.raise(events.Event{Type: events.UserCreated, UserID: user.ID, User: user})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import users: %w", err)
+	}
+
+	im.summary.Inserted += int64(len(imported))
+	im.summary.Duplicates += int64(len(im.pending) - len(imported))
+	im.pending = im.pending[:0]
+	// Emails of earlier batches are checked by the database from now on
+	clear(im.seen)
+
+	return nil
+}
+
+func (im *Importer) fail(row int64, err error) {
+	im.summary.Errored++
+	if len(im.summary.Errors) < maxImportErrors {
+		im.summary.Errors = append(im.summary.Errors, ImportError{Row: row, Err: err})
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
+)
+
+func TestImporterAdd(t *testing.T) {
+	s := &UserService{pii: pii.NewProtector(pii.Noop{}, nil)}
+	im := s.NewImporter(10)
+	ctx := context.Background()
+
+	rows := []struct{ email, name string }{
+		{"a@example.com", "A"},
+		{"", "No Email"},
+		{"a@example.com", "A again"},
+		{"b@example.com", ""},
+		{"c@example.com", "C"},
+	}
+	for _, row := range rows {
+		if err := im.Add(ctx, row.email, row.name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(im.pending) != 2 {
+		t.Errorf("expected 2 pending users, got %d", len(im.pending))
+	}
+	if im.summary.Received != 5 || im.summary.Duplicates != 1 || im.summary.Errored != 2 {
+		t.Errorf("unexpected summary %+v", im.summary)
+	}
+	if len(im.summary.Errors) != 2 || im.summary.Errors[0].Row != 2 || !errors.Is(im.summary.Errors[1].Err, ErrNameRequired) {
+		t.Errorf("unexpected errors %+v", im.summary.Errors)
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mail"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+var (
+	// ErrInvalidInviteToken is returned for forged, superseded, used or expired invite tokens
+	ErrInvalidInviteToken = errors.New("invalid or expired invite token")
+	// ErrInvitationPending is returned when the email already has a pending invitation
+	ErrInvitationPending = errors.New("invitation already pending for this email, resend it instead")
+	// ErrInvitationNotFound is returned when resending an unknown or accepted invitation
+	ErrInvitationNotFound = errors.New("pending invitation not found")
+	// ErrUserExists is returned when inviting an email that already has an account
+	ErrUserExists = errors.New("a user with this email already exists")
+)
+
+// uniqueViolation is the Postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// InvitationService handles the invite onboarding workflow
+type InvitationService struct {
+	repo       *repository.InvitationRepository
+	users      *UserService
+	mailer     mail.Sender
+	signingKey []byte
+	ttl        time.Duration
+	acceptURL  string
+}
+
+// NewInvitationService creates a new InvitationService instance
+func NewInvitationService(repo *repository.InvitationRepository, users *UserService, mailer mail.Sender, signingKey []byte, ttl time.Duration, acceptURL string) *InvitationService {
+	return &InvitationService{
+		repo:       repo,
+		users:      users,
+		mailer:     mailer,
+		signingKey: signingKey,
+		ttl:        ttl,
+		acceptURL:  acceptURL,
+	}
+}
+
+// InviteUser creates a pending invitation on behalf of the caller and emails
+// a signed invite link to the invitee
+func (s *InvitationService) InviteUser(ctx context.Context, email, name string) (*model.Invitation, error) {
+	storedEmail, err := s.users.pii.Protect(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invite user: %w", err)
+	}
+
+	_, err = s.users.repo.GetByEmail(ctx, storedEmail)
+	if err == nil {
+		return nil, ErrUserExists
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to invite user: %w", err)
+	}
+
+	inv := &model.Invitation{
+		Email:     storedEmail,
+		Name:      name,
+		InvitedBy: auth.Subject(ctx),
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := s.repo.Create(ctx, inv); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrInvitationPending
+		}
+		return nil, fmt.Errorf("failed to invite user: %w", err)
+	}
+
+	if err := s.send(ctx, inv, email); err != nil {
+		return nil, err
+	}
+
+	slog.Info("user invited",
+		slog.Int64("invitation_id", inv.ID),
+		slog.String("email", inv.Email),
+		slog.String("invited_by", inv.InvitedBy))
+
+	return s.reveal(ctx, inv)
+}
+
+// ResendInvite extends a pending invitation and emails a fresh link. Links
+// sent before are invalidated.
+func (s *InvitationService) ResendInvite(ctx context.Context, id int64) (*model.Invitation, error) {
+	inv, err := s.repo.Renew(ctx, id, time.Now().Add(s.ttl))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resend invitation: %w", err)
+	}
+
+	email, err := s.users.pii.Detokenize(ctx, inv.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resend invitation: %w", err)
+	}
+
+	if err := s.send(ctx, inv, email); err != nil {
+		return nil, err
+	}
+
+	slog.Info("invitation resent",
+		slog.Int64("invitation_id", inv.ID),
+		slog.Int("send_count", inv.SendCount))
+
+	return s.reveal(ctx, inv)
+}
+
+// AcceptInvite consumes an invite token and creates the invited user. The
+// invitee may override the name chosen by the inviter.
+func (s *InvitationService) AcceptInvite(ctx context.Context, token, name string) (*model.User, error) {
+	id, version, err := s.parseToken(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.repo.Claim(ctx, id, version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidInviteToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	if name == "" {
+		name = inv.Name
+	}
+
+	user, err := s.users.create(ctx, inv.Email, name, nil, "", "")
+	if err != nil {
+		if rerr := s.repo.Release(ctx, inv.ID); rerr != nil {
+			slog.Error("failed to release invitation", slog.String("error", rerr.Error()))
+		}
+		return nil, err
+	}
+
+	if err := s.repo.SetUser(ctx, inv.ID, user.ID); err != nil {
+		slog.Warn("failed to link invitation to user",
+			slog.Int64("invitation_id", inv.ID),
+			slog.String("error", err.Error()))
+	}
+
+	slog.Info("invitation accepted",
+		slog.Int64("invitation_id", inv.ID),
+		slog.Int64("user_id", user.ID))
+
+	return user, nil
+}
+
+// ListPendingInvites lists invitations that have not been accepted yet,
+// including expired ones that can still be resent
+func (s *InvitationService) ListPendingInvites(ctx context.Context, page, pageSize int) ([]*model.Invitation, int, error) {
+	offset := pagination.Offset(page, pageSize)
+
+	invitations, err := s.repo.ListPending(ctx, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	total, err := s.repo.CountPending(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count invitations: %w", err)
+	}
+
+	for i, inv := range invitations {
+		if invitations[i], err = s.reveal(ctx, inv); err != nil {
+			return nil, 0, fmt.Errorf("failed to list invitations: %w", err)
+		}
+	}
+
+	return invitations, total, nil
+}
+
+func (s *InvitationService) send(ctx context.Context, inv *model.Invitation, email string) error {
+	link := s.acceptURL + "?token=" + url.QueryEscape(s.signToken(inv))
+	err := s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "You have been invited",
+		Body:    fmt.Sprintf("Hi %s,\n\nYou have been invited to create an account. Accept the invitation here:\n\n%s\n\nThis link expires on %s.\n", inv.Name, link, inv.ExpiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send invitation email: %w", err)
+	}
+	return nil
+}
+
+func (s *InvitationService) reveal(ctx context.Context, inv *model.Invitation) (*model.Invitation, error) {
+	email, err := s.users.pii.Reveal(ctx, inv.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	revealed := *inv
+	revealed.Email = email
+	return &revealed, nil
+}
+
+// signToken encodes the invitation ID, token version and expiry, signed with
+// HMAC-SHA256 so tokens cannot be forged or extended
+func (s *InvitationService) signToken(inv *model.Invitation) string {
+	payload := fmt.Sprintf("%d:%d:%d", inv.ID, inv.TokenVersion, inv.ExpiresAt.Unix())
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded))
+}
+
+func (s *InvitationService) parseToken(token string, now time.Time) (int64, int, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, 0, ErrInvalidInviteToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return 0, 0, ErrInvalidInviteToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, 0, ErrInvalidInviteToken
+	}
+
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 3 {
+		return 0, 0, ErrInvalidInviteToken
+	}
+	id, err1 := strconv.ParseInt(parts[0], 10, 64)
+	version, err2 := strconv.Atoi(parts[1])
+	expires, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, ErrInvalidInviteToken
+	}
+
+	if !now.Before(time.Unix(expires, 0)) {
+		return 0, 0, ErrInvalidInviteToken
+	}
+
+	return id, version, nil
+}
+
+func (s *InvitationService) mac(data string) []byte {
+	h := hmac.New(sha256.New, s.signingKey)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+func TestInviteToken(t *testing.T) {
+	s := &InvitationService{signingKey: []byte("test-key")}
+	now := time.Now()
+	inv := &model.Invitation{ID: 42, TokenVersion: 3, ExpiresAt: now.Add(time.Hour)}
+
+	t.Run("round trip", func(t *testing.T) {
+		id, version, err := s.parseToken(s.signToken(inv), now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id != 42 || version != 3 {
+			t.Errorf("expected id 42 version 3, got id %d version %d", id, version)
+		}
+	})
+
+	t.Run("rejects tokens signed with another key", func(t *testing.T) {
+		other := &InvitationService{signingKey: []byte("other-key")}
+		if _, _, err := s.parseToken(other.signToken(inv), now); !errors.Is(err, ErrInvalidInviteToken) {
+			t.Errorf("expected ErrInvalidInviteToken, got %v", err)
+		}
+	})
+
+	t.Run("rejects expired tokens", func(t *testing.T) {
+		if _, _, err := s.parseToken(s.signToken(inv), now.Add(2*time.Hour)); !errors.Is(err, ErrInvalidInviteToken) {
+			t.Errorf("expected ErrInvalidInviteToken, got %v", err)
+		}
+	})
+
+	t.Run("rejects malformed tokens", func(t *testing.T) {
+		for _, token := range []string{"", "abc", "abc.def", "."} {
+			if _, _, err := s.parseToken(token, now); !errors.Is(err, ErrInvalidInviteToken) {
+				t.Errorf("token %q: expected ErrInvalidInviteToken, got %v", token, err)
+			}
+		}
+	})
+}
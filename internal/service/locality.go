@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/locality"
+)
+
+var (
+	// ErrInvalidTimezone is returned for time zones that are not IANA names
+	ErrInvalidTimezone = errors.New("timezone must be an IANA time zone name")
+	// ErrInvalidLocale is returned for locales that are not BCP 47 tags
+	ErrInvalidLocale = errors.New("locale must be a BCP 47 language tag")
+)
+
+// normalizeLocality validates a time zone and a locale, either of which may
+// be empty for unknown, and returns the locale in canonical form
+func normalizeLocality(timezone, locale string) (string, string, error) {
+	if timezone != "" && !locality.ValidTimezone(timezone) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidTimezone, timezone)
+	}
+	if locale != "" {
+		canonical, ok := locality.CanonicalLocale(locale)
+		if !ok {
+			return "", "", fmt.Errorf("%w: %q", ErrInvalidLocale, locale)
+		}
+		locale = canonical
+	}
+	return timezone, locale, nil
+}
+
+// fillLocality gives the user the time zone and locale it lacks from the
+// given defaults, e.g. those of an organization it joined. Users with both
+// set, and empty defaults, are left unchanged.
+func (s *UserService) fillLocality(ctx context.Context, id int64, timezone, locale string) error {
+	if timezone == "" && locale == "" {
+		return nil
+	}
+
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	changed := false
+	if user.Timezone == "" && timezone != "" {
+		user.Timezone, changed = timezone, true
+	}
+	if user.Locale == "" && locale != "" {
+		user.Locale, changed = locale, true
+	}
+	if !changed {
+		return nil
+	}
+	user.UpdatedAt = s.clock.Now()
+
+	err = s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		if err := s.repo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", id), "users:list")
+		fx.raise(events.Event{Type: events.UserUpdated, UserID: user.ID, User: user})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("user locality defaulted",
+		slog.Int64("user_id", id),
+		slog.String("timezone", user.Timezone),
+		slog.String("locale", user.Locale))
+
+	return nil
+}
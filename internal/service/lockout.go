@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+)
+
+var (
+	// ErrAccountLocked is returned when authenticating to an account locked
+	// after too many failed attempts
+	ErrAccountLocked = errors.New("account locked after too many failed attempts")
+	// ErrTooManyAttempts is returned when authenticating again too soon
+	// after failed attempts
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+)
+
+// ThrottledError refuses an authentication attempt for RetryAfter. It
+// wraps ErrAccountLocked or ErrTooManyAttempts.
+type ThrottledError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// LockoutPolicy limits failed authentications per user
+type LockoutPolicy struct {
+	// MaxFailures locks an account once that many attempts failed within
+	// Window; zero disables locking
+	MaxFailures int
+	Window      time.Duration
+	// Duration is how long an account stays locked
+	Duration time.Duration
+	// BaseDelay is how long to wait after a failed attempt, doubled with
+	// each further failure within Window up to MaxDelay; zero disables the
+	// backoff
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// backoff returns how long to wait after failures failed attempts
+func (p LockoutPolicy) backoff(failures int64) time.Duration {
+	if p.BaseDelay <= 0 || failures <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := int64(1); i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// lockoutStore keeps the failed attempts and locks; *cache.Redis in
+// production
+type lockoutStore interface {
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	CountWindow(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+	AddToWindow(ctx context.Context, key string, window time.Duration) (int64, error)
+	SetExact(ctx context.Context, key string, value string, expiration time.Duration) error
+	Delete(ctx context.Context, key string) error
+	DeleteMany(ctx context.Context, keys ...string) error
+}
+
+// Lockout tracks failed authentications per account in Redis, shared by
+// all instances, to slow down and stop credential stuffing. Accounts are
+// identified by their login email, whether a user has it or not, so that
+// throttling does not tell which emails are registered. Attempts are
+// admitted when Redis fails.
+type Lockout struct {
+	store  lockoutStore
+	policy LockoutPolicy
+	// onLock is called when the account of a user gets locked
+	onLock func(ctx context.Context, userID int64)
+}
+
+// NewLockout creates a Lockout enforcing policy. onLock, when not nil, is
+// called whenever the account of an existing user gets locked.
+func NewLockout(cache *cache.Redis, policy LockoutPolicy, onLock func(ctx context.Context, userID int64)) *Lockout {
+	return &Lockout{store: cache, policy: policy, onLock: onLock}
+}
+
+// lockoutAccount returns the account the lockout tracks for a stored email.
+// Emails are hashed so that Redis keys carry no personal data.
+func lockoutAccount(storedEmail string) string {
+	sum := sha256.Sum256([]byte(storedEmail))
+	return hex.EncodeToString(sum[:16])
+}
+
+func lockedKey(account string) string {
+	return "auth:locked:" + account
+}
+
+func failuresKey(account string) string {
+	return "auth:failures:" + account
+}
+
+// Check returns a *ThrottledError when the account may not attempt to
+// authenticate now
+func (l *Lockout) Check(ctx context.Context, account string) error {
+	locked, err := l.store.TTL(ctx, lockedKey(account))
+	if err != nil {
+		l.unavailable(account, err)
+		return nil
+	}
+	if locked > 0 {
+		return &ThrottledError{Err: ErrAccountLocked, RetryAfter: locked}
+	}
+
+	if l.policy.BaseDelay <= 0 {
+		return nil
+	}
+	failures, since, err := l.store.CountWindow(ctx, failuresKey(account), l.policy.Window)
+	if err != nil {
+		l.unavailable(account, err)
+		return nil
+	}
+	if wait := l.policy.backoff(failures) - since; wait > 0 {
+		return &ThrottledError{Err: ErrTooManyAttempts, RetryAfter: wait}
+	}
+	return nil
+}
+
+// Fail records a failed attempt, locking the account when it reaches the
+// maximum. It returns a *ThrottledError when the account got locked.
+// userID is the user owning the account, or 0 when there is none.
+func (l *Lockout) Fail(ctx context.Context, account string, userID int64) error {
+	failures, err := l.store.AddToWindow(ctx, failuresKey(account), l.policy.Window)
+	if err != nil {
+		l.unavailable(account, err)
+		return nil
+	}
+	if l.policy.MaxFailures <= 0 || failures < int64(l.policy.MaxFailures) {
+		return nil
+	}
+
+	if err := l.store.SetExact(ctx, lockedKey(account), "1", l.policy.Duration); err != nil {
+		l.unavailable(account, err)
+		return nil
+	}
+	if err := l.store.Delete(ctx, failuresKey(account)); err != nil {
+		slog.Warn("failed to reset failed attempts", slog.String("account", account), slog.String("error", err.Error()))
+	}
+
+	slog.Warn("account locked",
+		slog.String("account", account),
+		slog.Int64("user_id", userID),
+		slog.Int64("failures", failures),
+		slog.Duration("duration", l.policy.Duration))
+	if l.onLock != nil && userID != 0 {
+		l.onLock(ctx, userID)
+	}
+	return &ThrottledError{Err: ErrAccountLocked, RetryAfter: l.policy.Duration}
+}
+
+// Succeed forgets the failed attempts of an account that authenticated
+func (l *Lockout) Succeed(ctx context.Context, account string) {
+	if err := l.store.Delete(ctx, failuresKey(account)); err != nil {
+		slog.Warn("failed to reset failed attempts", slog.String("account", account), slog.String("error", err.Error()))
+	}
+}
+
+// Unlock lifts the lock of an account and forgets its failed attempts
+func (l *Lockout) Unlock(ctx context.Context, account string) error {
+	if err := l.store.DeleteMany(ctx, lockedKey(account), failuresKey(account)); err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	slog.Info("account unlocked", slog.String("account", account))
+	return nil
+}
+
+func (l *Lockout) unavailable(account string, err error) {
+	slog.Warn("account lockout unavailable, admitting attempt",
+		slog.String("account", account),
+		slog.String("error", err.Error()))
+}
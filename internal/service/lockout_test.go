@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// memoryLockoutStore keeps lockout state in memory on a fake clock
+type memoryLockoutStore struct {
+	clock   *clock.Fake
+	expires map[string]time.Time
+	events  map[string][]time.Time
+}
+
+func newMemoryLockoutStore(clk *clock.Fake) *memoryLockoutStore {
+	return &memoryLockoutStore{clock: clk, expires: map[string]time.Time{}, events: map[string][]time.Time{}}
+}
+
+func (m *memoryLockoutStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	return max(m.expires[key].Sub(m.clock.Now()), 0), nil
+}
+
+func (m *memoryLockoutStore) window(key string, window time.Duration) []time.Time {
+	var kept []time.Time
+	for _, at := range m.events[key] {
+		if m.clock.Now().Sub(at) < window {
+			kept = append(kept, at)
+		}
+	}
+	m.events[key] = kept
+	return kept
+}
+
+func (m *memoryLockoutStore) CountWindow(_ context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	events := m.window(key, window)
+	if len(events) == 0 {
+		return 0, 0, nil
+	}
+	return int64(len(events)), m.clock.Now().Sub(events[len(events)-1]), nil
+}
+
+func (m *memoryLockoutStore) AddToWindow(_ context.Context, key string, window time.Duration) (int64, error) {
+	m.events[key] = append(m.window(key, window), m.clock.Now())
+	return int64(len(m.events[key])), nil
+}
+
+func (m *memoryLockoutStore) SetExact(_ context.Context, key, _ string, expiration time.Duration) error {
+	m.expires[key] = m.clock.Now().Add(expiration)
+	return nil
+}
+
+func (m *memoryLockoutStore) Delete(ctx context.Context, key string) error {
+	return m.DeleteMany(ctx, key)
+}
+
+func (m *memoryLockoutStore) DeleteMany(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(m.expires, key)
+		delete(m.events, key)
+	}
+	return nil
+}
+
+func TestLockoutPolicy(t *testing.T) {
+	p := LockoutPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	t.Run("doubles the delay with each failure up to the maximum", func(t *testing.T) {
+		for failures, want := range map[int64]time.Duration{0: 0, 1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 100: 10 * time.Second} {
+			if got := p.backoff(failures); got != want {
+				t.Errorf("backoff(%d) = %s, want %s", failures, got, want)
+			}
+		}
+	})
+
+	t.Run("throttled errors match their cause", func(t *testing.T) {
+		err := error(&ThrottledError{Err: ErrAccountLocked, RetryAfter: time.Minute})
+		if !errors.Is(err, ErrAccountLocked) || errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("unexpected match for %v", err)
+		}
+	})
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	policy := LockoutPolicy{MaxFailures: 3, Window: 15 * time.Minute, Duration: 30 * time.Minute, BaseDelay: time.Second, MaxDelay: time.Minute}
+	newLockout := func() (*Lockout, *clock.Fake, *[]int64) {
+		clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		var locked []int64
+		l := &Lockout{store: newMemoryLockoutStore(clk), policy: policy, onLock: func(_ context.Context, userID int64) {
+			locked = append(locked, userID)
+		}}
+		return l, clk, &locked
+	}
+	account := lockoutAccount("jane@example.com")
+
+	t.Run("backs off longer after each failure", func(t *testing.T) {
+		l, clk, _ := newLockout()
+		for failures, wait := range []time.Duration{time.Second, 2 * time.Second} {
+			if err := l.Fail(ctx, account, 7); err != nil {
+				t.Fatalf("failure %d: unexpected error: %v", failures+1, err)
+			}
+			var throttled *ThrottledError
+			if err := l.Check(ctx, account); !errors.As(err, &throttled) || !errors.Is(err, ErrTooManyAttempts) || throttled.RetryAfter != wait {
+				t.Fatalf("failure %d: expected a wait of %s, got %v", failures+1, wait, err)
+			}
+			clk.Advance(wait)
+			if err := l.Check(ctx, account); err != nil {
+				t.Fatalf("failure %d: expected the attempt after the wait to be admitted, got %v", failures+1, err)
+			}
+		}
+	})
+
+	t.Run("locks after the maximum failures", func(t *testing.T) {
+		l, clk, locked := newLockout()
+		for i := 0; i < policy.MaxFailures-1; i++ {
+			if err := l.Fail(ctx, account, 7); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := l.Fail(ctx, account, 7); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("expected the account to get locked, got %v", err)
+		}
+		if len(*locked) != 1 || (*locked)[0] != 7 {
+			t.Errorf("expected the lock of user 7 to be reported, got %v", *locked)
+		}
+
+		clk.Advance(policy.Duration - time.Second)
+		if err := l.Check(ctx, account); !errors.Is(err, ErrAccountLocked) {
+			t.Errorf("expected the account to stay locked, got %v", err)
+		}
+		clk.Advance(time.Second)
+		if err := l.Check(ctx, account); err != nil {
+			t.Errorf("expected the lock to expire, got %v", err)
+		}
+	})
+
+	t.Run("locks unknown accounts alike without reporting them", func(t *testing.T) {
+		l, _, locked := newLockout()
+		unknown := lockoutAccount("nobody@example.com")
+		var err error
+		for i := 0; i < policy.MaxFailures; i++ {
+			err = l.Fail(ctx, unknown, 0)
+		}
+		if !errors.Is(err, ErrAccountLocked) || !errors.Is(l.Check(ctx, unknown), ErrAccountLocked) {
+			t.Errorf("expected the unknown account to get locked, got %v", err)
+		}
+		if len(*locked) != 0 {
+			t.Errorf("expected no lock to be reported, got %v", *locked)
+		}
+	})
+
+	t.Run("success and unlock reset the account", func(t *testing.T) {
+		l, _, _ := newLockout()
+		_ = l.Fail(ctx, account, 7)
+		l.Succeed(ctx, account)
+		if err := l.Check(ctx, account); err != nil {
+			t.Errorf("expected success to forget failures, got %v", err)
+		}
+
+		for i := 0; i < policy.MaxFailures; i++ {
+			_ = l.Fail(ctx, account, 7)
+		}
+		if err := l.Unlock(ctx, account); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := l.Check(ctx, account); err != nil {
+			t.Errorf("expected the account to be unlocked, got %v", err)
+		}
+	})
+}
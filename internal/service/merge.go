@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+var (
+	// ErrMergeSameUser is returned when merging a user into itself
+	ErrMergeSameUser = errors.New("cannot merge a user into itself")
+	// ErrMergeUserNotFound is returned when either user of a merge does not
+	// exist or is deleted
+	ErrMergeUserNotFound = errors.New("source or target user not found")
+	// ErrMetadataConflict is returned when both users of a merge set a
+	// metadata key to different values and conflicts must fail the merge
+	ErrMetadataConflict = errors.New("users have conflicting metadata")
+)
+
+// MetadataConflict decides how a merge resolves a metadata key set to
+// different values on both users
+type MetadataConflict int
+
+const (
+	// MetadataKeepTarget keeps the value of the target
+	MetadataKeepTarget MetadataConflict = iota
+	// MetadataPreferSource takes the value of the source
+	MetadataPreferSource
+	// MetadataFail fails the merge with ErrMetadataConflict
+	MetadataFail
+)
+
+// MergeUsers folds the duplicate account sourceID into targetID and returns
+// the merged target. The target keeps its email and name; it gains the
+// metadata keys, time zone and locale it lacks from the source, and the
+// source's organization memberships, accepted invitations and audit trail.
+// The source is deleted for good: it can be purged but not restored.
+func (s *UserService) MergeUsers(ctx context.Context, sourceID, targetID int64, conflict MetadataConflict) (*model.User, error) {
+	if sourceID == targetID {
+		return nil, ErrMergeSameUser
+	}
+
+	source, err := s.repo.GetByID(ctx, sourceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMergeUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source user: %w", err)
+	}
+	target, err := s.repo.GetByID(ctx, targetID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMergeUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target user: %w", err)
+	}
+
+	if target.Metadata, err = mergeUserMetadata(target.Metadata, source.Metadata, conflict); err != nil {
+		return nil, err
+	}
+	if target.Timezone == "" {
+		target.Timezone = source.Timezone
+	}
+	if target.Locale == "" {
+		target.Locale = source.Locale
+	}
+	target.UpdatedAt = s.clock.Now()
+
+	err = s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		err := s.repo.Merge(ctx, sourceID, target)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMergeUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to merge users: %w", err)
+		}
+		fx.invalidate(
+			fmt.Sprintf("user:%d", sourceID), fmt.Sprintf("user:%d", targetID), "users:list",
+			existsKey(sourceID), emailKey(source.Email),
+		)
+		fx.raise(events.Event{Type: events.UserMerged, UserID: sourceID, MergedInto: targetID})
+		fx.raise(events.Event{Type: events.UserUpdated, UserID: targetID, User: target})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Warn("users merged",
+		slog.Int64("source_id", sourceID),
+		slog.Int64("target_id", targetID),
+		slog.String("merged_by", auth.Subject(ctx)))
+
+	return s.revealUser(ctx, target)
+}
+
+// mergeUserMetadata returns the metadata of a merged user: the keys of
+// target, plus those of source it lacks, with keys set on both resolved by
+// conflict
+func mergeUserMetadata(target, source map[string]string, conflict MetadataConflict) (map[string]string, error) {
+	patch := make(map[string]string, len(source))
+	var conflicting []string
+	for key, value := range source {
+		current, ok := target[key]
+		switch {
+		case !ok:
+			patch[key] = value
+		case current == value:
+		case conflict == MetadataPreferSource:
+			patch[key] = value
+		case conflict == MetadataFail:
+			conflicting = append(conflicting, key)
+		}
+	}
+	if len(conflicting) > 0 {
+		slices.Sort(conflicting)
+		return nil, fmt.Errorf("%w: %s", ErrMetadataConflict, strings.Join(conflicting, ", "))
+	}
+	return mergeMetadata(target, patch)
+}
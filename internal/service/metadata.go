@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+)
+
+const (
+	// maxMetadataKeys caps the metadata attributes of a user
+	maxMetadataKeys = 64
+	// maxMetadataValueLen caps the length of a metadata value in bytes
+	maxMetadataValueLen = 512
+)
+
+// ErrInvalidMetadata is returned for metadata breaking the key or size rules
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// metadataKeyPattern restricts keys to short identifiers such as
+// "billing.plan" or "crm/account-id"
+var metadataKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-/]{0,62}$`)
+
+// mergeMetadata applies patch to current and returns the result without
+// modifying either: keys with an empty value are removed, other keys are
+// set, and keys absent from patch are kept
+func mergeMetadata(current, patch map[string]string) (map[string]string, error) {
+	merged := maps.Clone(current)
+	if merged == nil {
+		merged = make(map[string]string, len(patch))
+	}
+
+	for key, value := range patch {
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%w: key %q must be 1 to 63 letters, digits or _.-/", ErrInvalidMetadata, key)
+		}
+		if len(value) > maxMetadataValueLen {
+			return nil, fmt.Errorf("%w: value of %q exceeds %d bytes", ErrInvalidMetadata, key, maxMetadataValueLen)
+		}
+		if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	if len(merged) > maxMetadataKeys {
+		return nil, fmt.Errorf("%w: at most %d keys", ErrInvalidMetadata, maxMetadataKeys)
+	}
+	return merged, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	t.Run("sets, keeps and removes keys", func(t *testing.T) {
+		current := map[string]string{"plan": "free", "team": "a", "region": "eu"}
+		merged, err := mergeMetadata(current, map[string]string{"plan": "pro", "team": ""})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := map[string]string{"plan": "pro", "region": "eu"}
+		if !maps.Equal(merged, want) {
+			t.Errorf("expected %v, got %v", want, merged)
+		}
+		if current["plan"] != "free" {
+			t.Error("current metadata was modified")
+		}
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		for _, key := range []string{"", "has space", ".leading", strings.Repeat("k", 64)} {
+			if _, err := mergeMetadata(nil, map[string]string{key: "v"}); !errors.Is(err, ErrInvalidMetadata) {
+				t.Errorf("expected ErrInvalidMetadata for %q, got %v", key, err)
+			}
+		}
+	})
+
+	t.Run("rejects long values", func(t *testing.T) {
+		_, err := mergeMetadata(nil, map[string]string{"k": strings.Repeat("v", maxMetadataValueLen+1)})
+		if !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("expected ErrInvalidMetadata, got %v", err)
+		}
+	})
+}
+
+func TestMergeUserMetadata(t *testing.T) {
+	target := map[string]string{"plan": "pro", "team": "a"}
+	source := map[string]string{"plan": "free", "team": "a", "crm/id": "42"}
+
+	t.Run("keeps target values", func(t *testing.T) {
+		merged, err := mergeUserMetadata(target, source, MetadataKeepTarget)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := map[string]string{"plan": "pro", "team": "a", "crm/id": "42"}
+		if !maps.Equal(merged, want) {
+			t.Errorf("expected %v, got %v", want, merged)
+		}
+	})
+
+	t.Run("prefers source values", func(t *testing.T) {
+		merged, err := mergeUserMetadata(target, source, MetadataPreferSource)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged["plan"] != "free" || target["plan"] != "pro" {
+			t.Errorf("expected the source plan without modifying the target, got %v", merged)
+		}
+	})
+
+	t.Run("fails on conflicts only", func(t *testing.T) {
+		_, err := mergeUserMetadata(target, source, MetadataFail)
+		if !errors.Is(err, ErrMetadataConflict) || !strings.Contains(err.Error(), "plan") || strings.Contains(err.Error(), "team") {
+			t.Errorf("expected a conflict on plan alone, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+var (
+	// ErrOrganizationNotFound is returned for unknown organizations
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrInvalidSlug is returned for slugs that are not lowercase DNS labels
+	ErrInvalidSlug = errors.New("slug must be 1-63 lowercase letters, digits or dashes")
+	// ErrSlugTaken is returned when another organization uses the slug
+	ErrSlugTaken = errors.New("slug already in use")
+	// ErrInvalidRole is returned for unknown membership roles
+	ErrInvalidRole = errors.New("invalid organization role")
+	// ErrMembershipNotFound is returned when the user is not a member
+	ErrMembershipNotFound = errors.New("user is not a member of the organization")
+	// ErrMemberNotFound is returned when adding a user or organization that does not exist
+	ErrMemberNotFound = errors.New("organization or user not found")
+)
+
+// foreignKeyViolation is the Postgres error code for foreign key violations
+const foreignKeyViolation = "23503"
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// OrganizationService handles organizations and their memberships
+type OrganizationService struct {
+	repo  *repository.OrganizationRepository
+	users *UserService
+}
+
+// NewOrganizationService creates a new OrganizationService instance
+func NewOrganizationService(repo *repository.OrganizationRepository, users *UserService) *OrganizationService {
+	return &OrganizationService{
+		repo:  repo,
+		users: users,
+	}
+}
+
+// CreateOrganization creates a new organization
+func (s *OrganizationService) CreateOrganization(ctx context.Context, name, slug, defaultTimezone, defaultLocale string) (*model.Organization, error) {
+	if !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidSlug
+	}
+	defaultTimezone, defaultLocale, err := normalizeLocality(defaultTimezone, defaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	org := &model.Organization{
+		Name:            name,
+		Slug:            slug,
+		DefaultTimezone: defaultTimezone,
+		DefaultLocale:   defaultLocale,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	if err := s.repo.Create(ctx, org); err != nil {
+		return nil, mapOrganizationError(err)
+	}
+
+	slog.Info("organization created",
+		slog.Int64("organization_id", org.ID),
+		slog.String("slug", org.Slug))
+
+	return org, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *OrganizationService) GetOrganization(ctx context.Context, id int64) (*model.Organization, error) {
+	org, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapOrganizationError(err)
+	}
+
+	return org, nil
+}
+
+// ListOrganizations lists organizations with pagination
+func (s *OrganizationService) ListOrganizations(ctx context.Context, page, pageSize int) ([]*model.Organization, int, error) {
+	offset := pagination.Offset(page, pageSize)
+
+	orgs, err := s.repo.List(ctx, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	total, err := s.repo.Count(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count organizations: %w", err)
+	}
+
+	return orgs, total, nil
+}
+
+// UpdateOrganization updates the name and slug of an organization
+func (s *OrganizationService) UpdateOrganization(ctx context.Context, id int64, name, slug, defaultTimezone, defaultLocale string) (*model.Organization, error) {
+	if !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidSlug
+	}
+	defaultTimezone, defaultLocale, err := normalizeLocality(defaultTimezone, defaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapOrganizationError(err)
+	}
+
+	org.Name = name
+	org.Slug = slug
+	org.DefaultTimezone = defaultTimezone
+	org.DefaultLocale = defaultLocale
+	org.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, org); err != nil {
+		return nil, mapOrganizationError(err)
+	}
+
+	slog.Info("organization updated", slog.Int64("organization_id", org.ID))
+
+	return org, nil
+}
+
+// DeleteOrganization deletes an organization and its memberships. Member
+// users are not deleted.
+func (s *OrganizationService) DeleteOrganization(ctx context.Context, id int64) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	slog.Info("organization deleted", slog.Int64("organization_id", id))
+
+	return nil
+}
+
+// AddMember adds a user to an organization with the given role, or changes
+// the role of an existing member. The user takes the organization's default
+// time zone and locale when it has none.
+func (s *OrganizationService) AddMember(ctx context.Context, orgID, userID int64, role model.OrgRole) (*model.Membership, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	m := &model.Membership{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Role:           role,
+	}
+	if err := s.repo.UpsertMember(ctx, m); err != nil {
+		return nil, mapOrganizationError(err)
+	}
+
+	org, err := s.repo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, mapOrganizationError(err)
+	}
+	if err := s.users.fillLocality(ctx, userID, org.DefaultTimezone, org.DefaultLocale); err != nil {
+		return nil, fmt.Errorf("failed to apply organization defaults: %w", err)
+	}
+
+	slog.Info("organization member added",
+		slog.Int64("organization_id", orgID),
+		slog.Int64("user_id", userID),
+		slog.String("role", string(role)))
+
+	return m, nil
+}
+
+// RemoveMember removes a user from an organization
+func (s *OrganizationService) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	removed, err := s.repo.RemoveMember(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrMembershipNotFound
+	}
+
+	slog.Info("organization member removed",
+		slog.Int64("organization_id", orgID),
+		slog.Int64("user_id", userID))
+
+	return nil
+}
+
+// ListMembers lists the memberships of an organization with pagination
+func (s *OrganizationService) ListMembers(ctx context.Context, orgID int64, page, pageSize int) ([]*model.Membership, int, error) {
+	offset := pagination.Offset(page, pageSize)
+
+	members, err := s.repo.ListMembers(ctx, orgID, pageSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.repo.CountMembers(ctx, orgID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return members, total, nil
+}
+
+// ListUsers lists the users that are members of an organization
+func (s *OrganizationService) ListUsers(ctx context.Context, orgID int64, page, pageSize int) ([]*model.User, int, error) {
+	offset := pagination.Offset(page, pageSize)
+
+	users, err := s.users.repo.ListByOrganization(ctx, orgID, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	total, err := s.users.repo.CountByOrganization(ctx, orgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	users, err = s.users.revealUsers(ctx, users)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+func mapOrganizationError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrOrganizationNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return ErrSlugTaken
+	case errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation:
+		return ErrMemberNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+// ErrInvalidPageToken is returned for page tokens that were not issued by the service
+var ErrInvalidPageToken = pagination.ErrInvalidToken
+
+// userCursor returns the keyset position of user
+func userCursor(user *model.User) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+}
+
+// NextPageToken returns the token for the page after users, or an empty
+// string when a short page shows there are no more results
+func NextPageToken(users []*model.User, pageSize int) string {
+	return pagination.Next(users, pageSize, userCursor)
+}
+
+// ListUsersAfter lists the page of users following pageToken using keyset
+// pagination, optionally restricted to an organization. Unlike offset
+// pagination its cost does not grow with the page number.
+func (s *UserService) ListUsersAfter(ctx context.Context, orgID int64, pageToken string, pageSize int) ([]*model.User, string, error) {
+	cursor, err := pagination.Decode(pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	users, err := s.repo.ListAfter(ctx, orgID, cursor, pageSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list users: %w", err)
+	}
+
+	next := NextPageToken(users, pageSize)
+
+	users, err = s.revealUsers(ctx, users)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, next, nil
+}
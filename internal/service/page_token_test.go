@@ -0,0 +1,26 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+func TestNextPageToken(t *testing.T) {
+	createdAt := time.Date(2023, 12, 1, 10, 30, 0, 123456000, time.UTC)
+	users := []*model.User{{ID: 8}, {ID: 7, CreatedAt: createdAt}}
+
+	if token := NextPageToken(users, 3); token != "" {
+		t.Errorf("expected empty token after a short page, got %q", token)
+	}
+
+	cursor, err := pagination.Decode(NextPageToken(users, 2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cursor.ID != 7 || !cursor.CreatedAt.Equal(createdAt) {
+		t.Errorf("expected cursor at the last user, got (%v, %d)", cursor.CreatedAt, cursor.ID)
+	}
+}
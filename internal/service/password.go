@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/passwd"
+)
+
+var (
+	// ErrInvalidCredentials is returned when authenticating with an unknown
+	// email, a user without a password or a wrong password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrWeakPassword is returned when setting a password that is too short
+	ErrWeakPassword = errors.New("password too short")
+	// ErrPasswordChangeNotAllowed is returned when a caller other than the
+	// user or an admin sets a user's password
+	ErrPasswordChangeNotAllowed = errors.New("only the user or an admin may set the password")
+	// ErrWrongPassword is returned when setting a password with a wrong
+	// current password
+	ErrWrongPassword = errors.New("current password is wrong")
+)
+
+// PasswordService manages user passwords and authenticates users with them
+type PasswordService struct {
+	users     *UserService
+	hasher    *passwd.Hasher
+	minLength int
+	// lockout throttles failed attempts; nil when disabled
+	lockout *Lockout
+	// absent is verified against when the user has no password, so that
+	// unknown emails take as long to reject as wrong passwords
+	absent string
+}
+
+// NewPasswordService creates a new PasswordService instance. Passwords
+// shorter than minLength characters are rejected. Failed attempts are
+// throttled by lockout unless it is nil.
+func NewPasswordService(users *UserService, hasher *passwd.Hasher, minLength int, lockout *Lockout) (*PasswordService, error) {
+	absent, err := hasher.Hash("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create password service: %w", err)
+	}
+
+	return &PasswordService{
+		users:     users,
+		hasher:    hasher,
+		minLength: minLength,
+		lockout:   lockout,
+		absent:    absent,
+	}, nil
+}
+
+// SetPassword replaces the password of a user. Admins identified by a
+// credential verified here may set any password. Otherwise the caller must
+// be a session of the user and give the current password, unless the user
+// has none yet; wrong ones count as failed attempts of the lockout.
+func (s *PasswordService) SetPassword(ctx context.Context, userID int64, currentPassword, password string) error {
+	reset := adminReset(ctx)
+	if !reset {
+		if err := s.checkCurrent(ctx, userID, currentPassword); err != nil {
+			return err
+		}
+	}
+
+	hash, err := s.hash(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.users.repo.SetPasswordHash(ctx, userID, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	if reset {
+		slog.Warn("password reset by admin",
+			slog.Int64("user_id", userID),
+			slog.String("reset_by", auth.Subject(ctx)))
+	} else {
+		slog.Info("password set", slog.Int64("user_id", userID))
+	}
+
+	return nil
+}
+
+// adminReset reports whether the caller may override the password of any
+// user: an admin holding an API key or access token. Roles asserted by a
+// proxy header are not enough to take over accounts.
+func adminReset(ctx context.Context) bool {
+	p, ok := auth.FromContext(ctx)
+	if !ok || (p.Method != "api_key" && p.Method != "access_token") {
+		return false
+	}
+	return auth.HasRole(ctx, auth.AdminRole)
+}
+
+// checkCurrent refuses to let the caller set the password of userID unless
+// it is the user, not impersonated, and gives the current password
+func (s *PasswordService) checkCurrent(ctx context.Context, userID int64, currentPassword string) error {
+	if auth.Subject(ctx) != SessionSubject(userID) || auth.Impersonator(ctx) != "" {
+		return ErrPasswordChangeNotAllowed
+	}
+
+	email, current, err := s.users.repo.GetPasswordHashByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if current == "" {
+		return nil
+	}
+
+	account := lockoutAccount(email)
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, account); err != nil {
+			return err
+		}
+	}
+	ok, _, err := s.hasher.Verify(currentPassword, current)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if !ok {
+		if s.lockout != nil {
+			if err := s.lockout.Fail(ctx, account, userID); err != nil {
+				return err
+			}
+		}
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// hash checks the strength of a new password and hashes it
+func (s *PasswordService) hash(password string) (string, error) {
+	if len([]rune(password)) < s.minLength {
+		return "", fmt.Errorf("%w: at least %d characters are required", ErrWeakPassword, s.minLength)
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return hash, nil
+}
+
+// Authenticate returns the user with the given email when password is
+// theirs. Hashes made with outdated parameters are replaced on success.
+// Attempts on accounts locked or backing off after failures are refused
+// with a *ThrottledError without checking the password. Failures are
+// throttled the same way for unknown emails and users without a password,
+// so the answers do not tell which emails are registered.
+func (s *PasswordService) Authenticate(ctx context.Context, email, password string) (*model.User, error) {
+	storedEmail, err := s.users.pii.Protect(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	account := lockoutAccount(storedEmail)
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, account); err != nil {
+			return nil, err
+		}
+	}
+
+	userID, hash, err := s.users.repo.GetPasswordHash(ctx, storedEmail)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	var ok, rehash bool
+	if hash == "" {
+		s.hasher.Verify(password, s.absent)
+	} else if ok, rehash, err = s.hasher.Verify(password, hash); err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	if !ok {
+		slog.Info("authentication failed", slog.Int64("user_id", userID))
+		if s.lockout != nil {
+			if err := s.lockout.Fail(ctx, account, userID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if s.lockout != nil {
+		s.lockout.Succeed(ctx, account)
+	}
+
+	if rehash {
+		if hash, err := s.hasher.Hash(password); err == nil {
+			if err := s.users.repo.SetPasswordHash(ctx, userID, hash); err != nil {
+				slog.Warn("failed to rehash password",
+					slog.Int64("user_id", userID),
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+
+	return s.users.GetUser(ctx, userID)
+}
+
+// UnlockUser lifts the lockout of a user after failed authentications
+func (s *PasswordService) UnlockUser(ctx context.Context, userID int64) error {
+	if s.lockout == nil {
+		return nil
+	}
+	email, _, err := s.users.repo.GetPasswordHashByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+	return s.lockout.Unlock(ctx, lockoutAccount(email))
+}
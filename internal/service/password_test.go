@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+)
+
+func TestSetPassword(t *testing.T) {
+	s := &PasswordService{}
+
+	t.Run("refuses callers other than the user", func(t *testing.T) {
+		for name, ctx := range map[string]context.Context{
+			"no principal":  context.Background(),
+			"another user":  auth.NewContext(context.Background(), &auth.Principal{Subject: SessionSubject(8), Method: "access_token", Roles: []string{"user"}}),
+			"support role":  auth.NewContext(context.Background(), &auth.Principal{Subject: "support-tool", Roles: []string{"support"}}),
+			"impersonation": auth.NewContext(context.Background(), &auth.Principal{Subject: SessionSubject(7), Roles: []string{"user"}, Impersonator: "support-tool"}),
+			"header admin":  auth.NewContext(context.Background(), &auth.Principal{Subject: "gateway-admin", Method: "header", Roles: []string{auth.AdminRole}}),
+		} {
+			if err := s.SetPassword(ctx, 7, "", "correct horse battery"); !errors.Is(err, ErrPasswordChangeNotAllowed) {
+				t.Errorf("%s: expected ErrPasswordChangeNotAllowed, got %v", name, err)
+			}
+		}
+	})
+}
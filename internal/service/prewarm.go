@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+)
+
+// PrewarmCache refills the cache entries of each user created, updated or
+// restored on this instance as soon as the change is published, until ctx
+// is done or the publisher closes. Changes only evict entries otherwise, so
+// every replica reading the user next would miss and query the database.
+//
+// Entries are refilled one change at a time from the primary, through the
+// repository that hides deleted users, so the last fill of a user always
+// reads its last committed change. A fill that read the user just before
+// its deletion committed is evicted again when the deletion is handled,
+// after it. Changes dropped because the subscription fell behind are left
+// to the next read.
+func (s *UserService) PrewarmCache(ctx context.Context) error {
+	subscriber, ok := s.publisher.(events.Subscriber)
+	if !ok {
+		return errors.New("cache prewarming needs a publisher that can be subscribed to")
+	}
+
+	sub := subscriber.Subscribe(events.UserCreated, events.UserUpdated, events.UserRestored, events.UserDeleted, events.UserMerged)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if event.Replay {
+				continue
+			}
+			var err error
+			switch event.Type {
+			case events.UserDeleted, events.UserMerged:
+				err = s.cache.DeleteMany(ctx, fmt.Sprintf("user:%d", event.UserID))
+			default:
+				err = s.prewarm(ctx, event.UserID)
+			}
+			if err != nil {
+				slog.Warn("failed to prewarm cache",
+					slog.Int64("user_id", event.UserID),
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// prewarm caches the user id and its email mapping as GetUserByEmail does.
+// Users deleted since the change are skipped.
+func (s *UserService) prewarm(ctx context.Context, id int64) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to encode user: %w", err)
+	}
+	return s.cache.SetMany(ctx, map[string]string{
+		fmt.Sprintf("user:%d", id): string(data),
+		emailKey(user.Email):       strconv.FormatInt(id, 10),
+	}, 5*time.Minute)
+}
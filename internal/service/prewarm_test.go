@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+)
+
+func TestPrewarmCache(t *testing.T) {
+	t.Run("skips replays and stops with the bus", func(t *testing.T) {
+		bus := events.NewBus(10)
+		s := &UserService{publisher: bus}
+
+		done := make(chan error, 1)
+		go func() { done <- s.PrewarmCache(context.Background()) }()
+		for bus.Subscribers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// A replay reaching the repository would panic on the nil repo
+		if err := bus.Publish(context.Background(), events.Event{Type: events.UserUpdated, UserID: 1, Replay: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = bus.Close()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("prewarming did not stop")
+		}
+	})
+
+	t.Run("evicts deleted users", func(t *testing.T) {
+		bus := events.NewBus(10)
+		cache := NewMockCache()
+		cache.data["user:1"] = `{"id":1,"name":"Jane"}`
+		s := &UserService{publisher: bus, cache: cache}
+
+		done := make(chan error, 1)
+		go func() { done <- s.PrewarmCache(context.Background()) }()
+		for bus.Subscribers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := bus.Publish(context.Background(), events.Event{Type: events.UserDeleted, UserID: 1}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = bus.Close()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("prewarming did not stop")
+		}
+		if _, ok := cache.data["user:1"]; ok {
+			t.Error("expected the deleted user to be evicted")
+		}
+	})
+}
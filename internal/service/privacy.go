@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// exportHistoryPage is the number of history entries read at once when
+// exporting a user's data
+const exportHistoryPage = 1000
+
+// ErrPrivacyRequestNotAllowed is returned when a caller other than the user
+// or an admin exports or erases a user's data
+var ErrPrivacyRequestNotAllowed = errors.New("only the user or an admin may export or erase the user's data")
+
+// PrivacyService exports users' data and erases it on request, as data
+// protection laws such as the GDPR require. Erasures are queued and carried
+// out by RunErasures, so that they complete even when a step fails or the
+// instance stops half way.
+type PrivacyService struct {
+	users    *UserService
+	repo     *repository.PrivacyRepository
+	sessions *SessionService
+	// avatars is nil when no avatar storage is configured
+	avatars *AvatarService
+	clock   clock.Clock
+	// retryDelay is how long a failed or interrupted erasure waits before
+	// it is attempted again
+	retryDelay time.Duration
+}
+
+// NewPrivacyService creates a new PrivacyService instance
+func NewPrivacyService(users *UserService, repo *repository.PrivacyRepository, sessions *SessionService, avatars *AvatarService, clk clock.Clock, retryDelay time.Duration) *PrivacyService {
+	return &PrivacyService{
+		users:      users,
+		repo:       repo,
+		sessions:   sessions,
+		avatars:    avatars,
+		clock:      clk,
+		retryDelay: retryDelay,
+	}
+}
+
+// ExportUserData gathers everything stored about a user, deleted or not,
+// for the user or an admin. Emails are detokenized, as the export is meant
+// for the user it describes.
+func (s *PrivacyService) ExportUserData(ctx context.Context, userID int64) (*model.UserDataExport, error) {
+	if !subjectOrAdmin(ctx, userID) {
+		return nil, ErrPrivacyRequestNotAllowed
+	}
+
+	user, deletedAt, err := s.users.repo.GetStored(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+
+	export := &model.UserDataExport{User: user, DeletedAt: deletedAt, ExportedAt: s.clock.Now()}
+	if user.Email, err = s.users.pii.Detokenize(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+
+	for offset := 0; ; offset += exportHistoryPage {
+		entries, err := s.users.repo.History(ctx, userID, exportHistoryPage, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export user data: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Email, err = s.users.pii.Detokenize(ctx, entry.Email); err != nil {
+				return nil, fmt.Errorf("failed to export user data: %w", err)
+			}
+		}
+		export.History = append(export.History, entries...)
+		if len(entries) < exportHistoryPage {
+			break
+		}
+	}
+
+	if export.Memberships, err = s.repo.Memberships(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+	if export.Sessions, err = s.repo.Sessions(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+	if export.Invitations, err = s.repo.Invitations(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+	for _, inv := range export.Invitations {
+		if inv.Email, err = s.users.pii.Detokenize(ctx, inv.Email); err != nil {
+			return nil, fmt.Errorf("failed to export user data: %w", err)
+		}
+	}
+	if export.AuditEvents, err = s.repo.AuditEvents(ctx, userID, SessionSubject(userID)); err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+
+	slog.Info("user data exported",
+		slog.Int64("user_id", userID),
+		slog.String("exported_by", auth.Subject(ctx)))
+
+	return export, nil
+}
+
+// EraseUser queues the erasure of a user's personal data at the request of
+// the user or an admin, returning the pending erasure of the user if there
+// already is one
+func (s *PrivacyService) EraseUser(ctx context.Context, userID int64) (*model.ErasureRequest, error) {
+	if !subjectOrAdmin(ctx, userID) {
+		return nil, ErrPrivacyRequestNotAllowed
+	}
+
+	_, _, err := s.users.repo.GetStored(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase user: %w", err)
+	}
+
+	req, err := s.repo.Enqueue(ctx, userID, auth.Subject(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase user: %w", err)
+	}
+
+	slog.Warn("user erasure requested",
+		slog.Int64("user_id", userID),
+		slog.Int64("erasure_id", req.ID),
+		slog.String("requested_by", req.RequestedBy))
+
+	return req, nil
+}
+
+// RunErasures carries out the erasures due, one at a time, until none is
+// left. A failed erasure is retried after the retry delay.
+func (s *PrivacyService) RunErasures(ctx context.Context) error {
+	var errs []error
+	for ctx.Err() == nil {
+		req, err := s.repo.Claim(ctx, s.clock.Now(), s.retryDelay)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if req == nil {
+			break
+		}
+
+		if err := s.erase(ctx, req.UserID); err != nil {
+			slog.Error("user erasure failed",
+				slog.Int64("user_id", req.UserID),
+				slog.Int64("erasure_id", req.ID),
+				slog.Int("attempts", req.Attempts),
+				slog.String("error", err.Error()))
+			errs = append(errs, err)
+			if err := s.repo.Fail(ctx, req.ID, err.Error(), s.clock.Now().Add(s.retryDelay)); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if err := s.repo.Complete(ctx, req.ID, s.clock.Now()); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		slog.Warn("user erased",
+			slog.Int64("user_id", req.UserID),
+			slog.Int64("erasure_id", req.ID))
+	}
+	return errors.Join(errs...)
+}
+
+// erase removes the personal data of a user: its avatar, its sessions, the
+// fields of the user and its history, and the copies in invitations and
+// audit events. Every step can run again, so an erasure that failed half
+// way is completed by erasing again.
+func (s *PrivacyService) erase(ctx context.Context, userID int64) error {
+	if s.avatars != nil {
+		if err := s.avatars.Delete(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.sessions.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	email, err := s.users.pii.Protect(ctx, erasedEmail(userID))
+	if err != nil {
+		return fmt.Errorf("failed to erase user: %w", err)
+	}
+	if err := s.users.anonymize(ctx, userID, email); err != nil {
+		return err
+	}
+
+	return s.repo.EraseRelated(ctx, userID, email)
+}
+
+// erasedEmail is the email an erased user is left with. It is unique per
+// user and under a reserved domain, so it can never be delivered to.
+func erasedEmail(userID int64) string {
+	return fmt.Sprintf("erased-%d@erased.invalid", userID)
+}
+
+// anonymize replaces the personal data of a user and soft-deletes it,
+// evicting its cached copies
+func (s *UserService) anonymize(ctx context.Context, id int64, email string) error {
+	stored, _, err := s.repo.GetStored(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Purged since the erasure was requested, so there is nothing left
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to erase user: %w", err)
+	}
+
+	return s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		deleted, err := s.repo.Anonymize(ctx, id, email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", id), "users:list", existsKey(id), emailKey(stored.Email))
+		if deleted {
+			fx.raise(events.Event{Type: events.UserDeleted, UserID: id})
+		}
+		return nil
+	})
+}
+
+// subjectOrAdmin reports whether the caller is userID itself, not
+// impersonated, or an admin
+func subjectOrAdmin(ctx context.Context, userID int64) bool {
+	if auth.HasRole(ctx, auth.AdminRole) {
+		return true
+	}
+	return auth.Subject(ctx) == SessionSubject(userID) && auth.Impersonator(ctx) == ""
+}
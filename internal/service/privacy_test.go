@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+)
+
+func TestPrivacyRequests(t *testing.T) {
+	s := &PrivacyService{}
+
+	t.Run("refuse callers other than the user or an admin", func(t *testing.T) {
+		for name, ctx := range map[string]context.Context{
+			"no principal":  context.Background(),
+			"another user":  auth.NewContext(context.Background(), &auth.Principal{Subject: SessionSubject(8), Method: "access_token", Roles: []string{"user"}}),
+			"support role":  auth.NewContext(context.Background(), &auth.Principal{Subject: "support-tool", Method: "api_key", Roles: []string{"support"}}),
+			"impersonation": auth.NewContext(context.Background(), &auth.Principal{Subject: SessionSubject(7), Roles: []string{"user"}, Impersonator: "support-tool"}),
+		} {
+			if _, err := s.ExportUserData(ctx, 7); !errors.Is(err, ErrPrivacyRequestNotAllowed) {
+				t.Errorf("%s: expected export to fail with ErrPrivacyRequestNotAllowed, got %v", name, err)
+			}
+			if _, err := s.EraseUser(ctx, 7); !errors.Is(err, ErrPrivacyRequestNotAllowed) {
+				t.Errorf("%s: expected erasure to fail with ErrPrivacyRequestNotAllowed, got %v", name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/captcha"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mail"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+)
+
+// ErrInvalidVerificationToken is returned for unknown, used or expired tokens
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// RegistrationService handles public self-registration. Users are only
+// created once they have proven control of their email address.
+type RegistrationService struct {
+	repo      *repository.RegistrationRepository
+	users     *UserService
+	verifier  captcha.Verifier
+	mailer    mail.Sender
+	tokenTTL  time.Duration
+	verifyURL string
+}
+
+// NewRegistrationService creates a new RegistrationService instance
+func NewRegistrationService(repo *repository.RegistrationRepository, users *UserService, verifier captcha.Verifier, mailer mail.Sender, tokenTTL time.Duration, verifyURL string) *RegistrationService {
+	return &RegistrationService{
+		repo:      repo,
+		users:     users,
+		verifier:  verifier,
+		mailer:    mailer,
+		tokenTTL:  tokenTTL,
+		verifyURL: verifyURL,
+	}
+}
+
+// Register checks the human-verification token and emails a verification
+// link. To avoid revealing which addresses have accounts, registering an
+// existing email succeeds and sends a notice instead of a link.
+func (s *RegistrationService) Register(ctx context.Context, email, name, captchaToken, remoteIP string) error {
+	if err := s.verifier.Verify(ctx, captchaToken, remoteIP); err != nil {
+		return err
+	}
+
+	storedEmail, err := s.users.pii.Protect(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to register user: %w", err)
+	}
+
+	_, err = s.users.repo.GetByEmail(ctx, storedEmail)
+	if err == nil {
+		slog.Info("registration for existing email", slog.String("email", storedEmail))
+		return s.mailer.Send(ctx, mail.Message{
+			To:      email,
+			Subject: "Your account already exists",
+			Body:    "Someone tried to register with this email address, which already has an account. If this was you, sign in instead.",
+		})
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to register user: %w", err)
+	}
+
+	token, tokenHash, err := newVerificationToken()
+	if err != nil {
+		return fmt.Errorf("failed to register user: %w", err)
+	}
+
+	reg := &model.PendingRegistration{
+		Email:     storedEmail,
+		Name:      name,
+		ExpiresAt: time.Now().Add(s.tokenTTL),
+	}
+	if err := s.repo.UpsertPending(ctx, reg, tokenHash); err != nil {
+		return fmt.Errorf("failed to register user: %w", err)
+	}
+
+	link := s.verifyURL + "?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nConfirm your email address to finish creating your account:\n\n%s\n\nThis link expires in %s.\n", name, link, s.tokenTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	slog.Info("registration pending verification",
+		slog.Int64("registration_id", reg.ID),
+		slog.String("email", storedEmail))
+
+	return nil
+}
+
+// VerifyEmail consumes a verification token and creates the registered user
+func (s *RegistrationService) VerifyEmail(ctx context.Context, token string) (*model.User, error) {
+	reg, err := s.repo.ConsumePending(ctx, hashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return s.users.create(ctx, reg.Email, reg.Name, nil, "", "")
+}
+
+// PruneExpired removes registrations whose verification link has expired
+func (s *RegistrationService) PruneExpired(ctx context.Context) error {
+	pruned, err := s.repo.PruneExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if pruned > 0 {
+		slog.Info("expired registrations pruned", slog.Int64("registrations", pruned))
+	}
+	return nil
+}
+
+// newVerificationToken returns a random URL-safe token and its hash. Only the
+// hash is stored so that a database leak does not expose usable tokens.
+func newVerificationToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/report"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+)
+
+// ErrReportNotFound is returned for reports that do not exist
+var ErrReportNotFound = errors.New("report not found")
+
+// reportColumns are the columns of a user report, in order
+var reportColumns = []string{"id", "uuid", "email", "name", "timezone", "locale", "metadata", "created_at", "updated_at"}
+
+// ReportSettings tune how reports are generated and handed out
+type ReportSettings struct {
+	// ChunkSize is the number of users read at once
+	ChunkSize int
+	// RetryDelay is how long a failed or interrupted report waits before it
+	// is attempted again, up to MaxAttempts runs
+	RetryDelay  time.Duration
+	MaxAttempts int
+	// URLTTL is how long download URLs stay valid
+	URLTTL time.Duration
+}
+
+// ReportDownload is a temporary URL to download a completed report
+type ReportDownload struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+// ReportService generates spreadsheets of the users matching a filter, so
+// that support staff get exports without anyone running SQL. Reports are
+// queued and built by RunReports into object storage.
+type ReportService struct {
+	users    *UserService
+	repo     *repository.ReportRepository
+	store    storage.Store
+	clock    clock.Clock
+	settings ReportSettings
+}
+
+// NewReportService creates a new ReportService instance
+func NewReportService(users *UserService, repo *repository.ReportRepository, store storage.Store, clk clock.Clock, settings ReportSettings) *ReportService {
+	return &ReportService{users: users, repo: repo, store: store, clock: clk, settings: settings}
+}
+
+// GenerateUserReport queues a report of the users matching filter
+func (s *ReportService) GenerateUserReport(ctx context.Context, format report.Format, filter repository.UserFilter) (*model.UserReport, error) {
+	if format != report.CSV && format != report.XLSX {
+		return nil, report.ErrUnknownFormat
+	}
+	if err := s.users.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	rep, err := s.repo.Enqueue(ctx, string(format), filter, auth.Subject(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	slog.Info("user report requested",
+		slog.Int64("report_id", rep.ID),
+		slog.String("format", rep.Format),
+		slog.String("requested_by", rep.RequestedBy))
+
+	return rep, nil
+}
+
+// GetUserReport returns a report, with a download URL once it completed
+// when the store can sign one
+func (s *ReportService) GetUserReport(ctx context.Context, id int64) (*model.UserReport, *ReportDownload, error) {
+	rep, err := s.repo.Get(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get report: %w", err)
+	}
+
+	signer, ok := s.store.(storage.Signer)
+	if rep.Status != model.ReportStatusCompleted || !ok {
+		return rep, nil, nil
+	}
+	url, err := signer.SignedURL(rep.ObjectKey, s.settings.URLTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign report url: %w", err)
+	}
+	return rep, &ReportDownload{URL: url, ExpiresAt: s.clock.Now().Add(s.settings.URLTTL)}, nil
+}
+
+// RunReports builds the reports due, one at a time, until none is left. A
+// failed report is retried after the retry delay until it runs out of
+// attempts.
+func (s *ReportService) RunReports(ctx context.Context) error {
+	var errs []error
+	for ctx.Err() == nil {
+		rep, filter, err := s.repo.Claim(ctx, s.clock.Now(), s.settings.RetryDelay)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if rep == nil {
+			break
+		}
+
+		key, rows, err := s.build(ctx, rep, filter)
+		if err != nil {
+			slog.Error("user report failed",
+				slog.Int64("report_id", rep.ID),
+				slog.Int("attempts", rep.Attempts),
+				slog.String("error", err.Error()))
+			errs = append(errs, err)
+
+			// Invalid filters and oversized reports fail again on retry
+			var retryAt time.Time
+			permanent := errors.Is(err, report.ErrTooManyRows) || errors.Is(err, ErrEmailNotSearchable) || errors.Is(err, ErrMetadataNotSearchable)
+			if !permanent && rep.Attempts < s.settings.MaxAttempts {
+				retryAt = s.clock.Now().Add(s.settings.RetryDelay)
+			}
+			if err := s.repo.Fail(ctx, rep.ID, err.Error(), retryAt, s.clock.Now()); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if err := s.repo.Complete(ctx, rep.ID, key, rows, s.clock.Now()); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		slog.Info("user report completed",
+			slog.Int64("report_id", rep.ID),
+			slog.Int64("rows", rows))
+	}
+	return errors.Join(errs...)
+}
+
+// build writes a report to a temporary file and uploads it, returning its
+// object key and number of users
+func (s *ReportService) build(ctx context.Context, rep *model.UserReport, filter repository.UserFilter) (string, int64, error) {
+	file, err := os.CreateTemp("", "user-report-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w, err := report.NewWriter(report.Format(rep.Format), file)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := w.WriteRow(reportColumns...); err != nil {
+		return "", 0, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	var rows int64
+	err = s.users.StreamMatching(ctx, filter, s.settings.ChunkSize, func(users []*model.User) error {
+		for _, user := range users {
+			if err := w.WriteRow(reportRow(user)...); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+		}
+		rows += int64(len(users))
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if err := w.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, fmt.Errorf("failed to read report file: %w", err)
+	}
+	key := fmt.Sprintf("user-reports/%d.%s", rep.ID, rep.Format)
+	if err := s.store.Put(ctx, key, file); err != nil {
+		return "", 0, fmt.Errorf("failed to store report: %w", err)
+	}
+	return key, rows, nil
+}
+
+// reportRow is the row of a user in a report
+func reportRow(user *model.User) []string {
+	metadata := ""
+	if len(user.Metadata) > 0 {
+		// Marshaling a map of strings cannot fail
+		data, _ := json.Marshal(user.Metadata)
+		metadata = string(data)
+	}
+	return []string{
+		strconv.FormatInt(user.ID, 10),
+		user.UUID,
+		user.Email,
+		user.Name,
+		user.Timezone,
+		user.Locale,
+		metadata,
+		user.CreatedAt.UTC().Format(time.RFC3339),
+		user.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
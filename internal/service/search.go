@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+)
+
+var (
+	// ErrInvalidSortField is returned for sort fields outside the allowlist
+	ErrInvalidSortField = errors.New("invalid sort field, expected id, name, email, created_at or updated_at")
+	// ErrEmailNotSearchable is returned for email filters while emails are
+	// stored tokenized
+	ErrEmailNotSearchable = errors.New("email domain search is unavailable while emails are tokenized")
+	// ErrMetadataNotSearchable is returned for filters on the values of
+	// metadata keys encrypted at rest
+	ErrMetadataNotSearchable = errors.New("metadata value search is unavailable for encrypted keys")
+	// ErrInvalidCreatedRange is returned when the created_at range is empty
+	ErrInvalidCreatedRange = errors.New("created_after must be before created_before")
+)
+
+// SearchUsers lists the users matching filter in the requested order with
+// pagination. The sort field defaults to created_at.
+func (s *UserService) SearchUsers(ctx context.Context, filter repository.UserFilter, sort repository.UserSort, page, pageSize int) ([]*model.User, int, error) {
+	if sort.Field == "" {
+		sort.Field = "created_at"
+	}
+	if !repository.SortableField(sort.Field) {
+		return nil, 0, ErrInvalidSortField
+	}
+	if err := s.validateFilter(filter); err != nil {
+		return nil, 0, err
+	}
+
+	offset := pagination.Offset(page, pageSize)
+
+	users, total, err := s.repo.Search(ctx, filter, sort, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	users, err = s.revealUsers(ctx, users)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// CountUsers returns the number of users matching filter
+func (s *UserService) CountUsers(ctx context.Context, filter repository.UserFilter) (int, error) {
+	if err := s.validateFilter(filter); err != nil {
+		return 0, err
+	}
+
+	count, err := s.repo.CountMatching(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+func (s *UserService) validateFilter(filter repository.UserFilter) error {
+	if filter.EmailDomain != "" && !s.pii.Searchable() {
+		return ErrEmailNotSearchable
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return ErrInvalidCreatedRange
+	}
+	for key := range filter.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: invalid key %q", ErrInvalidMetadata, key)
+		}
+		if !s.repo.MetadataSearchable(key) {
+			return fmt.Errorf("%w: %q", ErrMetadataNotSearchable, key)
+		}
+	}
+	for _, key := range filter.MetadataKeys {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: invalid key %q", ErrInvalidMetadata, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+)
+
+func TestCountUsers(t *testing.T) {
+	s := &UserService{pii: pii.NewProtector(pii.Noop{}, nil)}
+
+	t.Run("rejects an empty created range", func(t *testing.T) {
+		now := time.Now()
+		filter := repository.UserFilter{CreatedAfter: now, CreatedBefore: now}
+		_, err := s.CountUsers(context.Background(), filter)
+		if !errors.Is(err, ErrInvalidCreatedRange) {
+			t.Errorf("expected ErrInvalidCreatedRange, got %v", err)
+		}
+	})
+
+	t.Run("rejects invalid metadata keys", func(t *testing.T) {
+		filter := repository.UserFilter{MetadataKeys: []string{"not a key"}}
+		_, err := s.CountUsers(context.Background(), filter)
+		if !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("expected ErrInvalidMetadata, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/token"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, replaced, revoked and
+	// expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrInvalidAccessToken is returned for access tokens that are malformed,
+	// expired or belong to a revoked session
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// ErrImpersonationNotAllowed is returned when a caller without the admin
+	// role, or an impersonating one, asks for an impersonation token
+	ErrImpersonationNotAllowed = errors.New("caller may not impersonate users")
+	// ErrImpersonatedUserNotFound is returned when impersonating a user
+	// that does not exist or is deleted
+	ErrImpersonatedUserNotFound = errors.New("no active user with this ID")
+)
+
+// refreshTokenPrefix starts every refresh token so leaked tokens are easy
+// to recognize
+const refreshTokenPrefix = "usr_"
+
+// sessionRoles are granted to users calling with an access token
+var sessionRoles = []string{"user"}
+
+// Impersonation is an access token acting as a user on behalf of a
+// support engineer
+type Impersonation struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// Tokens are the credentials of a session
+type Tokens struct {
+	Session      *model.Session
+	AccessToken  string
+	RefreshToken string
+	// AccessExpiresAt is when AccessToken must be refreshed
+	AccessExpiresAt time.Time
+}
+
+// SessionService logs users in with their password and keeps their
+// sessions alive. Access tokens are short-lived and verified without a
+// database query; revoking a session marks it in Redis until its last
+// access token expired.
+type SessionService struct {
+	repo       *repository.SessionRepository
+	passwords  *PasswordService
+	cache      *cache.Redis
+	signer     *token.Signer
+	clock      clock.Clock
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// impersonationTTL is how long impersonation tokens live
+	impersonationTTL time.Duration
+}
+
+// NewSessionService creates a new SessionService instance. Access tokens
+// live for accessTTL, sessions for refreshTTL after login, and
+// impersonation tokens for impersonationTTL.
+func NewSessionService(repo *repository.SessionRepository, passwords *PasswordService, cache *cache.Redis, signer *token.Signer, clk clock.Clock, accessTTL, refreshTTL, impersonationTTL time.Duration) *SessionService {
+	return &SessionService{
+		repo:             repo,
+		passwords:        passwords,
+		cache:            cache,
+		signer:           signer,
+		clock:            clk,
+		accessTTL:        accessTTL,
+		refreshTTL:       refreshTTL,
+		impersonationTTL: impersonationTTL,
+	}
+}
+
+// Login starts a session for the user with the given email and password
+func (s *SessionService) Login(ctx context.Context, email, password string) (*model.User, *Tokens, error) {
+	user, err := s.passwords.Authenticate(ctx, email, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.start(ctx, user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to log in: %w", err)
+	}
+
+	return user, tokens, nil
+}
+
+// start creates a session for a user and issues its first tokens
+func (s *SessionService) start(ctx context.Context, userID int64) (*Tokens, error) {
+	refresh, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	session := &model.Session{
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	}
+	if err := s.repo.Create(ctx, session, hash); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issue(session, refresh, now)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("session started",
+		slog.Int64("user_id", userID),
+		slog.Int64("session_id", session.ID))
+
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a refresh token that was already exchanged
+// means it leaked, so the session is revoked.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	refresh, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh session: %w", err)
+	}
+
+	now := s.clock.Now()
+	hash := hashSecret(refreshToken)
+	session, err := s.repo.Refresh(ctx, hash, newHash, now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.revokeReplaced(ctx, hash, now)
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh session: %w", err)
+	}
+
+	return s.issue(session, refresh, now)
+}
+
+// Logout ends the session of a refresh token
+func (s *SessionService) Logout(ctx context.Context, refreshToken string) error {
+	session, err := s.repo.Revoke(ctx, hashSecret(refreshToken), s.clock.Now())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+
+	if err := s.markRevoked(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+
+	slog.Info("session ended",
+		slog.Int64("user_id", session.UserID),
+		slog.Int64("session_id", session.ID))
+
+	return nil
+}
+
+// RevokeAllSessions ends every session of a user, e.g. after their account
+// was compromised, returning how many were active
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID int64) (int, error) {
+	ids, err := s.repo.RevokeAll(ctx, userID, s.clock.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := s.markRevoked(ctx, ids...); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	slog.Warn("all sessions revoked",
+		slog.Int64("user_id", userID),
+		slog.Int("sessions", len(ids)),
+		slog.String("revoked_by", auth.Subject(ctx)))
+
+	return len(ids), nil
+}
+
+// Impersonate issues an access token acting as the user with the given ID
+// on behalf of the caller, so that support can reproduce what the user
+// sees. The token carries the caller as impersonator and the roles of a
+// session of the user. It belongs to no session: it cannot be refreshed or
+// revoked, and only lives for the impersonation TTL. Only callers holding
+// auth.AdminRole may impersonate, and never while impersonating.
+func (s *SessionService) Impersonate(ctx context.Context, userID int64, reason string) (*Impersonation, error) {
+	impersonator := auth.Subject(ctx)
+	if !auth.HasRole(ctx, auth.AdminRole) || impersonator == auth.Anonymous {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	_, err := s.passwords.users.GetUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrImpersonatedUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate user: %w", err)
+	}
+
+	now := s.clock.Now()
+	expiresAt := now.Add(s.impersonationTTL)
+	access, err := s.signer.Sign(token.Claims{
+		Subject:      SessionSubject(userID),
+		Roles:        sessionRoles,
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    expiresAt.Unix(),
+		Impersonator: impersonator,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue impersonation token: %w", err)
+	}
+
+	slog.Warn("impersonation token issued",
+		slog.Int64("user_id", userID),
+		slog.String("impersonator", impersonator),
+		slog.String("reason", reason),
+		slog.Time("expires_at", expiresAt))
+
+	return &Impersonation{AccessToken: access, ExpiresAt: expiresAt}, nil
+}
+
+// VerifyAccessToken returns the principal of an access token of an active
+// session, or of an impersonation token. It fails closed: when revocations
+// cannot be checked the token is rejected. It implements
+// auth.AccessTokenVerifier.
+func (s *SessionService) VerifyAccessToken(ctx context.Context, accessToken string) (*auth.Principal, error) {
+	claims, err := s.signer.Verify(accessToken, s.clock.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAccessToken, err)
+	}
+
+	if claims.Impersonator != "" {
+		return &auth.Principal{
+			Subject:      claims.Subject,
+			Method:       "impersonation_token",
+			Roles:        claims.Roles,
+			Impersonator: claims.Impersonator,
+		}, nil
+	}
+
+	revoked, err := s.cache.Exists(ctx, revokedSessionKey(claims.SessionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrInvalidAccessToken
+	}
+
+	return &auth.Principal{
+		Subject: claims.Subject,
+		Method:  "access_token",
+		Roles:   claims.Roles,
+	}, nil
+}
+
+// PruneExpired deletes sessions that expired more than a day ago, keeping
+// recently expired ones for investigations
+func (s *SessionService) PruneExpired(ctx context.Context) error {
+	deleted, err := s.repo.DeleteExpired(ctx, s.clock.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("expired sessions pruned", slog.Int64("deleted", deleted))
+	}
+	return nil
+}
+
+// issue signs an access token for session
+func (s *SessionService) issue(session *model.Session, refresh string, now time.Time) (*Tokens, error) {
+	expiresAt := now.Add(s.accessTTL)
+	access, err := s.signer.Sign(token.Claims{
+		Subject:   SessionSubject(session.UserID),
+		SessionID: session.ID,
+		Roles:     sessionRoles,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		Session:         session,
+		AccessToken:     access,
+		RefreshToken:    refresh,
+		AccessExpiresAt: expiresAt,
+	}, nil
+}
+
+// revokeReplaced revokes the session a replaced refresh token belonged to
+func (s *SessionService) revokeReplaced(ctx context.Context, hash string, now time.Time) {
+	id, err := s.repo.RevokeReplaced(ctx, hash, now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err == nil {
+		err = s.markRevoked(ctx, id)
+	}
+	if err != nil {
+		slog.Error("failed to revoke session of reused refresh token", slog.String("error", err.Error()))
+		return
+	}
+
+	slog.Warn("refresh token reused, session revoked", slog.Int64("session_id", id))
+}
+
+// markRevoked makes the access tokens of sessions invalid. The marks only
+// need to outlive the longest-lived access token.
+func (s *SessionService) markRevoked(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	marks := make(map[string]string, len(ids))
+	for _, id := range ids {
+		marks[revokedSessionKey(id)] = "1"
+	}
+	return s.cache.SetManyExact(ctx, marks, s.accessTTL)
+}
+
+// SessionSubject is the subject of requests made with a user's access token
+func SessionSubject(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+func revokedSessionKey(id int64) string {
+	return "session:revoked:" + strconv.FormatInt(id, 10)
+}
+
+// newRefreshToken returns a random refresh token and its hash
+func newRefreshToken() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = refreshTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
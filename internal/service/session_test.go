@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+)
+
+func TestImpersonate(t *testing.T) {
+	s := &SessionService{}
+
+	t.Run("refuses callers without the admin role", func(t *testing.T) {
+		for name, ctx := range map[string]context.Context{
+			"no principal":  context.Background(),
+			"user role":     auth.NewContext(context.Background(), &auth.Principal{Subject: "user:7", Method: "access_token", Roles: []string{"user"}}),
+			"impersonating": auth.NewContext(context.Background(), &auth.Principal{Subject: "user:7", Roles: []string{"admin"}, Impersonator: "support-tool"}),
+		} {
+			if _, err := s.Impersonate(ctx, 42, "ticket 1"); !errors.Is(err, ErrImpersonationNotAllowed) {
+				t.Errorf("%s: expected ErrImpersonationNotAllowed, got %v", name, err)
+			}
+		}
+	})
+}
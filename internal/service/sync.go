@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+var (
+	// ErrInvalidSyncToken is returned when a sync token cannot be decoded
+	ErrInvalidSyncToken = errors.New("invalid sync token")
+	// ErrSyncTokenExpired is returned when history referenced by a token was pruned
+	ErrSyncTokenExpired = errors.New("sync token expired")
+)
+
+// SyncPage is one page of a differential user sync
+type SyncPage struct {
+	Changed    []*model.User
+	DeletedIDs []int64
+	NextToken  string
+	HasMore    bool
+}
+
+// syncToken is the decoded form of the opaque token handed to sync clients.
+// A sync starts with a snapshot of the users table paged by ID, pinned to the
+// history position observed when it began, then continues with history
+// changes. A position is the transaction and version of the last change seen.
+type syncToken struct {
+	snapshot bool
+	cursor   int64
+	txid     int64
+	version  int64
+}
+
+func (t syncToken) encode() string {
+	var raw string
+	if t.snapshot {
+		raw = fmt.Sprintf("s:%d:%d:%d", t.cursor, t.txid, t.version)
+	} else {
+		raw = fmt.Sprintf("c:%d:%d", t.txid, t.version)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSyncToken(token string) (syncToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return syncToken{}, ErrInvalidSyncToken
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) < 2 || (parts[0] != "s" && parts[0] != "c") {
+		return syncToken{}, ErrInvalidSyncToken
+	}
+	values := make([]int64, len(parts)-1)
+	for i, part := range parts[1:] {
+		if values[i], err = strconv.ParseInt(part, 10, 64); err != nil {
+			return syncToken{}, ErrInvalidSyncToken
+		}
+	}
+
+	switch {
+	case parts[0] == "s" && len(values) == 3:
+		return syncToken{snapshot: true, cursor: values[0], txid: values[1], version: values[2]}, nil
+	case parts[0] == "c" && len(values) == 2:
+		return syncToken{txid: values[0], version: values[1]}, nil
+	case parts[0] == "s" && len(values) == 2, parts[0] == "c" && len(values) == 1:
+		// Tokens without a transaction ordered changes by version alone and
+		// may have skipped changes committed late
+		return syncToken{}, ErrSyncTokenExpired
+	default:
+		return syncToken{}, ErrInvalidSyncToken
+	}
+}
+
+// SyncUsers returns the users changed or deleted since the given token.
+// An empty token starts a full sync.
+func (s *UserService) SyncUsers(ctx context.Context, sinceToken string, limit int) (*SyncPage, error) {
+	if sinceToken == "" {
+		txid, version, err := s.repo.HistoryWatermark(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start sync: %w", err)
+		}
+		return s.syncSnapshot(ctx, syncToken{snapshot: true, txid: txid, version: version}, limit)
+	}
+
+	token, err := decodeSyncToken(sinceToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.snapshot {
+		return s.syncSnapshot(ctx, token, limit)
+	}
+	return s.syncChanges(ctx, token, limit)
+}
+
+// ResumeToken returns a SyncUsers token for the changes made from now on,
+// for watchers to catch up on what they miss while disconnected
+func (s *UserService) ResumeToken(ctx context.Context) (string, error) {
+	txid, version, err := s.repo.HistoryWatermark(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to issue resume token: %w", err)
+	}
+	return syncToken{txid: txid, version: version}.encode(), nil
+}
+
+func (s *UserService) syncSnapshot(ctx context.Context, token syncToken, limit int) (*SyncPage, error) {
+	users, err := s.repo.ListAfterID(ctx, token.cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync users: %w", err)
+	}
+
+	page := &SyncPage{Changed: users}
+	if len(users) == limit {
+		token.cursor = users[len(users)-1].ID
+		page.HasMore = true
+	} else {
+		// Snapshot complete, continue from the history position it was pinned to
+		token = syncToken{txid: token.txid, version: token.version}
+	}
+	page.NextToken = token.encode()
+
+	return page, nil
+}
+
+func (s *UserService) syncChanges(ctx context.Context, token syncToken, limit int) (*SyncPage, error) {
+	minVersion, _, err := s.repo.HistoryBounds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync users: %w", err)
+	}
+	if minVersion > token.version+1 {
+		return nil, ErrSyncTokenExpired
+	}
+
+	entries, err := s.repo.ChangesSince(ctx, token.txid, token.version, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync users: %w", err)
+	}
+
+	page := collapseChanges(entries)
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		token.txid, token.version = last.TxID, last.Version
+	}
+	page.NextToken = token.encode()
+	page.HasMore = len(entries) == limit
+
+	return page, nil
+}
+
+// collapseChanges reduces ordered history entries to the final state of each user
+func collapseChanges(entries []*model.UserHistoryEntry) *SyncPage {
+	latest := make(map[int64]*model.UserHistoryEntry, len(entries))
+	var order []int64
+	for _, entry := range entries {
+		if _, seen := latest[entry.UserID]; !seen {
+			order = append(order, entry.UserID)
+		}
+		latest[entry.UserID] = entry
+	}
+
+	page := &SyncPage{}
+	for _, id := range order {
+		entry := latest[id]
+		if entry.Operation == model.HistoryOperationDelete {
+			page.DeletedIDs = append(page.DeletedIDs, id)
+			continue
+		}
+		page.Changed = append(page.Changed, &model.User{
+			ID:        entry.UserID,
+			UUID:      entry.UserUUID,
+			Email:     entry.Email,
+			Name:      entry.Name,
+			Metadata:  entry.Metadata,
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.UpdatedAt,
+		})
+	}
+
+	return page
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+func TestSyncToken(t *testing.T) {
+	t.Run("should round trip snapshot and change tokens", func(t *testing.T) {
+		for _, token := range []syncToken{
+			{snapshot: true, cursor: 42, txid: 1203, version: 7},
+			{txid: 1310, version: 99},
+		} {
+			decoded, err := decodeSyncToken(token.encode())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if decoded != token {
+				t.Errorf("expected %+v, got %+v", token, decoded)
+			}
+		}
+	})
+
+	t.Run("should reject malformed tokens", func(t *testing.T) {
+		for _, token := range []string{"not base64!", "eDox", "czoxOg"} {
+			if _, err := decodeSyncToken(token); !errors.Is(err, ErrInvalidSyncToken) {
+				t.Errorf("expected ErrInvalidSyncToken for %q, got %v", token, err)
+			}
+		}
+	})
+
+	t.Run("should expire tokens without a transaction", func(t *testing.T) {
+		for _, raw := range []string{"s:42:7", "c:99"} {
+			token := base64.RawURLEncoding.EncodeToString([]byte(raw))
+			if _, err := decodeSyncToken(token); !errors.Is(err, ErrSyncTokenExpired) {
+				t.Errorf("expected ErrSyncTokenExpired for %q, got %v", raw, err)
+			}
+		}
+	})
+}
+
+func TestCollapseChanges(t *testing.T) {
+	t.Run("should keep only the final state of each user", func(t *testing.T) {
+		page := collapseChanges([]*model.UserHistoryEntry{
+			{Version: 1, UserID: 1, Operation: model.HistoryOperationCreate, Email: "a@example.com"},
+			{Version: 2, UserID: 2, Operation: model.HistoryOperationCreate, Email: "b@example.com"},
+			{Version: 3, UserID: 1, Operation: model.HistoryOperationUpdate, Email: "a2@example.com"},
+			{Version: 4, UserID: 2, Operation: model.HistoryOperationDelete, Email: "b@example.com"},
+		})
+
+		if len(page.Changed) != 1 || page.Changed[0].Email != "a2@example.com" {
+			t.Errorf("expected user 1 with updated email, got %+v", page.Changed)
+		}
+		if len(page.DeletedIDs) != 1 || page.DeletedIDs[0] != 2 {
+			t.Errorf("expected user 2 deleted, got %v", page.DeletedIDs)
+		}
+	})
+}
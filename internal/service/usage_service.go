@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+)
+
+// UsageService handles per-caller cost reporting
+type UsageService struct {
+	repo *repository.UsageRepository
+}
+
+// NewUsageService creates a new UsageService instance
+func NewUsageService(repo *repository.UsageRepository) *UsageService {
+	return &UsageService{repo: repo}
+}
+
+// GetUsageReport retrieves hourly usage between from and to, optionally for a single caller
+func (s *UsageService) GetUsageReport(ctx context.Context, caller string, from, to time.Time) ([]*model.UsageRecord, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid report range: from %s is not before to %s", from, to)
+	}
+
+	records, err := s.repo.Report(ctx, caller, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage report: %w", err)
+	}
+
+	return records, nil
+}
+
+// UsageCSV renders usage records as CSV for chargeback spreadsheets
+func UsageCSV(records []*model.UsageRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"caller", "hour", "requests", "db_time_ms", "cache_ops", "bytes_in", "bytes_out"})
+	for _, record := range records {
+		w.Write([]string{
+			record.Caller,
+			record.Hour.UTC().Format(time.RFC3339),
+			strconv.FormatInt(record.Requests, 10),
+			strconv.FormatInt(record.DBTimeMs, 10),
+			strconv.FormatInt(record.CacheOps, 10),
+			strconv.FormatInt(record.BytesIn, 10),
+			strconv.FormatInt(record.BytesOut, 10),
+		})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write usage csv: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
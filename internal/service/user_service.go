@@ -2,51 +2,130 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
 	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pagination"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pool"
+)
+
+var (
+	// ErrInvalidFieldMask is returned for update masks naming unknown fields
+	ErrInvalidFieldMask = errors.New("invalid field mask")
+	// ErrUserNotFound is returned for lookups matching no user
+	ErrUserNotFound = errors.New("user not found")
+	// ErrDeletedUserNotFound is returned when restoring or purging a user
+	// that does not exist or is not deleted
+	ErrDeletedUserNotFound = errors.New("no deleted user with this ID")
+	// ErrInvalidUUID is returned for lookups by a malformed UUID
+	ErrInvalidUUID = errors.New("invalid uuid")
 )
 
+// uuidPattern matches UUIDs in their canonical textual form
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 // UserService handles user business logic
 type UserService struct {
-	repo  *repository.UserRepository
-	cache *cache.Redis
+	repo      *repository.UserRepository
+	cache     userCache
+	publisher events.Publisher
+	pii       *pii.Protector
+	clock     clock.Clock
+	// lookups runs the lookups of BatchGetUsers
+	lookups *pool.Pool
+}
+
+// userCache holds the users and lookups UserService reads through;
+// *cache.Redis in production
+type userCache interface {
+	Get(ctx context.Context, key string) (string, error)
+	MGet(ctx context.Context, keys ...string) ([]string, error)
+	SetMany(ctx context.Context, values map[string]string, expiration time.Duration) error
+	DeleteMany(ctx context.Context, keys ...string) error
+	DeleteMatching(ctx context.Context, pattern string, batchSize int64, fn func(cache.FlushProgress) error) (cache.FlushProgress, error)
 }
 
 // NewUserService creates a new UserService instance
-func NewUserService(repo *repository.UserRepository, cache *cache.Redis) *UserService {
+func NewUserService(repo *repository.UserRepository, cache *cache.Redis, publisher events.Publisher, protector *pii.Protector, clk clock.Clock, lookups *pool.Pool) *UserService {
 	return &UserService{
-		repo:  repo,
-		cache: cache,
+		repo:      repo,
+		cache:     cache,
+		publisher: publisher,
+		pii:       protector,
+		clock:     clk,
+		lookups:   lookups,
 	}
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(ctx context.Context, email, name string) (*model.User, error) {
-	user := &model.User{
-		Email:     email,
-		Name:      name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+// CreateUser creates a new user. Metadata entries with an empty value are
+// ignored.
+func (s *UserService) CreateUser(ctx context.Context, email, name string, metadata map[string]string, timezone, locale string) (*model.User, error) {
+	metadata, err := mergeMetadata(nil, metadata)
+	if err != nil {
+		return nil, err
+	}
+	timezone, locale, err = normalizeLocality(timezone, locale)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.repo.Create(ctx, user); err != nil {
+	storedEmail, err := s.pii.Protect(ctx, email)
+	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// Invalidate cache
-	s.cache.Delete(ctx, "users:list")
+	return s.create(ctx, storedEmail, name, metadata, timezone, locale)
+}
+
+// create persists a user whose email has already been protected
+func (s *UserService) create(ctx context.Context, storedEmail, name string, metadata map[string]string, timezone, locale string) (*model.User, error) {
+	user := &model.User{
+		Email:     storedEmail,
+		Name:      name,
+		Metadata:  metadata,
+		Timezone:  timezone,
+		Locale:    locale,
+		CreatedAt: s.clock.Now(),
+		UpdatedAt: s.clock.Now(),
+	}
+	return s.insert(ctx, user)
+}
+
+// insert persists a new user built by the caller and returns it revealed
+func (s *UserService) insert(ctx context.Context, user *model.User) (*model.User, error) {
+	err := s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		fx.invalidate("users:list", existsKey(user.ID), emailKey(user.Email))
+		fx.raise(events.Event{Type: events.UserCreated, UserID: user.ID, User: user})
+		return nil
+	})
+	if err != nil {
+		return nil, mapCreateError(err)
+	}
 
 	slog.Info("user created",
 		slog.Int64("user_id", user.ID),
 		slog.String("email", user.Email))
 
-	return user, nil
+	return s.revealUser(ctx, user)
 }
 
 // GetUser retrieves a user by ID
@@ -59,7 +138,7 @@ func (s *UserService) GetUser(ctx context.Context, id int64) (*model.User, error
 		var user model.User
 		if err := json.Unmarshal([]byte(cached), &user); err == nil {
 			slog.Debug("cache hit", slog.String("key", cacheKey))
-			return &user, nil
+			return s.revealUser(ctx, &user)
 		}
 	}
 
@@ -71,15 +150,100 @@ func (s *UserService) GetUser(ctx context.Context, id int64) (*model.User, error
 
 	// Cache the result
 	if data, err := json.Marshal(user); err == nil {
-		s.cache.Set(ctx, cacheKey, string(data), 5*time.Minute)
+		s.warm(ctx, map[string]string{cacheKey: string(data)}, 5*time.Minute)
 	}
 
-	return user, nil
+	return s.revealUser(ctx, user)
+}
+
+// GetUserByEmail retrieves a user by email. The email to ID mapping is
+// cached next to the ID-keyed entry, which holds the user itself.
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	storedEmail, err := s.pii.Protect(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	cacheKey := emailKey(storedEmail)
+
+	cached, err := s.cache.Get(ctx, cacheKey)
+	if err == nil && cached != "" {
+		if id, err := strconv.ParseInt(cached, 10, 64); err == nil {
+			slog.Debug("cache hit", slog.String("key", cacheKey))
+			return s.GetUser(ctx, id)
+		}
+	}
+
+	user, err := s.repo.GetByEmail(ctx, storedEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	entries := map[string]string{cacheKey: strconv.FormatInt(user.ID, 10)}
+	if data, err := json.Marshal(user); err == nil {
+		entries[fmt.Sprintf("user:%d", user.ID)] = string(data)
+	}
+	s.warm(ctx, entries, 5*time.Minute)
+
+	return s.revealUser(ctx, user)
+}
+
+// GetUserByUUID retrieves a user by UUID. UUIDs never change, so the UUID
+// to ID mapping is cached without invalidation.
+func (s *UserService) GetUserByUUID(ctx context.Context, uuid string) (*model.User, error) {
+	if !uuidPattern.MatchString(uuid) {
+		return nil, ErrInvalidUUID
+	}
+	uuid = strings.ToLower(uuid)
+	cacheKey := "user:uuid:" + uuid
+
+	cached, err := s.cache.Get(ctx, cacheKey)
+	if err == nil && cached != "" {
+		if id, err := strconv.ParseInt(cached, 10, 64); err == nil {
+			slog.Debug("cache hit", slog.String("key", cacheKey))
+			return s.GetUser(ctx, id)
+		}
+	}
+
+	user, err := s.repo.GetByUUID(ctx, uuid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	s.warm(ctx, map[string]string{cacheKey: strconv.FormatInt(user.ID, 10)}, time.Hour)
+	if data, err := json.Marshal(user); err == nil {
+		s.warm(ctx, map[string]string{fmt.Sprintf("user:%d", user.ID): string(data)}, 5*time.Minute)
+	}
+
+	return s.revealUser(ctx, user)
+}
+
+// emailKey returns the cache key of the email to ID mapping. Emails are
+// hashed so that no PII ends up in Redis key names.
+func emailKey(storedEmail string) string {
+	sum := sha256.Sum256([]byte(storedEmail))
+	return "user:email:" + hex.EncodeToString(sum[:])
+}
+
+// GetUserAsOf retrieves a user as it was at the given point in time.
+// Point-in-time reads always go to the history table and bypass the cache.
+func (s *UserService) GetUserAsOf(ctx context.Context, id int64, asOf time.Time) (*model.User, error) {
+	user, err := s.repo.GetAsOf(ctx, id, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	return s.revealUser(ctx, user)
 }
 
 // ListUsers lists all users with pagination
 func (s *UserService) ListUsers(ctx context.Context, page, pageSize int) ([]*model.User, int, error) {
-	offset := (page - 1) * pageSize
+	offset := pagination.Offset(page, pageSize)
 
 	users, err := s.repo.List(ctx, pageSize, offset)
 	if err != nil {
@@ -91,48 +255,280 @@ func (s *UserService) ListUsers(ctx context.Context, page, pageSize int) ([]*mod
 		return nil, 0, fmt.Errorf("failed to count users: %w", err)
 	}
 
+	users, err = s.revealUsers(ctx, users)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
 	return users, total, nil
 }
 
-// UpdateUser updates an existing user
-func (s *UserService) UpdateUser(ctx context.Context, id int64, email, name string) (*model.User, error) {
+// StreamUsers passes every user to fn in chunks of up to chunkSize
+func (s *UserService) StreamUsers(ctx context.Context, chunkSize int, fn func([]*model.User) error) error {
+	return s.StreamMatching(ctx, repository.UserFilter{}, chunkSize, fn)
+}
+
+// StreamMatching passes the users matching filter to fn in chunks of up to
+// chunkSize
+func (s *UserService) StreamMatching(ctx context.Context, filter repository.UserFilter, chunkSize int, fn func([]*model.User) error) error {
+	if err := s.validateFilter(filter); err != nil {
+		return err
+	}
+	return s.repo.StreamMatching(ctx, filter, chunkSize, func(users []*model.User) error {
+		revealed, err := s.revealUsers(ctx, users)
+		if err != nil {
+			return fmt.Errorf("failed to stream users: %w", err)
+		}
+		return fn(revealed)
+	})
+}
+
+// UpdateUser updates an existing user. Only the fields named in mask are
+// changed; an empty mask updates every field but an empty time zone or
+// locale, so clients unaware of them do not clear them. Metadata is merged
+// into the existing metadata, where an empty value removes its key.
+func (s *UserService) UpdateUser(ctx context.Context, id int64, email, name string, metadata map[string]string, timezone, locale string, mask []string) (*model.User, error) {
+	fields, err := parseUpdateMask(mask)
+	if err != nil {
+		return nil, err
+	}
+	timezone, locale, err = normalizeLocality(timezone, locale)
+	if err != nil {
+		return nil, err
+	}
+	if len(mask) == 0 {
+		fields.timezone = timezone != ""
+		fields.locale = locale != ""
+	}
+
 	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
-	user.Email = email
-	user.Name = name
-	user.UpdatedAt = time.Now()
-
-	if err := s.repo.Update(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+	previousEmail := user.Email
+	if fields.email {
+		if user.Email, err = s.pii.Protect(ctx, email); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+	if fields.name {
+		user.Name = name
+	}
+	if fields.metadata {
+		if user.Metadata, err = mergeMetadata(user.Metadata, metadata); err != nil {
+			return nil, err
+		}
+	}
+	if fields.timezone {
+		user.Timezone = timezone
 	}
+	if fields.locale {
+		user.Locale = locale
+	}
+	user.UpdatedAt = s.clock.Now()
 
-	// Invalidate cache
-	cacheKey := fmt.Sprintf("user:%d", id)
-	s.cache.Delete(ctx, cacheKey)
-	s.cache.Delete(ctx, "users:list")
+	err = s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		if err := s.repo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", id), "users:list")
+		if user.Email != previousEmail {
+			fx.invalidate(emailKey(previousEmail), emailKey(user.Email))
+		}
+		fx.raise(events.Event{Type: events.UserUpdated, UserID: user.ID, User: user})
+		return nil
+	})
+	if err != nil {
+		return nil, mapCreateError(err)
+	}
 
 	slog.Info("user updated",
 		slog.Int64("user_id", user.ID),
 		slog.String("email", user.Email))
 
-	return user, nil
+	return s.revealUser(ctx, user)
 }
 
-// DeleteUser deletes a user by ID
-func (s *UserService) DeleteUser(ctx context.Context, id int64) error {
-	if err := s.repo.Delete(ctx, id); err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+// updateMask lists the user fields selected by an update mask
+type updateMask struct {
+	email    bool
+	name     bool
+	metadata bool
+	timezone bool
+	locale   bool
+}
+
+// parseUpdateMask reports which user fields an update mask selects
+func parseUpdateMask(mask []string) (updateMask, error) {
+	if len(mask) == 0 {
+		return updateMask{email: true, name: true, metadata: true}, nil
 	}
 
-	// Invalidate cache
-	cacheKey := fmt.Sprintf("user:%d", id)
-	s.cache.Delete(ctx, cacheKey)
-	s.cache.Delete(ctx, "users:list")
+	var fields updateMask
+	for _, path := range mask {
+		switch path {
+		case "email":
+			fields.email = true
+		case "name":
+			fields.name = true
+		case "metadata":
+			fields.metadata = true
+		case "timezone":
+			fields.timezone = true
+		case "locale":
+			fields.locale = true
+		default:
+			return updateMask{}, fmt.Errorf("%w: unknown field %q", ErrInvalidFieldMask, path)
+		}
+	}
+	return fields, nil
+}
+
+// DeleteUser soft-deletes a user by ID; it can be restored until it is purged
+func (s *UserService) DeleteUser(ctx context.Context, id int64) error {
+	err := s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", id), "users:list", existsKey(id))
+		fx.raise(events.Event{Type: events.UserDeleted, UserID: id})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
 	slog.Info("user deleted", slog.Int64("user_id", id))
 
 	return nil
 }
+
+// RestoreUser undoes the deletion of a user that has not been purged or
+// merged into another yet
+func (s *UserService) RestoreUser(ctx context.Context, id int64) (*model.User, error) {
+	var user *model.User
+	err := s.transact(ctx, func(ctx context.Context, fx *effects) error {
+		var err error
+		user, err = s.repo.Restore(ctx, id, s.clock.Now())
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrDeletedUserNotFound
+		}
+		if err != nil {
+			return mapCreateError(err)
+		}
+		fx.invalidate(fmt.Sprintf("user:%d", id), "users:list", existsKey(id), emailKey(user.Email))
+		fx.raise(events.Event{Type: events.UserRestored, UserID: user.ID, User: user})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("user restored", slog.Int64("user_id", id))
+
+	return s.revealUser(ctx, user)
+}
+
+// PurgeUser permanently removes a deleted user. Users must be deleted first
+// so that a purge can never hit an active account by mistake.
+func (s *UserService) PurgeUser(ctx context.Context, id int64) error {
+	purged, err := s.repo.Purge(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !purged {
+		return ErrDeletedUserNotFound
+	}
+
+	slog.Info("user purged", slog.Int64("user_id", id))
+
+	return nil
+}
+
+// GetUserHistory lists the recorded changes of a user with pagination
+func (s *UserService) GetUserHistory(ctx context.Context, userID int64, page, pageSize int) ([]*model.UserHistoryEntry, int, error) {
+	offset := pagination.Offset(page, pageSize)
+
+	entries, err := s.repo.History(ctx, userID, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get user history: %w", err)
+	}
+
+	total, err := s.repo.CountHistory(ctx, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count user history: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Email, err = s.pii.Reveal(ctx, entry.Email); err != nil {
+			return nil, 0, fmt.Errorf("failed to get user history: %w", err)
+		}
+	}
+
+	return entries, total, nil
+}
+
+// PruneHistory removes history entries older than the retention period
+func (s *UserService) PruneHistory(ctx context.Context, retention time.Duration) (int64, error) {
+	pruned, err := s.repo.PruneHistory(ctx, s.clock.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune user history: %w", err)
+	}
+
+	slog.Info("user history pruned",
+		slog.Int64("entries", pruned),
+		slog.Duration("retention", retention))
+
+	return pruned, nil
+}
+
+// publish emits a domain event. Failures are logged rather than returned since
+// the users_history table remains the durable record of the change.
+func (s *UserService) publish(ctx context.Context, event events.Event) {
+	event.OccurredAt = s.clock.Now()
+	if err := s.publisher.Publish(ctx, event); err != nil {
+		slog.Warn("failed to publish event",
+			slog.String("type", string(event.Type)),
+			slog.Int64("user_id", event.UserID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// warm fills the cache with entries read from the database before the read
+// returns, rather than on a pool where fills could wait behind the
+// invalidations of later changes. This only narrows the race: a change
+// committing between the read and the fill still has its invalidation
+// overwritten with the entry read before it, served until it expires.
+func (s *UserService) warm(ctx context.Context, entries map[string]string, ttl time.Duration) {
+	if err := s.cache.SetMany(ctx, entries, ttl); err != nil {
+		slog.Warn("failed to warm cache",
+			slog.Int("keys", len(entries)),
+			slog.String("error", err.Error()))
+	}
+}
+
+// revealUser returns a copy of user whose stored email is revealed according
+// to the caller's privileges. Stored users are never modified so that cached
+// and published copies keep the persisted value.
+func (s *UserService) revealUser(ctx context.Context, user *model.User) (*model.User, error) {
+	email, err := s.pii.Reveal(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	revealed := *user
+	revealed.Email = email
+	return &revealed, nil
+}
+
+func (s *UserService) revealUsers(ctx context.Context, users []*model.User) ([]*model.User, error) {
+	revealed := make([]*model.User, len(users))
+	for i, user := range users {
+		var err error
+		if revealed[i], err = s.revealUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return revealed, nil
+}
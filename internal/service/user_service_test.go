@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -59,6 +60,7 @@ func (m *MockUserRepository) Delete(ctx context.Context, id int64) error {
 
 // MockCache is a mock implementation of the cache
 type MockCache struct {
+	userCache
 	data map[string]string
 }
 
@@ -85,6 +87,40 @@ func (m *MockCache) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (m *MockCache) SetMany(ctx context.Context, values map[string]string, exp time.Duration) error {
+	for key, value := range values {
+		m.data[key] = value
+	}
+	return nil
+}
+
+func (m *MockCache) DeleteMany(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(m.data, key)
+	}
+	return nil
+}
+
+func TestWarm(t *testing.T) {
+	t.Run("should fill before an invalidation that follows the read", func(t *testing.T) {
+		cache := NewMockCache()
+		s := &UserService{cache: cache}
+		ctx := context.Background()
+
+		// A read fills the entry it loaded, then a change commits and
+		// invalidates it; the stale fill must not land afterwards
+		s.warm(ctx, map[string]string{"user:1": `{"id":1,"name":"Before"}`}, 5*time.Minute)
+		if cached, _ := cache.Get(ctx, "user:1"); cached == "" {
+			t.Fatal("expected the entry to be cached when the read returns")
+		}
+		s.apply(ctx, &effects{keys: []string{"user:1"}})
+
+		if cached, _ := cache.Get(ctx, "user:1"); cached != "" {
+			t.Errorf("expected the entry to stay invalidated, got %s", cached)
+		}
+	})
+}
+
 func TestCreateUser(t *testing.T) {
 	// This is a placeholder test
 	// In a real scenario, you would use proper mocking libraries
@@ -115,3 +151,25 @@ func TestListUsers(t *testing.T) {
 		}
 	})
 }
+
+func TestParseUpdateMask(t *testing.T) {
+	t.Run("empty mask updates every field", func(t *testing.T) {
+		fields, err := parseUpdateMask(nil)
+		if err != nil || fields != (updateMask{email: true, name: true, metadata: true}) {
+			t.Errorf("expected every field, got (%+v, %v)", fields, err)
+		}
+	})
+
+	t.Run("selects only named fields", func(t *testing.T) {
+		fields, err := parseUpdateMask([]string{"name"})
+		if err != nil || fields != (updateMask{name: true}) {
+			t.Errorf("expected only name, got (%+v, %v)", fields, err)
+		}
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		if _, err := parseUpdateMask([]string{"name", "id"}); !errors.Is(err, ErrInvalidFieldMask) {
+			t.Errorf("expected ErrInvalidFieldMask, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+)
+
+var (
+	// ErrWatchUnavailable is returned when the event publisher cannot be subscribed to
+	ErrWatchUnavailable = errors.New("watching users is not available")
+	// ErrWatcherLagging is returned when a watcher consumed events too slowly
+	// and some were dropped; it should resynchronize before watching again
+	ErrWatcherLagging = errors.New("watcher fell behind and missed events")
+	// ErrWatchClosed is returned when the event bus shuts down
+	ErrWatchClosed = errors.New("event stream closed")
+)
+
+// WatchUsers passes live user changes to fn until ctx is done, fn fails or
+// the watcher falls behind. Types and userIDs narrow the changes when not
+// empty. Replayed events are skipped since watchers only follow live changes.
+//
+// Events are buffered per watcher; rather than block the publisher, a
+// watcher whose buffer overflows is ended with ErrWatcherLagging so that it
+// never silently misses a change.
+func (s *UserService) WatchUsers(ctx context.Context, types []events.Type, userIDs []int64, fn func(events.Event) error) error {
+	subscriber, ok := s.publisher.(events.Subscriber)
+	if !ok {
+		return ErrWatchUnavailable
+	}
+
+	for _, t := range types {
+		if _, ok := eventOperations[t]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownEventType, t)
+		}
+	}
+
+	sub := subscriber.Subscribe(types...)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return ErrWatchClosed
+			}
+			if sub.Dropped() > 0 {
+				return ErrWatcherLagging
+			}
+			if event.Replay || (len(userIDs) > 0 && !slices.Contains(userIDs, event.UserID)) {
+				continue
+			}
+
+			if event.User != nil {
+				user, err := s.revealUser(ctx, event.User)
+				if err != nil {
+					return fmt.Errorf("failed to watch users: %w", err)
+				}
+				event.User = user
+			}
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
+)
+
+func TestWatchUsers(t *testing.T) {
+	t.Run("delivers live changes of watched users", func(t *testing.T) {
+		bus := events.NewBus(10)
+		s := &UserService{publisher: bus, pii: pii.NewProtector(pii.Noop{}, nil)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var got []events.Event
+		done := make(chan error, 1)
+		go func() {
+			done <- s.WatchUsers(ctx, nil, []int64{1}, func(event events.Event) error {
+				got = append(got, event)
+				if len(got) == 2 {
+					cancel()
+				}
+				return nil
+			})
+		}()
+
+		waitForSubscriber(t, bus)
+		_ = bus.Publish(ctx, events.Event{Type: events.UserCreated, UserID: 2, User: &model.User{ID: 2}})
+		_ = bus.Publish(ctx, events.Event{Type: events.UserCreated, UserID: 1, User: &model.User{ID: 1}, Replay: true})
+		_ = bus.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: 1, User: &model.User{ID: 1, Name: "Jane"}})
+		_ = bus.Publish(ctx, events.Event{Type: events.UserDeleted, UserID: 1})
+
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if len(got) != 2 || got[0].Type != events.UserUpdated || got[0].User.Name != "Jane" || got[1].Type != events.UserDeleted {
+			t.Errorf("unexpected events: %+v", got)
+		}
+	})
+
+	t.Run("ends lagging watchers", func(t *testing.T) {
+		bus := events.NewBus(1)
+		s := &UserService{publisher: bus, pii: pii.NewProtector(pii.Noop{}, nil)}
+
+		release := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- s.WatchUsers(context.Background(), nil, nil, func(events.Event) error {
+				<-release
+				return nil
+			})
+		}()
+
+		waitForSubscriber(t, bus)
+		for i := int64(1); i <= 4; i++ {
+			_ = bus.Publish(context.Background(), events.Event{Type: events.UserDeleted, UserID: i})
+		}
+		close(release)
+
+		if err := <-done; !errors.Is(err, ErrWatcherLagging) {
+			t.Errorf("expected ErrWatcherLagging, got %v", err)
+		}
+	})
+
+	t.Run("rejects unknown types", func(t *testing.T) {
+		s := &UserService{publisher: events.NewBus(1)}
+		err := s.WatchUsers(context.Background(), []events.Type{"user.renamed"}, nil, nil)
+		if !errors.Is(err, ErrUnknownEventType) {
+			t.Errorf("expected ErrUnknownEventType, got %v", err)
+		}
+	})
+}
+
+// waitForSubscriber waits until the watcher has subscribed to the bus
+func waitForSubscriber(t *testing.T, bus *events.Bus) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for bus.Subscribers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
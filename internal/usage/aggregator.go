@@ -0,0 +1,92 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/model"
+)
+
+// Store persists aggregated usage, adding to any existing totals
+type Store interface {
+	AddUsage(ctx context.Context, records []*model.UsageRecord) error
+}
+
+type bucketKey struct {
+	caller string
+	hour   time.Time
+}
+
+// Aggregator sums per-request meters into hourly buckets per caller and
+// periodically flushes them to a Store
+type Aggregator struct {
+	mu      sync.Mutex
+	store   Store
+	pending map[bucketKey]*model.UsageRecord
+}
+
+// NewAggregator creates a new Aggregator instance
+func NewAggregator(store Store) *Aggregator {
+	return &Aggregator{
+		store:   store,
+		pending: make(map[bucketKey]*model.UsageRecord),
+	}
+}
+
+// Record adds the resources consumed by one request to the caller's bucket
+func (a *Aggregator) Record(caller string, m *Meter, at time.Time) {
+	key := bucketKey{caller: caller, hour: at.UTC().Truncate(time.Hour)}
+	bytesIn, bytesOut := m.Bytes()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	record, ok := a.pending[key]
+	if !ok {
+		record = &model.UsageRecord{Caller: key.caller, Hour: key.hour}
+		a.pending[key] = record
+	}
+	record.Requests++
+	record.DBTimeMs += m.DBTime().Milliseconds()
+	record.CacheOps += m.CacheOps()
+	record.BytesIn += bytesIn
+	record.BytesOut += bytesOut
+}
+
+// Flush writes pending buckets to the store. Buckets that fail to persist
+// are kept and retried on the next flush.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[bucketKey]*model.UsageRecord)
+	a.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	records := make([]*model.UsageRecord, 0, len(pending))
+	for _, record := range pending {
+		records = append(records, record)
+	}
+
+	if err := a.store.AddUsage(ctx, records); err != nil {
+		a.mu.Lock()
+		for key, record := range pending {
+			if current, ok := a.pending[key]; ok {
+				record.Requests += current.Requests
+				record.DBTimeMs += current.DBTimeMs
+				record.CacheOps += current.CacheOps
+				record.BytesIn += current.BytesIn
+				record.BytesOut += current.BytesOut
+			}
+			a.pending[key] = record
+		}
+		a.mu.Unlock()
+		return fmt.Errorf("failed to flush usage: %w", err)
+	}
+
+	return nil
+}
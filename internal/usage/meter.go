@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Meter accumulates the resources consumed while serving a single request.
+// All methods are safe to call on a nil Meter.
+type Meter struct {
+	dbTime   atomic.Int64
+	cacheOps atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+type meterKey struct{}
+
+// NewContext returns a context carrying the meter
+func NewContext(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// FromContext returns the meter stored in ctx, or nil
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	return m
+}
+
+// AddDBTime records time spent waiting on the database
+func (m *Meter) AddDBTime(d time.Duration) {
+	if m != nil {
+		m.dbTime.Add(int64(d))
+	}
+}
+
+// AddCacheOps records cache commands issued
+func (m *Meter) AddCacheOps(n int) {
+	if m != nil {
+		m.cacheOps.Add(int64(n))
+	}
+}
+
+// AddBytes records request and response payload sizes
+func (m *Meter) AddBytes(in, out int) {
+	if m != nil {
+		m.bytesIn.Add(int64(in))
+		m.bytesOut.Add(int64(out))
+	}
+}
+
+// DBTime returns the accumulated database time
+func (m *Meter) DBTime() time.Duration {
+	if m == nil {
+		return 0
+	}
+	return time.Duration(m.dbTime.Load())
+}
+
+// CacheOps returns the accumulated number of cache commands
+func (m *Meter) CacheOps() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.cacheOps.Load()
+}
+
+// Bytes returns the accumulated request and response payload sizes
+func (m *Meter) Bytes() (in, out int64) {
+	if m == nil {
+		return 0, 0
+	}
+	return m.bytesIn.Load(), m.bytesOut.Load()
+}
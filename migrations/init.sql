@@ -13,9 +13,396 @@ CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 -- Create index on created_at for sorting
 CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at DESC);
 
+-- Create users history table (one row per change, written by the repository),
+-- range partitioned by month so retention can drop whole partitions
+CREATE TABLE IF NOT EXISTS users_history (
+    id BIGSERIAL,
+    user_id BIGINT NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id, changed_at)
+) PARTITION BY RANGE (changed_at);
+
+-- Convert a users_history table created before partitioning. Its rows move
+-- to a partitioned copy keeping its columns, defaults and id sequence, with
+-- a monthly partition for each month they span, so the maintenance job never
+-- finds rows of a month it creates in the default partition. Statements are
+-- built with format() so that schema parsing only sees the table above.
+DO $$
+DECLARE
+    month TIMESTAMP;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_class WHERE oid = to_regclass('users_history') AND relkind = 'r') THEN
+        LOCK TABLE users_history IN ACCESS EXCLUSIVE MODE;
+        ALTER TABLE users_history RENAME TO users_history_unpartitioned;
+        ALTER TABLE users_history_unpartitioned RENAME CONSTRAINT users_history_pkey TO users_history_unpartitioned_pkey;
+        ALTER INDEX IF EXISTS idx_users_history_user_id RENAME TO idx_users_history_unpartitioned_user_id;
+        ALTER INDEX IF EXISTS idx_users_history_changed_at RENAME TO idx_users_history_unpartitioned_changed_at;
+        UPDATE users_history_unpartitioned SET changed_at = updated_at WHERE changed_at IS NULL;
+
+        EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS, PRIMARY KEY (id, changed_at)) PARTITION BY RANGE (changed_at)',
+            'users_history', 'users_history_unpartitioned');
+        EXECUTE format('CREATE TABLE %I PARTITION OF %I DEFAULT', 'users_history_default', 'users_history');
+        FOR month IN
+            SELECT generate_series(date_trunc('month', MIN(changed_at) AT TIME ZONE 'UTC'), date_trunc('month', NOW() AT TIME ZONE 'UTC'), INTERVAL '1 month')
+            FROM users_history_unpartitioned
+        LOOP
+            EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                'users_history_p' || to_char(month, 'YYYYMM'), 'users_history',
+                month AT TIME ZONE 'UTC', (month + INTERVAL '1 month') AT TIME ZONE 'UTC');
+        END LOOP;
+
+        INSERT INTO users_history SELECT * FROM users_history_unpartitioned;
+        ALTER SEQUENCE users_history_id_seq OWNED BY users_history.id;
+        DROP TABLE users_history_unpartitioned;
+    END IF;
+END
+$$;
+
+-- Create default partition for changes outside the monthly partitions that
+-- the partition maintenance job creates ahead of time
+CREATE TABLE IF NOT EXISTS users_history_default PARTITION OF users_history DEFAULT;
+
+-- Create index on user_id for per-user history lookups
+CREATE INDEX IF NOT EXISTS idx_users_history_user_id ON users_history(user_id, changed_at DESC);
+
+-- Create index on changed_at for retention pruning
+CREATE INDEX IF NOT EXISTS idx_users_history_changed_at ON users_history(changed_at);
+
+-- Create hourly usage table for per-caller cost accounting
+CREATE TABLE IF NOT EXISTS usage_hourly (
+    caller VARCHAR(255) NOT NULL,
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    db_time_ms BIGINT NOT NULL DEFAULT 0,
+    cache_ops BIGINT NOT NULL DEFAULT 0,
+    bytes_in BIGINT NOT NULL DEFAULT 0,
+    bytes_out BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (caller, hour)
+);
+
+-- Create index on hour for report range scans
+CREATE INDEX IF NOT EXISTS idx_usage_hourly_hour ON usage_hourly(hour);
+
+-- Create backups table for logical dump metadata
+CREATE TABLE IF NOT EXISTS backups (
+    id BIGSERIAL PRIMARY KEY,
+    object_key VARCHAR(512) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    row_counts JSONB NOT NULL DEFAULT '{}',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE,
+    verify_status VARCHAR(20) NOT NULL DEFAULT '',
+    verify_error TEXT NOT NULL DEFAULT '',
+    verified_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create index on started_at for listing recent backups
+CREATE INDEX IF NOT EXISTS idx_backups_started_at ON backups(started_at DESC);
+
+-- Create pending registrations table for self-registration email verification
+CREATE TABLE IF NOT EXISTS pending_registrations (
+    id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    token_hash BYTEA UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create index on expires_at for cleanup of stale registrations
+CREATE INDEX IF NOT EXISTS idx_pending_registrations_expires_at ON pending_registrations(expires_at);
+
+-- Create invitations table for the invite onboarding workflow
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    invited_by VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    token_version INT NOT NULL DEFAULT 1,
+    send_count INT NOT NULL DEFAULT 1,
+    user_id BIGINT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    accepted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create unique index so an email has at most one pending invitation
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_pending_email ON invitations(email) WHERE status = 'pending';
+
+-- Create index on created_at for listing pending invitations
+CREATE INDEX IF NOT EXISTS idx_invitations_created_at ON invitations(created_at DESC);
+
+-- Create organizations table
+CREATE TABLE IF NOT EXISTS organizations (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(63) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create organization memberships table with per-organization roles
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+-- Create index on user_id for listing the organizations of a user
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+
+-- Create index on (created_at, id) for keyset pagination of users
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users(created_at DESC, id DESC);
+
+-- Add soft delete column; deleted users keep their row until purged
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Restrict email uniqueness to users that are not deleted
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_active ON users(email) WHERE deleted_at IS NULL;
+
+-- Create index on lower(name) for case-insensitive prefix search
+CREATE INDEX IF NOT EXISTS idx_users_lower_name ON users(lower(name) text_pattern_ops);
+
+-- Add globally unique user identifiers for federation; unlike sequential IDs
+-- they do not reveal how many users exist
+ALTER TABLE users ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT gen_random_uuid();
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_uuid ON users(uuid);
+
+-- Record the user UUID in its history; NULL for changes recorded before it existed
+ALTER TABLE users_history ADD COLUMN IF NOT EXISTS user_uuid UUID;
+
+-- Add client-defined metadata attributes, indexed for containment and key
+-- existence filters
+ALTER TABLE users ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS idx_users_metadata ON users USING GIN (metadata);
+
+-- Record user metadata in its history
+ALTER TABLE users_history ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+-- Record the transaction that wrote each change. IDs are drawn before their
+-- transactions commit, so a change can become visible after later IDs; sync
+-- orders changes by transaction instead and only reads those of transactions
+-- older than every one still running. Stored as BIGINT, which the 64-bit
+-- transaction ID fits in, to compare it with sync tokens directly.
+ALTER TABLE users_history ADD COLUMN IF NOT EXISTS txid BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint;
+CREATE INDEX IF NOT EXISTS idx_users_history_txid ON users_history(txid, id);
+
+-- URL of the user's uploaded avatar; empty when none was uploaded
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+
+-- Create API keys for service-to-service callers; only SHA-256 hashes of the
+-- keys are stored. A rotated key's previous hash stays valid until
+-- previous_expires_at so callers can roll over without downtime.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    roles TEXT[] NOT NULL DEFAULT '{}',
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    previous_hash CHAR(64),
+    previous_expires_at TIMESTAMP WITH TIME ZONE,
+    rate_limit INT NOT NULL DEFAULT 0,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    rotated_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_previous_hash ON api_keys(previous_hash) WHERE previous_hash IS NOT NULL;
+
+-- argon2id hash of the user's password in PHC format; NULL when none is set
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+
+-- Login sessions. Refresh tokens are stored as hex SHA-256 hashes and
+-- replaced on every refresh; presenting a replaced one revokes the session.
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_hash CHAR(64) NOT NULL UNIQUE,
+    previous_hash CHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    refreshed_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_hash ON sessions(previous_hash) WHERE previous_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Audit trail of mutating RPCs. diff maps each changed field of the target
+-- user to its values before and after the call, as stored.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    method VARCHAR(255) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    target_user_id BIGINT,
+    code VARCHAR(32) NOT NULL,
+    diff JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_user_id ON audit_events(target_user_id, created_at DESC) WHERE target_user_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor, created_at DESC);
+
+-- IANA time zone and BCP 47 locale of each user, for sending at local
+-- times; empty when unknown. Users joining an organization take its
+-- defaults for the fields they lack.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS default_timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS default_locale TEXT NOT NULL DEFAULT '';
+
+-- Numbers of users, overall (organization_id 0) and per organization, by
+-- status: active or deleted. Listings and counts read these instead of
+-- scanning users. Triggers keep them in step with every write, including
+-- cascades. Each count is spread over 16 slots picked at random by writers,
+-- so concurrent creates do not queue on one row; readers sum the slots.
+CREATE TABLE IF NOT EXISTS users_counters (
+    organization_id BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    slot SMALLINT NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (organization_id, status, slot)
+);
+
+CREATE OR REPLACE FUNCTION users_status(deleted_at TIMESTAMP WITH TIME ZONE) RETURNS VARCHAR AS $$
+    SELECT CASE WHEN deleted_at IS NULL THEN 'active' ELSE 'deleted' END
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION users_counters_add(org BIGINT, st VARCHAR, delta BIGINT) RETURNS void AS $$
+    INSERT INTO users_counters (organization_id, status, slot, count)
+    VALUES (org, st, floor(random() * 16)::smallint, delta)
+    ON CONFLICT (organization_id, status, slot) DO UPDATE SET count = users_counters.count + EXCLUDED.count
+$$ LANGUAGE sql;
+
+CREATE OR REPLACE FUNCTION users_counters_on_user() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND users_status(OLD.deleted_at) = users_status(NEW.deleted_at) THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM users_counters_add(0, users_status(OLD.deleted_at), -1);
+        PERFORM users_counters_add(organization_id, users_status(OLD.deleted_at), -1)
+            FROM organization_members WHERE user_id = OLD.id;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        -- Fired before the delete, while the memberships still exist
+        RETURN OLD;
+    END IF;
+    PERFORM users_counters_add(0, users_status(NEW.deleted_at), 1);
+    PERFORM users_counters_add(organization_id, users_status(NEW.deleted_at), 1)
+        FROM organization_members WHERE user_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION users_counters_on_member() RETURNS trigger AS $$
+BEGIN
+    -- Memberships removed along with their user find no user row; the user
+    -- trigger counted them off already
+    IF TG_OP = 'DELETE' THEN
+        PERFORM users_counters_add(OLD.organization_id, users_status(deleted_at), -1)
+            FROM users WHERE id = OLD.user_id;
+    ELSE
+        PERFORM users_counters_add(NEW.organization_id, users_status(deleted_at), 1)
+            FROM users WHERE id = NEW.user_id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- Recounts from scratch, correcting any drift. Writers wait meanwhile.
+CREATE OR REPLACE FUNCTION users_counters_rebuild() RETURNS void AS $$
+BEGIN
+    LOCK TABLE users_counters IN EXCLUSIVE MODE;
+    DELETE FROM users_counters;
+    INSERT INTO users_counters (organization_id, status, slot, count)
+    SELECT 0, users_status(deleted_at), 0, COUNT(*) FROM users GROUP BY 1, 2
+    UNION ALL
+    SELECT m.organization_id, users_status(u.deleted_at), 0, COUNT(*)
+    FROM organization_members m JOIN users u ON u.id = m.user_id
+    GROUP BY 1, 2;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_counters_write ON users;
+CREATE TRIGGER users_counters_write AFTER INSERT OR UPDATE OF deleted_at ON users
+    FOR EACH ROW EXECUTE FUNCTION users_counters_on_user();
+DROP TRIGGER IF EXISTS users_counters_delete ON users;
+CREATE TRIGGER users_counters_delete BEFORE DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION users_counters_on_user();
+DROP TRIGGER IF EXISTS users_counters_member ON organization_members;
+CREATE TRIGGER users_counters_member AFTER INSERT OR DELETE ON organization_members
+    FOR EACH ROW EXECUTE FUNCTION users_counters_on_member();
+
+SELECT users_counters_rebuild();
+
+-- Queue of GDPR erasures, worked by the erasure job. Every step of an
+-- erasure can run again, so a failed or interrupted one is retried from the
+-- start at next_attempt_at. Rows outlive the user as proof of the erasure.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    requested_by VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_erasure_requests_pending_user ON erasure_requests(user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_next_attempt_at ON erasure_requests(next_attempt_at) WHERE status = 'pending';
+
+-- Queue of user reports, worked by the report job. A failed report is
+-- retried at next_attempt_at until it runs out of attempts. The filter is
+-- kept as given, so a retry reports the same users.
+CREATE TABLE IF NOT EXISTS user_reports (
+    id BIGSERIAL PRIMARY KEY,
+    format VARCHAR(10) NOT NULL,
+    filter JSONB NOT NULL DEFAULT '{}',
+    requested_by VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    object_key TEXT NOT NULL DEFAULT '',
+    row_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_user_reports_next_attempt_at ON user_reports(next_attempt_at) WHERE status = 'pending';
+
+-- Guests are created without an email for try-before-signup flows and
+-- hold a unique placeholder under guest.invalid until UpgradeGuest attaches
+-- a real email and a password
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest BOOLEAN NOT NULL DEFAULT false;
+
+-- Support engineer who made an audited call with an impersonation token,
+-- acting as the actor; empty for calls made with the caller's own
+-- credentials
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_audit_events_impersonator ON audit_events(impersonator, created_at DESC) WHERE impersonator <> '';
+
+-- User a duplicate account was merged into by MergeUsers. It is set on the
+-- deleted source, which can then no longer be restored.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS merged_into BIGINT;
+
 -- Insert sample data
 INSERT INTO users (email, name) VALUES 
     ('john@example.com', 'John Doe'),
     ('jane@example.com', 'Jane Smith'),
     ('bob@example.com', 'Bob Wilson')
-ON CONFLICT (email) DO NOTHING;
+ON CONFLICT (email) WHERE deleted_at IS NULL DO NOTHING;
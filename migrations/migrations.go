@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations so the server can compare
+// the live schema against them without shipping the files separately
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
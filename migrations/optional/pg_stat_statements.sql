@@ -0,0 +1,6 @@
+-- Enable statement statistics for the index advisor's slow statement
+-- sampling. Optional and not part of the migrations: creating the extension
+-- takes a superuser (or a managed service's admin role), and the server must
+-- load it with shared_preload_libraries = 'pg_stat_statements'. Without it
+-- the advisor samples table statistics only.
+CREATE EXTENSION IF NOT EXISTS pg_stat_statements;
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/deadline"
+)
+
+// usageHook counts Redis commands against the request's usage meter
+type usageHook struct{}
+
+// DialHook implements redis.Hook
+func (usageHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook
+func (usageHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		usage.FromContext(ctx).AddCacheOps(1)
+		return next(ctx, cmd)
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (usageHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		usage.FromContext(ctx).AddCacheOps(len(cmds))
+		return next(ctx, cmds)
+	}
+}
+
+// deadlineHook bounds each command by its share of the request deadline
+type deadlineHook struct{}
+
+// DialHook implements redis.Hook
+func (deadlineHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook
+func (deadlineHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, call := deadline.Start(ctx)
+		defer call.End("redis")
+		return next(ctx, cmd)
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (deadlineHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, call := deadline.Start(ctx)
+		defer call.End("redis")
+		return next(ctx, cmds)
+	}
+}
+
+// spanHook records each command as a child span of the caller's span.
+// Keys are recorded as patterns with their variable parts masked, e.g.
+// user:? for user:42, and values never. Commands outside a recorded trace
+// are not traced.
+type spanHook struct {
+	tracer trace.Tracer
+}
+
+func newSpanHook() spanHook {
+	return spanHook{tracer: otel.Tracer("github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache")}
+}
+
+// DialHook implements redis.Hook
+func (spanHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook
+func (h spanHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !trace.SpanFromContext(ctx).IsRecording() {
+			return next(ctx, cmd)
+		}
+
+		attrs := []attribute.KeyValue{semconv.DBSystemRedis, semconv.DBOperation(cmd.Name())}
+		if key := cmdKey(cmd); key != "" {
+			attrs = append(attrs, attribute.String("db.redis.key", keyPattern(key)))
+		}
+		ctx, span := h.tracer.Start(ctx, "redis "+cmd.Name(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...))
+		defer span.End()
+
+		err := next(ctx, cmd)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (h spanHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !trace.SpanFromContext(ctx).IsRecording() {
+			return next(ctx, cmds)
+		}
+
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := h.tracer.Start(ctx, "redis pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemRedis,
+				semconv.DBOperation("pipeline"),
+				attribute.StringSlice("db.redis.commands", names),
+			))
+		defer span.End()
+
+		err := next(ctx, cmds)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// endSpan marks the span failed unless the command succeeded or only
+// missed a key
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// cmdKey returns the first key of a command, which follows its name for
+// every command the service issues
+func cmdKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	key, _ := args[1].(string)
+	return key
+}
+
+// keyPattern masks the segments of a key holding ids, emails or hashes,
+// i.e. anything but lowercase words
+func keyPattern(key string) string {
+	segments := strings.Split(key, ":")
+	for i, s := range segments {
+		if strings.IndexFunc(s, func(r rune) bool { return (r < 'a' || r > 'z') && r != '_' && r != '-' }) >= 0 || s == "" {
+			segments[i] = "?"
+		}
+	}
+	return strings.Join(segments, ":")
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolTotalDesc = prometheus.NewDesc("redis_pool_total_conns",
+		"Connections in the pool.", nil, nil)
+	poolIdleDesc = prometheus.NewDesc("redis_pool_idle_conns",
+		"Idle connections in the pool.", nil, nil)
+	poolMaxDesc = prometheus.NewDesc("redis_pool_max_conns",
+		"Maximum size of the pool.", nil, nil)
+	poolHitsDesc = prometheus.NewDesc("redis_pool_hits_total",
+		"Commands that found an idle connection in the pool.", nil, nil)
+	poolMissesDesc = prometheus.NewDesc("redis_pool_misses_total",
+		"Commands that found no idle connection in the pool.", nil, nil)
+	poolTimeoutsDesc = prometheus.NewDesc("redis_pool_timeouts_total",
+		"Commands that failed waiting for a connection from an exhausted pool.", nil, nil)
+	poolStaleDesc = prometheus.NewDesc("redis_pool_stale_conns_total",
+		"Connections removed from the pool as stale.", nil, nil)
+)
+
+// PoolCollector exports the statistics of the connection pool of a Redis
+// client, so that an exhausted pool is noticed before commands time out
+type PoolCollector struct {
+	redis *Redis
+}
+
+// NewPoolCollector creates a new PoolCollector instance
+func NewPoolCollector(r *Redis) *PoolCollector {
+	return &PoolCollector{redis: r}
+}
+
+// Describe implements prometheus.Collector
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolTotalDesc
+	ch <- poolIdleDesc
+	ch <- poolMaxDesc
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+	ch <- poolStaleDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.redis.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(c.redis.client.Options().PoolSize))
+	ch <- prometheus.MustNewConstMetric(poolHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(poolMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(poolTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(poolStaleDesc, prometheus.CounterValue, float64(stats.StaleConns))
+}
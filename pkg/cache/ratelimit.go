@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeTokenScript refills the token bucket in KEYS[1] at ARGV[1] tokens per
+// second up to ARGV[2] tokens and takes one token if there is one. The time
+// comes from the Redis server so instances with skewed clocks agree. It
+// returns whether a token was taken and otherwise the milliseconds until
+// one will be available.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+// TakeToken takes a token from the bucket stored at key, which holds up to
+// burst tokens and refills at perSecond tokens per second. When the bucket
+// is empty it returns false and how long until a token is available. The
+// bucket expires once it would be full again.
+func (r *Redis) TakeToken(ctx context.Context, key string, perSecond float64, burst int) (bool, time.Duration, error) {
+	res, err := takeTokenScript.Run(ctx, r.client, []string{key}, perSecond, burst).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take token: %w", err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("failed to take token: unexpected reply %v", res)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// windowAddScript logs an event at the Redis server time in the sorted set
+// KEYS[1], drops events older than ARGV[1] milliseconds and returns how
+// many remain
+var windowAddScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+redis.call('ZADD', KEYS[1], now, t[1] .. '.' .. t[2] .. '-' .. math.random(1000000))
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window * 1000)
+redis.call('PEXPIRE', KEYS[1], window)
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// windowCountScript returns the number of events in the sorted set KEYS[1]
+// within the last ARGV[1] milliseconds, and the microseconds since the
+// latest of them
+var windowCountScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local count = redis.call('ZCOUNT', KEYS[1], now - window * 1000, '+inf')
+if count == 0 then
+	return {0, 0}
+end
+local latest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+return {count, now - tonumber(latest[2])}
+`)
+
+// AddToWindow logs an event in the sliding window stored at key and returns
+// the number of events within the last window, the new one included
+func (r *Redis) AddToWindow(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := windowAddScript.Run(ctx, r.client, []string{key}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add to window: %w", err)
+	}
+	return n, nil
+}
+
+// CountWindow returns the number of events logged by AddToWindow at key
+// within the last window, and how long ago the latest of them happened
+func (r *Redis) CountWindow(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	res, err := windowCountScript.Run(ctx, r.client, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count window: %w", err)
+	}
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("failed to count window: unexpected reply %v", res)
+	}
+	return res[0], time.Duration(res[1]) * time.Microsecond, nil
+}
+
+// TTL returns how long key has left to live, or zero when it does not
+// exist or never expires
+func (r *Redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
@@ -2,8 +2,12 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log/slog"
+	"math/rand"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -14,15 +18,46 @@ import (
 // Redis wraps the Redis client
 type Redis struct {
 	client *redis.Client
+	// jitter is the fraction by which Set and SetMany vary expirations
+	jitter float64
 }
 
 // NewRedis creates a new Redis client
 func NewRedis(cfg config.RedisConfig) (*Redis, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	password, _ := cfg.Password.Inline()
+	opts := &redis.Options{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Username:     cfg.Username,
+		Password:     password,
+		DB:           cfg.DB,
+		TLSConfig:    tlsConfig,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		// Lets per-call deadlines, such as dependency budgets, bound socket I/O
+		ContextTimeoutEnabled: true,
+	}
+	if !cfg.Password.Static() {
+		// Passwords from files or Vault are resolved per connection, so
+		// rotations apply to new connections
+		opts.CredentialsProvider = func() (string, string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			password, err := cfg.Password.Value(ctx)
+			if err != nil {
+				slog.Error("failed to get Redis password", slog.String("error", err.Error()))
+			}
+			return cfg.Username, password
+		}
+	}
+	client := redis.NewClient(opts)
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -32,11 +67,57 @@ func NewRedis(cfg config.RedisConfig) (*Redis, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	client.AddHook(deadlineHook{})
+	client.AddHook(usageHook{})
+	client.AddHook(newSpanHook())
+
 	slog.Info("connected to Redis",
 		slog.String("host", cfg.Host),
-		slog.Int("port", cfg.Port))
+		slog.Int("port", cfg.Port),
+		slog.Bool("tls", cfg.TLS))
 
-	return &Redis{client: client}, nil
+	return &Redis{client: client, jitter: cfg.TTLJitter}, nil
+}
+
+// newTLSConfig returns the TLS settings of the connection, or nil when TLS
+// is disabled
+func newTLSConfig(cfg config.RedisConfig) (*tls.Config, error) {
+	if !cfg.TLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+	if cfg.TLSSkipVerify {
+		slog.Warn("Redis TLS certificate verification is disabled")
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA file %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 // Get retrieves a value from Redis
@@ -44,16 +125,151 @@ func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 	return r.client.Get(ctx, key).Result()
 }
 
-// Set stores a value in Redis with expiration
+// Set stores a value in Redis with expiration, varied by the configured
+// jitter so keys written in bursts do not all expire at once
 func (r *Redis) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return r.client.Set(ctx, key, value, jitterTTL(expiration, r.jitter)).Err()
+}
+
+// SetExact stores a value in Redis with exactly expiration, for keys whose
+// lifetime matters, such as locks and revocations
+func (r *Redis) SetExact(ctx context.Context, key string, value string, expiration time.Duration) error {
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetIfAbsent stores a value with exactly expiration unless key is already
+// set, and reports whether it stored it
+func (r *Redis) SetIfAbsent(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+// jitterTTL varies ttl randomly by up to fraction of it either way. Zero
+// and negative TTLs, which mean no expiration, are kept.
+func jitterTTL(ttl time.Duration, fraction float64) time.Duration {
+	if ttl <= 0 || fraction <= 0 {
+		return ttl
+	}
+	spread := time.Duration(float64(ttl) * fraction)
+	if spread <= 0 {
+		return ttl
+	}
+	return ttl - spread + time.Duration(rand.Int63n(int64(2*spread)+1))
+}
+
+// MGet retrieves several values in one round trip; missing keys yield an
+// empty string at their position
+func (r *Redis) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			result[i] = s
+		}
+	}
+	return result, nil
+}
+
+// SetMany stores several values in one round trip, each expiring after
+// expiration varied by the configured jitter
+func (r *Redis) SetMany(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	return r.setMany(ctx, values, expiration, r.jitter)
+}
+
+// SetManyExact stores several values expiring after exactly expiration in
+// one round trip
+func (r *Redis) SetManyExact(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	return r.setMany(ctx, values, expiration, 0)
+}
+
+func (r *Redis) setMany(ctx context.Context, values map[string]string, expiration time.Duration, jitter float64) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(ctx, key, value, jitterTTL(expiration, jitter))
+		}
+		return nil
+	})
+	return err
+}
+
+// Exists reports whether a key is set
+func (r *Redis) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := r.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
 // Delete removes a key from Redis
 func (r *Redis) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
 
+// DeleteMany removes several keys in one round trip. Keys are deleted one by
+// one within a pipeline so that they may live on different cluster slots.
+func (r *Redis) DeleteMany(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// FlushProgress reports how far a DeleteMatching call has got
+type FlushProgress struct {
+	// Scanned counts the matching keys seen so far; SCAN may return a key
+	// more than once
+	Scanned int64
+	// Deleted counts the keys actually removed so far
+	Deleted int64
+}
+
+// DeleteMatching removes the keys matching a glob pattern. Keys are found
+// with SCAN, never KEYS, and removed with UNLINK in batches of about
+// batchSize keys so that Redis keeps serving other clients meanwhile. fn is
+// called after each batch and stops the flush when it returns an error.
+func (r *Redis) DeleteMatching(ctx context.Context, pattern string, batchSize int64, fn func(FlushProgress) error) (FlushProgress, error) {
+	var (
+		progress FlushProgress
+		cursor   uint64
+	)
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, pattern, batchSize).Result()
+		if err != nil {
+			return progress, fmt.Errorf("failed to scan keys: %w", err)
+		}
+
+		if len(keys) > 0 {
+			deleted, err := r.client.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return progress, fmt.Errorf("failed to unlink keys: %w", err)
+			}
+			progress.Scanned += int64(len(keys))
+			progress.Deleted += deleted
+
+			if err := fn(progress); err != nil {
+				return progress, err
+			}
+		}
+
+		if next == 0 {
+			return progress, nil
+		}
+		cursor = next
+	}
+}
+
+// Ping checks that Redis is reachable
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 // Close closes the Redis connection
 func (r *Redis) Close() error {
 	return r.client.Close()
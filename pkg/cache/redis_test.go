@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig(config.RedisConfig{Host: "redis"})
+		if err != nil || tlsConfig != nil {
+			t.Errorf("expected no TLS config, got %v, %v", tlsConfig, err)
+		}
+	})
+
+	t.Run("verifies the host by default", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig(config.RedisConfig{Host: "redis.example.com", TLS: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tlsConfig.ServerName != "redis.example.com" || tlsConfig.InsecureSkipVerify {
+			t.Errorf("unexpected TLS config %+v", tlsConfig)
+		}
+	})
+
+	t.Run("rejects a CA file without certificates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newTLSConfig(config.RedisConfig{TLS: true, TLSCAFile: path}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestKeyPattern(t *testing.T) {
+	tests := map[string]string{
+		"users:list":                  "users:list",
+		"user:42":                     "user:?",
+		"user:email:jane@example.com": "user:email:?",
+		"session:revoked:7":           "session:revoked:?",
+		"apikey:9f86d081884c7d65":     "apikey:?",
+	}
+	for key, want := range tests {
+		if got := keyPattern(key); got != want {
+			t.Errorf("keyPattern(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestJitterTTL(t *testing.T) {
+	t.Run("stays within the fraction", func(t *testing.T) {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 100; i++ {
+			ttl := jitterTTL(5*time.Minute, 0.1)
+			if ttl < 270*time.Second || ttl > 330*time.Second {
+				t.Fatalf("jitterTTL() = %s, want within 5m ± 30s", ttl)
+			}
+			seen[ttl] = true
+		}
+		if len(seen) < 2 {
+			t.Error("jitterTTL() returned the same TTL every time")
+		}
+	})
+
+	t.Run("keeps exact and unlimited TTLs", func(t *testing.T) {
+		if ttl := jitterTTL(time.Minute, 0); ttl != time.Minute {
+			t.Errorf("jitterTTL() without jitter = %s, want 1m", ttl)
+		}
+		if ttl := jitterTTL(0, 0.1); ttl != 0 {
+			t.Errorf("jitterTTL(0) = %s, want 0", ttl)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader serves a certificate, and optionally a client CA bundle, from
+// files that are replaced while the server runs, e.g. by cert-manager.
+// Handshakes use the files as of the last successful load; a failed reload
+// keeps the previous ones.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu       sync.Mutex
+	modTimes []time.Time
+
+	config atomic.Pointer[tls.Config]
+}
+
+// NewReloader loads the certificate and key, and when clientCAFile is not
+// empty, the CA bundle client certificates must be signed by
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerConfig returns a server TLS configuration resolving the current
+// files on every handshake
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load(), nil
+		},
+	}
+}
+
+// Run reloads the files when any of them changed since the last load. It is
+// meant to be scheduled at a fixed interval.
+func (r *Reloader) Run(context.Context) error {
+	reloaded, err := r.reload()
+	if err != nil {
+		return err
+	}
+	if reloaded {
+		slog.Info("TLS certificates reloaded", slog.String("cert_file", r.certFile))
+	}
+	return nil
+}
+
+// reload loads the files unless they are unchanged, reporting whether it
+// did
+func (r *Reloader) reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+	if r.modTimes != nil && slices.Equal(modTimes, r.modTimes) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// grpc only advertises HTTP/2 on the base configuration
+		NextProtos: []string{"h2"},
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates found in client CA file %s", r.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.config.Store(config)
+	r.modTimes = modTimes
+	return true, nil
+}
+
+// stat returns the modification times of the files
+func (r *Reloader) stat() ([]time.Time, error) {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+
+	modTimes := make([]time.Time, len(files))
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat TLS file: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
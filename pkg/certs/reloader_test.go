@@ -0,0 +1,132 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name and its key to dir
+func writeCert(t *testing.T, dir, name string, modTime time.Time) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// servedName returns the common name of the certificate served to clients
+func servedName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	config, err := r.ServerConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	t.Run("serves rotated certificates", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "first", start)
+
+		r, err := NewReloader(certFile, keyFile, "")
+		if err != nil {
+			t.Fatalf("NewReloader() error = %v", err)
+		}
+		if got := servedName(t, r); got != "first" {
+			t.Errorf("served %q, want first", got)
+		}
+
+		writeCert(t, dir, "second", start.Add(time.Minute))
+		if err := r.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if got := servedName(t, r); got != "second" {
+			t.Errorf("served %q after rotation, want second", got)
+		}
+	})
+
+	t.Run("keeps the previous certificate when a reload fails", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "first", start)
+
+		r, err := NewReloader(certFile, keyFile, "")
+		if err != nil {
+			t.Fatalf("NewReloader() error = %v", err)
+		}
+
+		if err := os.WriteFile(keyFile, []byte("truncated"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Run(context.Background()); err == nil {
+			t.Error("Run() error = nil, want error for an invalid key")
+		}
+		if got := servedName(t, r); got != "first" {
+			t.Errorf("served %q, want first", got)
+		}
+	})
+
+	t.Run("requires client certificates signed by the client CA", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "server", start)
+
+		r, err := NewReloader(certFile, keyFile, certFile)
+		if err != nil {
+			t.Fatalf("NewReloader() error = %v", err)
+		}
+		config, _ := r.ServerConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+		if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+			t.Errorf("ClientAuth = %v, want RequireAndVerifyClientCert with client CAs", config.ClientAuth)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/reqsign"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// Client is a UserService client for consumer services
+type Client struct {
+	pb.UserServiceClient
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	// flights coalesces GetUser calls; nil unless WithCoalescing is set
+	flights *singleflight.Group
+	metrics *Metrics
+}
+
+// Option configures a Client
+type Option func(*options)
+
+type options struct {
+	creds        credentials.TransportCredentials
+	metrics      *Metrics
+	dialOptions  []grpc.DialOption
+	preDial      time.Duration
+	preResolve   time.Duration
+	waitForReady *bool
+	coalesce     bool
+	signingKey   []byte
+}
+
+// WithTransportCredentials sets the transport credentials; connections are
+// insecure by default
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *options) {
+		o.creds = creds
+	}
+}
+
+// WithMetrics records per-method latency, status codes, retries and
+// connection state transitions to the given collector
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithDialOptions appends raw gRPC dial options
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOptions = append(o.dialOptions, opts...)
+	}
+}
+
+// WithPreDial establishes the connection at construction and waits up to
+// timeout for it to become ready, so the first call does not pay the
+// connection setup cost. New fails if the connection is not ready in time.
+func WithPreDial(timeout time.Duration) Option {
+	return func(o *options) {
+		o.preDial = timeout
+	}
+}
+
+// WithPreResolve resolves the target host at construction, warming resolver
+// caches and failing fast on unresolvable names
+func WithPreResolve(timeout time.Duration) Option {
+	return func(o *options) {
+		o.preResolve = timeout
+	}
+}
+
+// WithWaitForReady sets the default wait-for-ready behavior of every call.
+// Individual calls can override it by passing grpc.WaitForReady.
+func WithWaitForReady(waitForReady bool) Option {
+	return func(o *options) {
+		o.waitForReady = &waitForReady
+	}
+}
+
+// WithCoalescing makes concurrent identical GetUser calls share one RPC, as
+// fan-out heavy callers often ask for the same user many times at once.
+// Calls are identical when their requests and outgoing metadata are equal.
+func WithCoalescing() Option {
+	return func(o *options) {
+		o.coalesce = true
+	}
+}
+
+// WithRequestSigning signs every call with key, for servers requiring
+// signed requests on sensitive methods
+func WithRequestSigning(key []byte) Option {
+	return func(o *options) {
+		o.signingKey = key
+	}
+}
+
+// New creates a new Client connected to target
+func New(target string, opts ...Option) (*Client, error) {
+	o := &options{creds: insecure.NewCredentials()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.preResolve > 0 {
+		if err := preResolve(target, o.preResolve); err != nil {
+			return nil, err
+		}
+	}
+
+	// Calls join the caller's trace through the global tracer provider
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(o.creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if o.waitForReady != nil {
+		dialOptions = append(dialOptions, grpc.WithDefaultCallOptions(grpc.WaitForReady(*o.waitForReady)))
+	}
+	if o.metrics != nil {
+		dialOptions = append(dialOptions,
+			grpc.WithChainUnaryInterceptor(o.metrics.UnaryClientInterceptor()),
+			grpc.WithStatsHandler(o.metrics.statsHandler()),
+		)
+	}
+	if len(o.signingKey) > 0 {
+		dialOptions = append(dialOptions,
+			grpc.WithChainUnaryInterceptor(reqsign.UnaryClientInterceptor(o.signingKey)),
+			grpc.WithChainStreamInterceptor(reqsign.StreamClientInterceptor(o.signingKey)),
+		)
+	}
+	dialOptions = append(dialOptions, o.dialOptions...)
+
+	conn, err := grpc.Dial(target, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", target, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if o.metrics != nil {
+		go o.metrics.watchConnState(ctx, conn)
+	}
+
+	if o.preDial > 0 {
+		if err := preDial(conn, o.preDial); err != nil {
+			cancel()
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	c := &Client{
+		UserServiceClient: pb.NewUserServiceClient(conn),
+		conn:              conn,
+		cancel:            cancel,
+		metrics:           o.metrics,
+	}
+	if o.coalesce {
+		c.flights = &singleflight.Group{}
+	}
+	return c, nil
+}
+
+// Conn returns the underlying gRPC connection
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	c.cancel()
+	return c.conn.Close()
+}
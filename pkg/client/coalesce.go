@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// GetUser gets a user. With WithCoalescing, concurrent calls for the same
+// request and outgoing metadata share one RPC; calls passing call options
+// are always sent on their own since the options may differ.
+func (c *Client) GetUser(ctx context.Context, req *pb.GetUserRequest, opts ...grpc.CallOption) (*pb.UserResponse, error) {
+	if c.flights == nil || len(opts) > 0 {
+		return c.UserServiceClient.GetUser(ctx, req, opts...)
+	}
+	key, err := coalesceKey(ctx, req)
+	if err != nil {
+		return c.UserServiceClient.GetUser(ctx, req)
+	}
+
+	ch := c.flights.DoChan(key, func() (interface{}, error) {
+		// The shared call must not fail because the caller that happened to
+		// start it went away, but it keeps that caller's deadline
+		callCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithDeadline(callCtx, deadline)
+			defer cancel()
+		}
+		return c.UserServiceClient.GetUser(callCtx, req)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		resp := res.Val.(*pb.UserResponse)
+		if res.Shared {
+			if c.metrics != nil {
+				c.metrics.coalesced.WithLabelValues(pb.UserService_GetUser_FullMethodName).Inc()
+			}
+			// Callers own their response and may modify it
+			resp = proto.Clone(resp).(*pb.UserResponse)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// coalesceKey identifies calls that can share a response: the same request
+// sent with the same outgoing metadata, so callers with different
+// credentials never share
+func coalesceKey(ctx context.Context, req proto.Message) (string, error) {
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(len(body)) + ":")
+	b.Write(body)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			b.WriteString("\x00" + k + "\x00" + v)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+)
+
+// slowUsers answers GetUser once release is closed
+type slowUsers struct {
+	pb.UserServiceClient
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *slowUsers) GetUser(_ context.Context, req *pb.GetUserRequest, _ ...grpc.CallOption) (*pb.UserResponse, error) {
+	s.calls.Add(1)
+	<-s.release
+	return &pb.UserResponse{User: &pb.User{Id: req.Id}}, nil
+}
+
+func TestCoalescing(t *testing.T) {
+	t.Run("concurrent identical calls share one RPC", func(t *testing.T) {
+		users := &slowUsers{release: make(chan struct{})}
+		c := &Client{UserServiceClient: users, flights: &singleflight.Group{}}
+
+		var wg sync.WaitGroup
+		responses := make([]*pb.UserResponse, 5)
+		for i := range responses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resp, err := c.GetUser(context.Background(), &pb.GetUserRequest{Id: 7})
+				if err != nil {
+					t.Error(err)
+				}
+				responses[i] = resp
+			}(i)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(users.release)
+		wg.Wait()
+
+		if n := users.calls.Load(); n != 1 {
+			t.Errorf("sent %d RPCs, want 1", n)
+		}
+		if responses[0] == responses[1] || responses[0].GetUser().GetId() != 7 {
+			t.Error("callers should get their own copy of the response")
+		}
+	})
+
+	t.Run("calls with different credentials are not shared", func(t *testing.T) {
+		req := &pb.GetUserRequest{Id: 7}
+		alice, _ := coalesceKey(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer alice"), req)
+		bob, _ := coalesceKey(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer bob"), req)
+		again, _ := coalesceKey(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer alice"), req)
+		if alice == bob || alice != again {
+			t.Error("keys should differ exactly when the metadata differs")
+		}
+	})
+}
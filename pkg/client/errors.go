@@ -0,0 +1,86 @@
+package client
+
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Class tells callers what to do about an error returned by the service
+type Class int
+
+const (
+	// Success is the class of a nil error
+	Success Class = iota
+	// Retryable errors mean the service did not process the call, e.g. it
+	// was overloaded or unreachable; the same call may be sent again after
+	// RetryDelay
+	Retryable
+	// Conflict errors mean the call clashed with the current state, e.g. an
+	// email already in use, a write to a read-only region or a batch
+	// aborted by another item; retrying unchanged fails again, re-read the
+	// state or fix the request first
+	Conflict
+	// NotRetryable errors are final: invalid or unauthorized calls, missing
+	// resources, and failures after which the call may have been applied
+	NotRetryable
+)
+
+// String returns the name of the class
+func (c Class) String() string {
+	switch c {
+	case Success:
+		return "success"
+	case Retryable:
+		return "retryable"
+	case Conflict:
+		return "conflict"
+	default:
+		return "not_retryable"
+	}
+}
+
+// Classify returns the class of an error returned by a call. Calls that
+// timed out may have been applied, so DeadlineExceeded is only retryable
+// for idempotent calls; see ClassifyIdempotent.
+func Classify(err error) Class {
+	if err == nil {
+		return Success
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return Retryable
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return Conflict
+	default:
+		return NotRetryable
+	}
+}
+
+// ClassifyIdempotent is Classify for calls that are safe to repeat, such as
+// reads and deletes, which may also be retried after timing out
+func ClassifyIdempotent(err error) Class {
+	if status.Code(err) == codes.DeadlineExceeded {
+		return Retryable
+	}
+	return Classify(err)
+}
+
+// RetryDelay returns the back-off the service asked for in the
+// google.rpc.RetryInfo detail of err, or fallback when it sent none
+func RetryDelay(err error, fallback time.Duration) time.Duration {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fallback
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err        error
+		want       Class
+		idempotent Class
+	}{
+		{nil, Success, Success},
+		{status.Error(codes.Unavailable, "down"), Retryable, Retryable},
+		{status.Error(codes.ResourceExhausted, "rate limit exceeded"), Retryable, Retryable},
+		{status.Error(codes.AlreadyExists, "email taken"), Conflict, Conflict},
+		{status.Error(codes.FailedPrecondition, "region is read-only"), Conflict, Conflict},
+		{status.Error(codes.DeadlineExceeded, "timeout"), NotRetryable, Retryable},
+		{status.Error(codes.InvalidArgument, "bad email"), NotRetryable, NotRetryable},
+		{context.Canceled, NotRetryable, NotRetryable},
+		{errors.New("boom"), NotRetryable, NotRetryable},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+		if got := ClassifyIdempotent(tt.err); got != tt.idempotent {
+			t.Errorf("ClassifyIdempotent(%v) = %s, want %s", tt.err, got, tt.idempotent)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	st, _ := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(3 * time.Second),
+	})
+
+	if got := RetryDelay(st.Err(), time.Second); got != 3*time.Second {
+		t.Errorf("expected the advertised delay, got %v", got)
+	}
+	if got := RetryDelay(status.Error(codes.Unavailable, "down"), time.Second); got != time.Second {
+		t.Errorf("expected the fallback, got %v", got)
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics is a Prometheus collector for client-side UserService calls.
+// Register it with a prometheus.Registerer and pass it to New via WithMetrics.
+type Metrics struct {
+	latency     *prometheus.HistogramVec
+	requests    *prometheus.CounterVec
+	retries     *prometheus.CounterVec
+	connState   *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	coalesced   *prometheus.CounterVec
+}
+
+// NewMetrics creates a new Metrics collector labelled with the calling service name
+func NewMetrics(service string) *Metrics {
+	labels := prometheus.Labels{"service": service}
+
+	return &Metrics{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "user_client_request_duration_seconds",
+			Help:        "Latency of UserService calls as seen by the client.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"method"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "user_client_requests_total",
+			Help:        "UserService calls by method and status code.",
+			ConstLabels: labels,
+		}, []string{"method", "code"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "user_client_retries_total",
+			Help:        "Retry attempts made by the gRPC client beyond the first attempt.",
+			ConstLabels: labels,
+		}, []string{"method"}),
+		connState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "user_client_connection_state",
+			Help:        "Current connectivity state of the client connection (1 for the active state).",
+			ConstLabels: labels,
+		}, []string{"state"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "user_client_connection_state_transitions_total",
+			Help:        "Connectivity state transitions of the client connection.",
+			ConstLabels: labels,
+		}, []string{"from", "to"}),
+		coalesced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "user_client_coalesced_calls_total",
+			Help:        "Calls answered with the response of a concurrent identical call.",
+			ConstLabels: labels,
+		}, []string{"method"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.latency.Describe(ch)
+	m.requests.Describe(ch)
+	m.retries.Describe(ch)
+	m.connState.Describe(ch)
+	m.transitions.Describe(ch)
+	m.coalesced.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.latency.Collect(ch)
+	m.requests.Collect(ch)
+	m.retries.Collect(ch)
+	m.connState.Collect(ch)
+	m.transitions.Collect(ch)
+	m.coalesced.Collect(ch)
+}
+
+type attemptsKey struct{}
+
+// UnaryClientInterceptor records latency, status code and retries per call
+func (m *Metrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		attempts := new(atomic.Int32)
+		ctx = context.WithValue(ctx, attemptsKey{}, attempts)
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		m.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(method, status.Code(err).String()).Inc()
+		if n := attempts.Load(); n > 1 {
+			m.retries.WithLabelValues(method).Add(float64(n - 1))
+		}
+
+		return err
+	}
+}
+
+// statsHandler counts transport attempts per call; gRPC tags every attempt,
+// including retries, so attempts beyond the first are retries
+func (m *Metrics) statsHandler() stats.Handler {
+	return attemptCounter{}
+}
+
+type attemptCounter struct{}
+
+func (attemptCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	if attempts, ok := ctx.Value(attemptsKey{}).(*atomic.Int32); ok {
+		attempts.Add(1)
+	}
+	return ctx
+}
+
+func (attemptCounter) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (attemptCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (attemptCounter) HandleConn(context.Context, stats.ConnStats) {}
+
+// watchConnState tracks connectivity state transitions until ctx is done
+func (m *Metrics) watchConnState(ctx context.Context, conn *grpc.ClientConn) {
+	state := conn.GetState()
+	m.connState.WithLabelValues(state.String()).Set(1)
+
+	for conn.WaitForStateChange(ctx, state) {
+		next := conn.GetState()
+		m.connState.WithLabelValues(state.String()).Set(0)
+		m.connState.WithLabelValues(next.String()).Set(1)
+		m.transitions.WithLabelValues(state.String(), next.String()).Inc()
+		state = next
+
+		if state == connectivity.Shutdown {
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// preResolve looks up the host of a dns-style target ahead of the first call
+func preResolve(target string, timeout time.Duration) error {
+	host := targetHost(target)
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	return nil
+}
+
+// targetHost extracts the host from targets such as "host:port",
+// "dns:///host:port" or "passthrough:///host:port". Other schemes are left to
+// their resolvers and yield an empty host.
+func targetHost(target string) string {
+	if scheme, rest, ok := strings.Cut(target, "://"); ok {
+		if scheme != "dns" && scheme != "passthrough" {
+			return ""
+		}
+		target = rest[strings.Index(rest, "/")+1:]
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+	return host
+}
+
+// preDial starts connecting and waits until the connection is ready
+func preDial(conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("connection not ready after %s: last state %s", timeout, state)
+		}
+	}
+}
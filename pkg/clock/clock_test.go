@@ -0,0 +1,48 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	t.Run("advances only when told", func(t *testing.T) {
+		clk := NewFake(start)
+		clk.Advance(90 * time.Second)
+		if got := clk.Now(); !got.Equal(start.Add(90 * time.Second)) {
+			t.Errorf("expected %s, got %s", start.Add(90*time.Second), got)
+		}
+	})
+
+	t.Run("tickers fire when due and drop missed ticks", func(t *testing.T) {
+		clk := NewFake(start)
+		ticker := clk.NewTicker(time.Minute)
+
+		clk.Advance(59 * time.Second)
+		select {
+		case <-ticker.C():
+			t.Fatal("ticker fired early")
+		default:
+		}
+
+		clk.Advance(5 * time.Minute)
+		if tick := <-ticker.C(); !tick.Equal(start.Add(time.Minute)) {
+			t.Errorf("expected first tick at %s, got %s", start.Add(time.Minute), tick)
+		}
+		select {
+		case <-ticker.C():
+			t.Fatal("expected missed ticks to be dropped")
+		default:
+		}
+
+		ticker.Stop()
+		clk.Advance(time.Hour)
+		select {
+		case <-ticker.C():
+			t.Fatal("stopped ticker fired")
+		default:
+		}
+	})
+}
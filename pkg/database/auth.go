@@ -0,0 +1,144 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+// Authentication methods of DatabaseConfig.Auth
+const (
+	// AuthPassword uses the configured static password
+	AuthPassword = "password"
+	// AuthRDSIAM generates RDS IAM auth tokens with the aws CLI
+	AuthRDSIAM = "rds-iam"
+	// AuthCloudSQLIAM generates Cloud SQL IAM login tokens with the gcloud CLI
+	AuthCloudSQLIAM = "cloudsql-iam"
+	// AuthCommand runs DatabaseConfig.AuthTokenCommand for tokens
+	AuthCommand = "command"
+	// AuthFile reads tokens from DatabaseConfig.AuthTokenFile, as kept up to
+	// date by a sidecar
+	AuthFile = "file"
+)
+
+// TokenSource supplies short-lived passwords, such as cloud IAM auth
+// tokens. A token is requested for every new connection.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// NewTokenSource returns the token source of the configured authentication
+// method, or nil for authentication with an inline password
+func NewTokenSource(cfg config.DatabaseConfig, clk clock.Clock) (TokenSource, error) {
+	switch cfg.Auth {
+	case "", AuthPassword:
+		if cfg.Password.Static() {
+			return nil, nil
+		}
+		return SecretToken{cfg.Password}, nil
+	case AuthRDSIAM:
+		// The region is taken from the aws CLI configuration, e.g. AWS_REGION
+		return NewCommandToken([]string{
+			"aws", "rds", "generate-db-auth-token",
+			"--hostname", cfg.Host,
+			"--port", strconv.Itoa(cfg.Port),
+			"--username", cfg.User,
+		}, cfg.AuthTokenTTL, clk), nil
+	case AuthCloudSQLIAM:
+		return NewCommandToken([]string{"gcloud", "sql", "generate-login-token"}, cfg.AuthTokenTTL, clk), nil
+	case AuthCommand:
+		args := strings.Fields(cfg.AuthTokenCommand)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("database auth %q requires a token command", cfg.Auth)
+		}
+		return NewCommandToken(args, cfg.AuthTokenTTL, clk), nil
+	case AuthFile:
+		if cfg.AuthTokenFile == "" {
+			return nil, fmt.Errorf("database auth %q requires a token file", cfg.Auth)
+		}
+		return FileToken(cfg.AuthTokenFile), nil
+	default:
+		return nil, fmt.Errorf("unknown database auth %q", cfg.Auth)
+	}
+}
+
+// CommandToken runs a command printing a token on stdout and reuses the
+// token until its TTL passes
+type CommandToken struct {
+	args  []string
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewCommandToken creates a CommandToken running args. The TTL should stay
+// below the validity of the tokens: 15 minutes for RDS, 1 hour for Cloud SQL.
+func NewCommandToken(args []string, ttl time.Duration, clk clock.Clock) *CommandToken {
+	return &CommandToken{args: args, ttl: ttl, clock: clk}
+}
+
+// Token implements TokenSource
+func (c *CommandToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.clock.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w: %s", c.args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("%s printed no token", c.args[0])
+	}
+
+	c.token = token
+	c.expires = c.clock.Now().Add(c.ttl)
+	return token, nil
+}
+
+// FileToken reads the token from a file on every request
+type FileToken string
+
+// Token implements TokenSource
+func (f FileToken) Token(context.Context) (string, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("failed to read database token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SecretToken uses a password read from a file or Vault, which may be
+// rotated while connections are open
+type SecretToken struct {
+	Secret config.Secret
+}
+
+// Token implements TokenSource
+func (s SecretToken) Token(ctx context.Context) (string, error) {
+	password, err := s.Secret.Value(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get database password: %w", err)
+	}
+	return password, nil
+}
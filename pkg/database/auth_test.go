@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+)
+
+func TestCommandToken(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	path := filepath.Join(t.TempDir(), "calls")
+	src := NewCommandToken([]string{"sh", "-c", "echo x >> " + path + "; echo token"}, time.Minute, clk)
+
+	for i := 0; i < 2; i++ {
+		token, err := src.Token(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token != "token" {
+			t.Errorf("expected token, got %q", token)
+		}
+	}
+	clk.Advance(time.Minute)
+	if _, err := src.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls, _ := os.ReadFile(path)
+	if got := len(calls) / 2; got != 2 {
+		t.Errorf("expected the command to run twice, ran %d times", got)
+	}
+}
+
+func TestNewTokenSource(t *testing.T) {
+	t.Run("password auth needs no tokens", func(t *testing.T) {
+		src, err := NewTokenSource(config.DatabaseConfig{Auth: AuthPassword}, clock.Real{})
+		if err != nil || src != nil {
+			t.Errorf("expected no token source, got %v, %v", src, err)
+		}
+	})
+
+	t.Run("command auth requires a command", func(t *testing.T) {
+		if _, err := NewTokenSource(config.DatabaseConfig{Auth: AuthCommand}, clock.Real{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("rejects unknown methods", func(t *testing.T) {
+		if _, err := NewTokenSource(config.DatabaseConfig{Auth: "kerberos"}, clock.Real{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
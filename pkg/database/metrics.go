@@ -0,0 +1,65 @@
+package database
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolAcquiredDesc = prometheus.NewDesc("db_pool_acquired_conns",
+		"Connections currently acquired from the pool.", nil, nil)
+	poolIdleDesc = prometheus.NewDesc("db_pool_idle_conns",
+		"Idle connections in the pool.", nil, nil)
+	poolConstructingDesc = prometheus.NewDesc("db_pool_constructing_conns",
+		"Connections being established.", nil, nil)
+	poolTotalDesc = prometheus.NewDesc("db_pool_total_conns",
+		"Connections in the pool, acquired, idle or being established.", nil, nil)
+	poolMaxDesc = prometheus.NewDesc("db_pool_max_conns",
+		"Maximum size of the pool.", nil, nil)
+	poolAcquiresDesc = prometheus.NewDesc("db_pool_acquires_total",
+		"Connections acquired from the pool.", nil, nil)
+	poolEmptyAcquiresDesc = prometheus.NewDesc("db_pool_empty_acquires_total",
+		"Acquires that had to wait for a connection because none was idle.", nil, nil)
+	poolCanceledAcquiresDesc = prometheus.NewDesc("db_pool_canceled_acquires_total",
+		"Acquires canceled by their context before getting a connection.", nil, nil)
+	poolAcquireWaitDesc = prometheus.NewDesc("db_pool_acquire_wait_seconds_total",
+		"Time spent acquiring connections, including establishing new ones.", nil, nil)
+)
+
+// PoolCollector exports the statistics of a connection pool, so that an
+// exhausted pool is noticed before queries time out waiting on it
+type PoolCollector struct {
+	pool *pgxpool.Pool
+}
+
+// NewPoolCollector creates a new PoolCollector instance
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	return &PoolCollector{pool: pool}
+}
+
+// Describe implements prometheus.Collector
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredDesc
+	ch <- poolIdleDesc
+	ch <- poolConstructingDesc
+	ch <- poolTotalDesc
+	ch <- poolMaxDesc
+	ch <- poolAcquiresDesc
+	ch <- poolEmptyAcquiresDesc
+	ch <- poolCanceledAcquiresDesc
+	ch <- poolAcquireWaitDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolConstructingDesc, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquiresDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWaitDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
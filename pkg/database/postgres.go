@@ -4,30 +4,48 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
 )
 
 // NewPostgres creates a new PostgreSQL connection pool using pgx v5
 func NewPostgres(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.DBName,
-		cfg.SSLMode,
-	)
-
-	poolConfig, err := pgxpool.ParseConfig(connString)
+	poolConfig, err := pgxpool.ParseConfig(connString(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database config: %w", err)
 	}
 
 	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.ConnConfig.Tracer = tracers{deadlineTracer{}, usageTracer{}, newSpanTracer()}
+	if cfg.PgBouncer {
+		disableStatementCaching(poolConfig.ConnConfig)
+	}
+
+	// Tokens are generated for the server actually connected to, which
+	// comes from the URL when one is set
+	cfg.Host = poolConfig.ConnConfig.Host
+	cfg.Port = int(poolConfig.ConnConfig.Port)
+	cfg.User = poolConfig.ConnConfig.User
+	tokens, err := NewTokenSource(cfg, clock.Real{})
+	if err != nil {
+		return nil, err
+	}
+	if tokens != nil {
+		poolConfig.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+			token, err := tokens.Token(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to get database auth token: %w", err)
+			}
+			cc.Password = token
+			return nil
+		}
+	}
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
@@ -40,9 +58,61 @@ func NewPostgres(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
 	}
 
 	slog.Info("connected to PostgreSQL",
-		slog.String("host", cfg.Host),
-		slog.Int("port", cfg.Port),
-		slog.String("database", cfg.DBName))
+		slog.String("host", poolConfig.ConnConfig.Host),
+		slog.Int("port", int(poolConfig.ConnConfig.Port)),
+		slog.String("database", poolConfig.ConnConfig.Database),
+		slog.String("auth", cfg.Auth),
+		slog.Bool("pgbouncer", cfg.PgBouncer))
 
 	return pool, nil
 }
+
+// disableStatementCaching makes the connection usable behind pgbouncer in
+// transaction pooling mode. There each transaction may run on a different
+// server connection, so statements prepared and cached on one are missing
+// on the next. The simple protocol prepares nothing, at the cost of an
+// extra parse per query and of encoding parameters as text.
+func disableStatementCaching(cc *pgx.ConnConfig) {
+	cc.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	cc.StatementCacheCapacity = 0
+	cc.DescriptionCacheCapacity = 0
+}
+
+// connString returns the configured URL, or builds keyword/value pairs from
+// the discrete settings. Unlike a URL, these accept a unix socket directory
+// as host without escaping.
+func connString(cfg config.DatabaseConfig) string {
+	if cfg.URL != "" {
+		return cfg.URL
+	}
+
+	pairs := []string{
+		"host=" + quoteValue(cfg.Host),
+		"port=" + strconv.Itoa(cfg.Port),
+		"user=" + quoteValue(cfg.User),
+		"dbname=" + quoteValue(cfg.DBName),
+		"sslmode=" + quoteValue(cfg.SSLMode),
+	}
+	// pgx loads these files itself, verifying the server against the root
+	// certificate and presenting the client certificate
+	for _, file := range []struct{ keyword, path string }{
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+	} {
+		if file.path != "" {
+			pairs = append(pairs, file.keyword+"="+quoteValue(file.path))
+		}
+	}
+	// Passwords from files or Vault are resolved per connection by the token
+	// source instead, so rotations apply to new connections
+	if password, ok := cfg.Password.Inline(); ok && (cfg.Auth == "" || cfg.Auth == AuthPassword) {
+		pairs = append(pairs, "password="+quoteValue(password))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// quoteValue quotes a keyword/value connection string value
+func quoteValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
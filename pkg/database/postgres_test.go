@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+)
+
+func TestConnString(t *testing.T) {
+	t.Run("unix socket host", func(t *testing.T) {
+		cfg := config.DatabaseConfig{Host: "/var/run/postgresql", Port: 5432, User: "app", Password: config.InlineSecret("it's"), DBName: "users", SSLMode: "disable"}
+		parsed, err := pgxpool.ParseConfig(connString(cfg))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if parsed.ConnConfig.Host != "/var/run/postgresql" || parsed.ConnConfig.Password != "it's" {
+			t.Errorf("unexpected config %+v", parsed.ConnConfig)
+		}
+	})
+
+	t.Run("verify-full with certificates", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := config.DatabaseConfig{Host: "db.example.com", Port: 5432, DBName: "users", SSLMode: "verify-full", SSLRootCert: filepath.Join(dir, "missing.pem")}
+		got := connString(cfg)
+		if !strings.Contains(got, "sslmode='verify-full'") || !strings.Contains(got, "sslrootcert='"+cfg.SSLRootCert+"'") {
+			t.Errorf("unexpected connection string %q", got)
+		}
+		if _, err := pgxpool.ParseConfig(got); err == nil {
+			t.Error("expected the missing root certificate to be reported")
+		}
+	})
+
+	t.Run("url takes precedence", func(t *testing.T) {
+		cfg := config.DatabaseConfig{URL: "postgres://app@db.internal:6432/users", Host: "localhost"}
+		if got := connString(cfg); got != cfg.URL {
+			t.Errorf("expected the URL, got %q", got)
+		}
+	})
+}
+
+func TestDisableStatementCaching(t *testing.T) {
+	parsed, err := pgxpool.ParseConfig("host=localhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	disableStatementCaching(parsed.ConnConfig)
+
+	cc := parsed.ConnConfig
+	if cc.DefaultQueryExecMode != pgx.QueryExecModeSimpleProtocol || cc.StatementCacheCapacity != 0 || cc.DescriptionCacheCapacity != 0 {
+		t.Errorf("expected the simple protocol without caches, got %v, %d, %d", cc.DefaultQueryExecMode, cc.StatementCacheCapacity, cc.DescriptionCacheCapacity)
+	}
+}
+
+func TestSpanTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := spanTracer{tracer: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")}
+	query := pgx.TraceQueryStartData{SQL: "SELECT id FROM users WHERE email = $1", Args: []any{"jane@example.com"}}
+
+	t.Run("skips queries outside a trace", func(t *testing.T) {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, query)
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+		if n := len(recorder.Ended()); n != 0 {
+			t.Errorf("expected no spans, got %d", n)
+		}
+	})
+
+	t.Run("records child spans without arguments", func(t *testing.T) {
+		ctx, parent := tracer.tracer.Start(context.Background(), "handler")
+		ctx = tracer.TraceQueryStart(ctx, nil, query)
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+		parent.End()
+
+		spans := recorder.Ended()
+		if len(spans) != 2 || spans[0].Name() != "postgres SELECT" || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("unexpected spans %v", spans)
+		}
+		if spans[0].Status().Code != codes.Error {
+			t.Error("expected the failed query to be marked as an error")
+		}
+		for _, attr := range spans[0].Attributes() {
+			if strings.Contains(attr.Value.Emit(), "jane@") {
+				t.Errorf("argument leaked in %s", attr.Key)
+			}
+		}
+	})
+}
+
+func TestPoolCollector(t *testing.T) {
+	// Pools connect lazily, so stats are available without a server
+	poolConfig, err := pgxpool.ParseConfig("postgres://app@127.0.0.1:1/users?pool_max_conns=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	want := `
+# HELP db_pool_max_conns Maximum size of the pool.
+# TYPE db_pool_max_conns gauge
+db_pool_max_conns 7
+# HELP db_pool_acquired_conns Connections currently acquired from the pool.
+# TYPE db_pool_acquired_conns gauge
+db_pool_acquired_conns 0
+`
+	if err := testutil.CollectAndCompare(NewPoolCollector(pool), strings.NewReader(want), "db_pool_max_conns", "db_pool_acquired_conns"); err != nil {
+		t.Error(err)
+	}
+}
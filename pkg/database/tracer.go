@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/deadline"
+)
+
+type queryStartKey struct{}
+
+// usageTracer attributes query time to the request's usage meter
+type usageTracer struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (usageTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, time.Now())
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (usageTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	if start, ok := ctx.Value(queryStartKey{}).(time.Time); ok {
+		usage.FromContext(ctx).AddDBTime(time.Since(start))
+	}
+}
+
+// spanTracer records each query as a child span of the caller's span. The
+// SQL text is recorded, never the arguments. Queries outside a recorded
+// trace, e.g. of background jobs, are not traced.
+type spanTracer struct {
+	tracer trace.Tracer
+}
+
+func newSpanTracer() spanTracer {
+	return spanTracer{tracer: otel.Tracer("github.com/davidbadelllab/go-microservice-grpc-2023/pkg/database")}
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (t spanTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx
+	}
+
+	operation := queryOperation(data.SQL)
+	ctx, _ = t.tracer.Start(ctx, "postgres "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(operation),
+			semconv.DBStatement(data.SQL),
+			attribute.Int("db.args", len(data.Args)),
+		))
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (t spanTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// queryOperation returns the leading keyword of a statement, e.g. SELECT,
+// or WITH for common table expressions
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+type deadlineCallKey struct{}
+
+// deadlineTracer bounds each query by its share of the request deadline
+type deadlineTracer struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (deadlineTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	ctx, call := deadline.Start(ctx)
+	if call == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, deadlineCallKey{}, call)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (deadlineTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	if call, ok := ctx.Value(deadlineCallKey{}).(*deadline.Call); ok {
+		call.End("postgres")
+	}
+}
+
+// tracers calls several query tracers, as pgx accepts only one
+type tracers []pgx.QueryTracer
+
+// TraceQueryStart implements pgx.QueryTracer
+func (ts tracers) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, t := range ts {
+		ctx = t.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (ts tracers) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for _, t := range ts {
+		t.TraceQueryEnd(ctx, conn, data)
+	}
+}
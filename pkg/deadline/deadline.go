@@ -0,0 +1,90 @@
+// Package deadline splits the remaining deadline of a request between its
+// dependency calls and the work left after them, so a slow database or
+// cache call fails on its own instead of consuming the whole deadline
+package deadline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Budget derives dependency sub-deadlines, keeping a fraction of the
+// remaining time in reserve, e.g. to encode the response or write the
+// cache after a database read. It implements prometheus.Collector.
+type Budget struct {
+	reserve  float64
+	exceeded *prometheus.CounterVec
+}
+
+// New creates a Budget keeping reserve, between 0 and 1, of the remaining
+// time of each call
+func New(reserve float64) *Budget {
+	return &Budget{
+		reserve: reserve,
+		exceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dependency_deadline_exceeded_total",
+			Help: "Number of dependency calls cut short by their share of the request deadline",
+		}, []string{"dependency"}),
+	}
+}
+
+type budgetKey struct{}
+
+// NewContext returns a context whose dependency calls are bounded by b
+func NewContext(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// FromContext returns the budget stored in ctx, or nil
+func FromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
+
+// Call is a dependency call bounded by its share of the deadline
+type Call struct {
+	budget *Budget
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Start returns the context for a dependency call. Without a budget or a
+// deadline in ctx, the call is not bounded. The returned Call must be
+// ended.
+func Start(ctx context.Context) (context.Context, *Call) {
+	b := FromContext(ctx)
+	deadline, ok := ctx.Deadline()
+	if b == nil || !ok {
+		return ctx, nil
+	}
+
+	remaining := time.Until(deadline)
+	sub, cancel := context.WithTimeout(ctx, time.Duration(float64(remaining)*(1-b.reserve)))
+	return sub, &Call{budget: b, parent: ctx, ctx: sub, cancel: cancel}
+}
+
+// End releases the call and counts it when its share of the deadline ran
+// out while the request itself still had time left
+func (c *Call) End(dependency string) {
+	if c == nil {
+		return
+	}
+	if errors.Is(c.ctx.Err(), context.DeadlineExceeded) && c.parent.Err() == nil {
+		c.budget.exceeded.WithLabelValues(dependency).Inc()
+	}
+	c.cancel()
+}
+
+// Describe implements prometheus.Collector
+func (b *Budget) Describe(ch chan<- *prometheus.Desc) {
+	b.exceeded.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (b *Budget) Collect(ch chan<- prometheus.Metric) {
+	b.exceeded.Collect(ch)
+}
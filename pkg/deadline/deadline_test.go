@@ -0,0 +1,50 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStart(t *testing.T) {
+	t.Run("unbounded without a budget", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		sub, call := Start(ctx)
+		defer call.End("postgres")
+		if sub != ctx || call != nil {
+			t.Error("expected the call to be unbounded")
+		}
+	})
+
+	t.Run("keeps the reserve", func(t *testing.T) {
+		b := New(0.5)
+		ctx, cancel := context.WithTimeout(NewContext(context.Background(), b), time.Second)
+		defer cancel()
+
+		sub, call := Start(ctx)
+		defer call.End("postgres")
+		parent, _ := ctx.Deadline()
+		got, _ := sub.Deadline()
+		if remaining := time.Until(got); remaining > 500*time.Millisecond || !got.Before(parent) {
+			t.Errorf("expected at most half the deadline, got %v", remaining)
+		}
+	})
+
+	t.Run("counts exhausted budgets", func(t *testing.T) {
+		b := New(0.9)
+		ctx, cancel := context.WithTimeout(NewContext(context.Background(), b), 50*time.Millisecond)
+		defer cancel()
+
+		sub, call := Start(ctx)
+		<-sub.Done()
+		call.End("redis")
+
+		if got := testutil.ToFloat64(b.exceeded.WithLabelValues("redis")); got != 1 {
+			t.Errorf("expected 1 exceeded budget, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+// Package grpcmeta reads and writes the well-known gRPC metadata shared by
+// the service, its interceptors and its clients
+package grpcmeta
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Well-known metadata keys. gRPC lowercases keys on the wire.
+const (
+	RequestIDKey      = "x-request-id"
+	CallerIDKey       = "x-caller-id"
+	CallerRolesKey    = "x-caller-roles"
+	APIKeyKey         = "x-api-key"
+	TenantKey         = "x-tenant-id"
+	AuthorizationKey  = "authorization"
+	LocaleKey         = "x-locale"
+	IdempotencyKeyKey = "idempotency-key"
+)
+
+var (
+	// ErrMissing is returned when a metadata key is absent or empty
+	ErrMissing = errors.New("metadata missing")
+	// ErrInvalid is returned when a metadata value is malformed
+	ErrInvalid = errors.New("metadata invalid")
+)
+
+var (
+	requestIDPattern      = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+	tenantPattern         = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	localePattern         = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	idempotencyKeyPattern = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+)
+
+// Get returns the first value of key in the incoming metadata, or an empty
+// string when it is absent
+func Get(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// RequestID returns the incoming request ID
+func RequestID(ctx context.Context) (string, error) {
+	return lookup(ctx, RequestIDKey, requestIDPattern)
+}
+
+// CallerID returns the caller identity asserted by a trusted proxy
+func CallerID(ctx context.Context) (string, error) {
+	return lookup(ctx, CallerIDKey, nil)
+}
+
+// CallerRoles returns the comma-separated roles asserted by a trusted proxy
+// alongside the caller identity, or nil when there are none
+func CallerRoles(ctx context.Context) []string {
+	var roles []string
+	for _, role := range strings.Split(Get(ctx, CallerRolesKey), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Tenant returns the incoming tenant, a lowercase DNS label
+func Tenant(ctx context.Context) (string, error) {
+	return lookup(ctx, TenantKey, tenantPattern)
+}
+
+// BearerToken returns the token of an incoming "Bearer" authorization
+func BearerToken(ctx context.Context) (string, error) {
+	value, err := lookup(ctx, AuthorizationKey, nil)
+	if err != nil {
+		return "", err
+	}
+
+	scheme, token, ok := strings.Cut(value, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", fmt.Errorf("%w: %s is not a bearer token", ErrInvalid, AuthorizationKey)
+	}
+	return token, nil
+}
+
+// Locale returns the incoming BCP 47 language tag, e.g. "en-US"
+func Locale(ctx context.Context) (string, error) {
+	return lookup(ctx, LocaleKey, localePattern)
+}
+
+// IdempotencyKey returns the incoming idempotency key
+func IdempotencyKey(ctx context.Context) (string, error) {
+	return lookup(ctx, IdempotencyKeyKey, idempotencyKeyPattern)
+}
+
+func lookup(ctx context.Context, key string, pattern *regexp.Regexp) (string, error) {
+	value := Get(ctx, key)
+	if value == "" {
+		return "", fmt.Errorf("%w: %s", ErrMissing, key)
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return "", fmt.Errorf("%w: %s", ErrInvalid, key)
+	}
+	return value, nil
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate request id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID adds a request ID to the outgoing metadata
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, RequestIDKey, id)
+}
+
+// WithTenant adds a tenant to the outgoing metadata
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, TenantKey, tenant)
+}
+
+// WithBearerToken adds a bearer authorization to the outgoing metadata
+func WithBearerToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AuthorizationKey, "Bearer "+token)
+}
+
+// WithLocale adds a BCP 47 language tag to the outgoing metadata
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, LocaleKey, locale)
+}
+
+// WithIdempotencyKey adds an idempotency key to the outgoing metadata
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, IdempotencyKeyKey, key)
+}
@@ -0,0 +1,64 @@
+package grpcmeta
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func incoming(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestReaders(t *testing.T) {
+	t.Run("valid values", func(t *testing.T) {
+		ctx := incoming(
+			TenantKey, "acme",
+			AuthorizationKey, "bearer abc.def",
+			LocaleKey, "pt-BR",
+		)
+
+		if tenant, err := Tenant(ctx); err != nil || tenant != "acme" {
+			t.Errorf("tenant: got %q, %v", tenant, err)
+		}
+		if token, err := BearerToken(ctx); err != nil || token != "abc.def" {
+			t.Errorf("token: got %q, %v", token, err)
+		}
+		if locale, err := Locale(ctx); err != nil || locale != "pt-BR" {
+			t.Errorf("locale: got %q, %v", locale, err)
+		}
+	})
+
+	t.Run("missing and invalid values", func(t *testing.T) {
+		ctx := incoming(
+			TenantKey, "Acme Corp",
+			AuthorizationKey, "Basic dXNlcg==",
+		)
+
+		if _, err := RequestID(ctx); !errors.Is(err, ErrMissing) {
+			t.Errorf("expected ErrMissing, got %v", err)
+		}
+		if _, err := Tenant(ctx); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected ErrInvalid for tenant, got %v", err)
+		}
+		if _, err := BearerToken(ctx); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected ErrInvalid for token, got %v", err)
+		}
+	})
+
+	t.Run("writers round trip", func(t *testing.T) {
+		id := NewRequestID()
+		ctx := WithIdempotencyKey(WithRequestID(context.Background(), id), "create-42")
+		md, _ := metadata.FromOutgoingContext(ctx)
+
+		ctx = metadata.NewIncomingContext(context.Background(), md)
+		if got, err := RequestID(ctx); err != nil || got != id {
+			t.Errorf("request id: got %q, %v", got, err)
+		}
+		if got, err := IdempotencyKey(ctx); err != nil || got != "create-42" {
+			t.Errorf("idempotency key: got %q, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+// Package locality validates the time zones and locales attached to users
+package locality
+
+import (
+	"time"
+	// Embedded so time zones validate the same on hosts without tzdata
+	_ "time/tzdata"
+
+	"golang.org/x/text/language"
+)
+
+// ValidTimezone reports whether name is an IANA time zone name, such as
+// "Europe/Madrid" or "UTC". The process-dependent "Local" is not one.
+func ValidTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// CanonicalLocale returns tag in its canonical BCP 47 form, e.g. "en-US"
+// for "en_us", and whether it is a well-formed tag of a known language
+func CanonicalLocale(tag string) (string, bool) {
+	parsed, err := language.Parse(tag)
+	if err != nil || parsed == language.Und {
+		return "", false
+	}
+	return parsed.String(), true
+}
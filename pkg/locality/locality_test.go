@@ -0,0 +1,28 @@
+package locality
+
+import "testing"
+
+func TestValidTimezone(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Europe/Madrid": true,
+		"UTC":           true,
+		"Local":         false,
+		"Mars/Olympus":  false,
+		"":              false,
+	} {
+		if got := ValidTimezone(name); got != want {
+			t.Errorf("ValidTimezone(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCanonicalLocale(t *testing.T) {
+	if got, ok := CanonicalLocale("es-es"); !ok || got != "es-ES" {
+		t.Errorf("expected es-ES, got %q %v", got, ok)
+	}
+	for _, tag := range []string{"und", "not a tag", "e"} {
+		if _, ok := CanonicalLocale(tag); ok {
+			t.Errorf("expected %q to be rejected", tag)
+		}
+	}
+}
@@ -3,14 +3,21 @@ package logger
 import (
 	"log/slog"
 	"os"
+	"strings"
 )
 
-// New creates a new structured logger using Go 1.21's slog package
+// New creates a new structured logger using Go 1.21's slog package. The
+// attributes listed in LOG_REDACT_FIELDS are masked, or hashed with
+// LOG_REDACT_MODE=hash. Lines logged with the context of a traced request
+// carry its trace_id and span_id.
 func New() *slog.Logger {
 	opts := &slog.HandlerOptions{
 		Level:     getLogLevel(),
 		AddSource: true,
 	}
+	if r := RedactorFromEnv(); r != nil {
+		opts.ReplaceAttr = r.ReplaceAttr
+	}
 
 	var handler slog.Handler
 	if os.Getenv("LOG_FORMAT") == "text" {
@@ -19,7 +26,7 @@ func New() *slog.Logger {
 		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(NewTraceHandler(handler))
 }
 
 func getLogLevel() slog.Level {
@@ -36,3 +43,14 @@ func getLogLevel() slog.Level {
 		return slog.LevelInfo
 	}
 }
+
+// RedactorFromEnv creates the Redactor configured by LOG_REDACT_FIELDS
+// (default "email,name") and LOG_REDACT_MODE. An empty LOG_REDACT_FIELDS
+// disables redaction.
+func RedactorFromEnv() *Redactor {
+	fields, ok := os.LookupEnv("LOG_REDACT_FIELDS")
+	if !ok {
+		fields = "email,name"
+	}
+	return NewRedactor(strings.Split(fields, ","), os.Getenv("LOG_REDACT_MODE"))
+}
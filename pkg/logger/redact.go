@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redaction modes
+const (
+	// RedactMask keeps the first character of a value and, for emails, the
+	// domain
+	RedactMask = "mask"
+	// RedactHash replaces a value with a short SHA-256 digest, so log lines
+	// about the same value can still be correlated
+	RedactHash = "hash"
+)
+
+// Redactor rewrites the values of configured attribute keys, e.g. email and
+// name, before they are logged. Keys match case-insensitively at any
+// nesting level.
+type Redactor struct {
+	fields map[string]bool
+	hash   bool
+}
+
+// NewRedactor creates a Redactor for the given field names using mode,
+// RedactMask or RedactHash. It returns nil when no fields are given.
+func NewRedactor(fields []string, mode string) *Redactor {
+	r := &Redactor{fields: make(map[string]bool, len(fields)), hash: mode == RedactHash}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			r.fields[strings.ToLower(f)] = true
+		}
+	}
+	if len(r.fields) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Redacts reports whether values of key are redacted
+func (r *Redactor) Redacts(key string) bool {
+	return r != nil && r.fields[strings.ToLower(key)]
+}
+
+// Redact masks or hashes a single value
+func (r *Redactor) Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if r.hash {
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	_, size := utf8.DecodeRuneInString(value)
+	if at := strings.LastIndexByte(value, '@'); at > 0 {
+		return value[:size] + "***" + value[at:]
+	}
+	return value[:size] + "***"
+}
+
+// ReplaceAttr redacts the configured attributes; it is meant for
+// slog.HandlerOptions.ReplaceAttr
+func (r *Redactor) ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if !r.Redacts(a.Key) {
+		return a
+	}
+	return slog.String(a.Key, r.Redact(a.Value.Resolve().String()))
+}
+
+// RedactMap redacts the configured keys of a decoded JSON document in place
+func (r *Redactor) RedactMap(m map[string]interface{}) {
+	for k, v := range m {
+		if r.Redacts(k) {
+			if s, ok := v.(string); ok {
+				m[k] = r.Redact(s)
+				continue
+			}
+		}
+		r.redactValue(v)
+	}
+}
+
+func (r *Redactor) redactValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		r.RedactMap(v)
+	case []interface{}:
+		for _, e := range v {
+			r.redactValue(e)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	t.Run("masks values", func(t *testing.T) {
+		r := NewRedactor([]string{"email", "name"}, RedactMask)
+		if got := r.Redact("jane@example.com"); got != "j***@example.com" {
+			t.Errorf("got %q", got)
+		}
+		if got := r.Redact("Jane Doe"); got != "J***" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("hashes values consistently", func(t *testing.T) {
+		r := NewRedactor([]string{"email"}, RedactHash)
+		a, b := r.Redact("jane@example.com"), r.Redact("jane@example.com")
+		if a != b || !strings.HasPrefix(a, "sha256:") || strings.Contains(a, "jane") {
+			t.Errorf("got %q and %q", a, b)
+		}
+	})
+
+	t.Run("redacts log attributes", func(t *testing.T) {
+		var buf bytes.Buffer
+		r := NewRedactor([]string{"Email"}, RedactMask)
+		log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: r.ReplaceAttr}))
+
+		log.Info("user created", slog.Group("user", slog.String("email", "jane@example.com")), slog.Int("user_id", 7))
+
+		if strings.Contains(buf.String(), "jane@") || !strings.Contains(buf.String(), `"user_id":7`) {
+			t.Errorf("unexpected log line %s", buf.String())
+		}
+	})
+
+	t.Run("redacts nested documents", func(t *testing.T) {
+		r := NewRedactor([]string{"email"}, RedactMask)
+		doc := map[string]interface{}{
+			"users": []interface{}{map[string]interface{}{"email": "jane@example.com", "id": "7"}},
+		}
+		r.RedactMap(doc)
+		user := doc["users"].([]interface{})[0].(map[string]interface{})
+		if user["email"] != "j***@example.com" || user["id"] != "7" {
+			t.Errorf("got %v", user)
+		}
+	})
+
+	t.Run("nil without fields", func(t *testing.T) {
+		if r := NewRedactor([]string{" "}, RedactMask); r != nil {
+			t.Error("expected no redactor")
+		}
+	})
+}
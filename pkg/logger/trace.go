@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceHandler adds the trace_id and span_id of the span active in the
+// context of a record, so log lines can be joined with their trace. Only
+// records logged with a context, e.g. by slog.InfoContext, can carry them;
+// records logged outside a span pass through unchanged. Under WithGroup the
+// IDs are added to the innermost group.
+type TraceHandler struct {
+	next slog.Handler
+}
+
+// NewTraceHandler wraps next in a TraceHandler
+func NewTraceHandler(next slog.Handler) *TraceHandler {
+	return &TraceHandler{next: next}
+}
+
+// Enabled reports whether next handles records at level
+func (h *TraceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the span of ctx to r and passes it on
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r = r.Clone()
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a TraceHandler wrapping next with attrs
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TraceHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a TraceHandler wrapping next with the group name
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	return &TraceHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceHandler(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+
+	t.Run("adds the span of the context", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := slog.New(NewTraceHandler(slog.NewJSONHandler(&buf, nil))).With(slog.String("service", "users"))
+
+		log.InfoContext(trace.ContextWithSpanContext(context.Background(), sc), "user created")
+
+		for _, want := range []string{`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`, `"span_id":"00f067aa0ba902b7"`, `"service":"users"`} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("expected %s in %s", want, buf.String())
+			}
+		}
+	})
+
+	t.Run("leaves untraced lines alone", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := slog.New(NewTraceHandler(slog.NewJSONHandler(&buf, nil)))
+
+		log.InfoContext(context.Background(), "user created")
+
+		if strings.Contains(buf.String(), "trace_id") {
+			t.Errorf("unexpected trace in %s", buf.String())
+		}
+	})
+}
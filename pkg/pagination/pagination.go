@@ -0,0 +1,85 @@
+// Package pagination implements the pagination semantics shared by every
+// listing: page size limits, page numbers, and opaque keyset page tokens
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for page tokens that were not issued by the service
+var ErrInvalidToken = errors.New("invalid page token")
+
+// Limits bounds the page sizes accepted by a listing
+type Limits struct {
+	// Default applies when no page size is requested
+	Default int
+	Max     int
+}
+
+// DefaultLimits are the limits of listings without specific needs
+var DefaultLimits = Limits{Default: 100, Max: 100}
+
+// Clamp returns the page size to use for the requested one
+func (l Limits) Clamp(requested int) int {
+	if requested <= 0 {
+		return l.Default
+	}
+	return min(requested, l.Max)
+}
+
+// Page returns the 1-based page number to use for the requested one
+func Page(requested int) int {
+	return max(requested, 1)
+}
+
+// Offset returns the number of items before the given page
+func Offset(page, pageSize int) int {
+	return (Page(page) - 1) * pageSize
+}
+
+// Cursor is a position in a (created_at DESC, id DESC) keyset ordering
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Encode returns the opaque page token of the page following the cursor
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Decode returns the cursor of a page token issued by Encode
+func Decode(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidToken
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return Cursor{}, ErrInvalidToken
+	}
+
+	n, err1 := strconv.ParseInt(nanos, 10, 64)
+	i, err2 := strconv.ParseInt(id, 10, 64)
+	if err1 != nil || err2 != nil {
+		return Cursor{}, ErrInvalidToken
+	}
+
+	return Cursor{CreatedAt: time.Unix(0, n), ID: i}, nil
+}
+
+// Next returns the token of the page after items, or an empty string when a
+// short page shows there are no more results
+func Next[T any](items []T, pageSize int, cursor func(T) Cursor) string {
+	if pageSize <= 0 || len(items) < pageSize {
+		return ""
+	}
+	return cursor(items[len(items)-1]).Encode()
+}
@@ -0,0 +1,56 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	limits := Limits{Default: 500, Max: 1000}
+	for requested, want := range map[int]int{-1: 500, 0: 500, 20: 20, 1000: 1000, 5000: 1000} {
+		if got := limits.Clamp(requested); got != want {
+			t.Errorf("Clamp(%d): expected %d, got %d", requested, want, got)
+		}
+	}
+
+	if got := Offset(0, 20); got != 0 {
+		t.Errorf("expected page 0 to start at 0, got %d", got)
+	}
+	if got := Offset(3, 20); got != 40 {
+		t.Errorf("expected page 3 to start at 40, got %d", got)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		createdAt := time.Date(2023, 12, 1, 10, 30, 0, 123456000, time.UTC)
+		token := Cursor{CreatedAt: createdAt, ID: 7}.Encode()
+
+		cursor, err := Decode(token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cursor.ID != 7 || !cursor.CreatedAt.Equal(createdAt) {
+			t.Errorf("expected (%v, 7), got (%v, %d)", createdAt, cursor.CreatedAt, cursor.ID)
+		}
+	})
+
+	t.Run("rejects malformed tokens", func(t *testing.T) {
+		for _, token := range []string{"!!!", "bm90LWEtdG9rZW4", "MQ"} {
+			if _, err := Decode(token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("token %q: expected ErrInvalidToken, got %v", token, err)
+			}
+		}
+	})
+
+	t.Run("no token after a short page", func(t *testing.T) {
+		cursor := func(id int64) Cursor { return Cursor{ID: id} }
+		if token := Next([]int64{1, 2}, 3, cursor); token != "" {
+			t.Errorf("expected empty token, got %q", token)
+		}
+		if token := Next([]int64{1, 2}, 2, cursor); token == "" {
+			t.Error("expected token after a full page")
+		}
+	})
+}
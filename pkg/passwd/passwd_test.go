@@ -0,0 +1,59 @@
+package passwd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testParams keep tests fast
+var testParams = Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher(t *testing.T) {
+	t.Run("verifies the hashed password only", func(t *testing.T) {
+		h := New(testParams)
+		encoded, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("Hash() error = %v", err)
+		}
+		if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Errorf("Hash() = %q, want an encoded argon2id hash", encoded)
+		}
+
+		if ok, rehash, err := h.Verify("correct horse", encoded); !ok || rehash || err != nil {
+			t.Errorf("Verify(correct) = %v, %v, %v, want true, false, nil", ok, rehash, err)
+		}
+		if ok, _, err := h.Verify("battery staple", encoded); ok || err != nil {
+			t.Errorf("Verify(wrong) = %v, %v, want false, nil", ok, err)
+		}
+	})
+
+	t.Run("asks for a rehash when the parameters changed", func(t *testing.T) {
+		encoded, err := New(testParams).Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stronger := testParams
+		stronger.Iterations = 2
+		ok, rehash, err := New(stronger).Verify("correct horse", encoded)
+		if !ok || !rehash || err != nil {
+			t.Errorf("Verify() = %v, %v, %v, want true, true, nil", ok, rehash, err)
+		}
+	})
+
+	t.Run("rejects malformed hashes", func(t *testing.T) {
+		h := New(testParams)
+		for _, encoded := range []string{
+			"",
+			"plaintext",
+			"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+			"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5",
+			"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		} {
+			if _, _, err := h.Verify("x", encoded); !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("Verify(%q) error = %v, want ErrMalformedHash", encoded, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// Package pool runs asynchronous work on a bounded number of goroutines
+// with a bounded queue, so that a slow sink backs up into rejected tasks
+// instead of an ever growing number of goroutines
+package pool
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrFull is returned when a task is rejected because the queue is full
+	ErrFull = errors.New("worker pool queue is full")
+	// ErrClosed is returned when submitting to a closed pool
+	ErrClosed = errors.New("worker pool closed")
+)
+
+// Policy decides what happens to a task submitted while the queue is full
+type Policy int
+
+const (
+	// Reject fails the submission with ErrFull
+	Reject Policy = iota
+	// Block waits for room in the queue until the submitter's context is done
+	Block
+	// CallerRuns runs the task on the submitter's goroutine, slowing the
+	// submitter down to the pace of the workers
+	CallerRuns
+)
+
+// Task is a unit of asynchronous work
+type Task func(ctx context.Context)
+
+type queued struct {
+	ctx  context.Context
+	task Task
+}
+
+// Pool runs submitted tasks on a fixed set of workers. It is a
+// prometheus.Collector.
+type Pool struct {
+	name   string
+	policy Policy
+	tasks  chan queued
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	depth     prometheus.GaugeFunc
+	busy      prometheus.Gauge
+	completed prometheus.Counter
+	rejected  prometheus.Counter
+	panics    prometheus.Counter
+}
+
+// New starts a pool of workers goroutines queueing up to queueSize tasks
+func New(name string, workers, queueSize int, policy Policy) *Pool {
+	labels := prometheus.Labels{"pool": name}
+	p := &Pool{
+		name:   name,
+		policy: policy,
+		tasks:  make(chan queued, max(queueSize, 0)),
+		busy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "worker_pool_busy_workers",
+			Help:        "Number of workers running a task",
+			ConstLabels: labels,
+		}),
+		completed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "worker_pool_tasks_total",
+			Help:        "Number of tasks run by the pool's workers",
+			ConstLabels: labels,
+		}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "worker_pool_rejected_total",
+			Help:        "Number of tasks rejected because the queue was full",
+			ConstLabels: labels,
+		}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "worker_pool_panics_total",
+			Help:        "Number of tasks that panicked",
+			ConstLabels: labels,
+		}),
+	}
+	p.depth = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "worker_pool_queue_depth",
+		Help:        "Number of tasks waiting for a worker",
+		ConstLabels: labels,
+	}, func() float64 {
+		return float64(len(p.tasks))
+	})
+
+	for i := 0; i < max(workers, 1); i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+
+	return p
+}
+
+// Submit queues task, applying the pool's policy when the queue is full.
+// The task runs with a context carrying the values of ctx but not its
+// cancellation, as it usually outlives the request that submitted it.
+func (p *Pool) Submit(ctx context.Context, task Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	item := queued{ctx: context.WithoutCancel(ctx), task: task}
+	select {
+	case p.tasks <- item:
+		return nil
+	default:
+	}
+
+	switch p.policy {
+	case Block:
+		select {
+		case p.tasks <- item:
+			return nil
+		case <-ctx.Done():
+			p.rejected.Inc()
+			return ctx.Err()
+		}
+	case CallerRuns:
+		p.run(item)
+		return nil
+	default:
+		p.rejected.Inc()
+		return ErrFull
+	}
+}
+
+// Close stops accepting tasks and waits for the queued ones to finish
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for item := range p.tasks {
+		p.run(item)
+	}
+}
+
+func (p *Pool) run(item queued) {
+	p.busy.Inc()
+	defer p.busy.Dec()
+	defer p.completed.Inc()
+	defer func() {
+		if r := recover(); r != nil {
+			p.panics.Inc()
+			slog.Error("worker pool task panicked",
+				slog.String("pool", p.name),
+				slog.Any("panic", r))
+		}
+	}()
+
+	item.task(item.ctx)
+}
+
+// Describe implements prometheus.Collector
+func (p *Pool) Describe(ch chan<- *prometheus.Desc) {
+	p.depth.Describe(ch)
+	p.busy.Describe(ch)
+	p.completed.Describe(ch)
+	p.rejected.Describe(ch)
+	p.panics.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *Pool) Collect(ch chan<- prometheus.Metric) {
+	p.depth.Collect(ch)
+	p.busy.Collect(ch)
+	p.completed.Collect(ch)
+	p.rejected.Collect(ch)
+	p.panics.Collect(ch)
+}
@@ -0,0 +1,91 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	t.Run("runs every queued task before closing", func(t *testing.T) {
+		p := New("test", 2, 10, Reject)
+		var ran atomic.Int64
+		for i := 0; i < 10; i++ {
+			if err := p.Submit(context.Background(), func(context.Context) { ran.Add(1) }); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		p.Close()
+
+		if ran.Load() != 10 {
+			t.Errorf("expected 10 tasks to run, got %d", ran.Load())
+		}
+		if err := p.Submit(context.Background(), func(context.Context) {}); !errors.Is(err, ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+
+	// blocked fills a pool of one worker and a queue of one
+	blocked := func(t *testing.T, policy Policy) (*Pool, chan struct{}) {
+		p := New("test", 1, 1, policy)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		p.Submit(context.Background(), func(context.Context) { close(started); <-release })
+		<-started
+		if err := p.Submit(context.Background(), func(context.Context) {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return p, release
+	}
+
+	t.Run("reject fails when full", func(t *testing.T) {
+		p, release := blocked(t, Reject)
+		defer p.Close()
+		defer close(release)
+
+		if err := p.Submit(context.Background(), func(context.Context) {}); !errors.Is(err, ErrFull) {
+			t.Errorf("expected ErrFull, got %v", err)
+		}
+	})
+
+	t.Run("block waits until the context is done", func(t *testing.T) {
+		p, release := blocked(t, Block)
+		defer p.Close()
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := p.Submit(ctx, func(context.Context) {}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("caller runs the task when full", func(t *testing.T) {
+		p, release := blocked(t, CallerRuns)
+		defer p.Close()
+		defer close(release)
+
+		ran := false
+		if err := p.Submit(context.Background(), func(context.Context) { ran = true }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ran {
+			t.Error("expected the task to run on the caller")
+		}
+	})
+
+	t.Run("tasks outlive the submitter's context", func(t *testing.T) {
+		p := New("test", 1, 1, Reject)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		p.Submit(ctx, func(ctx context.Context) { done <- ctx.Err() })
+		cancel()
+		p.Close()
+
+		if err := <-done; err != nil {
+			t.Errorf("expected a live context, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package reqsign
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+type memoryNonces map[string]bool
+
+func (m memoryNonces) SetIfAbsent(_ context.Context, key, _ string, _ time.Duration) (bool, error) {
+	if m[key] {
+		return false, nil
+	}
+	m[key] = true
+	return true, nil
+}
+
+func TestVerify(t *testing.T) {
+	const method = "/user.UserService/PurgeUser"
+	key := []byte("current")
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte("request")
+
+	newVerifier := func() *Verifier {
+		v := NewVerifier([][]byte{key, []byte("previous")}, time.Minute, memoryNonces{})
+		v.now = func() time.Time { return now }
+		return v
+	}
+	signed := func(key []byte, at time.Time, nonce string) metadata.MD {
+		return metadata.Pairs(
+			TimestampKey, strconv.FormatInt(at.Unix(), 10),
+			NonceKey, nonce,
+			SignatureKey, Sign(key, method, at.Unix(), nonce, body),
+		)
+	}
+
+	t.Run("accepts a signature once", func(t *testing.T) {
+		v := newVerifier()
+		md := signed(key, now, "n1")
+		if err := v.Verify(context.Background(), method, md, body); err != nil {
+			t.Fatalf("expected signature to be accepted, got %v", err)
+		}
+		if err := v.Verify(context.Background(), method, md, body); !errors.Is(err, ErrReplayed) {
+			t.Errorf("expected ErrReplayed, got %v", err)
+		}
+	})
+
+	t.Run("accepts the previous key", func(t *testing.T) {
+		if err := newVerifier().Verify(context.Background(), method, signed([]byte("previous"), now, "n1"), body); err != nil {
+			t.Errorf("expected signature to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("rejects forged, altered and stale calls", func(t *testing.T) {
+		tests := []struct {
+			name string
+			md   metadata.MD
+			body []byte
+			want error
+		}{
+			{"unsigned", metadata.MD{}, body, ErrMissing},
+			{"other key", signed([]byte("other"), now, "n1"), body, ErrInvalid},
+			{"altered body", signed(key, now, "n1"), []byte("other"), ErrInvalid},
+			{"too old", signed(key, now.Add(-2*time.Minute), "n1"), body, ErrStale},
+			{"in the future", signed(key, now.Add(2*time.Minute), "n1"), body, ErrStale},
+		}
+		for _, tt := range tests {
+			err := newVerifier().Verify(context.Background(), method, tt.md, tt.body)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			}
+		}
+	})
+}
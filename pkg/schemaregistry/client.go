@@ -0,0 +1,121 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SchemaTypeProtobuf is the registry schema type for protobuf schemas
+const SchemaTypeProtobuf = "PROTOBUF"
+
+// ErrSubjectNotFound is returned when the subject has no registered schema
+var ErrSubjectNotFound = errors.New("subject not found")
+
+// Client talks to a Confluent Schema Registry compatible API
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// New creates a new Client; username and password enable basic auth
+func New(baseURL, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+// Register registers the schema under subject and returns its global ID.
+// Registering an identical schema again returns the existing ID.
+func (c *Client) Register(ctx context.Context, subject, schema string) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.post(ctx, path, schemaRequest{schema, SchemaTypeProtobuf}, &resp); err != nil {
+		return 0, fmt.Errorf("failed to register schema: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// Lookup returns the ID of schema if it is registered under subject
+func (c *Client) Lookup(ctx context.Context, subject, schema string) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject)
+	if err := c.post(ctx, path, schemaRequest{schema, SchemaTypeProtobuf}, &resp); err != nil {
+		return 0, fmt.Errorf("failed to look up schema: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// Compatible checks schema against the latest version of subject using the
+// subject's configured compatibility level. A subject without versions is
+// compatible with anything.
+func (c *Client) Compatible(ctx context.Context, subject, schema string) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest"
+	err := c.post(ctx, path, schemaRequest{schema, SchemaTypeProtobuf}, &resp)
+	if errors.Is(err, ErrSubjectNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check schema compatibility: %w", err)
+	}
+	return resp.IsCompatible, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var regErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&regErr)
+		// 40401 subject not found, 40402 version not found, 40403 schema not found
+		if resp.StatusCode == http.StatusNotFound && regErr.ErrorCode >= 40401 && regErr.ErrorCode <= 40403 {
+			return fmt.Errorf("%w: %s", ErrSubjectNotFound, regErr.Message)
+		}
+		return fmt.Errorf("schema registry returned %s: %s", resp.Status, regErr.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
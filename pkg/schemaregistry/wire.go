@@ -0,0 +1,64 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// magicByte prefixes every payload in the Confluent wire format
+const magicByte = 0
+
+// ErrInvalidFrame is returned for payloads not in the Confluent wire format
+var ErrInvalidFrame = errors.New("invalid schema registry frame")
+
+// FrameProtobuf prefixes a serialized protobuf message with the Confluent
+// wire format header: magic byte, big-endian schema ID and the message index
+// path. The path of the first message in the schema is encoded as a single 0.
+func FrameProtobuf(schemaID int, messageIndexes []int, payload []byte) []byte {
+	buf := make([]byte, 5, 5+binary.MaxVarintLen64*(len(messageIndexes)+1)+len(payload))
+	buf[0] = magicByte
+	binary.BigEndian.PutUint32(buf[1:5], uint32(schemaID))
+
+	if len(messageIndexes) == 1 && messageIndexes[0] == 0 {
+		buf = append(buf, 0)
+	} else {
+		buf = binary.AppendVarint(buf, int64(len(messageIndexes)))
+		for _, index := range messageIndexes {
+			buf = binary.AppendVarint(buf, int64(index))
+		}
+	}
+
+	return append(buf, payload...)
+}
+
+// UnframeProtobuf splits a Confluent wire format payload into its schema ID,
+// message index path and serialized protobuf message
+func UnframeProtobuf(data []byte) (int, []int, []byte, error) {
+	if len(data) < 6 || data[0] != magicByte {
+		return 0, nil, nil, ErrInvalidFrame
+	}
+	schemaID := int(binary.BigEndian.Uint32(data[1:5]))
+	rest := data[5:]
+
+	count, n := binary.Varint(rest)
+	if n <= 0 || count < 0 {
+		return 0, nil, nil, ErrInvalidFrame
+	}
+	rest = rest[n:]
+
+	if count == 0 {
+		return schemaID, []int{0}, rest, nil
+	}
+
+	indexes := make([]int, count)
+	for i := range indexes {
+		index, n := binary.Varint(rest)
+		if n <= 0 {
+			return 0, nil, nil, ErrInvalidFrame
+		}
+		indexes[i] = int(index)
+		rest = rest[n:]
+	}
+
+	return schemaID, indexes, rest, nil
+}
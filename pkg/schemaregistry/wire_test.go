@@ -0,0 +1,35 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestFrameProtobuf(t *testing.T) {
+	t.Run("first message uses the short index path", func(t *testing.T) {
+		framed := FrameProtobuf(42, []int{0}, []byte{0x08, 0x01})
+		want := []byte{0, 0, 0, 0, 42, 0, 0x08, 0x01}
+		if !bytes.Equal(framed, want) {
+			t.Errorf("expected %x, got %x", want, framed)
+		}
+	})
+
+	t.Run("round trip with nested message path", func(t *testing.T) {
+		framed := FrameProtobuf(7, []int{1, 2}, []byte("payload"))
+
+		id, indexes, payload, err := UnframeProtobuf(framed)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id != 7 || !slices.Equal(indexes, []int{1, 2}) || string(payload) != "payload" {
+			t.Errorf("got id %d indexes %v payload %q", id, indexes, payload)
+		}
+	})
+
+	t.Run("rejects payloads without magic byte", func(t *testing.T) {
+		if _, _, _, err := UnframeProtobuf([]byte{1, 0, 0, 0, 1, 0}); err != ErrInvalidFrame {
+			t.Errorf("expected ErrInvalidFrame, got %v", err)
+		}
+	})
+}
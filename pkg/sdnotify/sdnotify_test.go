@@ -0,0 +1,70 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Run("sends the state to the notify socket", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "notify.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+		if err != nil {
+			t.Skipf("unix datagram sockets unavailable: %v", err)
+		}
+		defer conn.Close()
+		t.Setenv("NOTIFY_SOCKET", name)
+
+		sent, err := Notify(Ready)
+		if !sent || err != nil {
+			t.Fatalf("Notify() = %v, %v, want true, nil", sent, err)
+		}
+
+		buf := make([]byte, 64)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != Ready {
+			t.Errorf("received %q, want %q", got, Ready)
+		}
+	})
+
+	t.Run("does nothing outside systemd", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+
+		if sent, err := Notify(Ready); sent || err != nil {
+			t.Errorf("Notify() = %v, %v, want false, nil", sent, err)
+		}
+	})
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{name: "disabled", usec: "", want: 0},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "this process", usec: "30000000", pid: strconv.Itoa(os.Getpid()), want: 30 * time.Second},
+		{name: "another process", usec: "30000000", pid: "1", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			if got := WatchdogInterval(); got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
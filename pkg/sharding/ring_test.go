@@ -0,0 +1,56 @@
+package sharding
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	t.Run("empty ring", func(t *testing.T) {
+		if shard := NewRing(nil, 0).Locate(UserKey(1)); shard != "" {
+			t.Errorf("expected no shard, got %q", shard)
+		}
+	})
+
+	t.Run("keys spread evenly", func(t *testing.T) {
+		r := NewRing([]string{"a", "b", "c", "d"}, 0)
+		counts := map[string]int{}
+		for id := int64(1); id <= 40000; id++ {
+			counts[r.Locate(UserKey(id))]++
+		}
+		for shard, n := range counts {
+			if n < 7000 || n > 13000 {
+				t.Errorf("shard %s got %d of 40000 keys", shard, n)
+			}
+		}
+	})
+
+	t.Run("adding a shard only moves keys to it", func(t *testing.T) {
+		before := NewRing([]string{"a", "b", "c"}, 0)
+		after := NewRing([]string{"a", "b", "c", "d"}, 0)
+
+		moved := 0
+		for id := int64(1); id <= 10000; id++ {
+			from, to := before.Locate(UserKey(id)), after.Locate(UserKey(id))
+			if from != to {
+				if to != "d" {
+					t.Fatalf("key %d moved from %s to %s", id, from, to)
+				}
+				moved++
+			}
+		}
+		if moved < 1500 || moved > 3500 {
+			t.Errorf("expected about a quarter of the keys to move, got %d", moved)
+		}
+	})
+
+	t.Run("email keys ignore case", func(t *testing.T) {
+		r := NewRing([]string{"a", "b", "c"}, 0)
+		for i := 0; i < 100; i++ {
+			email := fmt.Sprintf("User%d@Example.com", i)
+			if r.Locate(EmailKey(email)) != r.Locate(EmailKey(fmt.Sprintf("user%d@example.com", i))) {
+				t.Fatalf("%s located differently by case", email)
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPStore stores objects with plain PUT and GET requests below a base URL
+type HTTPStore struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewHTTPStore creates a new HTTPStore instance
+func NewHTTPStore(baseURL, token string, timeout time.Duration) *HTTPStore {
+	return &HTTPStore{
+		baseURL: baseURL,
+		token:   token,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Put implements Store
+func (s *HTTPStore) Put(ctx context.Context, key string, r io.Reader) error {
+	resp, err := s.do(ctx, http.MethodPut, key, r)
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get implements Store
+func (s *HTTPStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// Delete implements Store
+func (s *HTTPStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, key string, body io.Reader) (*http.Response, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+"/"+key, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkStatus closes the body of unsuccessful responses and describes them
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("object storage returned %s", resp.Status)
+}
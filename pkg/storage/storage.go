@@ -0,0 +1,79 @@
+// Package storage stores opaque objects, such as backups and avatars, on
+// local disk or in S3-compatible object storage
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidKey is returned for object keys that are empty or escape the store
+	ErrInvalidKey = errors.New("invalid object key")
+	// ErrNotFound is returned when getting an object that does not exist
+	ErrNotFound = errors.New("object not found")
+)
+
+// Store is an object storage backend
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// maxSignedURLTTL is the longest lifetime S3 accepts for presigned URLs
+const maxSignedURLTTL = 7 * 24 * time.Hour
+
+// Signer is implemented by stores handing out temporary URLs that download
+// an object without credentials
+type Signer interface {
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// Options configures the stores created by Open
+type Options struct {
+	// Token is sent as a bearer token by http(s) stores
+	Token   string
+	Timeout time.Duration
+	S3      S3Credentials
+}
+
+// Open creates a Store from a URL: file:///path stores objects in a local
+// (typically mounted) directory, http(s)://host/prefix PUTs and GETs objects
+// against a gateway endpoint, and s3://bucket/prefix signs requests to an
+// S3-compatible endpoint
+func Open(rawURL string, opts Options) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse store url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileStore(u.Path), nil
+	case "http", "https":
+		return NewHTTPStore(strings.TrimSuffix(rawURL, "/"), opts.Token, opts.Timeout), nil
+	case "s3":
+		return NewS3Store(u.Host, strings.Trim(u.Path, "/"), opts.S3, opts.Timeout)
+	default:
+		return nil, fmt.Errorf("unsupported store scheme %q", u.Scheme)
+	}
+}
+
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir())
+
+	t.Run("round trip", func(t *testing.T) {
+		if err := store.Put(ctx, "users/20240101T000000Z.tar.gz", strings.NewReader("dump")); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+
+		r, err := store.Get(ctx, "users/20240101T000000Z.tar.gz")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer r.Close()
+
+		data, _ := io.ReadAll(r)
+		if string(data) != "dump" {
+			t.Errorf("expected %q, got %q", "dump", data)
+		}
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		if _, err := store.Get(ctx, "users/missing.tar.gz"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Put(ctx, "avatars/1", strings.NewReader("png")); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		if err := store.Delete(ctx, "avatars/1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := store.Get(ctx, "avatars/1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound after delete, got %v", err)
+		}
+		if err := store.Delete(ctx, "avatars/1"); err != nil {
+			t.Errorf("deleting a missing object: %v", err)
+		}
+	})
+
+	t.Run("rejects keys escaping the root", func(t *testing.T) {
+		for _, key := range []string{"", "/etc/passwd", "../secret", "users//x", "users/./x"} {
+			if err := store.Put(ctx, key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("key %q: expected ErrInvalidKey, got %v", key, err)
+			}
+		}
+	})
+}
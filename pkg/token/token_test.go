@@ -0,0 +1,60 @@
+package token
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	claims := Claims{
+		Subject:   "user:42",
+		SessionID: 7,
+		Roles:     []string{"user"},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(15 * time.Minute).Unix(),
+	}
+
+	t.Run("verifies its own tokens", func(t *testing.T) {
+		s := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+		tok, err := s.Sign(claims)
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+
+		got, err := s.Verify(tok, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if !reflect.DeepEqual(*got, claims) {
+			t.Errorf("Verify() = %+v, want %+v", *got, claims)
+		}
+	})
+
+	t.Run("rejects expired tokens", func(t *testing.T) {
+		s := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+		tok, _ := s.Sign(claims)
+
+		if _, err := s.Verify(tok, now.Add(15*time.Minute)); !errors.Is(err, ErrExpired) {
+			t.Errorf("Verify() error = %v, want ErrExpired", err)
+		}
+	})
+
+	t.Run("rejects tokens signed with another key or altered", func(t *testing.T) {
+		s := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+		other, _ := NewSigner([]byte("another key of thirty-two bytes!")).Sign(claims)
+		tok, _ := s.Sign(claims)
+		parts := strings.Split(tok, ".")
+		altered := parts[0] + "." + parts[1] + "x." + parts[2]
+		unsigned := parts[0] + "." + parts[1] + "."
+
+		for _, tok := range []string{other, altered, unsigned, "", "not-a-token"} {
+			if _, err := s.Verify(tok, now); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify(%q) error = %v, want ErrInvalid", tok, err)
+			}
+		}
+	})
+}
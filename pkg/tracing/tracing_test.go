@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+)
+
+func TestSetup(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	t.Run("disabled installs nothing", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), config.TracingConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if otel.GetTracerProvider() != provider {
+			t.Error("expected the global tracer provider to be left alone")
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("installs provider and propagators", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), config.TracingConfig{
+			Enabled:      true,
+			Exporter:     "otlp-http",
+			OTLPEndpoint: "127.0.0.1:1",
+			OTLPInsecure: true,
+			ServiceName:  "user-service",
+			SampleRatio:  1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		defer shutdown(ctx)
+
+		if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); !ok {
+			t.Errorf("expected an SDK tracer provider, got %T", otel.GetTracerProvider())
+		}
+		fields := otel.GetTextMapPropagator().Fields()
+		if !slices.Contains(fields, "traceparent") || !slices.Contains(fields, "baggage") {
+			t.Errorf("expected trace context and baggage propagators, got %v", fields)
+		}
+	})
+}
@@ -0,0 +1,304 @@
+package userservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/analytics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/audit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/auth"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/budget"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/ipfilter"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/policy"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/ratelimit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/server"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/deadline"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/logger"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/reqsign"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+// readOnlyMethods are still served while a secondary region fences writes
+var readOnlyMethods = map[string]bool{
+	pb.UserService_GetUser_FullMethodName:                 true,
+	pb.UserService_GetUserByEmail_FullMethodName:          true,
+	pb.UserService_ListUsers_FullMethodName:               true,
+	pb.UserService_SearchUsers_FullMethodName:             true,
+	pb.UserService_CountUsers_FullMethodName:              true,
+	pb.UserService_StreamUsers_FullMethodName:             true,
+	pb.UserService_ExportUsers_FullMethodName:             true,
+	pb.UserService_WatchUsers_FullMethodName:              true,
+	pb.UserService_UsersExist_FullMethodName:              true,
+	pb.UserService_BatchGetUsers_FullMethodName:           true,
+	pb.UserService_GetAvatar_FullMethodName:               true,
+	pb.UserService_GetUserHistory_FullMethodName:          true,
+	pb.UserService_ReplayEvents_FullMethodName:            true,
+	pb.UserService_SyncUsers_FullMethodName:               true,
+	pb.UserService_GetUsageReport_FullMethodName:          true,
+	pb.UserService_ListPendingInvites_FullMethodName:      true,
+	pb.UserService_GetOrganization_FullMethodName:         true,
+	pb.UserService_ListOrganizations_FullMethodName:       true,
+	pb.UserService_ListOrganizationMembers_FullMethodName: true,
+	pb.UserService_Authenticate_FullMethodName:            true,
+	pb.UserService_ListAuditEvents_FullMethodName:         true,
+	pb.UserService_GetServerInfo_FullMethodName:           true,
+	pb.UserService_GetTrafficDump_FullMethodName:          true,
+	pb.UserService_GetUserReport_FullMethodName:           true,
+	pb.UserService_ListDataIssues_FullMethodName:          true,
+	userv2.UserService_GetUser_FullMethodName:             true,
+	userv2.UserService_ListUsers_FullMethodName:           true,
+}
+
+// userCreatingMethods are audited with the created user as the change
+var userCreatingMethods = map[string]bool{
+	pb.UserService_CreateUser_FullMethodName:      true,
+	pb.UserService_VerifyEmail_FullMethodName:     true,
+	pb.UserService_CreateGuestUser_FullMethodName: true,
+	pb.UserService_AcceptInvite_FullMethodName:    true,
+	userv2.UserService_CreateUser_FullMethodName:  true,
+}
+
+// auditedStreams are the streaming methods that change data
+var auditedStreams = map[string]bool{
+	pb.UserService_ImportUsers_FullMethodName:  true,
+	pb.UserService_UploadAvatar_FullMethodName: true,
+	pb.UserService_FlushCache_FullMethodName:   true,
+}
+
+// methodBudgets bound the request size and handler latency of the busiest
+// methods. Oversized requests are rejected; slow calls are only logged and
+// counted in grpc_budget_violations_total.
+var methodBudgets = map[string]budget.Budget{
+	pb.UserService_GetUser_FullMethodName:          {MaxRequestBytes: 1 << 10, MaxLatency: 50 * time.Millisecond},
+	pb.UserService_GetUserByEmail_FullMethodName:   {MaxRequestBytes: 1 << 10, MaxLatency: 50 * time.Millisecond},
+	pb.UserService_ListUsers_FullMethodName:        {MaxRequestBytes: 4 << 10, MaxLatency: 200 * time.Millisecond},
+	pb.UserService_SearchUsers_FullMethodName:      {MaxRequestBytes: 4 << 10, MaxLatency: 300 * time.Millisecond},
+	pb.UserService_CountUsers_FullMethodName:       {MaxRequestBytes: 4 << 10, MaxLatency: 300 * time.Millisecond},
+	pb.UserService_UsersExist_FullMethodName:       {MaxRequestBytes: 64 << 10, MaxLatency: 100 * time.Millisecond},
+	pb.UserService_BatchGetUsers_FullMethodName:    {MaxRequestBytes: 64 << 10, MaxLatency: 500 * time.Millisecond},
+	pb.UserService_CreateUser_FullMethodName:       {MaxRequestBytes: 16 << 10, MaxLatency: 200 * time.Millisecond},
+	pb.UserService_BatchCreateUsers_FullMethodName: {MaxRequestBytes: 1 << 20, MaxLatency: 2 * time.Second},
+	pb.UserService_UpdateUser_FullMethodName:       {MaxRequestBytes: 16 << 10, MaxLatency: 200 * time.Millisecond},
+	pb.UserService_DeleteUser_FullMethodName:       {MaxRequestBytes: 1 << 10, MaxLatency: 200 * time.Millisecond},
+	pb.UserService_Authenticate_FullMethodName:     {MaxRequestBytes: 1 << 10, MaxLatency: 500 * time.Millisecond},
+	pb.UserService_Login_FullMethodName:            {MaxRequestBytes: 1 << 10, MaxLatency: 500 * time.Millisecond},
+	pb.UserService_RefreshToken_FullMethodName:     {MaxRequestBytes: 1 << 10, MaxLatency: 100 * time.Millisecond},
+	userv2.UserService_GetUser_FullMethodName:      {MaxRequestBytes: 1 << 10, MaxLatency: 50 * time.Millisecond},
+	userv2.UserService_ListUsers_FullMethodName:    {MaxRequestBytes: 4 << 10, MaxLatency: 200 * time.Millisecond},
+}
+
+// buildInterceptors assembles the unary and stream interceptor chains
+func (s *Service) buildInterceptors(
+	apiKeyService *service.APIKeyService,
+	sessionService *service.SessionService,
+	auditRecorder *audit.Recorder,
+	usageAggregator *usage.Aggregator,
+	adaptiveLimiter *ratelimit.Adaptive,
+	requestMirror *analytics.Mirror,
+	trafficDump *server.TrafficDump,
+	redisClient *cache.Redis,
+) error {
+	cfg := s.cfg
+
+	// Load authorization policy
+	var policyEngine policy.Engine = policy.AllowAll{}
+	if cfg.Policy.Path != "" {
+		opa, err := policy.NewOPA(context.Background(), cfg.Policy.Path, cfg.Policy.Query)
+		if err != nil {
+			return fmt.Errorf("%w: failed to load policy: %w", ErrConfig, err)
+		}
+		policyEngine = opa
+	}
+	if cfg.Policy.CacheTTL > 0 {
+		policyEngine = policy.NewCached(policyEngine, cfg.Policy.CacheTTL)
+	}
+	if cfg.Policy.DecisionLog {
+		policyEngine = policy.NewLogged(policyEngine)
+	}
+
+	// Load role grants
+	var authorizer *authz.Authorizer
+	if cfg.RBAC.PolicyPath != "" {
+		var err error
+		if authorizer, err = authz.Load(cfg.RBAC.PolicyPath); err != nil {
+			return fmt.Errorf("%w: failed to load role policy: %w", ErrConfig, err)
+		}
+	}
+
+	// Methods served to everyone, even with invalid credentials
+	exemptions, err := server.NewExemptions(cfg.Auth.ExemptMethods)
+	if err != nil {
+		return fmt.Errorf("%w: AUTH_EXEMPT_METHODS: %w", ErrConfig, err)
+	}
+	s.exemptions = exemptions
+
+	// Identify callers
+	var authenticators []auth.Authenticator
+	if cfg.APIKeys.Enabled {
+		authenticators = append(authenticators, auth.APIKeyAuthenticator{Keys: apiKeyService})
+	}
+	authenticators = append(authenticators, auth.BearerAuthenticator{Tokens: sessionService})
+	if cfg.Auth.TrustCallerHeader {
+		headerAuth, err := auth.NewHeaderAuthenticator(cfg.Auth.CallerHeaderProxies, cfg.Auth.TrustCallerRoles)
+		if err != nil {
+			return fmt.Errorf("%w: AUTH_CALLER_HEADER_PROXIES: %w", ErrConfig, err)
+		}
+		authenticators = append(authenticators, headerAuth)
+	}
+
+	// Public RPCs get stricter per-address limits
+	registrationLimiter := ratelimit.NewKeyed(cfg.Registration.RateLimitPerMinute, cfg.Registration.RateLimitBurst)
+	loginLimiter := ratelimit.NewKeyed(cfg.Sessions.RateLimitPerMinute, cfg.Sessions.RateLimitBurst)
+	publicLimits := map[string]*ratelimit.Keyed{
+		pb.UserService_RegisterUser_FullMethodName:    registrationLimiter,
+		pb.UserService_VerifyEmail_FullMethodName:     registrationLimiter,
+		pb.UserService_CreateGuestUser_FullMethodName: registrationLimiter,
+		pb.UserService_AcceptInvite_FullMethodName:    registrationLimiter,
+		pb.UserService_Login_FullMethodName:           loginLimiter,
+		pb.UserService_RefreshToken_FullMethodName:    loginLimiter,
+	}
+
+	budgets := budget.New(methodBudgets)
+	s.registerer.MustRegister(budgets)
+
+	// Restrict callers by address
+	var ipFilter *ipfilter.Filter
+	if len(cfg.IPFilter.Deny) > 0 || len(cfg.IPFilter.Allow) > 0 {
+		var err error
+		ipFilter, err = ipfilter.New(ipfilter.Rules{
+			Deny:           cfg.IPFilter.Deny,
+			Allow:          cfg.IPFilter.Allow,
+			Methods:        cfg.IPFilter.AllowMethods,
+			TrustedProxies: cfg.IPFilter.TrustedProxies,
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrConfig, err)
+		}
+		s.registerer.MustRegister(ipFilter)
+	}
+
+	// Calls made with an API key are limited per key
+	apiKeyLimiter := ratelimit.NewKeyed(cfg.APIKeys.RateLimitPerMinute, cfg.APIKeys.RateLimitBurst)
+
+	// Limit each caller across instances
+	var callerLimiter *ratelimit.PerCaller
+	if cfg.CallerLimits.PerMinute > 0 {
+		rules, err := ratelimit.ParseRules(cfg.CallerLimits.Methods)
+		if err != nil {
+			return fmt.Errorf("%w: CALLER_RATE_LIMIT_METHODS: %w", ErrConfig, err)
+		}
+		callerLimiter = ratelimit.NewPerCaller(redisClient, ratelimit.Rule{
+			PerMinute: cfg.CallerLimits.PerMinute,
+			Burst:     cfg.CallerLimits.Burst,
+		}, rules)
+		s.registerer.MustRegister(callerLimiter)
+	}
+
+	// Require signed requests on sensitive methods
+	var signatures *reqsign.Verifier
+	if cfg.RequestSigning.Key.IsSet() {
+		if err := authz.CheckPatterns(cfg.RequestSigning.Methods); err != nil {
+			return fmt.Errorf("%w: REQUEST_SIGNING_METHODS: %w", ErrConfig, err)
+		}
+		key, err := signingKey(context.Background(), cfg.RequestSigning.Key)
+		if err != nil {
+			return fmt.Errorf("%w: REQUEST_SIGNING_KEY: %w", ErrConfig, err)
+		}
+		previous, err := signingKey(context.Background(), cfg.RequestSigning.PreviousKey)
+		if err != nil {
+			return fmt.Errorf("%w: REQUEST_SIGNING_PREVIOUS_KEY: %w", ErrConfig, err)
+		}
+		keys := [][]byte{key}
+		if len(previous) > 0 {
+			keys = append(keys, previous)
+		}
+		signatures = reqsign.NewVerifier(keys, cfg.RequestSigning.MaxSkew, redisClient)
+	}
+
+	requestMetrics := server.NewRequestMetrics()
+	s.registerer.MustRegister(requestMetrics)
+
+	s.unary = []grpc.UnaryServerInterceptor{server.LoggingInterceptor, server.NewMetricsInterceptor(requestMetrics)}
+	if trafficDump != nil {
+		s.unary = append(s.unary, trafficDump.UnaryInterceptor)
+	}
+	if ipFilter != nil {
+		s.unary = append(s.unary, server.NewIPFilterInterceptor(ipFilter))
+	}
+	if cfg.Log.RequestPayloads {
+		s.unary = append(s.unary, server.NewPayloadLoggingInterceptor(logger.NewRedactor(cfg.Log.RedactFields, cfg.Log.RedactMode)))
+	}
+	if cfg.Deadlines.Reserve > 0 {
+		deadlines := deadline.New(cfg.Deadlines.Reserve)
+		s.registerer.MustRegister(deadlines)
+		s.unary = append(s.unary, server.NewDeadlineBudgetInterceptor(deadlines))
+	}
+	s.unary = append(s.unary,
+		server.NewRetryInfoInterceptor(cfg.RetryHints),
+		exemptions.Unary(server.NewAuthInterceptor(policyEngine, authenticators...)),
+	)
+	if authorizer != nil {
+		s.unary = append(s.unary, exemptions.Unary(server.NewRBACInterceptor(authorizer)))
+	}
+	if signatures != nil {
+		s.unary = append(s.unary, exemptions.Unary(server.NewRequestSigningInterceptor(signatures, cfg.RequestSigning.Methods)))
+	}
+	if callerLimiter != nil {
+		s.unary = append(s.unary, exemptions.Unary(server.NewCallerRateLimitInterceptor(callerLimiter)))
+	}
+	// Exempt public methods keep their per-address limits
+	s.unary = append(s.unary,
+		exemptions.Unary(server.NewAPIKeyRateLimitInterceptor(apiKeyLimiter)),
+		server.NewRateLimitInterceptor(publicLimits),
+		server.NewWriteFenceInterceptor(s.region, readOnlyMethods),
+		server.NewBudgetInterceptor(budgets),
+		server.NewSanitizeInterceptor(cfg.Messages.MaxStringBytes),
+		server.ValidationInterceptor,
+		server.NewAuditInterceptor(auditRecorder, readOnlyMethods, userCreatingMethods),
+	)
+	if usageAggregator != nil {
+		s.unary = append(s.unary, server.NewUsageInterceptor(usageAggregator))
+	}
+	if adaptiveLimiter != nil {
+		s.unary = append(s.unary, exemptions.Unary(server.NewAdaptiveRateLimitInterceptor(adaptiveLimiter)))
+	}
+	if requestMirror != nil {
+		s.unary = append(s.unary, server.NewMirrorInterceptor(requestMirror))
+	}
+	s.unary = append(s.unary, server.RecoveryInterceptor)
+
+	s.stream = []grpc.StreamServerInterceptor{server.LoggingStreamInterceptor, server.NewMetricsStreamInterceptor(requestMetrics)}
+	if trafficDump != nil {
+		s.stream = append(s.stream, trafficDump.StreamInterceptor)
+	}
+	if ipFilter != nil {
+		s.stream = append(s.stream, server.NewIPFilterStreamInterceptor(ipFilter))
+	}
+	s.stream = append(s.stream, exemptions.Stream(server.NewAuthStreamInterceptor(policyEngine, authenticators...)))
+	if authorizer != nil {
+		s.stream = append(s.stream, exemptions.Stream(server.NewRBACStreamInterceptor(authorizer)))
+	}
+	if signatures != nil {
+		s.stream = append(s.stream, exemptions.Stream(server.NewRequestSigningStreamInterceptor(signatures, cfg.RequestSigning.Methods)))
+	}
+	if callerLimiter != nil {
+		s.stream = append(s.stream, exemptions.Stream(server.NewCallerRateLimitStreamInterceptor(callerLimiter)))
+	}
+	s.stream = append(s.stream,
+		server.NewWriteFenceStreamInterceptor(s.region, readOnlyMethods),
+		server.NewSanitizeStreamInterceptor(cfg.Messages.MaxStringBytes),
+		server.ValidationStreamInterceptor,
+		server.NewAuditStreamInterceptor(auditRecorder, auditedStreams),
+		server.RecoveryStreamInterceptor,
+	)
+
+	return nil
+}
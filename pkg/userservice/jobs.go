@@ -0,0 +1,194 @@
+package userservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/analytics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/backup"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/diagnostics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/heartbeat"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/jobs"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/partition"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/ratelimit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+)
+
+// schedule registers the background jobs with the scheduler. Jobs writing
+// to the database only run while the region is primary. It returns the
+// adaptive limiter when enabled, as it is both a job and an interceptor.
+func (s *Service) schedule(
+	db *pgxpool.Pool,
+	redisClient *cache.Redis,
+	userService *service.UserService,
+	registrationService *service.RegistrationService,
+	sessionService *service.SessionService,
+	privacyService *service.PrivacyService,
+	reportService *service.ReportService,
+	dataQuality *diagnostics.DataQualityChecker,
+	historyPartitions *partition.Maintainer,
+	usageAggregator *usage.Aggregator,
+	requestMirror *analytics.Mirror,
+	onWatchdog func(reason string),
+) (*ratelimit.Adaptive, error) {
+	cfg := s.cfg
+
+	s.scheduler.Add(jobs.Job{
+		Name:     "region-monitor",
+		Interval: cfg.Region.CheckInterval,
+		Run:      s.region.Run,
+	})
+	s.scheduler.Add(jobs.Job{
+		Name:     "partition-maintenance",
+		Interval: cfg.Partitions.Interval,
+		Run:      s.region.PrimaryOnly(historyPartitions.Run),
+	})
+	if cfg.History.RetentionDays > 0 {
+		retention := time.Duration(cfg.History.RetentionDays) * 24 * time.Hour
+		s.scheduler.Add(jobs.Job{
+			Name:     "history-retention",
+			Interval: cfg.History.PruneInterval,
+			Run: s.region.PrimaryOnly(func(ctx context.Context) error {
+				// Whole expired partitions are dropped, the rest is deleted row by row
+				if _, err := historyPartitions.DropBefore(ctx, time.Now().Add(-retention)); err != nil {
+					return err
+				}
+				_, err := userService.PruneHistory(ctx, retention)
+				return err
+			}),
+		})
+	}
+	s.scheduler.Add(jobs.Job{
+		Name:     "registration-cleanup",
+		Interval: cfg.Registration.CleanupInterval,
+		Run:      s.region.PrimaryOnly(registrationService.PruneExpired),
+	})
+	s.scheduler.Add(jobs.Job{
+		Name:     "session-cleanup",
+		Interval: cfg.Sessions.CleanupInterval,
+		Run:      s.region.PrimaryOnly(sessionService.PruneExpired),
+	})
+	s.scheduler.Add(jobs.Job{
+		Name:     "erasure",
+		Interval: cfg.Erasure.Interval,
+		Run:      s.region.PrimaryOnly(privacyService.RunErasures),
+	})
+	if reportService != nil {
+		s.scheduler.Add(jobs.Job{
+			Name:     "user-reports",
+			Interval: cfg.Reports.Interval,
+			Run:      s.region.PrimaryOnly(reportService.RunReports),
+		})
+	}
+	if requestMirror != nil {
+		s.scheduler.Add(jobs.Job{
+			Name:     "analytics-flush",
+			Interval: cfg.Analytics.FlushInterval,
+			Run:      requestMirror.Flush,
+		})
+	}
+	if usageAggregator != nil {
+		s.scheduler.Add(jobs.Job{
+			Name:     "usage-flush",
+			Interval: cfg.Usage.FlushInterval,
+			Run:      s.region.PrimaryOnly(usageAggregator.Flush),
+		})
+	}
+	if cfg.Diagnostics.Interval > 0 {
+		advisor := diagnostics.NewIndexAdvisor(db, diagnostics.IndexAdvisorConfig{
+			Tables:                 cfg.Diagnostics.Tables,
+			SeqScanMinRows:         int64(cfg.Diagnostics.SeqScanMinRows),
+			SlowStatementThreshold: cfg.Diagnostics.SlowStatementThreshold,
+		})
+		s.registerer.MustRegister(advisor)
+		s.scheduler.Add(jobs.Job{
+			Name:     "index-advisor",
+			Interval: cfg.Diagnostics.Interval,
+			Run:      advisor.Run,
+		})
+	}
+	if dataQuality != nil {
+		// Scans only read and may run anywhere; repairs write
+		run := dataQuality.Run
+		if len(cfg.DataQuality.Repair) > 0 {
+			run = s.region.PrimaryOnly(run)
+		}
+		s.scheduler.Add(jobs.Job{
+			Name:     "data-quality",
+			Interval: cfg.DataQuality.Interval,
+			Run:      run,
+		})
+	}
+	if cfg.Backup.StoreURL != "" {
+		store, err := storage.Open(cfg.Backup.StoreURL, storage.Options{
+			Token:   cfg.Backup.StoreToken,
+			Timeout: cfg.Backup.StoreTimeout,
+			S3:      s3Credentials(cfg.S3),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to configure backup store: %w", ErrConfig, err)
+		}
+		backups := backup.NewManager(db, repository.NewBackupRepository(db), store, cfg.Backup.Tables)
+		s.scheduler.Add(jobs.Job{
+			Name:     "backup",
+			Interval: cfg.Backup.Interval,
+			Run:      s.region.PrimaryOnly(backups.Run),
+		})
+		s.scheduler.Add(jobs.Job{
+			Name:     "backup-verify",
+			Interval: cfg.Backup.VerifyInterval,
+			Run:      s.region.PrimaryOnly(backups.RunVerify),
+		})
+	}
+
+	// Shed load when errors or database latency climb
+	var adaptiveLimiter *ratelimit.Adaptive
+	if cfg.AdaptiveLimit.Enabled {
+		adaptiveLimiter = ratelimit.NewAdaptive(ratelimit.AdaptiveConfig{
+			Initial:      cfg.AdaptiveLimit.Initial,
+			Min:          cfg.AdaptiveLimit.Min,
+			Max:          cfg.AdaptiveLimit.Max,
+			Increase:     cfg.AdaptiveLimit.Increase,
+			Decrease:     cfg.AdaptiveLimit.Decrease,
+			MaxErrorRate: cfg.AdaptiveLimit.MaxErrorRate,
+			MaxDBLatency: cfg.AdaptiveLimit.MaxDBLatency,
+			MinRequests:  cfg.AdaptiveLimit.MinRequests,
+		})
+		s.registerer.MustRegister(adaptiveLimiter)
+		s.scheduler.Add(jobs.Job{
+			Name:     "adaptive-limit",
+			Interval: cfg.AdaptiveLimit.Interval,
+			Run:      adaptiveLimiter.Run,
+		})
+	}
+
+	// Export dependency roundtrips and, when asked to, report wedged
+	// processes
+	hb := heartbeat.New(cfg.Heartbeat.Timeout, clock.Real{})
+	hb.Add("db", db.Ping)
+	hb.Add("cache", redisClient.Ping)
+	s.registerer.MustRegister(hb)
+	s.scheduler.Add(jobs.Job{
+		Name:     "heartbeat",
+		Interval: cfg.Heartbeat.Interval,
+		Run:      hb.Run,
+	})
+	if cfg.Heartbeat.WatchdogThreshold > 0 && onWatchdog != nil {
+		watchdog := heartbeat.NewWatchdog(hb, cfg.Heartbeat.WatchdogThreshold, clock.Real{}, onWatchdog, "db")
+		s.scheduler.Add(jobs.Job{
+			Name:     "watchdog",
+			Interval: cfg.Heartbeat.Interval,
+			Run:      watchdog.Run,
+		})
+	}
+
+	return adaptiveLimiter, nil
+}
@@ -0,0 +1,637 @@
+// Package userservice embeds the user service in a gRPC server. The
+// standalone server in cmd/server is a thin host around it; other binaries
+// can mount the service next to their own:
+//
+//	svc, err := userservice.New(ctx, userservice.Options{})
+//	if err != nil { ... }
+//	defer svc.Close()
+//
+//	srv := grpc.NewServer(svc.ServerOptions()...)
+//	svc.RegisterWith(srv)
+//	if err := svc.CheckExemptions(srv); err != nil { ... }
+//	go svc.Run(ctx)
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/analytics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/audit"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/authz"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/buildinfo"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/captcha"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/config"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/crypto"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/diagnostics"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/events"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/jobs"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/mail"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/partition"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/pii"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/readiness"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/region"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/repository"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/schema"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/server"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/service"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/internal/usage"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/migrations"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/cache"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/clock"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/database"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/passwd"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/pool"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/schemaregistry"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/storage"
+	"github.com/davidbadelllab/go-microservice-grpc-2023/pkg/token"
+	pb "github.com/davidbadelllab/go-microservice-grpc-2023/proto"
+	userv2 "github.com/davidbadelllab/go-microservice-grpc-2023/proto/userservice/v2"
+)
+
+var (
+	// ErrConfig wraps errors of New caused by invalid configuration
+	ErrConfig = errors.New("invalid configuration")
+	// ErrDependency wraps errors of New caused by unreachable dependencies
+	ErrDependency = errors.New("dependency unavailable")
+)
+
+// Config is the service configuration, read from the environment by
+// LoadConfig
+type Config = config.Config
+
+// LoadConfig reads the service configuration from the environment and
+// validates it
+func LoadConfig() (*Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Options configure an embedded user service
+type Options struct {
+	// Config is read from the environment when nil
+	Config *Config
+	// Registerer receives the service's metrics; prometheus.DefaultRegisterer
+	// when nil
+	Registerer prometheus.Registerer
+	// OnWatchdog is called when the watchdog finds the database wedged for
+	// longer than the configured threshold, typically to exit the process.
+	// The watchdog is disabled when nil.
+	OnWatchdog func(reason string)
+}
+
+// Service is the user service with its dependencies, ready to be
+// registered with a gRPC server
+type Service struct {
+	cfg        *Config
+	registerer prometheus.Registerer
+
+	region    *region.Monitor
+	eventBus  *events.Bus
+	scheduler *jobs.Scheduler
+	readiness *readiness.Checker
+
+	// prewarm refills the cache after changes; nil unless enabled
+	prewarm func(ctx context.Context) error
+
+	userServer   *server.UserServer
+	userServerV2 *server.UserServerV2
+	watches      *server.WatchSessions
+
+	unary      []grpc.UnaryServerInterceptor
+	stream     []grpc.StreamServerInterceptor
+	exemptions *server.Exemptions
+
+	closers []closer
+}
+
+// closer is a resource released by Close
+type closer struct {
+	name  string
+	close func() error
+}
+
+// New connects to the service's dependencies and assembles it. Background
+// jobs do not start until Run is called.
+func New(ctx context.Context, opts Options) (svc *Service, err error) {
+	cfg := opts.Config
+	if cfg == nil {
+		if cfg, err = LoadConfig(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConfig, err)
+		}
+	}
+
+	s := &Service{
+		cfg:        cfg,
+		registerer: opts.Registerer,
+		scheduler:  jobs.NewScheduler(clock.Real{}),
+	}
+	if s.registerer == nil {
+		s.registerer = prometheus.DefaultRegisterer
+	}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	// Initialize database
+	db, err := database.NewPostgres(cfg.Database)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to database: %w", ErrDependency, err)
+	}
+	s.addCloser("postgres", func() error {
+		db.Close()
+		return nil
+	})
+	s.registerer.MustRegister(database.NewPoolCollector(db))
+
+	// Detect whether this region's database is primary; replicas fence writes
+	s.region = region.NewMonitor(db, cfg.Region.Name, cfg.Region.MaxReplicationLag)
+	if err := s.region.Run(ctx); err != nil {
+		return nil, fmt.Errorf("%w: failed to check replication status: %w", ErrDependency, err)
+	}
+	s.registerer.MustRegister(s.region)
+	slog.Info("region detected",
+		slog.String("region", cfg.Region.Name),
+		slog.String("role", string(s.region.Status().Role)))
+
+	// Initialize cache
+	redisClient, err := cache.NewRedis(cfg.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to redis: %w", ErrDependency, err)
+	}
+	s.addCloser("redis", redisClient.Close)
+	s.registerer.MustRegister(cache.NewPoolCollector(redisClient))
+
+	// Initialize in-process event bus
+	s.eventBus = events.NewBus(cfg.Events.BufferSize)
+	s.addCloser("event_bus", s.eventBus.Close)
+
+	// Check the event schema against the registry so incompatible changes
+	// fail the rollout instead of breaking downstream consumers
+	if cfg.SchemaRegistry.URL != "" {
+		registry := schemaregistry.New(cfg.SchemaRegistry.URL, cfg.SchemaRegistry.Username, cfg.SchemaRegistry.Password, cfg.SchemaRegistry.Timeout)
+		serializer, err := events.NewSerializer(ctx, registry, cfg.SchemaRegistry.Subject, cfg.SchemaRegistry.AutoRegister)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to resolve event schema: %w", ErrDependency, err)
+		}
+		slog.Info("event schema registered",
+			slog.String("subject", cfg.SchemaRegistry.Subject),
+			slog.Int("schema_id", serializer.SchemaID()))
+	}
+
+	// Initialize encryption at rest
+	var encryption repository.MetadataEncryption
+	if cfg.Encryption.Keys.IsSet() {
+		keys, err := cfg.Encryption.Keys.Value(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ENCRYPTION_KEYS: %w", ErrConfig, err)
+		}
+		kms, err := crypto.ParseStaticKMS(keys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ENCRYPTION_KEYS: %w", ErrConfig, err)
+		}
+		if !kms.Has(cfg.Encryption.KeyID) {
+			return nil, fmt.Errorf("%w: ENCRYPTION_KEY_ID %q is not in ENCRYPTION_KEYS", ErrConfig, cfg.Encryption.KeyID)
+		}
+		encryption = repository.MetadataEncryption{
+			Cipher: crypto.NewEnvelope(kms, cfg.Encryption.KeyID),
+			Keys:   cfg.Encryption.MetadataKeys,
+		}
+	}
+
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db, encryption)
+	usageRepo := repository.NewUsageRepository(db)
+
+	// Initialize PII tokenization
+	var tokenizer pii.Tokenizer = pii.Noop{}
+	if cfg.PII.TokenizerURL != "" {
+		tokenizer = pii.NewHTTPTokenizer(cfg.PII.TokenizerURL, cfg.PII.TokenizerAPIKey, cfg.PII.TokenizerTimeout)
+	}
+	protector := pii.NewProtector(tokenizer, cfg.PII.PrivilegedSubjects)
+
+	// Initialize outgoing mail and human verification for self-registration
+	var mailer mail.Sender = mail.LogSender{}
+	if cfg.Mail.SMTPAddress != "" {
+		mailer = mail.NewSMTPSender(cfg.Mail.SMTPAddress, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	}
+	var verifier captcha.Verifier = captcha.Disabled{}
+	if cfg.Captcha.Secret != "" {
+		verifier = captcha.NewSiteVerifier(cfg.Captcha.VerifyURL, cfg.Captcha.Secret, cfg.Captcha.Timeout)
+	} else {
+		slog.Warn("CAPTCHA_SECRET not set, self-registration is not protected by human verification")
+	}
+
+	inviteKey, err := signingKey(ctx, cfg.Invitations.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: INVITE_SIGNING_KEY: %w", ErrConfig, err)
+	}
+	if len(inviteKey) == 0 {
+		slog.Warn("INVITE_SIGNING_KEY not set, invite links will not survive a restart")
+		inviteKey = make([]byte, 32)
+		if _, err := rand.Read(inviteKey); err != nil {
+			return nil, fmt.Errorf("%w: failed to generate invite signing key: %w", ErrConfig, err)
+		}
+	}
+
+	sessionKey, err := signingKey(ctx, cfg.Sessions.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: SESSION_SIGNING_KEY: %w", ErrConfig, err)
+	}
+	if len(sessionKey) > 0 && len(sessionKey) < 32 {
+		return nil, fmt.Errorf("%w: SESSION_SIGNING_KEY must be at least 32 bytes", ErrConfig)
+	}
+	if len(sessionKey) == 0 {
+		slog.Warn("SESSION_SIGNING_KEY not set, access tokens will not survive a restart nor be accepted by other instances")
+		sessionKey = make([]byte, 32)
+		if _, err := rand.Read(sessionKey); err != nil {
+			return nil, fmt.Errorf("%w: failed to generate session signing key: %w", ErrConfig, err)
+		}
+	}
+
+	// Batch lookups share a bounded pool so concurrent batches cannot pile
+	// up goroutines and take every database connection
+	lookups := pool.New("batch_get", cfg.BatchGet.Workers, cfg.BatchGet.QueueSize, pool.CallerRuns)
+	s.registerer.MustRegister(lookups)
+	s.addCloser("batch_get", lookups.Close)
+
+	// Initialize services
+	userService := service.NewUserService(userRepo, redisClient, s.eventBus, protector, clock.Real{}, lookups)
+	if cfg.CacheWarm.OnChange {
+		s.prewarm = userService.PrewarmCache
+	}
+	usageService := service.NewUsageService(usageRepo)
+	registrationService := service.NewRegistrationService(
+		repository.NewRegistrationRepository(db),
+		userService,
+		verifier,
+		mailer,
+		cfg.Registration.TokenTTL,
+		cfg.Registration.VerifyURL,
+	)
+	invitationService := service.NewInvitationService(
+		repository.NewInvitationRepository(db),
+		userService,
+		mailer,
+		inviteKey,
+		cfg.Invitations.TTL,
+		cfg.Invitations.AcceptURL,
+	)
+	organizationService := service.NewOrganizationService(repository.NewOrganizationRepository(db), userService)
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(db), redisClient, clock.Real{}, cfg.APIKeys.CacheTTL, cfg.APIKeys.RotationGrace)
+	auditRecorder := audit.NewRecorder(repository.NewAuditRepository(db), userRepo.GetByID, clock.Real{})
+	var lockout *service.Lockout
+	if cfg.Lockout.MaxFailures > 0 || cfg.Lockout.BaseDelay > 0 {
+		lockout = service.NewLockout(redisClient, service.LockoutPolicy{
+			MaxFailures: cfg.Lockout.MaxFailures,
+			Window:      cfg.Lockout.Window,
+			Duration:    cfg.Lockout.Duration,
+			BaseDelay:   cfg.Lockout.BaseDelay,
+			MaxDelay:    cfg.Lockout.MaxDelay,
+		}, server.AuditLockout(auditRecorder))
+	}
+	passwordService, err := service.NewPasswordService(userService, passwd.New(passwd.Params{
+		Memory:      uint32(cfg.Passwords.Memory),
+		Iterations:  uint32(cfg.Passwords.Iterations),
+		Parallelism: uint8(cfg.Passwords.Parallelism),
+		SaltLength:  passwd.DefaultParams.SaltLength,
+		KeyLength:   passwd.DefaultParams.KeyLength,
+	}), cfg.Passwords.MinLength, lockout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	sessionService := service.NewSessionService(repository.NewSessionRepository(db), passwordService, redisClient, token.NewSigner(sessionKey), clock.Real{}, cfg.Sessions.AccessTTL, cfg.Sessions.RefreshTTL, cfg.Sessions.ImpersonationTTL)
+
+	// Guests are optional; they register without an email
+	var guestService *service.GuestService
+	if cfg.Guests.Enabled {
+		guestService = service.NewGuestService(userService, passwordService, sessionService, verifier)
+	}
+
+	// Avatars are optional and need object storage
+	var avatarService *service.AvatarService
+	if cfg.Avatars.StoreURL != "" {
+		avatarStore, err := storage.Open(cfg.Avatars.StoreURL, storage.Options{
+			Token:   cfg.Avatars.StoreToken,
+			Timeout: cfg.Avatars.StoreTimeout,
+			S3:      s3Credentials(cfg.S3),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to configure avatar store: %w", ErrConfig, err)
+		}
+		avatarService = service.NewAvatarService(userService, avatarStore, cfg.Avatars.MaxSize, cfg.Avatars.PublicURL)
+	}
+
+	// Reports are optional and need object storage
+	var reportService *service.ReportService
+	if cfg.Reports.StoreURL != "" {
+		reportStore, err := storage.Open(cfg.Reports.StoreURL, storage.Options{
+			Token:   cfg.Reports.StoreToken,
+			Timeout: cfg.Reports.StoreTimeout,
+			S3:      s3Credentials(cfg.S3),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to configure report store: %w", ErrConfig, err)
+		}
+		if _, ok := reportStore.(storage.Signer); !ok {
+			slog.Warn("report store cannot sign download urls, reports are only stored", slog.String("store", cfg.Reports.StoreURL))
+		}
+		reportService = service.NewReportService(userService, repository.NewReportRepository(db), reportStore, clock.Real{}, service.ReportSettings{
+			ChunkSize:   cfg.StreamChunkSize,
+			RetryDelay:  cfg.Reports.RetryDelay,
+			MaxAttempts: cfg.Reports.MaxAttempts,
+			URLTTL:      cfg.Reports.URLTTL,
+		})
+	}
+
+	privacyService := service.NewPrivacyService(userService, repository.NewPrivacyRepository(db), sessionService, avatarService, clock.Real{}, cfg.Erasure.RetryDelay)
+
+	// Initialize per-caller cost accounting
+	var usageAggregator *usage.Aggregator
+	if cfg.Usage.Enabled {
+		usageAggregator = usage.NewAggregator(usageRepo)
+		s.addCloser("usage", func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return usageAggregator.Flush(ctx)
+		})
+	}
+
+	// Mirror request summaries to the analytics pipeline
+	var requestMirror *analytics.Mirror
+	if cfg.Analytics.KafkaRESTURL != "" {
+		sink := analytics.NewKafkaRESTSink(cfg.Analytics.KafkaRESTURL, cfg.Analytics.Topic, cfg.Analytics.Username, cfg.Analytics.Password, cfg.Analytics.Timeout)
+		requestMirror = analytics.NewMirror(sink, cfg.Analytics.BatchSize, cfg.Analytics.MaxPending)
+		s.addCloser("analytics", func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return requestMirror.Flush(ctx)
+		})
+	}
+
+	// Scan for anomalies in user data, repairing the known kinds asked for
+	var dataQuality *diagnostics.DataQualityChecker
+	if cfg.DataQuality.Interval > 0 {
+		repair := make([]diagnostics.IssueKind, len(cfg.DataQuality.Repair))
+		for i, kind := range cfg.DataQuality.Repair {
+			repair[i] = diagnostics.IssueKind(kind)
+		}
+		dataQuality = diagnostics.NewDataQualityChecker(db, diagnostics.DataQualityConfig{
+			Repair:     repair,
+			Samples:    cfg.DataQuality.Samples,
+			SkipEmails: cfg.PII.TokenizerURL != "",
+		})
+		s.registerer.MustRegister(dataQuality)
+	}
+
+	// Create the upcoming history partitions before serving writes so that no
+	// change lands in the default partition
+	historyPartitions := partition.NewMaintainer(db, "users_history", cfg.Partitions.MonthsAhead)
+	if s.region.Writable() {
+		if err := historyPartitions.Run(ctx); err != nil {
+			return nil, fmt.Errorf("%w: failed to create history partitions: %w", ErrDependency, err)
+		}
+	}
+
+	adaptiveLimiter, err := s.schedule(db, redisClient, userService, registrationService, sessionService, privacyService, reportService, dataQuality, historyPartitions, usageAggregator, requestMirror, opts.OnWatchdog)
+	if err != nil {
+		return nil, err
+	}
+
+	var trafficDump *server.TrafficDump
+	if cfg.TrafficDump.Size > 0 {
+		if err := authz.CheckPatterns(cfg.TrafficDump.Methods); err != nil {
+			return nil, fmt.Errorf("%w: TRAFFIC_DUMP_METHODS: %w", ErrConfig, err)
+		}
+		trafficDump = server.NewTrafficDump(cfg.TrafficDump.Size, cfg.TrafficDump.Methods)
+	}
+
+	if err := s.buildInterceptors(apiKeyService, sessionService, auditRecorder, usageAggregator, adaptiveLimiter, requestMirror, trafficDump, redisClient); err != nil {
+		return nil, err
+	}
+
+	expectedSchema, err := schema.ParseMigrationsFS(migrations.FS)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse migrations: %w", ErrConfig, err)
+	}
+	info := buildinfo.Read(expectedSchema.Version(), enabledFeatures(cfg), time.Now())
+
+	s.watches = server.NewWatchSessions(server.WatchLimits{
+		MaxStreams:          cfg.Watch.MaxStreams,
+		MaxStreamsPerClient: cfg.Watch.MaxStreamsPerClient,
+		IdleTimeout:         cfg.Watch.IdleTimeout,
+	})
+	s.registerer.MustRegister(s.watches)
+
+	s.userServer = server.NewUserServer(userService, usageService, registrationService, invitationService, organizationService, avatarService, apiKeyService, passwordService, sessionService, privacyService, reportService, guestService, auditRecorder, cfg.StreamChunkSize, info, trafficDump, dataQuality, s.watches)
+	s.registerer.MustRegister(s.userServer)
+	s.userServerV2 = server.NewUserServerV2(userService, organizationService)
+
+	// Report readiness per dependency
+	s.readiness = readiness.NewChecker(cfg.Readiness.Timeout, clock.Real{})
+	s.readiness.Add("db", db.Ping)
+	s.readiness.Add("redis", redisClient.Ping)
+	s.readiness.Add("migrations", readiness.Cached(readiness.Migrations(db, expectedSchema), cfg.Readiness.SchemaInterval, clock.Real{}))
+	s.readiness.Add("event_bus", func(context.Context) error { return s.eventBus.Err() })
+
+	info.Log()
+	return s, nil
+}
+
+// enabledFeatures names the optional features cfg turns on
+func enabledFeatures(cfg *Config) []string {
+	flags := []struct {
+		name    string
+		enabled bool
+	}{
+		{"tls", cfg.TLS.CertFile != ""},
+		{"opa_policy", cfg.Policy.Path != ""},
+		{"rbac", cfg.RBAC.PolicyPath != ""},
+		{"api_keys", cfg.APIKeys.Enabled},
+		{"trusted_caller_header", cfg.Auth.TrustCallerHeader},
+		{"ip_filter", len(cfg.IPFilter.Allow) > 0 || len(cfg.IPFilter.Deny) > 0},
+		{"usage", cfg.Usage.Enabled},
+		{"adaptive_limit", cfg.AdaptiveLimit.Enabled},
+		{"caller_rate_limit", cfg.CallerLimits.PerMinute > 0},
+		{"account_lockout", cfg.Lockout.MaxFailures > 0 || cfg.Lockout.BaseDelay > 0},
+		{"request_signing", cfg.RequestSigning.Key.IsSet()},
+		{"traffic_dump", cfg.TrafficDump.Size > 0},
+		{"encryption_at_rest", cfg.Encryption.Keys.IsSet()},
+		{"user_reports", cfg.Reports.StoreURL != ""},
+		{"tracing", cfg.Tracing.Enabled},
+		{"data_quality", cfg.DataQuality.Interval > 0},
+		{"deadline_budgets", cfg.Deadlines.Reserve > 0},
+		{"request_payload_logging", cfg.Log.RequestPayloads},
+		{"analytics_mirror", cfg.Analytics.KafkaRESTURL != ""},
+		{"schema_registry", cfg.SchemaRegistry.URL != ""},
+		{"captcha", cfg.Captcha.Secret != ""},
+		{"smtp", cfg.Mail.SMTPAddress != ""},
+		{"avatars", cfg.Avatars.StoreURL != ""},
+		{"backups", cfg.Backup.StoreURL != ""},
+		{"index_advisor", cfg.Diagnostics.Interval > 0},
+		{"watchdog", cfg.Heartbeat.WatchdogThreshold > 0},
+		{"guests", cfg.Guests.Enabled},
+		{"cache_prewarm", cfg.CacheWarm.OnChange},
+	}
+
+	var features []string
+	for _, f := range flags {
+		if f.enabled {
+			features = append(features, f.name)
+		}
+	}
+	return features
+}
+
+// Config returns the configuration the service was built with
+func (s *Service) Config() *Config {
+	return s.cfg
+}
+
+// ServerOptions returns the options chaining the service's interceptors,
+// for servers dedicated to the service
+func (s *Service) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(s.unary...),
+		grpc.ChainStreamInterceptor(s.stream...),
+		grpc.MaxRecvMsgSize(s.cfg.Messages.MaxRecvSize),
+		grpc.MaxSendMsgSize(s.cfg.Messages.MaxSendSize),
+	}
+}
+
+// UnaryInterceptors returns the service's unary interceptors, in order, for
+// hosts that chain them with their own. They apply to every method of the
+// server, not only the user service's.
+func (s *Service) UnaryInterceptors() []grpc.UnaryServerInterceptor {
+	return s.unary
+}
+
+// StreamInterceptors returns the service's stream interceptors, in order
+func (s *Service) StreamInterceptors() []grpc.StreamServerInterceptor {
+	return s.stream
+}
+
+// RegisterWith registers both API versions of the user service with srv
+func (s *Service) RegisterWith(srv grpc.ServiceRegistrar) {
+	pb.RegisterUserServiceServer(srv, s.userServer)
+	userv2.RegisterUserServiceServer(srv, s.userServerV2)
+}
+
+// CheckExemptions verifies that every method exempted from authentication
+// matches a method registered on srv. Call it once all services, including
+// health and reflection, are registered.
+func (s *Service) CheckExemptions(srv interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}) error {
+	if err := s.exemptions.Check(srv.GetServiceInfo()); err != nil {
+		return fmt.Errorf("%w: AUTH_EXEMPT_METHODS: %w", ErrConfig, err)
+	}
+	return nil
+}
+
+// ReportHealth marks the service as serving on h under "user-service" and
+// keeps "user-service.replication" in line with the replication health of
+// the region, so that a lagging secondary is not taken out of rotation for
+// reads by orchestrators
+func (s *Service) ReportHealth(h *health.Server) {
+	h.SetServingStatus("user-service", grpc_health_v1.HealthCheckResponse_SERVING)
+
+	setReplicationHealth := func(_, _ region.Status) {
+		servingStatus := grpc_health_v1.HealthCheckResponse_SERVING
+		if !s.region.Healthy() {
+			servingStatus = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+		h.SetServingStatus("user-service.replication", servingStatus)
+	}
+	setReplicationHealth(region.Status{}, s.region.Status())
+	s.region.OnChange(setReplicationHealth)
+}
+
+// ReadinessHandler serves the readiness of each dependency as JSON
+func (s *Service) ReadinessHandler() http.Handler {
+	return s.readiness
+}
+
+// Run runs the background jobs and cache prewarming until ctx is done. It
+// then ends watch streams, which never finish on their own, so that a
+// graceful stop of the server does not wait for them, and stops the jobs.
+func (s *Service) Run(ctx context.Context) error {
+	s.scheduler.Start(ctx)
+	var prewarming sync.WaitGroup
+	if s.prewarm != nil {
+		prewarming.Add(1)
+		go func() {
+			defer prewarming.Done()
+			if err := s.prewarm(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("cache prewarming stopped", slog.String("error", err.Error()))
+			}
+		}()
+	}
+	<-ctx.Done()
+
+	s.watches.Drain()
+	s.eventBus.Close()
+	prewarming.Wait()
+	s.scheduler.Stop()
+	return nil
+}
+
+// Close releases the service's resources in reverse order of acquisition.
+// It must be called after the server stopped serving.
+func (s *Service) Close() error {
+	var errs []error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		c := s.closers[i]
+		if err := c.close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	s.closers = nil
+	return errors.Join(errs...)
+}
+
+func (s *Service) addCloser(name string, close func() error) {
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+// s3Credentials returns the credentials of s3:// stores
+func s3Credentials(cfg config.S3Config) storage.S3Credentials {
+	return storage.S3Credentials{
+		Endpoint:        cfg.Endpoint,
+		Region:          cfg.Region,
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		SessionToken:    cfg.SessionToken,
+	}
+}
+
+// signingKey reads a token signing key. Keys are read once, as rotating
+// them while running would invalidate tokens signed by the old key.
+func signingKey(ctx context.Context, secret config.Secret) ([]byte, error) {
+	key, err := secret.Value(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(key), nil
+}
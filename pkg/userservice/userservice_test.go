@@ -0,0 +1,39 @@
+package userservice
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestClose(t *testing.T) {
+	t.Run("releases resources in reverse order and joins errors", func(t *testing.T) {
+		var order []string
+		errRedis := errors.New("redis close failed")
+
+		s := &Service{}
+		s.addCloser("postgres", func() error {
+			order = append(order, "postgres")
+			return nil
+		})
+		s.addCloser("redis", func() error {
+			order = append(order, "redis")
+			return errRedis
+		})
+		s.addCloser("event_bus", func() error {
+			order = append(order, "event_bus")
+			return nil
+		})
+
+		err := s.Close()
+		if !errors.Is(err, errRedis) {
+			t.Errorf("Close() error = %v, want %v", err, errRedis)
+		}
+		if want := []string{"event_bus", "redis", "postgres"}; !reflect.DeepEqual(order, want) {
+			t.Errorf("close order = %v, want %v", order, want)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("second Close() error = %v, want nil", err)
+		}
+	})
+}
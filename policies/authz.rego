@@ -0,0 +1,74 @@
+package userservice.authz
+
+import future.keywords.if
+import future.keywords.in
+
+# Example authorization policy, loaded with POLICY_PATH=policies/authz.rego.
+# Input: {"subject": ..., "auth_method": ..., "method": "/user.UserService/GetUser"},
+# plus "impersonator" for calls made with an impersonation token
+
+default allow := false
+
+admin_subjects := {"support-tool", "billing-reconciler"}
+
+admin_methods := {
+	"/user.UserService/GetUserHistory",
+	"/user.UserService/GetUsageReport",
+	"/user.UserService/ReplayEvents",
+	"/user.UserService/PurgeUser",
+	"/user.UserService/BulkDeleteUsers",
+	"/user.UserService/FlushCache",
+	"/user.UserService/ImportUsers",
+	"/user.UserService/ExportUsers",
+	"/user.UserService/CreateAPIKey",
+	"/user.UserService/RotateAPIKey",
+	"/user.UserService/RevokeAPIKey",
+	"/user.UserService/RevokeAllSessions",
+	"/user.UserService/UnlockUser",
+	"/user.UserService/ExportUserData",
+	"/user.UserService/EraseUser",
+	"/user.UserService/ListAuditEvents",
+	"/user.UserService/GetServerInfo",
+	"/user.UserService/GetTrafficDump",
+	"/user.UserService/GenerateUserReport",
+	"/user.UserService/GetUserReport",
+	"/user.UserService/ListDataIssues",
+	"/user.UserService/MergeUsers",
+	"/user.UserService/ImpersonationToken",
+}
+
+# Health checks and reflection are always reachable
+allow if startswith(input.method, "/grpc.health.v1.Health/")
+
+allow if startswith(input.method, "/grpc.reflection.")
+
+# Self-registration, guests, invite acceptance and logins are public; abuse is
+# contained by captcha, signed tokens and rate limits
+allow if input.method in {
+	"/user.UserService/RegisterUser",
+	"/user.UserService/VerifyEmail",
+	"/user.UserService/CreateGuestUser",
+	"/user.UserService/AcceptInvite",
+	"/user.UserService/Login",
+	"/user.UserService/RefreshToken",
+	"/user.UserService/Logout",
+}
+
+# Identified callers may use every user RPC of either API version except
+# admin ones
+allow if {
+	input.subject != "anonymous"
+	startswith(input.method, "/user.UserService/")
+	not input.method in admin_methods
+}
+
+allow if {
+	input.subject != "anonymous"
+	startswith(input.method, "/userservice.v2.UserService/")
+}
+
+# Admin RPCs are limited to known support and billing tools
+allow if {
+	input.subject in admin_subjects
+	input.method in admin_methods
+}